@@ -1,24 +1,37 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"tofash/internal/config"
 
 	// User Module
 	userHandler "tofash/internal/modules/user/handler"
+	userJobs "tofash/internal/modules/user/jobs"
 	userRepo "tofash/internal/modules/user/repository"
 	userService "tofash/internal/modules/user/service"
 	userValidator "tofash/internal/modules/user/utils/validator"
 
 	// Product Module
 	productHandler "tofash/internal/modules/product/handlers"
+	productJobs "tofash/internal/modules/product/jobs"
 	productRepo "tofash/internal/modules/product/repository"
 	productService "tofash/internal/modules/product/service"
 
 	// Order Module
+	checkoutHandler "tofash/internal/modules/checkout/handlers"
+	checkoutService "tofash/internal/modules/checkout/service"
 	orderHandler "tofash/internal/modules/order/handlers"
+	orderJobs "tofash/internal/modules/order/jobs"
 	orderRepo "tofash/internal/modules/order/repository"
 	orderService "tofash/internal/modules/order/service"
+	"tofash/internal/modules/order/shipping"
 
 	// Payment Module
 	paymentHandler "tofash/internal/modules/payment/handlers"
@@ -28,13 +41,25 @@ import (
 
 	// Notification Module
 	notifHandler "tofash/internal/modules/notification/handlers"
+	notifJobs "tofash/internal/modules/notification/jobs"
 	notifMessage "tofash/internal/modules/notification/message"
 	notifRepo "tofash/internal/modules/notification/repository"
 	notifService "tofash/internal/modules/notification/service"
 
+	paymentJobs "tofash/internal/modules/payment/jobs"
+	productStorage "tofash/internal/modules/product/storage"
+	returnsHandler "tofash/internal/modules/returns/handlers"
+	returnsJobs "tofash/internal/modules/returns/jobs"
+	returnsRepo "tofash/internal/modules/returns/repository"
+	returnsService "tofash/internal/modules/returns/service"
+	systemHandler "tofash/internal/modules/system/handlers"
+	systemJobs "tofash/internal/modules/system/jobs"
 	"tofash/internal/modules/system/repository"
+	systemService "tofash/internal/modules/system/service"
 	"tofash/internal/shared/async"
+	"tofash/internal/shared/metrics"
 	mid "tofash/internal/shared/middleware"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -66,6 +91,14 @@ func main() {
 	e.Validator = userValidator.NewValidator()
 
 	// 3. Setup Dependencies
+	// Unit of work and job queue are shared so modules can enqueue jobs in
+	// the same transaction as their own writes (Postgres backend).
+	unitOfWork := uow.NewUnitOfWork(db)
+	jobRepo := repository.NewJobRepository(db)
+	jobQueue, err := async.NewQueue(cfg, jobRepo, repository.NewJobListener(db))
+	if err != nil {
+		log.Fatalf("[MAIN] Failed to set up job queue: %v", err)
+	}
 
 	// 4. WIRING: User Module
 	userRepository := userRepo.NewUserRepository(db)
@@ -79,6 +112,8 @@ func main() {
 		cfg,
 		jwtSvc,
 		verificationTokenRepository,
+		unitOfWork,
+		jobQueue,
 	)
 	roleSvc := userService.NewRoleService(roleRepository)
 
@@ -117,16 +152,37 @@ func main() {
 	// orderPublisher := orderMessage.NewPublisherRabbitMQ(cfg)
 
 	// Job Queue (System Module)
-	jobRepo := repository.NewJobRepository(db)
+	jobSvc := systemService.NewJobService(jobRepo)
+	jobH := systemHandler.NewJobHandler(jobSvc)
 
 	orderSvc := orderService.NewOrderService(
 		orderRepository,
 		cfg,
-		jobRepo,
+		unitOfWork,
+		jobQueue,
 		productSvc,
 		userSvc,
 	)
 	orderH := orderHandler.NewOrderHandler(orderSvc)
+	var shippingProviders []shipping.ShippingProvider
+	for _, name := range cfg.Order.ShippingProviders {
+		switch name {
+		case shipping.FakeProviderName:
+			shippingProviders = append(shippingProviders, shipping.NewFakeProvider(cfg.Order.ShippingWebhookSecret))
+		default:
+			log.Fatalf("[MAIN] Unknown shipping provider %q", name)
+		}
+	}
+	shipmentSvc := orderService.NewShipmentService(
+		orderRepo.NewShipmentRepository(db),
+		orderRepository,
+		cfg,
+		unitOfWork,
+		jobQueue,
+		userSvc,
+		shippingProviders...,
+	)
+	shipmentH := orderHandler.NewShipmentHandler(shipmentSvc)
 
 	// 7. WIRING: Notification Module
 	notifRepository := notifRepo.NewNotificationRepository(db)
@@ -137,10 +193,6 @@ func main() {
 
 	// consumerRabbit := notifRabbitMQ.NewConsumeRabbitMQ... // Removed
 
-	// 7b. WIRING: Async Worker (Job Queue Consumer)
-	jobWorker := async.NewWorker(jobRepo, productSvc, notifSvc)
-	go jobWorker.Run()
-
 	// 8. WIRING: Payment Module
 	paymentRepository := paymentRepo.NewPaymentRepository(db)
 	midtransClient := paymentHttpClient.NewMidtransClient(cfg)
@@ -149,9 +201,59 @@ func main() {
 	// Assuming PaymentService still needs refactoring or we ignore for now as per instructions "Refactor Services (Publisher) -> OrderService".
 	// But let's check PaymentService signature.
 
-	paymentSvc := paymentService.NewPaymentService(paymentRepository, cfg, midtransClient, orderSvc, userSvc)
+	paymentSvc := paymentService.NewPaymentService(paymentRepository, cfg, unitOfWork, midtransClient, orderSvc, userSvc)
 	paymentH := paymentHandler.NewPaymentHandler(paymentSvc)
 
+	// 8b. WIRING: Checkout (cart -> order -> payment)
+	checkoutSvc := checkoutService.NewCheckoutService(cartSvc, orderSvc, paymentSvc)
+	checkoutH := checkoutHandler.NewCheckoutHandler(checkoutSvc)
+
+	// 8c. WIRING: Returns (order item -> refund or exchange order)
+	returnRepository := returnsRepo.NewReturnRepository(db)
+	returnSvc := returnsService.NewReturnService(
+		returnRepository,
+		unitOfWork,
+		jobQueue,
+		productStorage.NewSupabase(cfg),
+		orderSvc,
+		paymentSvc,
+		userSvc,
+	)
+	returnH := returnsHandler.NewReturnHandler(returnSvc)
+
+	// 7b. WIRING: Async Worker (Job Queue Consumer)
+	jobWorker := async.NewWorker(jobQueue)
+	productJobs.RegisterHandlers(jobWorker, productSvc)
+	notifJobs.RegisterHandlers(jobWorker, notifSvc)
+	userJobs.RegisterHandlers(jobWorker, userSvc)
+	systemJobs.RegisterHandlers(jobWorker, jobSvc)
+	paymentJobs.RegisterHandlers(jobWorker, paymentSvc)
+	orderJobs.RegisterHandlers(jobWorker, orderSvc, notifSvc)
+	returnsJobs.RegisterHandlers(jobWorker, returnSvc)
+	go jobWorker.Run()
+
+	if stats, ok := jobQueue.(async.StatsReporter); ok {
+		if err := metrics.RegisterJobStats(stats.Stats); err != nil {
+			log.Fatalf("[MAIN] Failed to register job queue metrics: %v", err)
+		}
+	}
+
+	// 7c. WIRING: Cron Scheduler (one replica at a time enqueues recurring jobs)
+	scheduler := async.NewScheduler(jobQueue, repository.NewLeaderLock(db, repository.SchedulerLockKey))
+	for _, registerSchedules := range []func(async.Cron) error{
+		productJobs.RegisterSchedules,
+		notifJobs.RegisterSchedules,
+		userJobs.RegisterSchedules,
+		systemJobs.RegisterSchedules,
+		orderJobs.RegisterSchedules,
+		paymentJobs.RegisterSchedules,
+	} {
+		if err := registerSchedules(scheduler); err != nil {
+			log.Fatalf("[MAIN] Invalid job schedule: %v", err)
+		}
+	}
+	go scheduler.Run()
+
 	// 7. Setup Routes
 	api := e.Group("/api/v1")
 
@@ -184,6 +286,18 @@ func main() {
 	auth.POST("/orders", orderH.CreateOrder) // Consider DistanceCheck middleware if needed
 	auth.GET("/orders", orderH.GetAllCustomer)
 	auth.GET("/orders/:orderID", orderH.GetDetailCustomer)
+	auth.GET("/orders/:orderID/invoice.pdf", orderH.Invoice)
+	auth.POST("/orders/:orderID/cancel", orderH.CancelOrder)
+	auth.GET("/orders/:orderID/shipments", shipmentH.GetByOrderIDCustomer)
+
+	// Checkout
+	auth.POST("/checkout", checkoutH.Checkout)
+	auth.GET("/checkout/shipping-quote", checkoutH.QuoteShipping)
+
+	// Returns
+	auth.POST("/returns", returnH.CreateReturn)
+	auth.GET("/returns", returnH.GetAllCustomer)
+	auth.GET("/returns/:returnID", returnH.GetDetailCustomer)
 
 	// Payment
 	auth.POST("/payments", paymentH.Create)
@@ -199,10 +313,72 @@ func main() {
 	admin := api.Group("/admin", authMiddleware.CheckToken)
 	admin.GET("/payments", paymentH.GetAllAdmin)
 
+	// Order
+	admin.GET("/orders", orderH.GetAllAdmin)
+	admin.GET("/orders/export", orderH.ExportAdmin)
+	admin.GET("/orders/:orderID", orderH.GetByIDAdmin)
+	admin.GET("/orders/:orderID/packing-slip.pdf", orderH.PackingSlip)
+	admin.PUT("/orders/:orderID/status", orderH.UpdateStatus)
+	admin.POST("/orders/:orderID/cancel", orderH.CancelOrderAdmin)
+	admin.POST("/orders/:orderID/shipments", shipmentH.CreateShipment)
+	admin.GET("/orders/:orderID/shipments", shipmentH.GetByOrderIDAdmin)
+	admin.POST("/orders/:orderID/shipments/book", shipmentH.BookShipment)
+	admin.GET("/orders/:orderID/courier-rates", shipmentH.CourierRates)
+	admin.POST("/shipments/:shipmentID/track", shipmentH.TrackShipment)
+
+	// Returns
+	admin.GET("/returns", returnH.GetAllAdmin)
+	admin.GET("/returns/:returnID", returnH.GetByIDAdmin)
+	admin.POST("/returns/:returnID/approve", returnH.Approve)
+	admin.POST("/returns/:returnID/reject", returnH.Reject)
+	admin.POST("/returns/:returnID/receive", returnH.Receive)
+
+	// Job Queue
+	admin.GET("/jobs", jobH.GetAll)
+	admin.DELETE("/jobs/completed", jobH.PurgeCompleted)
+	admin.GET("/jobs/:id", jobH.GetByID)
+	admin.POST("/jobs/:id/retry", jobH.Retry)
+	admin.POST("/jobs/:id/cancel", jobH.Cancel)
+
 	// Webhooks & Public
 	api.POST("/midtrans/webhook", paymentH.MidtranswebHookHandler)
+	api.POST("/shipping/:provider/webhook", shipmentH.TrackingWebhook)
 	e.GET("/ws", wsH.WebSocketHandler)
 
+	// Prometheus scrape endpoint
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
 	// Start Server
-	e.Logger.Fatal(e.Start(":" + cfg.App.AppPort))
+	go func() {
+		if err := e.Start(":" + cfg.App.AppPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, then drain in-flight jobs
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	shutdownTimeout := 30 * time.Second
+	if cfg.App.ServerTimeOut > 0 {
+		shutdownTimeout = time.Duration(cfg.App.ServerTimeOut) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	log.Println("[MAIN] Shutting down HTTP server...")
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("[MAIN] HTTP server shutdown: %v", err)
+	}
+
+	log.Println("[MAIN] Stopping scheduler...")
+	if err := scheduler.Shutdown(ctx); err != nil {
+		log.Printf("[MAIN] Scheduler shutdown: %v", err)
+	}
+
+	log.Println("[MAIN] Draining async worker...")
+	if err := jobWorker.Shutdown(ctx); err != nil {
+		log.Printf("[MAIN] Worker shutdown: %v", err)
+	}
 }
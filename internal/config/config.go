@@ -1,6 +1,10 @@
 package config
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -64,6 +68,113 @@ type PublisherName struct {
 	PublisherUpdateStatus   string `json:"publisher_update_status"`
 }
 
+// JobQueue selects the job queue backend: "postgres" (default), "rabbitmq"
+// or "memory".
+type JobQueue struct {
+	Backend string `json:"backend"`
+}
+
+// Order holds order lifecycle settings. PaymentWindowMinutes is how long
+// an order may stay unpaid before it expires, and its stock stays held,
+// overridden per payment method by PaymentWindowsByMethod.
+// TrackingURLTemplate builds a shipment's tracking link from its
+// {courier} and {tracking_number}. ShippingRates prices delivery; when
+// empty the shipping package's defaults apply. ShippingProviders names the
+// courier integrations to register; none are by default.
+// ShippingWebhookSecret signs the stub courier's tracking webhooks. StoreName, StoreAddress and
+// StorePhone head invoices and packing slips and are the courier pickup
+// contact.
+type Order struct {
+	PaymentWindowMinutes   int            `json:"payment_window_minutes"`
+	PaymentWindowsByMethod map[string]int `json:"payment_windows_by_method"`
+	TrackingURLTemplate    string         `json:"tracking_url_template"`
+	ShippingRates          []ShippingRate `json:"shipping_rates"`
+	ShippingProviders      []string       `json:"shipping_providers"`
+	ShippingWebhookSecret  string         `json:"shipping_webhook_secret"`
+	StoreName              string         `json:"store_name"`
+	StoreAddress           string         `json:"store_address"`
+	StorePhone             string         `json:"store_phone"`
+}
+
+// ShippingRate prices parcels of ShippingType sent up to MaxDistanceKm
+// from the store (no limit when zero): BaseFee covers the first kilogram
+// and PerKgFee each kilogram after it, part kilograms rounded up.
+type ShippingRate struct {
+	ShippingType  string  `json:"shipping_type"`
+	MaxDistanceKm float64 `json:"max_distance_km"`
+	BaseFee       int64   `json:"base_fee"`
+	PerKgFee      int64   `json:"per_kg_fee"`
+}
+
+// DefaultPaymentWindow applies when PAYMENT_WINDOW_MINUTES is not set.
+const DefaultPaymentWindow = 24 * time.Hour
+
+// PaymentWindow returns how long an order paid with method may stay unpaid.
+func (o Order) PaymentWindow(method string) time.Duration {
+	if minutes, ok := o.PaymentWindowsByMethod[strings.ToLower(method)]; ok && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	if o.PaymentWindowMinutes > 0 {
+		return time.Duration(o.PaymentWindowMinutes) * time.Minute
+	}
+	return DefaultPaymentWindow
+}
+
+// parseMinutesByKey reads "midtrans=60,bank_transfer=1440" into a map.
+// Malformed pairs are skipped.
+func parseMinutesByKey(value string) map[string]int {
+	minutes := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		minutes[strings.ToLower(strings.TrimSpace(key))] = n
+	}
+	return minutes
+}
+
+// parseList reads "a, b" into its trimmed, non-empty entries.
+func parseList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseShippingRates reads "Delivery:10:5000:2000,Delivery:0:15000:5000",
+// i.e. type:max_distance_km:base_fee:per_kg_fee, into rates. Malformed
+// entries are skipped.
+func parseShippingRates(value string) []ShippingRate {
+	var rates []ShippingRate
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 4 {
+			continue
+		}
+		maxDistance, err1 := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		baseFee, err2 := strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+		perKgFee, err3 := strconv.ParseInt(strings.TrimSpace(fields[3]), 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		rates = append(rates, ShippingRate{
+			ShippingType:  strings.TrimSpace(fields[0]),
+			MaxDistanceKm: maxDistance,
+			BaseFee:       baseFee,
+			PerKgFee:      perKgFee,
+		})
+	}
+	return rates
+}
+
 type ElasticSearch struct {
 	Host string `json:"host"`
 }
@@ -83,6 +194,8 @@ type Config struct {
 	Midtrans      Midtrans      `json:"midtrans"`
 	ElasticSearch ElasticSearch `json:"elasticsearch"`
 	EmailConf     EmailConf     `json:"email_conf"`
+	JobQueue      JobQueue      `json:"job_queue"`
+	Order         Order         `json:"order"`
 }
 
 type EmailConf struct {
@@ -167,6 +280,20 @@ func LoadConfig() *Config {
 			Sending:  viper.GetString("EMAIL_SENDING"),
 			IsTLS:    viper.GetBool("EMAIL_IS_TLS"),
 		},
+		JobQueue: JobQueue{
+			Backend: viper.GetString("JOB_QUEUE_BACKEND"),
+		},
+		Order: Order{
+			PaymentWindowMinutes:   viper.GetInt("PAYMENT_WINDOW_MINUTES"),
+			PaymentWindowsByMethod: parseMinutesByKey(viper.GetString("PAYMENT_WINDOW_MINUTES_BY_METHOD")),
+			TrackingURLTemplate:    viper.GetString("SHIPMENT_TRACKING_URL_TEMPLATE"),
+			ShippingRates:          parseShippingRates(viper.GetString("SHIPPING_RATES")),
+			ShippingProviders:      parseList(viper.GetString("SHIPPING_PROVIDERS")),
+			ShippingWebhookSecret:  viper.GetString("SHIPPING_WEBHOOK_SECRET"),
+			StoreName:              viper.GetString("STORE_NAME"),
+			StoreAddress:           viper.GetString("STORE_ADDRESS"),
+			StorePhone:             viper.GetString("STORE_PHONE"),
+		},
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	orderModel "tofash/internal/modules/order/model"
 	productSeeds "tofash/internal/modules/product/database/seeds"
 	productModel "tofash/internal/modules/product/model"
+	returnsModel "tofash/internal/modules/returns/model"
 	systemModel "tofash/internal/modules/system/model"
 	"tofash/internal/modules/user/database/seeds"
 	userModel "tofash/internal/modules/user/model"
@@ -93,10 +94,19 @@ func InitDatabase(cfg *Config) *gorm.DB {
 		// Product Module
 		&productModel.Category{},
 		&productModel.Product{},
+		&productModel.StockMovement{},
+		&productModel.StockReservation{},
 
 		// Order Module
 		&orderModel.Order{},
 		&orderModel.OrderItem{},
+		&orderModel.OrderStatusHistory{},
+		&orderModel.Shipment{},
+		&orderModel.ShipmentItem{},
+		&orderModel.ShipmentTrackingEvent{},
+
+		// Returns Module
+		&returnsModel.ReturnRequest{},
 
 		// System (Job Queue)
 		&systemModel.Job{},
@@ -0,0 +1,21 @@
+package entity
+
+import orderEntity "tofash/internal/modules/order/entity"
+
+type CheckoutEntity struct {
+	BuyerID       int64
+	ShippingType  string
+	PaymentMethod string
+	Remarks       string
+	// TotalAmount is the total the customer was shown. When set, checkout
+	// fails with the current breakdown if the price has changed since.
+	TotalAmount int64
+}
+
+type CheckoutResultEntity struct {
+	OrderID       int64
+	OrderCode     string
+	Pricing       orderEntity.OrderPricing
+	PaymentStatus string
+	PaymentToken  string
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"tofash/internal/modules/checkout/entity"
+	"tofash/internal/modules/checkout/handlers/request"
+	"tofash/internal/modules/checkout/handlers/response"
+	"tofash/internal/modules/checkout/service"
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	"tofash/internal/modules/order/shipping"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type CheckoutHandlerInterface interface {
+	Checkout(c echo.Context) error
+	QuoteShipping(c echo.Context) error
+}
+
+type checkoutHandler struct {
+	checkoutService service.CheckoutServiceInterface
+}
+
+// Checkout implements CheckoutHandlerInterface.
+func (h *checkoutHandler) Checkout(c echo.Context) error {
+	var (
+		ctx         = c.Request().Context()
+		req         = request.CheckoutRequest{}
+		jwtUserData = orderEntity.JwtUserData{}
+	)
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		log.Errorf("[CheckoutHandler-1] Checkout: %s", "data token not found")
+		return c.JSON(http.StatusUnauthorized, response.ResponseError("data token not found"))
+	}
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		log.Errorf("[CheckoutHandler-2] Checkout: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[CheckoutHandler-3] Checkout: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+	if err := c.Validate(&req); err != nil {
+		log.Errorf("[CheckoutHandler-4] Checkout: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+	}
+
+	result, err := h.checkoutService.Checkout(ctx, entity.CheckoutEntity{
+		BuyerID:       jwtUserData.UserID,
+		ShippingType:  req.ShippingType,
+		PaymentMethod: req.PaymentMethod,
+		Remarks:       req.Remarks,
+		TotalAmount:   req.TotalAmount,
+	}, user)
+	if err != nil {
+		log.Errorf("[CheckoutHandler-5] Checkout: %v", err)
+		var (
+			mismatch   *orderService.PriceMismatchError
+			outOfStock *orderService.InsufficientStockError
+		)
+		switch {
+		case errors.Is(err, service.ErrCartEmpty):
+			return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+		case errors.As(err, &mismatch):
+			return c.JSON(http.StatusConflict, response.DefaultResponse{
+				Message: "total amount does not match the order price",
+				Data:    mismatch.Pricing,
+			})
+		case errors.As(err, &outOfStock):
+			return c.JSON(http.StatusConflict, response.ResponseError(outOfStock.Error()))
+		case errors.Is(err, shipping.ErrNoDestination), errors.Is(err, shipping.ErrOutOfRange):
+			return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+		case err.Error() == "400":
+			return c.JSON(http.StatusBadRequest, response.ResponseError("cart contains an unknown product or variant"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusCreated, response.ResponseSuccess("success", response.CheckoutResponse{
+		OrderID:       result.OrderID,
+		OrderCode:     result.OrderCode,
+		Pricing:       result.Pricing,
+		PaymentStatus: result.PaymentStatus,
+		PaymentToken:  result.PaymentToken,
+	}))
+}
+
+// QuoteShipping implements CheckoutHandlerInterface.
+func (h *checkoutHandler) QuoteShipping(c echo.Context) error {
+	var (
+		ctx         = c.Request().Context()
+		jwtUserData = orderEntity.JwtUserData{}
+	)
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		log.Errorf("[CheckoutHandler-1] QuoteShipping: %s", "data token not found")
+		return c.JSON(http.StatusUnauthorized, response.ResponseError("data token not found"))
+	}
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		log.Errorf("[CheckoutHandler-2] QuoteShipping: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	quotes, err := h.checkoutService.QuoteShipping(ctx, jwtUserData.UserID)
+	if err != nil {
+		log.Errorf("[CheckoutHandler-3] QuoteShipping: %v", err)
+		var outOfStock *orderService.InsufficientStockError
+		switch {
+		case errors.Is(err, service.ErrCartEmpty):
+			return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+		case errors.As(err, &outOfStock):
+			return c.JSON(http.StatusConflict, response.ResponseError(outOfStock.Error()))
+		case err.Error() == "400":
+			return c.JSON(http.StatusBadRequest, response.ResponseError("cart contains an unknown product or variant"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", quotes))
+}
+
+func NewCheckoutHandler(checkoutService service.CheckoutServiceInterface) CheckoutHandlerInterface {
+	return &checkoutHandler{checkoutService: checkoutService}
+}
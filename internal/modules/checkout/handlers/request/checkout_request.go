@@ -0,0 +1,8 @@
+package request
+
+type CheckoutRequest struct {
+	ShippingType  string `json:"shipping_type" validate:"required"`
+	PaymentMethod string `json:"payment_method"`
+	Remarks       string `json:"remarks"`
+	TotalAmount   int64  `json:"total_amount"`
+}
@@ -0,0 +1,30 @@
+package response
+
+import orderEntity "tofash/internal/modules/order/entity"
+
+type DefaultResponse struct {
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type CheckoutResponse struct {
+	OrderID       int64                    `json:"order_id"`
+	OrderCode     string                   `json:"order_code"`
+	Pricing       orderEntity.OrderPricing `json:"pricing"`
+	PaymentStatus string                   `json:"payment_status,omitempty"`
+	PaymentToken  string                   `json:"payment_token,omitempty"`
+}
+
+func ResponseSuccess(message string, data interface{}) DefaultResponse {
+	return DefaultResponse{
+		Message: message,
+		Data:    data,
+	}
+}
+
+func ResponseError(message string) DefaultResponse {
+	return DefaultResponse{
+		Message: message,
+		Data:    nil,
+	}
+}
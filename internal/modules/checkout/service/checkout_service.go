@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"tofash/internal/modules/checkout/entity"
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	paymentEntity "tofash/internal/modules/payment/entity"
+	paymentService "tofash/internal/modules/payment/service"
+	productService "tofash/internal/modules/product/service"
+
+	"github.com/labstack/gommon/log"
+)
+
+// ErrCartEmpty is returned when the buyer has nothing to check out.
+var ErrCartEmpty = errors.New("cart is empty")
+
+type CheckoutServiceInterface interface {
+	Checkout(ctx context.Context, req entity.CheckoutEntity, accessToken string) (*entity.CheckoutResultEntity, error)
+	QuoteShipping(ctx context.Context, buyerID int64) ([]orderEntity.ShippingQuote, error)
+}
+
+type checkoutService struct {
+	cartSvc    productService.CartServiceInterface
+	orderSvc   orderService.OrderServiceInterface
+	paymentSvc paymentService.PaymentServiceInterface
+}
+
+// Checkout implements CheckoutServiceInterface. It turns the buyer's cart
+// into an order, starts the payment when a method is given and empties the
+// cart. If the payment cannot be started the order is cancelled again, which
+// gives its stock back, and the cart is kept.
+func (c *checkoutService) Checkout(ctx context.Context, req entity.CheckoutEntity, accessToken string) (*entity.CheckoutResultEntity, error) {
+	order, err := c.cartOrder(ctx, req.BuyerID)
+	if err != nil {
+		log.Errorf("[CheckoutService-1] Checkout: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	order.OrderDate = now.Format("2006-01-02")
+	order.OrderTime = now.Format("15:04:05")
+	order.ShippingType = req.ShippingType
+	order.PaymentMethod = req.PaymentMethod
+	order.Remarks = req.Remarks
+
+	pricing, err := c.orderSvc.QuoteOrder(ctx, order)
+	if err != nil {
+		log.Errorf("[CheckoutService-2] Checkout: %v", err)
+		return nil, err
+	}
+	if req.TotalAmount != 0 && req.TotalAmount != pricing.GrandTotal {
+		return nil, &orderService.PriceMismatchError{Submitted: req.TotalAmount, Pricing: pricing}
+	}
+	order.TotalAmount = pricing.GrandTotal
+
+	orderID, err := c.orderSvc.CreateOrder(ctx, order)
+	if err != nil {
+		log.Errorf("[CheckoutService-3] Checkout: %v", err)
+		return nil, err
+	}
+
+	result := &entity.CheckoutResultEntity{OrderID: orderID, Pricing: pricing}
+	if created, err := c.orderSvc.GetByID(ctx, orderID); err == nil {
+		result.OrderCode = created.OrderCode
+	} else {
+		log.Errorf("[CheckoutService-4] Checkout: %v", err)
+	}
+
+	if req.PaymentMethod != "" {
+		payment, err := c.paymentSvc.ProcessPayment(ctx, paymentEntity.PaymentEntity{
+			OrderID:       uint(orderID),
+			UserID:        uint(req.BuyerID),
+			PaymentMethod: req.PaymentMethod,
+			GrossAmount:   float64(pricing.GrandTotal),
+			Remarks:       req.Remarks,
+		}, accessToken)
+		if err != nil {
+			log.Errorf("[CheckoutService-5] Checkout: %v", err)
+			if cancelErr := c.orderSvc.CancelOrder(ctx, orderID, "payment could not be started", orderEntity.SystemActor); cancelErr != nil {
+				log.Errorf("[CheckoutService-6] Checkout: %v", cancelErr)
+			}
+			return nil, err
+		}
+
+		result.PaymentStatus = payment.PaymentStatus
+		result.PaymentToken = payment.PaymentGatewayID
+	}
+
+	// The order stands even if Redis is unavailable now; a stale cart is
+	// the lesser evil.
+	if err := c.cartSvc.RemoveAllCart(ctx, req.BuyerID); err != nil {
+		log.Errorf("[CheckoutService-7] Checkout: %v", err)
+	}
+
+	return result, nil
+}
+
+// QuoteShipping implements CheckoutServiceInterface. It quotes each
+// shipping type for the buyer's cart, so they can pick one at checkout.
+func (c *checkoutService) QuoteShipping(ctx context.Context, buyerID int64) ([]orderEntity.ShippingQuote, error) {
+	order, err := c.cartOrder(ctx, buyerID)
+	if err != nil {
+		log.Errorf("[CheckoutService-1] QuoteShipping: %v", err)
+		return nil, err
+	}
+
+	quotes, err := c.orderSvc.QuoteShipping(ctx, order)
+	if err != nil {
+		log.Errorf("[CheckoutService-2] QuoteShipping: %v", err)
+		return nil, err
+	}
+
+	return quotes, nil
+}
+
+// cartOrder turns the buyer's cart into the items of an order, failing
+// with ErrCartEmpty when there are none.
+func (c *checkoutService) cartOrder(ctx context.Context, buyerID int64) (orderEntity.OrderEntity, error) {
+	cart, err := c.cartSvc.GetCartByUserID(ctx, buyerID)
+	if err != nil {
+		return orderEntity.OrderEntity{}, err
+	}
+	if len(cart) == 0 {
+		return orderEntity.OrderEntity{}, ErrCartEmpty
+	}
+
+	order := orderEntity.OrderEntity{BuyerId: buyerID}
+	for _, item := range cart {
+		order.OrderItems = append(order.OrderItems, orderEntity.OrderItemEntity{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Size:      item.Size,
+			Color:     item.Color,
+			SKU:       item.SKU,
+		})
+	}
+	return order, nil
+}
+
+func NewCheckoutService(cartSvc productService.CartServiceInterface, orderSvc orderService.OrderServiceInterface, paymentSvc paymentService.PaymentServiceInterface) CheckoutServiceInterface {
+	return &checkoutService{
+		cartSvc:    cartSvc,
+		orderSvc:   orderSvc,
+		paymentSvc: paymentSvc,
+	}
+}
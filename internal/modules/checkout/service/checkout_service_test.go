@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tofash/internal/modules/checkout/entity"
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	paymentEntity "tofash/internal/modules/payment/entity"
+	paymentService "tofash/internal/modules/payment/service"
+	productEntity "tofash/internal/modules/product/entity"
+	productService "tofash/internal/modules/product/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCartService struct {
+	productService.CartServiceInterface
+	items   []productEntity.CartItem
+	cleared bool
+}
+
+func (m *mockCartService) GetCartByUserID(ctx context.Context, userID int64) ([]productEntity.CartItem, error) {
+	return m.items, nil
+}
+
+func (m *mockCartService) RemoveAllCart(ctx context.Context, userID int64) error {
+	m.cleared = true
+	return nil
+}
+
+type mockOrderService struct {
+	orderService.OrderServiceInterface
+	pricing   orderEntity.OrderPricing
+	created   *orderEntity.OrderEntity
+	cancelled []int64
+}
+
+func (m *mockOrderService) QuoteOrder(ctx context.Context, req orderEntity.OrderEntity) (orderEntity.OrderPricing, error) {
+	return m.pricing, nil
+}
+
+func (m *mockOrderService) QuoteShipping(ctx context.Context, req orderEntity.OrderEntity) ([]orderEntity.ShippingQuote, error) {
+	m.created = &req
+	return []orderEntity.ShippingQuote{{ShippingType: "Delivery", Fee: 5000, Available: true}}, nil
+}
+
+func (m *mockOrderService) CreateOrder(ctx context.Context, req orderEntity.OrderEntity) (int64, error) {
+	req.ID = 42
+	req.OrderCode = "ORD-42"
+	m.created = &req
+	return req.ID, nil
+}
+
+func (m *mockOrderService) GetByID(ctx context.Context, orderID int64) (*orderEntity.OrderEntity, error) {
+	return m.created, nil
+}
+
+func (m *mockOrderService) CancelOrder(ctx context.Context, orderID int64, reason string, actor orderEntity.OrderActor) error {
+	m.cancelled = append(m.cancelled, orderID)
+	return nil
+}
+
+type mockPaymentService struct {
+	paymentService.PaymentServiceInterface
+	err error
+}
+
+func (m *mockPaymentService) ProcessPayment(ctx context.Context, payment paymentEntity.PaymentEntity, accessToken string) (*paymentEntity.PaymentEntity, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	payment.PaymentStatus = paymentEntity.PaymentStatusPending
+	payment.PaymentGatewayID = "snap-token"
+	return &payment, nil
+}
+
+func newCheckoutFixture() (*mockCartService, *mockOrderService, *mockPaymentService) {
+	cart := &mockCartService{items: []productEntity.CartItem{{ProductID: 1, Quantity: 2, Size: "L"}}}
+	orders := &mockOrderService{pricing: orderEntity.OrderPricing{Subtotal: 200000, GrandTotal: 205000, ShippingFee: 5000}}
+	return cart, orders, &mockPaymentService{}
+}
+
+func TestCheckoutService_Checkout_CreatesOrderAndClearsCart(t *testing.T) {
+	cart, orders, payments := newCheckoutFixture()
+	svc := NewCheckoutService(cart, orders, payments)
+
+	result, err := svc.Checkout(context.Background(), entity.CheckoutEntity{
+		BuyerID: 7, ShippingType: "Delivery", PaymentMethod: "midtrans", TotalAmount: 205000,
+	}, "{}")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), result.OrderID)
+	assert.Equal(t, "ORD-42", result.OrderCode)
+	assert.Equal(t, "snap-token", result.PaymentToken)
+	assert.Equal(t, int64(205000), orders.created.TotalAmount)
+	assert.Equal(t, "L", orders.created.OrderItems[0].Size)
+	assert.True(t, cart.cleared)
+}
+
+func TestCheckoutService_Checkout_StalePriceIsRejected(t *testing.T) {
+	cart, orders, payments := newCheckoutFixture()
+	svc := NewCheckoutService(cart, orders, payments)
+
+	_, err := svc.Checkout(context.Background(), entity.CheckoutEntity{BuyerID: 7, TotalAmount: 100}, "{}")
+	var mismatch *orderService.PriceMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Nil(t, orders.created)
+	assert.False(t, cart.cleared)
+}
+
+func TestCheckoutService_Checkout_PaymentFailureCancelsOrder(t *testing.T) {
+	cart, orders, payments := newCheckoutFixture()
+	payments.err = errors.New("gateway down")
+	svc := NewCheckoutService(cart, orders, payments)
+
+	_, err := svc.Checkout(context.Background(), entity.CheckoutEntity{BuyerID: 7, PaymentMethod: "midtrans"}, "{}")
+	assert.EqualError(t, err, "gateway down")
+	assert.Equal(t, []int64{42}, orders.cancelled)
+	assert.False(t, cart.cleared)
+}
+
+func TestCheckoutService_Checkout_EmptyCart(t *testing.T) {
+	_, orders, payments := newCheckoutFixture()
+	svc := NewCheckoutService(&mockCartService{}, orders, payments)
+
+	_, err := svc.Checkout(context.Background(), entity.CheckoutEntity{BuyerID: 7}, "{}")
+	assert.ErrorIs(t, err, ErrCartEmpty)
+}
+
+func TestCheckoutService_QuoteShipping_QuotesTheCart(t *testing.T) {
+	cart, orders, payments := newCheckoutFixture()
+	svc := NewCheckoutService(cart, orders, payments)
+
+	quotes, err := svc.QuoteShipping(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, quotes, 1)
+	assert.Equal(t, int64(7), orders.created.BuyerId)
+	assert.Equal(t, int64(2), orders.created.OrderItems[0].Quantity)
+	assert.False(t, cart.cleared)
+
+	_, err = NewCheckoutService(&mockCartService{}, orders, payments).QuoteShipping(context.Background(), 7)
+	assert.ErrorIs(t, err, ErrCartEmpty)
+}
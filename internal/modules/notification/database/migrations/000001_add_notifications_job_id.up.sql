@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS job_id BIGINT NULL;
+
+-- A retried job finds the notification it already stored.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_job_id ON notifications(job_id);
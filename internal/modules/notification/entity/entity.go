@@ -14,6 +14,18 @@ type NotificationEntity struct {
 	ReadAt           *time.Time `json:"read_at"`
 	CreatedAt        time.Time  `json:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at"`
+	// JobID is the job that sent the notification, so a retried job
+	// does not send it again.
+	JobID uint `json:"-"`
+	// Attachments go out with an email but are not stored.
+	Attachments []Attachment `json:"-"`
+}
+
+// Attachment is a file sent along with an email.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
 }
 
 type NotifyQueryString struct {
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"tofash/internal/modules/notification/entity"
+	"tofash/internal/modules/notification/service"
+	"tofash/internal/shared/async"
+)
+
+const TopicEmailNotification = "email_notification"
+
+// Emails are independent of each other and mostly wait on SMTP, so they
+// can safely run in parallel.
+const emailConcurrency = 4
+
+type NotificationPayload struct {
+	ReceiverEmail string `json:"receiver_email"`
+	Subject       string `json:"subject"`
+	Message       string `json:"message"`
+	Type          string `json:"type"`
+	ReceiverID    int64  `json:"receiver_id"`
+}
+
+// RegisterHandlers plugs the notification module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, notifSvc service.NotificationServiceInterface) {
+	r.Register(TopicEmailNotification, async.Typed(func(ctx context.Context, jobID uint, data NotificationPayload) error {
+		// Producers use Type to describe the event (e.g. UPDATE_STATUS);
+		// everything on this topic is delivered by email unless marked PUSH.
+		notifType := "EMAIL"
+		if data.Type == "PUSH" {
+			notifType = "PUSH"
+		}
+
+		notifEntity := entity.NotificationEntity{
+			ReceiverEmail:    &data.ReceiverEmail,
+			Subject:          &data.Subject,
+			Message:          data.Message,
+			NotificationType: notifType,
+			Status:           "PENDING",
+			ReceiverID:       uint(data.ReceiverID),
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
+			JobID:            jobID,
+		}
+
+		return notifSvc.CreateAndSend(ctx, notifEntity)
+	}), async.WithConcurrency(emailConcurrency))
+
+	registerPurge(r, notifSvc)
+}
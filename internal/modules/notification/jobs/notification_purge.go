@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/notification/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+)
+
+const TopicNotificationPurge = "notification_purge"
+
+type NotificationPurgePayload struct {
+	OlderThanDays int `json:"older_than_days"`
+}
+
+// notificationRetentionDays is how long notifications are kept.
+const notificationRetentionDays = 90
+
+func registerPurge(r async.Registry, notifSvc service.NotificationServiceInterface) {
+	r.Register(TopicNotificationPurge, async.Typed(func(ctx context.Context, _ uint, data NotificationPurgePayload) error {
+		if data.OlderThanDays < 1 {
+			data.OlderThanDays = notificationRetentionDays
+		}
+
+		purged, err := notifSvc.PurgeOlderThan(ctx, data.OlderThanDays)
+		if err != nil {
+			return err
+		}
+		log.Infof("[NotificationPurgeJob] Deleted %d notification(s) older than %d days", purged, data.OlderThanDays)
+		return nil
+	}))
+}
+
+// RegisterSchedules declares the notification module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("30 3 * * *", TopicNotificationPurge, NotificationPurgePayload{OlderThanDays: notificationRetentionDays})
+}
@@ -1,15 +1,17 @@
 package message
 
 import (
+	"bytes"
 	"crypto/tls"
 	"tofash/internal/config"
+	"tofash/internal/modules/notification/entity"
 
 	"github.com/go-mail/mail"
 	"github.com/labstack/gommon/log"
 )
 
 type MessageEmailInterface interface {
-	SendEmailNotif(to, subject, body string) error
+	SendEmailNotif(to, subject, body string, attachments ...entity.Attachment) error
 }
 
 type emailAttribute struct {
@@ -22,13 +24,18 @@ type emailAttribute struct {
 }
 
 // SendEmailNotif implements MessageEmailInterface.
-func (e *emailAttribute) SendEmailNotif(to string, subject string, body string) error {
+func (e *emailAttribute) SendEmailNotif(to string, subject string, body string, attachments ...entity.Attachment) error {
 	m := mail.NewMessage()
 	m.SetHeader("From", e.From)
 	m.SetHeader("To", to)
 
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", body)
+	for _, attachment := range attachments {
+		m.AttachReader(attachment.Filename, bytes.NewReader(attachment.Content), mail.SetHeader(map[string][]string{
+			"Content-Type": {attachment.ContentType},
+		}))
+	}
 
 	d := mail.NewDialer(e.Host, e.Port, e.Username, e.Password)
 	d.TLSConfig = &tls.Config{
@@ -9,6 +9,7 @@ type Notification struct {
 	Message          string  `gorm:"type:text"`
 	Status           string  `gorm:"type:varchar(50)"` // SENT, PENDING, READ
 	NotificationType string  `gorm:"type:varchar(50)"` // EMAIL, PUSH
+	JobID            *uint   `gorm:"column:job_id;uniqueIndex"`
 	SentAt           *time.Time
 	ReadAt           *time.Time
 	CreatedAt        time.Time
@@ -60,7 +60,7 @@ func (c *consumeRabbitMQ) ConsumeMessage(queueName string) error {
 			notificationEntity.Status = "SENT"
 		}
 
-		err = c.notifRepository.CreateNotification(context.Background(), notificationEntity)
+		_, err = c.notifRepository.CreateNotification(context.Background(), notificationEntity)
 		if err != nil {
 			log.Errorf("Failed to create notification: %v", err)
 			continue
@@ -16,9 +16,11 @@ import (
 type NotificationRepositoryInterface interface {
 	GetAll(ctx context.Context, query entity.NotifyQueryString) ([]entity.NotificationEntity, int64, int64, error)
 	GetByID(ctx context.Context, notifID uint) (*entity.NotificationEntity, error)
-	CreateNotification(ctx context.Context, notification entity.NotificationEntity) error
+	CreateNotification(ctx context.Context, notification entity.NotificationEntity) (uint, error)
+	GetByJobID(ctx context.Context, jobID uint) (*entity.NotificationEntity, error)
 	MarkAsSent(notifID uint) error
 	MarkAsRead(ctx context.Context, notifID uint) error
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error)
 }
 
 type notificationRepository struct {
@@ -70,8 +72,9 @@ func (n *notificationRepository) MarkAsSent(notifID uint) error {
 	return nil
 }
 
-// CreateNotification implements NotificationRepositoryInterface.
-func (n *notificationRepository) CreateNotification(ctx context.Context, notification entity.NotificationEntity) error {
+// CreateNotification implements NotificationRepositoryInterface. It
+// returns the new notification's ID.
+func (n *notificationRepository) CreateNotification(ctx context.Context, notification entity.NotificationEntity) (uint, error) {
 	now := time.Now()
 	modelNotif := model.Notification{
 		ReceiverID:       notification.ReceiverID,
@@ -82,12 +85,34 @@ func (n *notificationRepository) CreateNotification(ctx context.Context, notific
 		Message:          notification.Message,
 		NotificationType: notification.NotificationType,
 	}
+	if notification.JobID != 0 {
+		modelNotif.JobID = &notification.JobID
+	}
 
-	if err := n.db.Create(&modelNotif).Error; err != nil {
+	if err := n.db.WithContext(ctx).Create(&modelNotif).Error; err != nil {
 		log.Errorf("[CreateNotification-1] Failed to create notification: %v", err)
-		return err
+		return 0, err
 	}
-	return nil
+	return modelNotif.ID, nil
+}
+
+// GetByJobID implements NotificationRepositoryInterface.
+func (n *notificationRepository) GetByJobID(ctx context.Context, jobID uint) (*entity.NotificationEntity, error) {
+	modelNotif := model.Notification{}
+
+	if err := n.db.WithContext(ctx).Select("id", "status").Where("job_id = ?", jobID).First(&modelNotif).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("404")
+		}
+		log.Errorf("[GetByJobID-1] Failed to find notification by job ID: %v", err)
+		return nil, err
+	}
+
+	return &entity.NotificationEntity{
+		ID:     modelNotif.ID,
+		Status: modelNotif.Status,
+		JobID:  jobID,
+	}, nil
 }
 
 // GetByID implements NotificationRepositoryInterface.
@@ -165,6 +190,17 @@ func (n *notificationRepository) GetAll(ctx context.Context, queryString entity.
 	return notifEntities, countData, int64(totalPage), nil
 }
 
+// DeleteOlderThan implements NotificationRepositoryInterface.
+func (n *notificationRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	result := n.db.WithContext(ctx).Where("created_at < ?", before).Delete(&model.Notification{})
+	if result.Error != nil {
+		log.Errorf("[NotificationRepository-1] DeleteOlderThan: %v", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
 func NewNotificationRepository(db *gorm.DB) NotificationRepositoryInterface {
 	return &notificationRepository{db: db}
 }
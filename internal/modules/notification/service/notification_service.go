@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 	"tofash/internal/modules/notification/entity"
 	"tofash/internal/modules/notification/message"
 	"tofash/internal/modules/notification/repository"
@@ -15,6 +16,7 @@ type NotificationServiceInterface interface {
 	MarkAsRead(ctx context.Context, notifID uint) error
 	SendPushNotification(ctx context.Context, notification entity.NotificationEntity) error
 	CreateAndSend(ctx context.Context, notification entity.NotificationEntity) error
+	PurgeOlderThan(ctx context.Context, days int) (int64, error)
 }
 
 type notificationService struct {
@@ -38,6 +40,11 @@ func (s *notificationService) MarkAsRead(ctx context.Context, notifID uint) erro
 	return s.repo.MarkAsRead(ctx, notifID)
 }
 
+// PurgeOlderThan deletes notifications created more than days ago.
+func (s *notificationService) PurgeOlderThan(ctx context.Context, days int) (int64, error) {
+	return s.repo.DeleteOlderThan(ctx, time.Now().AddDate(0, 0, -days))
+}
+
 func (s *notificationService) SendPushNotification(ctx context.Context, notification entity.NotificationEntity) error {
 	// Logic to send push notification (e.g. Firebase)
 	// For now, just placeholder
@@ -45,26 +52,39 @@ func (s *notificationService) SendPushNotification(ctx context.Context, notifica
 	return nil
 }
 
+// CreateAndSend stores the notification as PENDING, sends it and marks it
+// SENT. A notification carrying a JobID is stored once per job: a retry
+// finds the earlier row and sends only if that attempt did not get to.
 func (s *notificationService) CreateAndSend(ctx context.Context, notification entity.NotificationEntity) error {
-	// 1. Create Notification Record (Pending)
 	notification.Status = "PENDING"
-	if notification.NotificationType == "EMAIL" {
-		// Usually we mark as sent after sending, or pending before.
-		// Old consumer logic: set status "SENT" if type EMAIL. Weird.
-		// Let's stick to "PENDING" then update to "SENT".
+
+	if notification.JobID != 0 {
+		existing, err := s.repo.GetByJobID(ctx, notification.JobID)
+		switch {
+		case err == nil && existing.Status == "SENT":
+			log.Infof("[NotificationService] CreateAndSend: job %d already sent notification %d", notification.JobID, existing.ID)
+			return nil
+		case err == nil:
+			notification.ID = existing.ID
+		case err.Error() != "404":
+			log.Errorf("[NotificationService] GetByJobID: %v", err)
+			return err
+		}
 	}
 
-	err := s.repo.CreateNotification(ctx, notification)
-	if err != nil {
-		log.Errorf("[NotificationService] CreateNotification: %v", err)
-		return err
+	if notification.ID == 0 {
+		id, err := s.repo.CreateNotification(ctx, notification)
+		if err != nil {
+			log.Errorf("[NotificationService] CreateNotification: %v", err)
+			return err
+		}
+		notification.ID = id
 	}
 
-	// 2. Send Message
 	switch notification.NotificationType {
 	case "EMAIL":
 		if notification.ReceiverEmail != nil && notification.Subject != nil {
-			err = s.emailSvc.SendEmailNotif(*notification.ReceiverEmail, *notification.Subject, notification.Message)
+			err := s.emailSvc.SendEmailNotif(*notification.ReceiverEmail, *notification.Subject, notification.Message, notification.Attachments...)
 			if err != nil {
 				log.Errorf("[NotificationService] SendEmail: %v", err)
 				// Don't fail the whole job? Or retry?
@@ -77,5 +97,10 @@ func (s *notificationService) CreateAndSend(ctx context.Context, notification en
 		_ = s.SendPushNotification(ctx, notification)
 	}
 
+	// The message is out; failing the job now would only send it again.
+	if err := s.repo.MarkAsSent(notification.ID); err != nil {
+		log.Errorf("[NotificationService] MarkAsSent: %v", err)
+	}
+
 	return nil
 }
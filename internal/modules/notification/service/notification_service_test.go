@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tofash/internal/modules/notification/entity"
+	"tofash/internal/modules/notification/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockNotifRepo struct {
+	repository.NotificationRepositoryInterface
+	rows []entity.NotificationEntity
+}
+
+func (m *mockNotifRepo) CreateNotification(ctx context.Context, notification entity.NotificationEntity) (uint, error) {
+	notification.ID = uint(len(m.rows) + 1)
+	m.rows = append(m.rows, notification)
+	return notification.ID, nil
+}
+
+func (m *mockNotifRepo) GetByJobID(ctx context.Context, jobID uint) (*entity.NotificationEntity, error) {
+	for _, row := range m.rows {
+		if row.JobID == jobID {
+			return &row, nil
+		}
+	}
+	return nil, errors.New("404")
+}
+
+func (m *mockNotifRepo) MarkAsSent(notifID uint) error {
+	m.rows[notifID-1].Status = "SENT"
+	return nil
+}
+
+type mockEmail struct {
+	sent int
+	err  error
+}
+
+func (m *mockEmail) SendEmailNotif(to, subject, body string, attachments ...entity.Attachment) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent++
+	return nil
+}
+
+func TestNotificationService_CreateAndSend_RetriedJobSendsOnce(t *testing.T) {
+	ctx := context.Background()
+	repo, email := &mockNotifRepo{}, &mockEmail{err: errors.New("smtp down")}
+	svc := NewNotificationService(repo, email)
+	to, subject := "buyer@example.com", "Update Status Order"
+	notification := entity.NotificationEntity{ReceiverEmail: &to, Subject: &subject, NotificationType: "EMAIL", JobID: 42}
+
+	// The first attempt stores the row but cannot send.
+	assert.Error(t, svc.CreateAndSend(ctx, notification))
+	assert.Len(t, repo.rows, 1)
+	assert.Equal(t, "PENDING", repo.rows[0].Status)
+
+	// The retry sends through the same row.
+	email.err = nil
+	assert.NoError(t, svc.CreateAndSend(ctx, notification))
+	assert.Len(t, repo.rows, 1)
+	assert.Equal(t, "SENT", repo.rows[0].Status)
+	assert.Equal(t, 1, email.sent)
+
+	// A job that ran again after sending does not email twice.
+	assert.NoError(t, svc.CreateAndSend(ctx, notification))
+	assert.Equal(t, 1, email.sent)
+
+	// Another job's notification is its own.
+	notification.JobID = 43
+	assert.NoError(t, svc.CreateAndSend(ctx, notification))
+	assert.Len(t, repo.rows, 2)
+	assert.Equal(t, 2, email.sent)
+}
@@ -27,7 +27,7 @@ func (cfg Config) ConnectionPostgres() (*Postgres, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&model.Order{}, &model.OrderItem{})
+	db.AutoMigrate(&model.Order{}, &model.OrderItem{}, &model.OrderStatusHistory{}, &model.Shipment{}, &model.ShipmentItem{}, &model.ShipmentTrackingEvent{})
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "order_status_history" (
+    id SERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    previous_status VARCHAR(20) NULL,
+    status VARCHAR(20) NOT NULL,
+    actor_id BIGINT NULL,
+    actor_role VARCHAR(50) NULL,
+    remarks text NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id);
@@ -0,0 +1,3 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS price;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS subtotal;
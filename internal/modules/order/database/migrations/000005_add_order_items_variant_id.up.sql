@@ -0,0 +1 @@
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_orders_status_payment_due_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS payment_due_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS payment_method;
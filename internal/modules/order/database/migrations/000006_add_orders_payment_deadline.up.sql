@@ -0,0 +1,8 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_method VARCHAR(50) NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_due_at TIMESTAMP NULL;
+
+-- Orders placed before deadlines existed get the default 24 hour window.
+UPDATE orders SET payment_due_at = created_at + INTERVAL '1 day'
+WHERE payment_due_at IS NULL AND status IN ('Pending', 'pending');
+
+CREATE INDEX IF NOT EXISTS idx_orders_status_payment_due_at ON orders(status, payment_due_at);
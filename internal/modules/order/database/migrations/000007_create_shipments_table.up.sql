@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS "shipments" (
+    id SERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    courier VARCHAR(50) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    tracking_url text NULL,
+    created_by BIGINT NULL,
+    shipped_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX idx_shipments_order_id ON shipments(order_id);
+
+CREATE TABLE IF NOT EXISTS "shipment_items" (
+    id SERIAL PRIMARY KEY,
+    shipment_id BIGINT NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+    order_item_id BIGINT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity BIGINT NOT NULL
+);
+
+CREATE INDEX idx_shipment_items_shipment_id ON shipment_items(shipment_id);
+CREATE INDEX idx_shipment_items_order_item_id ON shipment_items(order_item_id);
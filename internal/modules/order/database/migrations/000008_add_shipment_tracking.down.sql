@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS shipment_tracking_events;
+DROP INDEX IF EXISTS idx_shipments_provider_tracking_number;
+ALTER TABLE shipments DROP COLUMN IF EXISTS delivered_at;
+ALTER TABLE shipments DROP COLUMN IF EXISTS status;
+ALTER TABLE shipments DROP COLUMN IF EXISTS service;
+ALTER TABLE shipments DROP COLUMN IF EXISTS provider;
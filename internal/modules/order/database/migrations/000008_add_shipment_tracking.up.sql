@@ -0,0 +1,19 @@
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS provider VARCHAR(30) NULL;
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS service VARCHAR(30) NULL;
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS status VARCHAR(30) NOT NULL DEFAULT 'in_transit';
+ALTER TABLE shipments ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_shipments_provider_tracking_number ON shipments(provider, tracking_number);
+
+CREATE TABLE IF NOT EXISTS "shipment_tracking_events" (
+    id SERIAL PRIMARY KEY,
+    shipment_id BIGINT NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+    status VARCHAR(30) NOT NULL,
+    description text NULL,
+    location VARCHAR(100) NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A courier repeating an event must not record it twice.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipment_tracking_events_unique ON shipment_tracking_events(shipment_id, status, occurred_at);
@@ -0,0 +1,219 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+
+	"tofash/internal/modules/order/entity"
+)
+
+// Store is the seller printed at the top of every document.
+type Store struct {
+	Name    string
+	Address string
+	Phone   string
+}
+
+// Payment statuses printed on documents.
+const (
+	PaymentStatusPaid      = "Paid"
+	PaymentStatusUnpaid    = "Unpaid"
+	PaymentStatusCancelled = "Cancelled"
+	PaymentStatusRefunded  = "Refunded"
+)
+
+// PaymentStatus says whether an order in status has been paid for. Every
+// status after Paid implies the money arrived.
+func PaymentStatus(status string) string {
+	switch entity.NormalizeOrderStatus(status) {
+	case entity.OrderStatusPending, entity.OrderStatusExpired:
+		return PaymentStatusUnpaid
+	case entity.OrderStatusCancelled:
+		return PaymentStatusCancelled
+	case entity.OrderStatusRefunded:
+		return PaymentStatusRefunded
+	default:
+		return PaymentStatusPaid
+	}
+}
+
+// Item table columns: left edges of the text columns, right edges of the
+// numeric ones.
+const (
+	colItem   = margin
+	colSize   = 195.0
+	colColor  = 240.0
+	colSKU    = 300.0
+	colQty    = 400.0
+	colPrice  = 470.0
+	colAmount = pageWidth - margin
+)
+
+// Invoice renders the buyer's invoice for order, which must carry its
+// items and buyer details as GetDetailCustomer returns them.
+func Invoice(order entity.OrderEntity, store Store) []byte {
+	w := newPDFWriter()
+	header(w, "INVOICE", order, store)
+
+	w.text(colItem, 10, true, "Bill to")
+	w.nextLine(14)
+	party(w, order)
+
+	itemHeader := func() {
+		w.text(colItem, 9, true, "Item")
+		w.text(colSize, 9, true, "Size")
+		w.text(colColor, 9, true, "Colour")
+		w.text(colSKU, 9, true, "SKU")
+		w.textRight(colQty, 9, true, "Qty")
+		w.textRight(colPrice, 9, true, "Price")
+		w.textRight(colAmount, 9, true, "Amount")
+		w.rule(colItem, colAmount)
+		w.nextLine(16)
+	}
+	itemHeader()
+	for _, item := range order.OrderItems {
+		if w.ensure(14) {
+			itemHeader()
+		}
+		itemColumns(w, item)
+		w.textRight(colQty, 9, false, strconv.FormatInt(item.Quantity, 10))
+		w.textRight(colPrice, 9, false, formatRupiah(item.Price))
+		w.textRight(colAmount, 9, false, formatRupiah(item.Price*item.Quantity))
+		w.nextLine(14)
+	}
+	w.rule(colItem, colAmount)
+	w.nextLine(20)
+
+	w.ensure(90)
+	total := func(label, amount string, bold bool) {
+		w.textRight(colPrice, 10, bold, label)
+		w.textRight(colAmount, 10, bold, amount)
+		w.nextLine(15)
+	}
+	total("Subtotal", formatRupiah(order.Subtotal), false)
+	if order.Discount > 0 {
+		total("Discount", "-"+formatRupiah(order.Discount), false)
+	}
+	shippingLabel := "Shipping"
+	if order.ShippingType != "" {
+		shippingLabel = fmt.Sprintf("Shipping (%s)", order.ShippingType)
+	}
+	total(shippingLabel, formatRupiah(order.ShippingFee), false)
+	total("Total", formatRupiah(order.TotalAmount), true)
+
+	return w.bytes()
+}
+
+// PackingSlip renders the warehouse's picking list for order: what goes
+// in the parcel and where it goes, without prices.
+func PackingSlip(order entity.OrderEntity, store Store) []byte {
+	w := newPDFWriter()
+	header(w, "PACKING SLIP", order, store)
+
+	w.text(colItem, 10, true, "Ship to")
+	w.nextLine(14)
+	party(w, order)
+
+	itemHeader := func() {
+		w.text(colItem, 9, true, "Item")
+		w.text(colSize, 9, true, "Size")
+		w.text(colColor, 9, true, "Colour")
+		w.text(colSKU, 9, true, "SKU")
+		w.textRight(colQty, 9, true, "Qty")
+		w.textRight(colAmount, 9, true, "Packed")
+		w.rule(colItem, colAmount)
+		w.nextLine(16)
+	}
+	itemHeader()
+	var quantity int64
+	for _, item := range order.OrderItems {
+		if w.ensure(14) {
+			itemHeader()
+		}
+		itemColumns(w, item)
+		w.textRight(colQty, 9, false, strconv.FormatInt(item.Quantity, 10))
+		w.textRight(colAmount, 9, false, "[   ]")
+		w.nextLine(14)
+		quantity += item.Quantity
+	}
+	w.rule(colItem, colAmount)
+	w.nextLine(20)
+
+	w.ensure(40)
+	w.textRight(colPrice, 10, false, "Total items")
+	w.textRight(colAmount, 10, true, strconv.FormatInt(quantity, 10))
+	w.nextLine(15)
+	w.textRight(colPrice, 10, false, "Order total")
+	w.textRight(colAmount, 10, true, formatRupiah(order.TotalAmount))
+
+	return w.bytes()
+}
+
+// header prints the title, the store and the order's particulars.
+func header(w *pdfWriter, title string, order entity.OrderEntity, store Store) {
+	w.nextLine(10)
+	w.text(colItem, 20, true, title)
+	w.textRight(colAmount, 12, true, store.Name)
+	w.nextLine(14)
+	for _, line := range []string{store.Address, store.Phone} {
+		if line != "" {
+			w.textRight(colAmount, 9, false, line)
+			w.nextLine(12)
+		}
+	}
+	w.nextLine(14)
+
+	details := [][2]string{
+		{"Order", order.OrderCode},
+		{"Date", order.OrderDate},
+		{"Payment", PaymentStatus(order.Status)},
+	}
+	if order.PaymentMethod != "" {
+		details = append(details, [2]string{"Payment method", order.PaymentMethod})
+	}
+	if order.ShippingType != "" {
+		details = append(details, [2]string{"Shipping", order.ShippingType})
+	}
+	for _, detail := range details {
+		w.text(colItem, 10, true, detail[0])
+		w.text(colItem+100, 10, false, detail[1])
+		w.nextLine(14)
+	}
+	w.nextLine(10)
+}
+
+// party prints the buyer's contact details.
+func party(w *pdfWriter, order entity.OrderEntity) {
+	for _, line := range []string{order.BuyerName, order.BuyerEmail, order.BuyerPhone, order.BuyerAddress} {
+		if line != "" {
+			w.text(colItem, 10, false, fit(line, colAmount-colItem, 10, false))
+			w.nextLine(13)
+		}
+	}
+	w.nextLine(14)
+}
+
+// itemColumns prints an item's name, size, colour and SKU.
+func itemColumns(w *pdfWriter, item entity.OrderItemEntity) {
+	w.text(colItem, 9, false, fit(item.ProductName, colSize-colItem-5, 9, false))
+	w.text(colSize, 9, false, fit(item.Size, colColor-colSize-5, 9, false))
+	w.text(colColor, 9, false, fit(item.Color, colSKU-colColor-5, 9, false))
+	w.text(colSKU, 9, false, fit(item.SKU, colQty-colSKU-30, 9, false))
+}
+
+// formatRupiah prints amount as "Rp 1.250.000".
+func formatRupiah(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	grouped := make([]byte, 0, len(digits)+len(digits)/3)
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped = append(grouped, '.')
+		}
+		grouped = append(grouped, digits[i])
+	}
+	return sign + "Rp " + string(grouped)
+}
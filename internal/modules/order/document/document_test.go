@@ -0,0 +1,88 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"tofash/internal/modules/order/entity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOrder(items int) entity.OrderEntity {
+	order := entity.OrderEntity{
+		OrderCode:    "ORD-007",
+		OrderDate:    "2026-03-01",
+		Status:       entity.OrderStatusPaid,
+		Subtotal:     200000,
+		ShippingType: "Delivery",
+		ShippingFee:  7000,
+		TotalAmount:  207000,
+		BuyerName:    "Siti (Home)",
+		BuyerAddress: "Jl. Merdeka 1",
+	}
+	for i := 0; i < items; i++ {
+		order.OrderItems = append(order.OrderItems, entity.OrderItemEntity{
+			ProductName: "Linen Shirt", Size: "M", Color: "Navy", SKU: fmt.Sprintf("LS-M-%03d", i),
+			Quantity: 2, Price: 100000,
+		})
+	}
+	return order
+}
+
+// checkXref asserts every object the cross-reference table lists starts
+// where it says.
+func checkXref(t *testing.T, pdf []byte) {
+	t.Helper()
+	start := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if !assert.NotNil(t, start) {
+		return
+	}
+	xref, _ := strconv.Atoi(string(start[1]))
+	assert.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))), "object %d", i+1)
+	}
+}
+
+func TestInvoice(t *testing.T) {
+	pdf := Invoice(testOrder(1), Store{Name: "Tofash"})
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	checkXref(t, pdf)
+	for _, text := range []string{"(INVOICE)", "(ORD-007)", "(LS-M-000)", "(Navy)", "(Rp 207.000)", "(Paid)", `(Siti \(Home\))`} {
+		assert.Contains(t, string(pdf), text)
+	}
+	assert.Contains(t, string(pdf), "/Count 1")
+}
+
+func TestPackingSlip_BreaksPages(t *testing.T) {
+	pdf := PackingSlip(testOrder(80), Store{Name: "Tofash"})
+
+	checkXref(t, pdf)
+	assert.Contains(t, string(pdf), "(PACKING SLIP)")
+	assert.Contains(t, string(pdf), "(LS-M-079)")
+	assert.Contains(t, string(pdf), "(160)")
+	assert.NotContains(t, string(pdf), "(Rp 100.000)")
+	assert.Contains(t, string(pdf), "/Count 2")
+}
+
+func TestPaymentStatus(t *testing.T) {
+	assert.Equal(t, PaymentStatusUnpaid, PaymentStatus(entity.OrderStatusPending))
+	assert.Equal(t, PaymentStatusPaid, PaymentStatus(entity.OrderStatusShipped))
+	assert.Equal(t, PaymentStatusPaid, PaymentStatus("Done"))
+	assert.Equal(t, PaymentStatusRefunded, PaymentStatus(entity.OrderStatusRefunded))
+}
+
+func TestFormatRupiah(t *testing.T) {
+	assert.Equal(t, "Rp 0", formatRupiah(0))
+	assert.Equal(t, "Rp 999", formatRupiah(999))
+	assert.Equal(t, "Rp 1.250.000", formatRupiah(1250000))
+	assert.Equal(t, "-Rp 5.000", formatRupiah(-5000))
+}
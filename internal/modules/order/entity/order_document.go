@@ -0,0 +1,8 @@
+package entity
+
+// OrderDocument is a printable file generated for an order.
+type OrderDocument struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
@@ -3,31 +3,41 @@ package entity
 import "time"
 
 type OrderEntity struct {
-	ID            int64             `json:"id"`
-	OrderCode     string            `json:"order_code"`
-	BuyerId       int64             `json:"buyer_id"`
-	OrderDate     string            `json:"order_date"`
-	Status        string            `json:"status"`
-	TotalAmount   int64             `json:"total_amount"`
-	PaymentMethod string            `json:"payment_method"`
-	ShippingType  string            `json:"shipping_type"`
-	ShippingFee   int64             `json:"shipping_fee"`
-	OrderTime     string            `json:"order_time"`
-	Remarks       string            `json:"remarks"`
-	CreatedAt     time.Time         `json:"created_at"`
-	OrderItems    []OrderItemEntity `json:"order_items"`
-	BuyerName     string            `json:"buyer_name"`
-	BuyerEmail    string            `json:"buyer_email"`
-	BuyerPhone    string            `json:"buyer_phone"`
-	BuyerAddress  string            `json:"buyer_address"`
-	BuyerLat      string            `json:"buyer_lat"`
-	BuyerLng      string            `json:"buyer_lng"`
+	ID            int64                      `json:"id"`
+	OrderCode     string                     `json:"order_code"`
+	BuyerId       int64                      `json:"buyer_id"`
+	OrderDate     string                     `json:"order_date"`
+	Status        string                     `json:"status"`
+	Subtotal      int64                      `json:"subtotal"`
+	Discount      int64                      `json:"discount"`
+	TotalAmount   int64                      `json:"total_amount"`
+	PaymentMethod string                     `json:"payment_method"`
+	PaymentDueAt  *time.Time                 `json:"payment_due_at"`
+	ShippingType  string                     `json:"shipping_type"`
+	ShippingFee   int64                      `json:"shipping_fee"`
+	OrderTime     string                     `json:"order_time"`
+	Remarks       string                     `json:"remarks"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	OrderItems    []OrderItemEntity          `json:"order_items"`
+	StatusHistory []OrderStatusHistoryEntity `json:"status_history"`
+	BuyerName     string                     `json:"buyer_name"`
+	BuyerEmail    string                     `json:"buyer_email"`
+	BuyerPhone    string                     `json:"buyer_phone"`
+	BuyerAddress  string                     `json:"buyer_address"`
+	BuyerLat      string                     `json:"buyer_lat"`
+	BuyerLng      string                     `json:"buyer_lng"`
 }
 
+// QueryStringEntity filters order lists. From and To bound the order date
+// (To exclusive); zero leaves that end open.
 type QueryStringEntity struct {
-	Page    int64
-	Search  string
-	Limit   int64
-	Status  string
-	BuyerID int64
+	Page          int64
+	Search        string
+	Limit         int64
+	Status        string
+	BuyerID       int64
+	From          time.Time
+	To            time.Time
+	PaymentMethod string
+	ShippingType  string
 }
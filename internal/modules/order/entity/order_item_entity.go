@@ -4,6 +4,7 @@ type OrderItemEntity struct {
 	ID            int64  `json:"id"`
 	OrderID       int64  `json:"order_id"`
 	ProductID     int64  `json:"product_id"`
+	VariantID     int64  `json:"variant_id"`
 	Quantity      int64  `json:"quantity"`
 	OrderCode     string `json:"order_code"`
 	ProductName   string `json:"product_name"`
@@ -16,6 +17,15 @@ type OrderItemEntity struct {
 	SKU           string `json:"sku"`
 }
 
+// StockProductID is the product row whose stock the item takes: its
+// variant, or the product itself.
+func (i OrderItemEntity) StockProductID() int64 {
+	if i.VariantID != 0 {
+		return i.VariantID
+	}
+	return i.ProductID
+}
+
 type PublishOrderItemEntity struct {
 	ProductID int64 `json:"product_id"`
 	Quantity  int64 `json:"quantity"`
@@ -0,0 +1,37 @@
+package entity
+
+// OrderPricing is the server-side price breakdown of an order. Amounts are
+// in rupiah.
+type OrderPricing struct {
+	Lines       []OrderPricingLine `json:"lines"`
+	Subtotal    int64              `json:"subtotal"`
+	Discount    int64              `json:"discount"`
+	ShippingFee int64              `json:"shipping_fee"`
+	GrandTotal  int64              `json:"grand_total"`
+}
+
+// OrderPricingLine prices one order item. VariantID is the product row the
+// price (and stock) comes from. RegularPrice and UnitPrice are per unit;
+// the difference, times Quantity, counts towards the discount.
+type OrderPricingLine struct {
+	ProductID    int64  `json:"product_id"`
+	VariantID    int64  `json:"variant_id"`
+	SKU          string `json:"sku"`
+	Size         string `json:"size"`
+	Color        string `json:"color"`
+	Quantity     int64  `json:"quantity"`
+	RegularPrice int64  `json:"regular_price"`
+	UnitPrice    int64  `json:"unit_price"`
+	LineTotal    int64  `json:"line_total"`
+}
+
+// ShippingQuote is what sending an order's items with ShippingType costs.
+// Types that can't reach the buyer are not Available, and Reason says why.
+type ShippingQuote struct {
+	ShippingType string  `json:"shipping_type"`
+	WeightGrams  int64   `json:"weight_grams"`
+	DistanceKm   float64 `json:"distance_km"`
+	Fee          int64   `json:"fee"`
+	Available    bool    `json:"available"`
+	Reason       string  `json:"reason,omitempty"`
+}
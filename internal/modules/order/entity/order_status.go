@@ -0,0 +1,83 @@
+package entity
+
+import "time"
+
+const (
+	OrderStatusPending          = "Pending"
+	OrderStatusPaid             = "Paid"
+	OrderStatusProcessing       = "Processing"
+	OrderStatusShipped          = "Shipped"
+	OrderStatusPartiallyShipped = "Partially Shipped"
+	OrderStatusDelivered        = "Delivered"
+	OrderStatusCancelled        = "Cancelled"
+	OrderStatusRefunded         = "Refunded"
+	OrderStatusExpired          = "Expired"
+)
+
+// orderStatusTransitions lists the statuses each status may move to. An
+// order whose items go out in several shipments is Partially Shipped until
+// the last one leaves. Delivered and cancelled orders can still be
+// refunded, as can expired ones whose payment arrived late; Refunded is
+// final.
+var orderStatusTransitions = map[string][]string{
+	OrderStatusPending:          {OrderStatusPaid, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusPaid:             {OrderStatusProcessing, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusProcessing:       {OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusPartiallyShipped: {OrderStatusShipped},
+	OrderStatusShipped:          {OrderStatusDelivered},
+	OrderStatusDelivered:        {OrderStatusRefunded},
+	OrderStatusCancelled:        {OrderStatusRefunded},
+	OrderStatusExpired:          {OrderStatusRefunded},
+}
+
+// legacyOrderStatuses maps statuses written before the lifecycle was
+// enforced to their current equivalent.
+var legacyOrderStatuses = map[string]string{
+	"pending":   OrderStatusPending,
+	"Confirmed": OrderStatusPaid,
+	"Process":   OrderStatusProcessing,
+	"Sending":   OrderStatusShipped,
+	"Done":      OrderStatusDelivered,
+}
+
+// NormalizeOrderStatus returns the current name of a stored status.
+func NormalizeOrderStatus(status string) string {
+	if current, ok := legacyOrderStatuses[status]; ok {
+		return current
+	}
+	return status
+}
+
+// CanTransitionOrderStatus reports whether an order in status from may be
+// moved to status to.
+func CanTransitionOrderStatus(from, to string) bool {
+	for _, next := range orderStatusTransitions[NormalizeOrderStatus(from)] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderActor is who changed an order's status. System changes (payment
+// callbacks, scheduled jobs) have no ID.
+type OrderActor struct {
+	ID   int64
+	Role string
+}
+
+// OrderActorCustomer is the role of buyers acting on their own orders.
+const OrderActorCustomer = "Customer"
+
+var SystemActor = OrderActor{Role: "System"}
+
+type OrderStatusHistoryEntity struct {
+	ID             int64     `json:"id"`
+	OrderID        int64     `json:"order_id"`
+	PreviousStatus string    `json:"previous_status"`
+	Status         string    `json:"status"`
+	ActorID        int64     `json:"actor_id"`
+	ActorRole      string    `json:"actor_role"`
+	Remarks        string    `json:"remarks"`
+	CreatedAt      time.Time `json:"created_at"`
+}
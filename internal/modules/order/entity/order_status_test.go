@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransitionOrderStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{OrderStatusPending, OrderStatusPaid, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusDelivered, false},
+		{OrderStatusPaid, OrderStatusProcessing, true},
+		{OrderStatusProcessing, OrderStatusShipped, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusPaid, OrderStatusShipped, true},
+		{OrderStatusProcessing, OrderStatusPartiallyShipped, true},
+		{OrderStatusPartiallyShipped, OrderStatusShipped, true},
+		{OrderStatusPartiallyShipped, OrderStatusCancelled, false},
+		{OrderStatusPartiallyShipped, OrderStatusDelivered, false},
+		{OrderStatusDelivered, OrderStatusPending, false},
+		{OrderStatusDelivered, OrderStatusRefunded, true},
+		{OrderStatusCancelled, OrderStatusRefunded, true},
+		{OrderStatusPending, OrderStatusExpired, true},
+		{OrderStatusPaid, OrderStatusExpired, false},
+		{OrderStatusExpired, OrderStatusPaid, false},
+		{OrderStatusRefunded, OrderStatusPaid, false},
+		{OrderStatusPaid, "Teleported", false},
+		// Statuses stored before the lifecycle existed keep working.
+		{"Confirmed", OrderStatusProcessing, true},
+		{"Sending", OrderStatusDelivered, true},
+		{"pending", OrderStatusPaid, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CanTransitionOrderStatus(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
@@ -0,0 +1,42 @@
+package entity
+
+import "time"
+
+type ShipmentEntity struct {
+	ID             int64                         `json:"id"`
+	OrderID        int64                         `json:"order_id"`
+	Courier        string                        `json:"courier"`
+	TrackingNumber string                        `json:"tracking_number"`
+	TrackingURL    string                        `json:"tracking_url"`
+	Provider       string                        `json:"provider"`
+	Service        string                        `json:"service"`
+	Status         string                        `json:"status"`
+	CreatedBy      int64                         `json:"created_by"`
+	ShippedAt      time.Time                     `json:"shipped_at"`
+	DeliveredAt    *time.Time                    `json:"delivered_at"`
+	Items          []ShipmentItemEntity          `json:"items"`
+	Events         []ShipmentTrackingEventEntity `json:"events"`
+}
+
+type ShipmentItemEntity struct {
+	ID          int64 `json:"id"`
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+}
+
+type ShipmentTrackingEventEntity struct {
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// CourierRate is what a courier integration charges to send a parcel with
+// one of its services.
+type CourierRate struct {
+	Provider string `json:"provider"`
+	Courier  string `json:"courier"`
+	Service  string `json:"service"`
+	Fee      int64  `json:"fee"`
+	EtaDays  int    `json:"eta_days"`
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"tofash/internal/modules/order/entity"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// WriteOrder implements Writer. Each order is flushed so rows reach the
+// client as they are written.
+func (c *csvWriter) WriteOrder(order entity.OrderEntity) error {
+	records := rows(order)
+	for _, record := range records {
+		for i, value := range record {
+			if !columns[i].numeric {
+				record[i] = defuseFormula(value)
+			}
+		}
+	}
+	return c.w.WriteAll(records)
+}
+
+// Close implements Writer.
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// defuseFormula keeps spreadsheet apps from running text a buyer typed,
+// such as their name, as a formula.
+func defuseFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func newCSVWriter(w io.Writer) (Writer, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	if err := c.w.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
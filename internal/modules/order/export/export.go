@@ -0,0 +1,124 @@
+package export
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"tofash/internal/modules/order/document"
+	"tofash/internal/modules/order/entity"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ErrUnknownFormat is returned for an export format other than csv or xlsx.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes orders to a spreadsheet, one row per order item, as they
+// arrive. Close finishes the file; nothing is complete before it.
+type Writer interface {
+	WriteOrder(order entity.OrderEntity) error
+	Close() error
+}
+
+// NewWriter starts an export in format on w, writing the header row.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType is the MIME type of format.
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// column is one spreadsheet column. Numeric columns are written as numbers
+// in XLSX so they can be summed.
+type column struct {
+	name    string
+	numeric bool
+}
+
+var columns = []column{
+	{"order_code", false},
+	{"order_date", false},
+	{"status", false},
+	{"payment_status", false},
+	{"payment_method", false},
+	{"shipping_type", false},
+	{"buyer_id", true},
+	{"buyer_name", false},
+	{"buyer_email", false},
+	{"buyer_phone", false},
+	{"buyer_address", false},
+	{"subtotal", true},
+	{"discount", true},
+	{"shipping_fee", true},
+	{"total_amount", true},
+	{"order_item_id", true},
+	{"product_id", true},
+	{"variant_id", true},
+	{"product_name", false},
+	{"sku", false},
+	{"size", false},
+	{"color", false},
+	{"quantity", true},
+	{"price", true},
+	{"line_total", true},
+}
+
+// rows flattens order into one row per item, in columns order. An order
+// without items still gets a row, with the item columns empty.
+func rows(order entity.OrderEntity) [][]string {
+	head := []string{
+		order.OrderCode,
+		order.OrderDate,
+		order.Status,
+		document.PaymentStatus(order.Status),
+		order.PaymentMethod,
+		order.ShippingType,
+		strconv.FormatInt(order.BuyerId, 10),
+		order.BuyerName,
+		order.BuyerEmail,
+		order.BuyerPhone,
+		order.BuyerAddress,
+		strconv.FormatInt(order.Subtotal, 10),
+		strconv.FormatInt(order.Discount, 10),
+		strconv.FormatInt(order.ShippingFee, 10),
+		strconv.FormatInt(order.TotalAmount, 10),
+	}
+
+	if len(order.OrderItems) == 0 {
+		return [][]string{append(head, make([]string, len(columns)-len(head))...)}
+	}
+
+	result := make([][]string, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		row := append(append([]string{}, head...),
+			strconv.FormatInt(item.ID, 10),
+			strconv.FormatInt(item.ProductID, 10),
+			strconv.FormatInt(item.VariantID, 10),
+			item.ProductName,
+			item.SKU,
+			item.Size,
+			item.Color,
+			strconv.FormatInt(item.Quantity, 10),
+			strconv.FormatInt(item.Price, 10),
+			strconv.FormatInt(item.Price*item.Quantity, 10),
+		)
+		result = append(result, row)
+	}
+	return result
+}
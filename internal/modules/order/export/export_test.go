@@ -0,0 +1,101 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"tofash/internal/modules/order/entity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exportOrders = []entity.OrderEntity{
+	{
+		OrderCode: "ORD-001", Status: entity.OrderStatusPaid, BuyerId: 10, BuyerName: "=HYPERLINK(\"x\")",
+		TotalAmount: 207000,
+		OrderItems: []entity.OrderItemEntity{
+			{ID: 1, ProductID: 5, SKU: "LS-M", Quantity: 2, Price: 100000},
+			{ID: 2, ProductID: 6, SKU: "CAP <L>", Quantity: 1, Price: 7000},
+		},
+	},
+	{OrderCode: "ORD-002", Status: entity.OrderStatusPending, BuyerId: 11},
+}
+
+func TestCSVWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w, err := NewWriter(FormatCSV, out)
+	assert.NoError(t, err)
+	for _, order := range exportOrders {
+		assert.NoError(t, w.WriteOrder(order))
+	}
+	assert.NoError(t, w.Close())
+
+	records, err := csv.NewReader(out).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 4) {
+		assert.Equal(t, "order_code", records[0][0])
+		assert.Equal(t, []string{"ORD-001", "Paid", "'=HYPERLINK(\"x\")", "LS-M", "200000"},
+			[]string{records[1][0], records[1][3], records[1][7], records[1][19], records[1][24]})
+		assert.Equal(t, "CAP <L>", records[2][19])
+		assert.Equal(t, []string{"ORD-002", "Unpaid", ""}, []string{records[3][0], records[3][3], records[3][19]})
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w, err := NewWriter(FormatXLSX, out)
+	assert.NoError(t, err)
+	for _, order := range exportOrders {
+		assert.NoError(t, w.WriteOrder(order))
+	}
+	assert.NoError(t, w.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+	parts := map[string][]byte{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		parts[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	assert.Contains(t, parts, "[Content_Types].xml")
+	assert.Contains(t, parts, "xl/workbook.xml")
+
+	sheet := struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}{}
+	assert.NoError(t, xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet))
+	if assert.Len(t, sheet.Rows, 4) {
+		assert.Equal(t, "A1", sheet.Rows[0].Cells[0].Ref)
+		assert.Equal(t, "order_code", sheet.Rows[0].Cells[0].Inline)
+
+		cells := map[string]string{}
+		for _, cell := range sheet.Rows[2].Cells {
+			cells[cell.Ref] = cell.Value + cell.Inline
+		}
+		assert.Equal(t, "CAP <L>", cells["T3"])
+		assert.Equal(t, "7000", cells["Y3"])
+	}
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter("pdf", io.Discard)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Y", columnName(24))
+	assert.Equal(t, "AA", columnName(26))
+}
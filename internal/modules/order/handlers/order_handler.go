@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/export"
 	"tofash/internal/modules/order/handlers/request"
 	"tofash/internal/modules/order/handlers/response"
 	"tofash/internal/modules/order/service"
+	"tofash/internal/modules/order/shipping"
 	"tofash/internal/modules/order/utils/conv"
 
 	"github.com/labstack/echo/v4"
@@ -15,11 +20,16 @@ import (
 
 type OrderHandlerInterface interface {
 	GetAllAdmin(c echo.Context) error
+	ExportAdmin(c echo.Context) error
 	GetByIDAdmin(c echo.Context) error
 	CreateOrder(c echo.Context) error
 	UpdateStatus(c echo.Context) error
+	CancelOrder(c echo.Context) error
+	CancelOrderAdmin(c echo.Context) error
 	GetAllCustomer(c echo.Context) error
 	GetDetailCustomer(c echo.Context) error
+	Invoice(c echo.Context) error
+	PackingSlip(c echo.Context) error
 	DeleteByID(c echo.Context) error
 	GetOrderByOrderCode(c echo.Context) error
 	GetPublicOrderByOrderCode(c echo.Context) error
@@ -80,6 +90,8 @@ func (o *orderHandler) GetOrderByOrderCode(c echo.Context) error {
 	respOrder.Status = order.Status
 	respOrder.TotalAmount = order.TotalAmount
 	respOrder.OrderDatetime = order.OrderDate
+	respOrder.Subtotal = order.Subtotal
+	respOrder.Discount = order.Discount
 	respOrder.ShippingFee = order.ShippingFee
 	respOrder.Remarks = order.Remarks
 	respOrder.PaymentMethod = order.PaymentMethod
@@ -167,6 +179,8 @@ func (o *orderHandler) GetDetailCustomer(c echo.Context) error {
 	respOrder.Status = order.Status
 	respOrder.TotalAmount = order.TotalAmount
 	respOrder.OrderDatetime = order.OrderDate
+	respOrder.Subtotal = order.Subtotal
+	respOrder.Discount = order.Discount
 	respOrder.ShippingFee = order.ShippingFee
 	respOrder.ShippingType = order.ShippingType
 	respOrder.Remarks = order.Remarks
@@ -190,9 +204,164 @@ func (o *orderHandler) GetDetailCustomer(c echo.Context) error {
 		})
 	}
 
+	respOrder.StatusHistory = toStatusHistoryResponse(order.StatusHistory)
+
 	return c.JSON(http.StatusOK, response.ResponseSuccess("success", respOrder))
 }
 
+// Invoice implements OrderHandlerInterface. Buyers download the invoice
+// of one of their orders as a PDF.
+func (o *orderHandler) Invoice(c echo.Context) error {
+	var (
+		ctx         = c.Request().Context()
+		jwtUserData = entity.JwtUserData{}
+	)
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		log.Errorf("[OrderHandler-1] Invoice: %s", "data token not found")
+		return c.JSON(http.StatusUnauthorized, response.ResponseError("data token not found"))
+	}
+
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		log.Errorf("[OrderHandler-2] Invoice: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[OrderHandler-3] Invoice: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	invoice, err := o.orderService.Invoice(ctx, orderID, jwtUserData.UserID)
+	if err != nil {
+		log.Errorf("[OrderHandler-4] Invoice: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return sendDocument(c, invoice)
+}
+
+// PackingSlip implements OrderHandlerInterface.
+func (o *orderHandler) PackingSlip(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[OrderHandler-1] PackingSlip: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[OrderHandler-2] PackingSlip: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	slip, err := o.orderService.PackingSlip(ctx, orderID)
+	if err != nil {
+		log.Errorf("[OrderHandler-3] PackingSlip: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return sendDocument(c, slip)
+}
+
+// ExportAdmin implements OrderHandlerInterface. It streams the orders
+// matching the orderFilters as CSV or, with format=xlsx, a spreadsheet.
+func (o *orderHandler) ExportAdmin(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[OrderHandler-1] ExportAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		log.Errorf("[OrderHandler-2] ExportAdmin: %v", export.ErrUnknownFormat)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("format must be csv or xlsx"))
+	}
+
+	reqEntity, err := orderFilters(c)
+	if err != nil {
+		log.Errorf("[OrderHandler-3] ExportAdmin: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("orders-%s.%s", time.Now().Format("20060102"), format)))
+	res.WriteHeader(http.StatusOK)
+
+	// The status line is out, so from here failures can only cut the file
+	// short.
+	writer, err := export.NewWriter(format, res)
+	if err != nil {
+		log.Errorf("[OrderHandler-5] ExportAdmin: %v", err)
+		return nil
+	}
+
+	err = o.orderService.ExportOrders(ctx, reqEntity, func(order entity.OrderEntity) error {
+		if err := writer.WriteOrder(order); err != nil {
+			return err
+		}
+		_ = http.NewResponseController(res).Flush()
+		return nil
+	})
+	if err != nil {
+		log.Errorf("[OrderHandler-6] ExportAdmin: %v", err)
+		return nil
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Errorf("[OrderHandler-7] ExportAdmin: %v", err)
+	}
+	return nil
+}
+
+// orderFilters reads the admin order filters: status, search,
+// payment_method, shipping_type and the order date range from-to
+// (YYYY-MM-DD, both inclusive).
+func orderFilters(c echo.Context) (entity.QueryStringEntity, error) {
+	reqEntity := entity.QueryStringEntity{
+		Search:        c.QueryParam("search"),
+		Status:        c.QueryParam("status"),
+		PaymentMethod: c.QueryParam("payment_method"),
+		ShippingType:  c.QueryParam("shipping_type"),
+	}
+	if from := c.QueryParam("from"); from != "" {
+		date, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return reqEntity, errors.New("from must be YYYY-MM-DD")
+		}
+		reqEntity.From = date
+	}
+	if to := c.QueryParam("to"); to != "" {
+		date, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return reqEntity, errors.New("to must be YYYY-MM-DD")
+		}
+		reqEntity.To = date.AddDate(0, 0, 1)
+	}
+	return reqEntity, nil
+}
+
+// sendDocument serves doc for viewing in the browser, named for saving.
+func sendDocument(c echo.Context, doc *entity.OrderDocument) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", doc.Filename))
+	return c.Blob(http.StatusOK, doc.ContentType, doc.Content)
+}
+
 // GetAllCustomer implements OrderHandlerInterface.
 func (o *orderHandler) GetAllCustomer(c echo.Context) error {
 	var (
@@ -279,6 +448,12 @@ func (o *orderHandler) UpdateStatus(c echo.Context) error {
 		req = request.OrderUpdateStatusRequest{}
 	)
 
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[OrderHandler-1] UpdateStatus: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
 	if err := c.Bind(&req); err != nil {
 		log.Errorf("[OrderHandler-2] UpdateStatus: %v", err)
 		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
@@ -307,7 +482,10 @@ func (o *orderHandler) UpdateStatus(c echo.Context) error {
 		ID:      orderID,
 	}
 
-	err = o.orderService.UpdateStatus(ctx, reqEntity)
+	err = o.orderService.UpdateStatus(ctx, reqEntity, entity.OrderActor{
+		ID:   jwtUserData.UserID,
+		Role: jwtUserData.RoleName,
+	})
 	if err != nil {
 		log.Errorf("[OrderHandler-6] UpdateStatus: %v", err)
 		if err.Error() == "404" {
@@ -323,6 +501,68 @@ func (o *orderHandler) UpdateStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
 }
 
+// CancelOrder implements OrderHandlerInterface. Customers cancel their own
+// orders.
+func (o *orderHandler) CancelOrder(c echo.Context) error {
+	jwtUserData := entity.JwtUserData{}
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		log.Errorf("[OrderHandler-1] CancelOrder: %s", "data token not found")
+		return c.JSON(http.StatusUnauthorized, response.ResponseError("data token not found"))
+	}
+
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		log.Errorf("[OrderHandler-2] CancelOrder: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	return o.cancel(c, entity.OrderActor{ID: jwtUserData.UserID, Role: entity.OrderActorCustomer})
+}
+
+// CancelOrderAdmin implements OrderHandlerInterface.
+func (o *orderHandler) CancelOrderAdmin(c echo.Context) error {
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[OrderHandler-1] CancelOrderAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	return o.cancel(c, entity.OrderActor{ID: jwtUserData.UserID, Role: jwtUserData.RoleName})
+}
+
+func (o *orderHandler) cancel(c echo.Context, actor entity.OrderActor) error {
+	var (
+		ctx = c.Request().Context()
+		req = request.OrderCancelRequest{}
+	)
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[OrderHandler-3] CancelOrder: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[OrderHandler-4] CancelOrder: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	err = o.orderService.CancelOrder(ctx, orderID, req.Reason, actor)
+	if err != nil {
+		log.Errorf("[OrderHandler-5] CancelOrder: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		if err.Error() == "400" {
+			return c.JSON(http.StatusConflict, response.ResponseError("order can no longer be cancelled"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
+}
+
 // GetAllAdmin implements OrderHandlerInterface.
 func (o *orderHandler) CreateOrder(c echo.Context) error {
 	var (
@@ -365,6 +605,23 @@ func (o *orderHandler) CreateOrder(c echo.Context) error {
 	orderID, err := o.orderService.CreateOrder(ctx, reqEntity)
 	if err != nil {
 		log.Errorf("[OrderHandler-4] CreateOrder: %v", err)
+		var mismatch *service.PriceMismatchError
+		if errors.As(err, &mismatch) {
+			return c.JSON(http.StatusConflict, response.DefaultResponse{
+				Message: "total amount does not match the order price",
+				Data:    mismatch.Pricing,
+			})
+		}
+		var outOfStock *service.InsufficientStockError
+		if errors.As(err, &outOfStock) {
+			return c.JSON(http.StatusConflict, response.ResponseError(outOfStock.Error()))
+		}
+		if errors.Is(err, shipping.ErrNoDestination) || errors.Is(err, shipping.ErrOutOfRange) {
+			return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+		}
+		if err.Error() == "400" {
+			return c.JSON(http.StatusBadRequest, response.ResponseError("order contains an unknown product or variant"))
+		}
 		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
 	}
 
@@ -380,6 +637,11 @@ func (o *orderHandler) GetByIDAdmin(c echo.Context) error {
 		respOrder = response.OrderAdminDetail{}
 	)
 
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[OrderHandler-1] GetByIDAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
 	orderIDStr := c.Param("orderID")
 	if orderIDStr == "" {
 		log.Errorf("[OrderHandler-2] GetByIDAdmin: %s", "orderID not found")
@@ -406,6 +668,8 @@ func (o *orderHandler) GetByIDAdmin(c echo.Context) error {
 	respOrder.Status = order.Status
 	respOrder.TotalAmount = order.TotalAmount
 	respOrder.OrderDatetime = order.OrderDate
+	respOrder.Subtotal = order.Subtotal
+	respOrder.Discount = order.Discount
 	respOrder.ShippingFee = order.ShippingFee
 	respOrder.Remarks = order.Remarks
 	respOrder.Customer = response.CustomerOrder{
@@ -428,6 +692,8 @@ func (o *orderHandler) GetByIDAdmin(c echo.Context) error {
 		})
 	}
 
+	respOrder.StatusHistory = toStatusHistoryResponse(order.StatusHistory)
+
 	return c.JSON(http.StatusOK, response.ResponseSuccess("success", respOrder))
 }
 
@@ -438,7 +704,17 @@ func (o *orderHandler) GetAllAdmin(c echo.Context) error {
 		respOrders = []response.OrderAdminList{}
 	)
 
-	search := c.QueryParam("search")
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[OrderHandler-1] GetAllAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	reqEntity, err := orderFilters(c)
+	if err != nil {
+		log.Errorf("[OrderHandler-2] GetAllAdmin: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
 	var page int64 = 1
 	if pageStr := c.QueryParam("page"); pageStr != "" {
 		page, _ = conv.StringToInt64(pageStr)
@@ -455,17 +731,8 @@ func (o *orderHandler) GetAllAdmin(c echo.Context) error {
 		}
 	}
 
-	status := ""
-	if statusStr := c.QueryParam("status"); statusStr != "" {
-		status = statusStr
-	}
-
-	reqEntity := entity.QueryStringEntity{
-		Search: search,
-		Status: status,
-		Page:   page,
-		Limit:  perPage,
-	}
+	reqEntity.Page = page
+	reqEntity.Limit = perPage
 
 	results, totalData, totalPage, err := o.orderService.GetAll(ctx, reqEntity)
 	if err != nil {
@@ -495,6 +762,42 @@ func (o *orderHandler) GetAllAdmin(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.ResponseSuccessWithPagination("success", respOrders, page, totalData, totalPage, perPage))
 }
 
+func toStatusHistoryResponse(history []entity.OrderStatusHistoryEntity) []response.OrderStatusHistory {
+	resp := []response.OrderStatusHistory{}
+	for _, h := range history {
+		resp = append(resp, response.OrderStatusHistory{
+			PreviousStatus: h.PreviousStatus,
+			Status:         h.Status,
+			ActorID:        h.ActorID,
+			ActorRole:      h.ActorRole,
+			Remarks:        h.Remarks,
+			CreatedAt:      h.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return resp
+}
+
+// adminUser returns the caller's token data, rejecting customers; the admin
+// group only checks that the caller is logged in.
+func adminUser(c echo.Context) (entity.JwtUserData, error) {
+	jwtUserData := entity.JwtUserData{}
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		return jwtUserData, errors.New("data token not found")
+	}
+
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		return jwtUserData, err
+	}
+
+	if jwtUserData.RoleName == "" || jwtUserData.RoleName == "Customer" {
+		return jwtUserData, errors.New("customer cannot access admin routes")
+	}
+
+	return jwtUserData, nil
+}
+
 func NewOrderHandler(orderService service.OrderServiceInterface) OrderHandlerInterface {
 	return &orderHandler{orderService: orderService}
 }
@@ -23,3 +23,26 @@ type OrderUpdateStatusRequest struct {
 	Status  string `json:"status" validate:"required"`
 	Remarks string `json:"remarks"`
 }
+
+type OrderCancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+type CreateShipmentRequest struct {
+	Courier        string                      `json:"courier" validate:"required"`
+	TrackingNumber string                      `json:"tracking_number" validate:"required"`
+	TrackingURL    string                      `json:"tracking_url"`
+	Items          []CreateShipmentItemRequest `json:"items" validate:"dive"`
+}
+
+type CreateShipmentItemRequest struct {
+	OrderItemID int64 `json:"order_item_id" validate:"required"`
+	Quantity    int64 `json:"quantity" validate:"required"`
+}
+
+type BookShipmentRequest struct {
+	Provider    string                      `json:"provider" validate:"required"`
+	Service     string                      `json:"service" validate:"required"`
+	WeightGrams int64                       `json:"weight_grams" validate:"required,gt=0"`
+	Items       []CreateShipmentItemRequest `json:"items" validate:"dive"`
+}
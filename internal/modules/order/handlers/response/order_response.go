@@ -11,18 +11,21 @@ type OrderAdminList struct {
 }
 
 type OrderAdminDetail struct {
-	ID            int64         `json:"id"`
-	OrderCode     string        `json:"order_code"`
-	ProductImage  string        `json:"product_image"`
-	OrderDatetime string        `json:"order_datetime"`
-	Status        string        `json:"order_status"`
-	PaymentMethod string        `json:"payment_method"`
-	ShippingFee   int64         `json:"shipping_fee"`
-	ShippingType  string        `json:"shipping_type"`
-	Remarks       string        `json:"remarks"`
-	TotalAmount   int64         `json:"total_amount"`
-	Customer      CustomerOrder `json:"customer"`
-	OrderDetail   []OrderDetail `json:"order_detail"`
+	ID            int64                `json:"id"`
+	OrderCode     string               `json:"order_code"`
+	ProductImage  string               `json:"product_image"`
+	OrderDatetime string               `json:"order_datetime"`
+	Status        string               `json:"order_status"`
+	PaymentMethod string               `json:"payment_method"`
+	Subtotal      int64                `json:"subtotal"`
+	Discount      int64                `json:"discount"`
+	ShippingFee   int64                `json:"shipping_fee"`
+	ShippingType  string               `json:"shipping_type"`
+	Remarks       string               `json:"remarks"`
+	TotalAmount   int64                `json:"total_amount"`
+	Customer      CustomerOrder        `json:"customer"`
+	OrderDetail   []OrderDetail        `json:"order_detail"`
+	StatusHistory []OrderStatusHistory `json:"status_history"`
 }
 
 type OrderCustomerList struct {
@@ -56,3 +59,37 @@ type OrderDetail struct {
 	Color        string `json:"color"`
 	SKU          string `json:"sku"`
 }
+
+type OrderStatusHistory struct {
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+	ActorID        int64  `json:"actor_id"`
+	ActorRole      string `json:"actor_role"`
+	Remarks        string `json:"remarks"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type Shipment struct {
+	ID             int64                   `json:"id"`
+	Courier        string                  `json:"courier"`
+	Service        string                  `json:"service"`
+	TrackingNumber string                  `json:"tracking_number"`
+	TrackingURL    string                  `json:"tracking_url"`
+	Status         string                  `json:"status"`
+	ShippedAt      string                  `json:"shipped_at"`
+	DeliveredAt    string                  `json:"delivered_at,omitempty"`
+	Items          []ShipmentItem          `json:"items"`
+	Events         []ShipmentTrackingEvent `json:"events"`
+}
+
+type ShipmentItem struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+}
+
+type ShipmentTrackingEvent struct {
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	OccurredAt  string `json:"occurred_at"`
+}
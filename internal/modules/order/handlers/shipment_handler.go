@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/handlers/request"
+	"tofash/internal/modules/order/handlers/response"
+	"tofash/internal/modules/order/service"
+	"tofash/internal/modules/order/shipping"
+	"tofash/internal/modules/order/utils/conv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type ShipmentHandlerInterface interface {
+	CreateShipment(c echo.Context) error
+	BookShipment(c echo.Context) error
+	CourierRates(c echo.Context) error
+	TrackShipment(c echo.Context) error
+	TrackingWebhook(c echo.Context) error
+	GetByOrderIDAdmin(c echo.Context) error
+	GetByOrderIDCustomer(c echo.Context) error
+}
+
+// maxWebhookBody caps how much of a tracking webhook's body is read.
+const maxWebhookBody = 1 << 20
+
+type shipmentHandler struct {
+	shipmentService service.ShipmentServiceInterface
+}
+
+// CreateShipment implements ShipmentHandlerInterface. Leaving items out
+// ships everything not yet shipped.
+func (s *shipmentHandler) CreateShipment(c echo.Context) error {
+	var (
+		ctx = c.Request().Context()
+		req = request.CreateShipmentRequest{}
+	)
+
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-1] CreateShipment: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[ShipmentHandler-2] CreateShipment: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Validate(&req); err != nil {
+		log.Errorf("[ShipmentHandler-3] CreateShipment: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-4] CreateShipment: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	reqEntity := entity.ShipmentEntity{
+		OrderID:        orderID,
+		Courier:        req.Courier,
+		TrackingNumber: req.TrackingNumber,
+		TrackingURL:    req.TrackingURL,
+	}
+	for _, item := range req.Items {
+		reqEntity.Items = append(reqEntity.Items, entity.ShipmentItemEntity{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	shipment, err := s.shipmentService.CreateShipment(ctx, reqEntity, entity.OrderActor{
+		ID:   jwtUserData.UserID,
+		Role: jwtUserData.RoleName,
+	})
+	if err != nil {
+		log.Errorf("[ShipmentHandler-5] CreateShipment: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		if err.Error() == "400" {
+			return c.JSON(http.StatusBadRequest, response.ResponseError("order or items cannot be shipped"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusCreated, response.ResponseSuccess("success", toShipmentResponse(*shipment)))
+}
+
+// BookShipment implements ShipmentHandlerInterface. It books the parcel
+// with a courier integration instead of taking the tracking number.
+func (s *shipmentHandler) BookShipment(c echo.Context) error {
+	var (
+		ctx = c.Request().Context()
+		req = request.BookShipmentRequest{}
+	)
+
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-1] BookShipment: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[ShipmentHandler-2] BookShipment: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Validate(&req); err != nil {
+		log.Errorf("[ShipmentHandler-3] BookShipment: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-4] BookShipment: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	reqEntity := entity.ShipmentEntity{
+		OrderID:  orderID,
+		Provider: req.Provider,
+		Service:  req.Service,
+	}
+	for _, item := range req.Items {
+		reqEntity.Items = append(reqEntity.Items, entity.ShipmentItemEntity{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	shipment, err := s.shipmentService.BookShipment(ctx, reqEntity, req.WeightGrams, entity.OrderActor{
+		ID:   jwtUserData.UserID,
+		Role: jwtUserData.RoleName,
+	})
+	if err != nil {
+		log.Errorf("[ShipmentHandler-5] BookShipment: %v", err)
+		if errors.Is(err, shipping.ErrUnknownProvider) {
+			return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+		}
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		if err.Error() == "400" {
+			return c.JSON(http.StatusBadRequest, response.ResponseError("order or items cannot be shipped"))
+		}
+		return c.JSON(http.StatusBadGateway, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusCreated, response.ResponseSuccess("success", toShipmentResponse(*shipment)))
+}
+
+// CourierRates implements ShipmentHandlerInterface. weight_grams is the
+// packed parcel's weight.
+func (s *shipmentHandler) CourierRates(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[ShipmentHandler-1] CourierRates: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-2] CourierRates: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	weightGrams, err := conv.StringToInt64(c.QueryParam("weight_grams"))
+	if err != nil || weightGrams <= 0 {
+		log.Errorf("[ShipmentHandler-3] CourierRates: %s", "invalid weight_grams")
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid weight_grams"))
+	}
+
+	rates, err := s.shipmentService.CourierRates(ctx, orderID, weightGrams)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-4] CourierRates: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", rates))
+}
+
+// TrackShipment implements ShipmentHandlerInterface.
+func (s *shipmentHandler) TrackShipment(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[ShipmentHandler-1] TrackShipment: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	shipmentID, err := conv.StringToInt64(c.Param("shipmentID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-2] TrackShipment: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid shipmentID"))
+	}
+
+	shipment, err := s.shipmentService.TrackShipment(ctx, shipmentID)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-3] TrackShipment: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		if err.Error() == "400" {
+			return c.JSON(http.StatusBadRequest, response.ResponseError("shipment was not booked with a courier integration"))
+		}
+		if errors.Is(err, shipping.ErrUnknownTrackingNumber) {
+			return c.JSON(http.StatusConflict, response.ResponseError("courier has no parcel with this tracking number"))
+		}
+		return c.JSON(http.StatusBadGateway, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", toShipmentResponse(*shipment)))
+}
+
+// TrackingWebhook implements ShipmentHandlerInterface. Couriers post
+// tracking updates here; the provider checks the call's signature.
+func (s *shipmentHandler) TrackingWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBody))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-1] TrackingWebhook: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	err = s.shipmentService.HandleTrackingWebhook(ctx, c.Param("provider"), c.Request().Header, body)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-2] TrackingWebhook: %v", err)
+		if errors.Is(err, shipping.ErrUnknownProvider) {
+			return c.JSON(http.StatusNotFound, response.ResponseError(err.Error()))
+		}
+		if errors.Is(err, shipping.ErrInvalidWebhook) {
+			return c.JSON(http.StatusUnauthorized, response.ResponseError(err.Error()))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
+}
+
+// GetByOrderIDAdmin implements ShipmentHandlerInterface.
+func (s *shipmentHandler) GetByOrderIDAdmin(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[ShipmentHandler-1] GetByOrderIDAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-2] GetByOrderIDAdmin: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	shipments, err := s.shipmentService.GetByOrderID(ctx, orderID)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-3] GetByOrderIDAdmin: %v", err)
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", toShipmentsResponse(shipments)))
+}
+
+// GetByOrderIDCustomer implements ShipmentHandlerInterface. Customers only
+// see shipments of their own orders.
+func (s *shipmentHandler) GetByOrderIDCustomer(c echo.Context) error {
+	var (
+		ctx         = c.Request().Context()
+		jwtUserData = entity.JwtUserData{}
+	)
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		log.Errorf("[ShipmentHandler-1] GetByOrderIDCustomer: %s", "data token not found")
+		return c.JSON(http.StatusUnauthorized, response.ResponseError("data token not found"))
+	}
+
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		log.Errorf("[ShipmentHandler-2] GetByOrderIDCustomer: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	orderID, err := conv.StringToInt64(c.Param("orderID"))
+	if err != nil {
+		log.Errorf("[ShipmentHandler-3] GetByOrderIDCustomer: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid orderID"))
+	}
+
+	shipments, err := s.shipmentService.GetByOrderIDCustomer(ctx, orderID, jwtUserData.UserID)
+	if err != nil {
+		log.Errorf("[ShipmentHandler-4] GetByOrderIDCustomer: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", toShipmentsResponse(shipments)))
+}
+
+func toShipmentsResponse(shipments []entity.ShipmentEntity) []response.Shipment {
+	resp := []response.Shipment{}
+	for _, shipment := range shipments {
+		resp = append(resp, toShipmentResponse(shipment))
+	}
+	return resp
+}
+
+func toShipmentResponse(shipment entity.ShipmentEntity) response.Shipment {
+	resp := response.Shipment{
+		ID:             shipment.ID,
+		Courier:        shipment.Courier,
+		Service:        shipment.Service,
+		TrackingNumber: shipment.TrackingNumber,
+		TrackingURL:    shipment.TrackingURL,
+		Status:         shipment.Status,
+		ShippedAt:      shipment.ShippedAt.Format("2006-01-02 15:04:05"),
+		Items:          []response.ShipmentItem{},
+		Events:         []response.ShipmentTrackingEvent{},
+	}
+	if shipment.DeliveredAt != nil {
+		resp.DeliveredAt = shipment.DeliveredAt.Format("2006-01-02 15:04:05")
+	}
+	for _, item := range shipment.Items {
+		resp.Items = append(resp.Items, response.ShipmentItem{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+	for _, event := range shipment.Events {
+		resp.Events = append(resp.Events, response.ShipmentTrackingEvent{
+			Status:      event.Status,
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.OccurredAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return resp
+}
+
+func NewShipmentHandler(shipmentService service.ShipmentServiceInterface) ShipmentHandlerInterface {
+	return &shipmentHandler{shipmentService: shipmentService}
+}
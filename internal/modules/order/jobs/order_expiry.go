@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+
+	notifService "tofash/internal/modules/notification/service"
+	"tofash/internal/modules/order/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/datatypes"
+)
+
+const TopicOrderExpiry = "order_expiry"
+
+// RegisterHandlers plugs the order module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, orderSvc service.OrderServiceInterface, notifSvc notifService.NotificationServiceInterface) {
+	r.Register(TopicOrderExpiry, func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		expired, err := orderSvc.ExpireOverdueOrders(ctx)
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			log.Infof("[OrderExpiryJob] Expired %d unpaid order(s)", expired)
+		}
+		return nil
+	})
+
+	registerInvoiceEmail(r, orderSvc, notifSvc)
+}
+
+// RegisterSchedules declares the order module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("* * * * *", TopicOrderExpiry, nil)
+}
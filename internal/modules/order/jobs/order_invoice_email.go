@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	notifEntity "tofash/internal/modules/notification/entity"
+	notifService "tofash/internal/modules/notification/service"
+	"tofash/internal/modules/order/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+)
+
+const TopicOrderInvoiceEmail = "order_invoice_email"
+
+// OrderInvoiceEmailPayload is the Paid status email. The invoice is
+// rendered when the job runs, so only the order ID is queued.
+type OrderInvoiceEmailPayload struct {
+	OrderID       int64  `json:"order_id"`
+	ReceiverEmail string `json:"receiver_email"`
+	ReceiverID    int64  `json:"receiver_id"`
+	Subject       string `json:"subject"`
+	Message       string `json:"message"`
+}
+
+func registerInvoiceEmail(r async.Registry, orderSvc service.OrderServiceInterface, notifSvc notifService.NotificationServiceInterface) {
+	r.Register(TopicOrderInvoiceEmail, async.Typed(func(ctx context.Context, jobID uint, data OrderInvoiceEmailPayload) error {
+		notif := notifEntity.NotificationEntity{
+			ReceiverEmail:    &data.ReceiverEmail,
+			Subject:          &data.Subject,
+			Message:          data.Message,
+			NotificationType: "EMAIL",
+			Status:           "PENDING",
+			ReceiverID:       uint(data.ReceiverID),
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
+			JobID:            jobID,
+		}
+
+		// The buyer still hears about the payment when the order is gone;
+		// anything else is retried.
+		invoice, err := orderSvc.Invoice(ctx, data.OrderID, data.ReceiverID)
+		switch {
+		case err == nil:
+			notif.Attachments = []notifEntity.Attachment{{
+				Filename:    invoice.Filename,
+				ContentType: invoice.ContentType,
+				Content:     invoice.Content,
+			}}
+		case err.Error() == "404":
+			log.Warnf("[OrderInvoiceEmailJob] Order %d not found, sending without invoice", data.OrderID)
+		default:
+			return err
+		}
+
+		return notifSvc.CreateAndSend(ctx, notif)
+	}))
+}
@@ -2,13 +2,13 @@ package adapter
 
 import (
 	"encoding/json"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"tofash/internal/config"
 	"tofash/internal/modules/order/entity"
 	"tofash/internal/modules/order/handlers/response"
+	"tofash/internal/modules/order/shipping"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
@@ -25,18 +25,7 @@ type middlewareAdapter struct {
 }
 
 func (m *middlewareAdapter) HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // radius bumi dalam kilometer
-
-	dLat := (lat2 - lat1) * (math.Pi / 180)
-	dLon := (lon2 - lon1) * (math.Pi / 180)
-
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*(math.Pi/180))*math.Cos(lat2*(math.Pi/180))*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return R * c //kilometer
+	return shipping.HaversineDistance(lat1, lon1, lat2, lon2)
 }
 
 // DistanceCheck implements MiddlewareAdapterInterface.
@@ -9,8 +9,10 @@ import (
 type OrderItem struct {
 	ID        int64          `gorm:"primaryKey"`
 	OrderID   int64          `gorm:"column:order_id;not null;references:orders.id;onDelete:CASCADE"`
-	ProductID int64          `gorm:"column:product_id;not null"` // You might have a Product struct
+	ProductID int64          `gorm:"column:product_id;not null"`           // You might have a Product struct
+	VariantID int64          `gorm:"column:variant_id;not null;default:0"` // product row the stock is held on
 	Quantity  int64          `gorm:"column:quantity;not null;default:1"`
+	Price     int64          `gorm:"column:price;not null;default:0"` // unit price when ordered
 	CreatedAt time.Time      `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
 	UpdatedAt *time.Time     `gorm:"column:updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
@@ -7,18 +7,23 @@ import (
 )
 
 type Order struct {
-	ID           int64          `gorm:"primaryKey"`
-	OrderCode    string         `gorm:"column:order_code;unique;not null;size:64"`
-	BuyerId      int64          `gorm:"column:buyer_id;not null"` // Assuming buyer_id is a user ID
-	OrderDate    time.Time      `gorm:"column:order_date;not null;default:CURRENT_TIMESTAMP"`
-	Status       string         `gorm:"column:status;not null;default:'pending';size:20"`
-	TotalAmount  float64        `gorm:"column:total_amount;not null;default:0"`
-	ShippingType string         `gorm:"column:shipping_type;not null;default:'PICKUP';size:20"`
-	ShippingFee  float64        `gorm:"column:shipping_fee;not null;default:0"`
-	OrderTime    string         `gorm:"column:order_time"`
-	Remarks      string         `gorm:"column:remarks"`
-	CreatedAt    time.Time      `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
-	UpdatedAt    *time.Time     `gorm:"column:updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"column:deleted_at;index"`
-	OrderItems   []OrderItem    `gorm:"foreignKey:OrderID"`
+	ID            int64                `gorm:"primaryKey"`
+	OrderCode     string               `gorm:"column:order_code;unique;not null;size:64"`
+	BuyerId       int64                `gorm:"column:buyer_id;not null"` // Assuming buyer_id is a user ID
+	OrderDate     time.Time            `gorm:"column:order_date;not null;default:CURRENT_TIMESTAMP"`
+	Status        string               `gorm:"column:status;not null;default:'pending';size:20"`
+	Subtotal      float64              `gorm:"column:subtotal;not null;default:0"`
+	Discount      float64              `gorm:"column:discount;not null;default:0"`
+	TotalAmount   float64              `gorm:"column:total_amount;not null;default:0"`
+	ShippingType  string               `gorm:"column:shipping_type;not null;default:'PICKUP';size:20"`
+	ShippingFee   float64              `gorm:"column:shipping_fee;not null;default:0"`
+	PaymentMethod string               `gorm:"column:payment_method;size:50"`
+	PaymentDueAt  *time.Time           `gorm:"column:payment_due_at"`
+	OrderTime     string               `gorm:"column:order_time"`
+	Remarks       string               `gorm:"column:remarks"`
+	CreatedAt     time.Time            `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt     *time.Time           `gorm:"column:updated_at"`
+	DeletedAt     gorm.DeletedAt       `gorm:"column:deleted_at;index"`
+	OrderItems    []OrderItem          `gorm:"foreignKey:OrderID"`
+	StatusHistory []OrderStatusHistory `gorm:"foreignKey:OrderID"`
 }
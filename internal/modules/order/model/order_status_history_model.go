@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// OrderStatusHistory records every status an order has been moved to, and
+// by whom. Rows are only ever inserted.
+type OrderStatusHistory struct {
+	ID             int64     `gorm:"primaryKey"`
+	OrderID        int64     `gorm:"column:order_id;not null;index"`
+	PreviousStatus string    `gorm:"column:previous_status;size:20"`
+	Status         string    `gorm:"column:status;not null;size:20"`
+	ActorID        int64     `gorm:"column:actor_id"`
+	ActorRole      string    `gorm:"column:actor_role;size:50"`
+	Remarks        string    `gorm:"column:remarks"`
+	CreatedAt      time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// Shipment is one parcel sent for an order. Its items say how much of each
+// order item went in it, so an order can ship over several parcels.
+// Provider is set when the parcel was booked through a courier
+// integration, which then reports its Status.
+type Shipment struct {
+	ID             int64                   `gorm:"primaryKey"`
+	OrderID        int64                   `gorm:"column:order_id;not null;index"`
+	Courier        string                  `gorm:"column:courier;not null;size:50"`
+	TrackingNumber string                  `gorm:"column:tracking_number;not null;size:100"`
+	TrackingURL    string                  `gorm:"column:tracking_url"`
+	Provider       string                  `gorm:"column:provider;size:30"`
+	Service        string                  `gorm:"column:service;size:30"`
+	Status         string                  `gorm:"column:status;not null;default:'in_transit';size:30"`
+	CreatedBy      int64                   `gorm:"column:created_by"`
+	ShippedAt      time.Time               `gorm:"column:shipped_at;not null;default:CURRENT_TIMESTAMP"`
+	DeliveredAt    *time.Time              `gorm:"column:delivered_at"`
+	CreatedAt      time.Time               `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt      *time.Time              `gorm:"column:updated_at"`
+	Items          []ShipmentItem          `gorm:"foreignKey:ShipmentID"`
+	Events         []ShipmentTrackingEvent `gorm:"foreignKey:ShipmentID"`
+}
+
+func (Shipment) TableName() string {
+	return "shipments"
+}
+
+type ShipmentItem struct {
+	ID          int64 `gorm:"primaryKey"`
+	ShipmentID  int64 `gorm:"column:shipment_id;not null;index"`
+	OrderItemID int64 `gorm:"column:order_item_id;not null;index"`
+	Quantity    int64 `gorm:"column:quantity;not null"`
+}
+
+func (ShipmentItem) TableName() string {
+	return "shipment_items"
+}
+
+// ShipmentTrackingEvent is one step of a shipment's trip as the courier
+// reported it. Couriers resend their whole history, so a step is stored
+// once per shipment.
+type ShipmentTrackingEvent struct {
+	ID          int64     `gorm:"primaryKey"`
+	ShipmentID  int64     `gorm:"column:shipment_id;not null;index;uniqueIndex:idx_shipment_tracking_events_unique,priority:1"`
+	Status      string    `gorm:"column:status;not null;size:30;uniqueIndex:idx_shipment_tracking_events_unique,priority:2"`
+	Description string    `gorm:"column:description"`
+	Location    string    `gorm:"column:location;size:100"`
+	OccurredAt  time.Time `gorm:"column:occurred_at;not null;uniqueIndex:idx_shipment_tracking_events_unique,priority:3"`
+	CreatedAt   time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
+
+func (ShipmentTrackingEvent) TableName() string {
+	return "shipment_tracking_events"
+}
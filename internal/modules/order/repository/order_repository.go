@@ -7,17 +7,22 @@ import (
 	"time"
 	"tofash/internal/modules/order/entity"
 	"tofash/internal/modules/order/model"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepositoryInterface interface {
 	GetAll(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error)
+	GetForExport(ctx context.Context, queryString entity.QueryStringEntity, createdBefore time.Time, afterID int64, limit int) ([]entity.OrderEntity, error)
 	GetByID(ctx context.Context, orderID int64) (*entity.OrderEntity, error)
 	CreateOrder(ctx context.Context, req entity.OrderEntity) (int64, error)
-	UpdateStatus(ctx context.Context, req entity.OrderEntity) (int64, string, string, error)
+	UpdateStatus(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) (int64, string, string, error)
 	DeleteOrder(ctx context.Context, orderID int64) error
+	StartPayment(ctx context.Context, orderID int64, method string, window time.Duration) error
+	GetOverdueOrderIDs(ctx context.Context, now time.Time, limit int) ([]int64, error)
 
 	GetOrderByOrderCode(ctx context.Context, orderCode string) (*entity.OrderEntity, error)
 }
@@ -30,7 +35,7 @@ type orderRepository struct {
 func (o *orderRepository) GetOrderByOrderCode(ctx context.Context, orderCode string) (*entity.OrderEntity, error) {
 	var modelOrder model.Order
 
-	if err := o.db.Preload("OrderItems").Where("order_code =?", orderCode).First(&modelOrder).Error; err != nil {
+	if err := uow.DB(ctx, o.db).Preload("OrderItems").Where("order_code =?", orderCode).First(&modelOrder).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[OrderRepository-1] GetOrderByOrderCode: Order not found")
@@ -40,29 +45,20 @@ func (o *orderRepository) GetOrderByOrderCode(ctx context.Context, orderCode str
 		return nil, err
 	}
 
-	orderItemEntities := []entity.OrderItemEntity{}
-	for _, item := range modelOrder.OrderItems {
-		orderItemEntities = append(orderItemEntities, entity.OrderItemEntity{
-			ID:        item.ID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Size:      item.Size,
-			Color:     item.Color,
-			SKU:       item.SKU,
-		})
-	}
-
 	return &entity.OrderEntity{
-		ID:           modelOrder.ID,
-		OrderCode:    modelOrder.OrderCode,
-		Status:       modelOrder.Status,
-		BuyerId:      modelOrder.BuyerId,
-		OrderDate:    modelOrder.OrderDate.Format("2006-01-02 15:04:05"),
-		TotalAmount:  int64(modelOrder.TotalAmount),
-		OrderItems:   orderItemEntities,
-		Remarks:      modelOrder.Remarks,
-		ShippingType: modelOrder.ShippingType,
-		ShippingFee:  int64(modelOrder.ShippingFee),
+		ID:            modelOrder.ID,
+		OrderCode:     modelOrder.OrderCode,
+		Status:        modelOrder.Status,
+		BuyerId:       modelOrder.BuyerId,
+		OrderDate:     modelOrder.OrderDate.Format("2006-01-02 15:04:05"),
+		Subtotal:      int64(modelOrder.Subtotal),
+		Discount:      int64(modelOrder.Discount),
+		TotalAmount:   int64(modelOrder.TotalAmount),
+		OrderItems:    toOrderItemEntities(modelOrder.OrderItems),
+		Remarks:       modelOrder.Remarks,
+		ShippingType:  modelOrder.ShippingType,
+		ShippingFee:   int64(modelOrder.ShippingFee),
+		PaymentMethod: modelOrder.PaymentMethod,
 	}, nil
 }
 
@@ -78,7 +74,9 @@ func (o *orderRepository) CreateOrder(ctx context.Context, req entity.OrderEntit
 	for _, item := range req.OrderItems {
 		orderItem := model.OrderItem{
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
 			Quantity:  item.Quantity,
+			Price:     item.Price,
 			Size:      item.Size,
 			Color:     item.Color,
 			SKU:       item.SKU,
@@ -87,19 +85,29 @@ func (o *orderRepository) CreateOrder(ctx context.Context, req entity.OrderEntit
 	}
 
 	modelOrder := model.Order{
-		OrderCode:    req.OrderCode,
-		BuyerId:      req.BuyerId,
-		OrderDate:    orderDate,
-		OrderTime:    req.OrderTime,
-		Status:       req.Status,
-		TotalAmount:  float64(req.TotalAmount),
-		ShippingType: req.ShippingType,
-		ShippingFee:  float64(req.ShippingFee),
-		Remarks:      req.Remarks,
-		OrderItems:   orderItems,
+		OrderCode:     req.OrderCode,
+		BuyerId:       req.BuyerId,
+		OrderDate:     orderDate,
+		OrderTime:     req.OrderTime,
+		Status:        req.Status,
+		Subtotal:      float64(req.Subtotal),
+		Discount:      float64(req.Discount),
+		TotalAmount:   float64(req.TotalAmount),
+		ShippingType:  req.ShippingType,
+		ShippingFee:   float64(req.ShippingFee),
+		PaymentMethod: req.PaymentMethod,
+		PaymentDueAt:  req.PaymentDueAt,
+		Remarks:       req.Remarks,
+		OrderItems:    orderItems,
+		StatusHistory: []model.OrderStatusHistory{{
+			Status:    req.Status,
+			ActorID:   req.BuyerId,
+			ActorRole: entity.OrderActorCustomer,
+			Remarks:   req.Remarks,
+		}},
 	}
 
-	if err := o.db.Create(&modelOrder).Error; err != nil {
+	if err := uow.DB(ctx, o.db).Create(&modelOrder).Error; err != nil {
 		log.Errorf("[OrderRepository-3] CreateOrder: %v", err)
 		return 0, err
 	}
@@ -111,7 +119,7 @@ func (o *orderRepository) CreateOrder(ctx context.Context, req entity.OrderEntit
 func (o *orderRepository) DeleteOrder(ctx context.Context, orderID int64) error {
 	modelOrder := model.Order{}
 
-	if err := o.db.Preload("OrderItems").Where("id = ?", orderID).First(&modelOrder).Error; err != nil {
+	if err := uow.DB(ctx, o.db).Preload("OrderItems").Where("id = ?", orderID).First(&modelOrder).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[OrderRepository-1] DeleteOrder: Order not found")
@@ -121,7 +129,7 @@ func (o *orderRepository) DeleteOrder(ctx context.Context, orderID int64) error
 		return err
 	}
 
-	if err := o.db.Select("OrderItems").Delete(&modelOrder).Error; err != nil {
+	if err := uow.DB(ctx, o.db).Select("OrderItems").Delete(&modelOrder).Error; err != nil {
 		log.Errorf("[OrderRepository-3] DeleteOrder: %v", err)
 		return err
 	}
@@ -129,49 +137,118 @@ func (o *orderRepository) DeleteOrder(ctx context.Context, orderID int64) error
 	return nil
 }
 
-// EditOrder implements OrderRepositoryInterface.
-func (o *orderRepository) UpdateStatus(ctx context.Context, req entity.OrderEntity) (int64, string, string, error) {
+// UpdateStatus implements OrderRepositoryInterface. It moves the order to
+// req.Status if the lifecycle allows it and records the change in
+// order_status_history; illegal transitions return "400".
+func (o *orderRepository) UpdateStatus(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) (int64, string, string, error) {
 	modelOrder := model.Order{}
 
-	if err := o.db.Select("id", "order_code", "status", "buyer_id", "remarks").Where("id = ?", req.ID).First(&modelOrder).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			err = errors.New("404")
-			log.Infof("[OrderRepository-1] UpdateStatus: Order not found")
-			return 0, "", "", err
+	err := uow.DB(ctx, o.db).Transaction(func(tx *gorm.DB) error {
+		// Lock the row so two concurrent transitions can't both pass the check.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "order_code", "status", "buyer_id", "remarks").
+			Where("id = ?", req.ID).
+			First(&modelOrder).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[OrderRepository-1] UpdateStatus: Order not found")
+				return errors.New("404")
+			}
+			log.Errorf("[OrderRepository-2] UpdateStatus: %v", err)
+			return err
+		}
+
+		previousStatus := entity.NormalizeOrderStatus(modelOrder.Status)
+		if !entity.CanTransitionOrderStatus(previousStatus, req.Status) {
+			log.Infof("[OrderRepository-3] UpdateStatus: Invalid status transition %s -> %s", previousStatus, req.Status)
+			return errors.New("400")
+		}
+
+		modelOrder.Status = req.Status
+		modelOrder.Remarks = req.Remarks
+		if err := tx.Model(&modelOrder).UpdateColumns(map[string]interface{}{
+			"status":     modelOrder.Status,
+			"remarks":    modelOrder.Remarks,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			log.Errorf("[OrderRepository-4] UpdateStatus: %v", err)
+			return err
+		}
+
+		history := model.OrderStatusHistory{
+			OrderID:        modelOrder.ID,
+			PreviousStatus: previousStatus,
+			Status:         modelOrder.Status,
+			ActorID:        actor.ID,
+			ActorRole:      actor.Role,
+			Remarks:        req.Remarks,
 		}
-		log.Errorf("[OrderRepository-2] UpdateStatus: %v", err)
+		if err := tx.Create(&history).Error; err != nil {
+			log.Errorf("[OrderRepository-5] UpdateStatus: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
 		return 0, "", "", err
 	}
 
-	if modelOrder.Status == "Pending" && (req.Status != "Confirmed" && req.Status != "Cancelled") {
-		log.Infof("[OrderRepository-3] UpdateStatus: Invalid status transition")
-		return 0, "", "", errors.New("400")
-	}
+	return modelOrder.BuyerId, modelOrder.Status, modelOrder.OrderCode, nil
+}
 
-	if modelOrder.Status == "Confirmed" && (req.Status != "Process" && req.Status != "Cancelled") {
-		log.Infof("[OrderRepository-4] UpdateStatus: Invalid status transition")
-		return 0, "", "", errors.New("400")
-	}
+// StartPayment implements OrderRepositoryInterface. It records the payment
+// method of a pending order and moves its payment deadline to window after
+// the order was placed. It fails with "400" once the order is no longer
+// pending or that deadline has passed.
+func (o *orderRepository) StartPayment(ctx context.Context, orderID int64, method string, window time.Duration) error {
+	return uow.DB(ctx, o.db).Transaction(func(tx *gorm.DB) error {
+		modelOrder := model.Order{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "created_at").
+			Where("id = ?", orderID).
+			First(&modelOrder).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[OrderRepository-1] StartPayment: Order not found")
+				return errors.New("404")
+			}
+			log.Errorf("[OrderRepository-2] StartPayment: %v", err)
+			return err
+		}
 
-	if modelOrder.Status == "Process" && (req.Status != "Sending" && req.Status != "Cancelled") {
-		log.Infof("[OrderRepository-5] UpdateStatus: Invalid status transition")
-		return 0, "", "", errors.New("400")
-	}
+		dueAt := modelOrder.CreatedAt.Add(window)
+		if entity.NormalizeOrderStatus(modelOrder.Status) != entity.OrderStatusPending || !dueAt.After(time.Now()) {
+			log.Infof("[OrderRepository-3] StartPayment: Order %d can no longer be paid", orderID)
+			return errors.New("400")
+		}
 
-	if modelOrder.Status == "Sending" && (req.Status != "Done" && req.Status != "Cancelled") {
-		log.Infof("[OrderRepository-6] UpdateStatus: Invalid status transition")
-		return 0, "", "", errors.New("400")
-	}
+		if err := tx.Model(&modelOrder).UpdateColumns(map[string]interface{}{
+			"payment_method": method,
+			"payment_due_at": dueAt,
+			"updated_at":     time.Now(),
+		}).Error; err != nil {
+			log.Errorf("[OrderRepository-4] StartPayment: %v", err)
+			return err
+		}
 
-	modelOrder.Status = req.Status
-	modelOrder.Remarks = req.Remarks
+		return nil
+	})
+}
 
-	if err := o.db.UpdateColumns(&modelOrder).Error; err != nil {
-		log.Errorf("[OrderRepository-7] UpdateStatus: %v", err)
-		return 0, "", "", err
+// GetOverdueOrderIDs implements OrderRepositoryInterface. It returns up to
+// limit pending orders whose payment deadline passed before now.
+func (o *orderRepository) GetOverdueOrderIDs(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	var ids []int64
+	err := uow.DB(ctx, o.db).Model(&model.Order{}).
+		Where("status IN ? AND payment_due_at < ?", []string{entity.OrderStatusPending, "pending"}, now).
+		Order("payment_due_at ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Errorf("[OrderRepository-1] GetOverdueOrderIDs: %v", err)
+		return nil, err
 	}
 
-	return modelOrder.BuyerId, modelOrder.Status, modelOrder.OrderCode, nil
+	return ids, nil
 }
 
 // GetAll implements OrderRepositoryInterface.
@@ -180,12 +257,7 @@ func (o *orderRepository) GetAll(ctx context.Context, queryString entity.QuerySt
 	var countData int64
 	offset := (queryString.Page - 1) * queryString.Limit
 
-	sqlMain := o.db.Preload("OrderItems").
-		Where("order_code ILIKE ? OR status ILIKE ?", "%"+queryString.Search+"%", "%"+queryString.Status+"%")
-
-	if queryString.BuyerID != 0 {
-		sqlMain = sqlMain.Where("buyer_id = ?", queryString.BuyerID)
-	}
+	sqlMain := filterOrders(uow.DB(ctx, o.db).Preload("OrderItems"), queryString)
 
 	if err := sqlMain.Model(&modelOrders).Count(&countData).Error; err != nil {
 		log.Errorf("[OrderRepository-1] GetAll: %v", err)
@@ -206,36 +278,70 @@ func (o *orderRepository) GetAll(ctx context.Context, queryString entity.QuerySt
 
 	entities := []entity.OrderEntity{}
 	for _, val := range modelOrders {
-		orderItemEntities := []entity.OrderItemEntity{}
-		for _, item := range val.OrderItems {
-			orderItemEntities = append(orderItemEntities, entity.OrderItemEntity{
-				ID:        item.ID,
-				ProductID: item.ProductID,
-				Quantity:  item.Quantity,
-				Size:      item.Size,
-				Color:     item.Color,
-				SKU:       item.SKU,
-			})
-		}
 		entities = append(entities, entity.OrderEntity{
-			ID:          val.ID,
-			OrderCode:   val.OrderCode,
-			Status:      val.Status,
-			OrderDate:   val.OrderDate.Format("2006-01-02 15:04:05"),
-			TotalAmount: int64(val.TotalAmount),
-			OrderItems:  orderItemEntities,
-			BuyerId:     val.BuyerId,
+			ID:            val.ID,
+			OrderCode:     val.OrderCode,
+			Status:        val.Status,
+			OrderDate:     val.OrderDate.Format("2006-01-02 15:04:05"),
+			TotalAmount:   int64(val.TotalAmount),
+			PaymentMethod: val.PaymentMethod,
+			OrderItems:    toOrderItemEntities(val.OrderItems),
+			BuyerId:       val.BuyerId,
 		})
 	}
 
 	return entities, countData, int64(totalPage), nil
 }
 
+// GetForExport implements OrderRepositoryInterface. It returns up to limit
+// orders matching queryString with an id above afterID, in id order, so a
+// caller can page with the last id it saw. Orders created after
+// createdBefore are left out, which keeps a long export to the set of
+// orders that existed when it started.
+func (o *orderRepository) GetForExport(ctx context.Context, queryString entity.QueryStringEntity, createdBefore time.Time, afterID int64, limit int) ([]entity.OrderEntity, error) {
+	var modelOrders []model.Order
+
+	sqlMain := filterOrders(uow.DB(ctx, o.db).Preload("OrderItems"), queryString).
+		Where("id > ? AND created_at <= ?", afterID, createdBefore)
+
+	if err := sqlMain.Order("id ASC").Limit(limit).Find(&modelOrders).Error; err != nil {
+		log.Errorf("[OrderRepository-1] GetForExport: %v", err)
+		return nil, err
+	}
+
+	entities := make([]entity.OrderEntity, 0, len(modelOrders))
+	for _, val := range modelOrders {
+		entities = append(entities, entity.OrderEntity{
+			ID:            val.ID,
+			OrderCode:     val.OrderCode,
+			Status:        val.Status,
+			OrderDate:     val.OrderDate.Format("2006-01-02 15:04:05"),
+			Subtotal:      int64(val.Subtotal),
+			Discount:      int64(val.Discount),
+			ShippingType:  val.ShippingType,
+			ShippingFee:   int64(val.ShippingFee),
+			TotalAmount:   int64(val.TotalAmount),
+			PaymentMethod: val.PaymentMethod,
+			OrderItems:    toOrderItemEntities(val.OrderItems),
+			BuyerId:       val.BuyerId,
+		})
+	}
+
+	return entities, nil
+}
+
 // GetByID implements OrderRepositoryInterface.
 func (o *orderRepository) GetByID(ctx context.Context, orderID int64) (*entity.OrderEntity, error) {
 	var modelOrder model.Order
 
-	if err := o.db.Preload("OrderItems").Where("id =?", orderID).First(&modelOrder).Error; err != nil {
+	err := uow.DB(ctx, o.db).
+		Preload("OrderItems").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		Where("id =?", orderID).
+		First(&modelOrder).Error
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[OrderRepository-1] GetByID: Order not found")
@@ -245,30 +351,86 @@ func (o *orderRepository) GetByID(ctx context.Context, orderID int64) (*entity.O
 		return nil, err
 	}
 
+	return &entity.OrderEntity{
+		ID:            modelOrder.ID,
+		OrderCode:     modelOrder.OrderCode,
+		Status:        modelOrder.Status,
+		BuyerId:       modelOrder.BuyerId,
+		OrderDate:     modelOrder.OrderDate.Format("2006-01-02 15:04:05"),
+		Subtotal:      int64(modelOrder.Subtotal),
+		Discount:      int64(modelOrder.Discount),
+		TotalAmount:   int64(modelOrder.TotalAmount),
+		OrderItems:    toOrderItemEntities(modelOrder.OrderItems),
+		Remarks:       modelOrder.Remarks,
+		ShippingType:  modelOrder.ShippingType,
+		ShippingFee:   int64(modelOrder.ShippingFee),
+		PaymentMethod: modelOrder.PaymentMethod,
+		PaymentDueAt:  modelOrder.PaymentDueAt,
+		CreatedAt:     modelOrder.CreatedAt,
+		StatusHistory: toStatusHistoryEntities(modelOrder.StatusHistory),
+	}, nil
+}
+
+// filterOrders narrows db to the orders queryString asks for. The admin
+// list and the export share it so both return the same orders.
+func filterOrders(db *gorm.DB, queryString entity.QueryStringEntity) *gorm.DB {
+	db = db.Where("order_code ILIKE ? OR status ILIKE ?", "%"+queryString.Search+"%", "%"+queryString.Status+"%")
+
+	if queryString.BuyerID != 0 {
+		db = db.Where("buyer_id = ?", queryString.BuyerID)
+	}
+
+	if !queryString.From.IsZero() {
+		db = db.Where("order_date >= ?", queryString.From)
+	}
+
+	if !queryString.To.IsZero() {
+		db = db.Where("order_date < ?", queryString.To)
+	}
+
+	if queryString.PaymentMethod != "" {
+		db = db.Where("payment_method = ?", queryString.PaymentMethod)
+	}
+
+	if queryString.ShippingType != "" {
+		db = db.Where("shipping_type = ?", queryString.ShippingType)
+	}
+
+	return db
+}
+
+func toOrderItemEntities(items []model.OrderItem) []entity.OrderItemEntity {
 	orderItemEntities := []entity.OrderItemEntity{}
-	for _, item := range modelOrder.OrderItems {
+	for _, item := range items {
 		orderItemEntities = append(orderItemEntities, entity.OrderItemEntity{
 			ID:        item.ID,
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
 			Quantity:  item.Quantity,
+			Price:     item.Price,
 			Size:      item.Size,
 			Color:     item.Color,
 			SKU:       item.SKU,
 		})
 	}
+	return orderItemEntities
+}
 
-	return &entity.OrderEntity{
-		ID:           modelOrder.ID,
-		OrderCode:    modelOrder.OrderCode,
-		Status:       modelOrder.Status,
-		BuyerId:      modelOrder.BuyerId,
-		OrderDate:    modelOrder.OrderDate.Format("2006-01-02 15:04:05"),
-		TotalAmount:  int64(modelOrder.TotalAmount),
-		OrderItems:   orderItemEntities,
-		Remarks:      modelOrder.Remarks,
-		ShippingType: modelOrder.ShippingType,
-		ShippingFee:  int64(modelOrder.ShippingFee),
-	}, nil
+func toStatusHistoryEntities(rows []model.OrderStatusHistory) []entity.OrderStatusHistoryEntity {
+	history := []entity.OrderStatusHistoryEntity{}
+	for _, row := range rows {
+		history = append(history, entity.OrderStatusHistoryEntity{
+			ID:             row.ID,
+			OrderID:        row.OrderID,
+			PreviousStatus: row.PreviousStatus,
+			Status:         row.Status,
+			ActorID:        row.ActorID,
+			ActorRole:      row.ActorRole,
+			Remarks:        row.Remarks,
+			CreatedAt:      row.CreatedAt,
+		})
+	}
+	return history
 }
 
 func NewOrderRepository(db *gorm.DB) OrderRepositoryInterface {
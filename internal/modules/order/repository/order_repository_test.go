@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/model"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds SQL without ever connecting to a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	conn, err := sql.Open("pgx", "postgres://localhost/none")
+	require.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestFilterOrders_AppliesEveryFilter(t *testing.T) {
+	db := dryRunDB(t)
+	query := entity.QueryStringEntity{
+		Search:        "ORD",
+		Status:        entity.OrderStatusPaid,
+		BuyerID:       10,
+		From:          time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		PaymentMethod: "cod",
+		ShippingType:  "Pickup",
+	}
+
+	stmt := filterOrders(db, query).Find(&[]model.Order{}).Statement
+	sqlText := stmt.SQL.String()
+	assert.Contains(t, sqlText, "(order_code ILIKE $1 OR status ILIKE $2)")
+	assert.Contains(t, sqlText, "buyer_id = $3")
+	assert.Contains(t, sqlText, "order_date >= $4")
+	assert.Contains(t, sqlText, "order_date < $5")
+	assert.Contains(t, sqlText, "payment_method = $6")
+	assert.Contains(t, sqlText, "shipping_type = $7")
+	assert.Equal(t, []interface{}{"%ORD%", "%Paid%", int64(10), query.From, query.To, "cod", "Pickup"}, stmt.Vars)
+
+	bare := filterOrders(db, entity.QueryStringEntity{}).Find(&[]model.Order{}).Statement.SQL.String()
+	assert.NotContains(t, bare, "order_date")
+	assert.NotContains(t, bare, "payment_method")
+}
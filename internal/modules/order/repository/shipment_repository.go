@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/model"
+	"tofash/internal/modules/order/shipping"
+	"tofash/internal/shared/uow"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// shippableStatuses are the statuses an order may ship from.
+var shippableStatuses = []string{
+	entity.OrderStatusPaid,
+	entity.OrderStatusProcessing,
+	entity.OrderStatusPartiallyShipped,
+}
+
+// trackingEventConflict skips events a shipment already has; it targets
+// idx_shipment_tracking_events_unique.
+var trackingEventConflict = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "shipment_id"}, {Name: "status"}, {Name: "occurred_at"}},
+	DoNothing: true,
+}
+
+type ShipmentRepositoryInterface interface {
+	CreateShipment(ctx context.Context, req entity.ShipmentEntity) (*entity.ShipmentEntity, bool, error)
+	GetByOrderID(ctx context.Context, orderID int64) ([]entity.ShipmentEntity, error)
+	GetByID(ctx context.Context, shipmentID int64) (*entity.ShipmentEntity, error)
+	GetByTrackingNumber(ctx context.Context, provider, trackingNumber string) (*entity.ShipmentEntity, error)
+	RecordTrackingEvents(ctx context.Context, shipmentID int64, events []entity.ShipmentTrackingEventEntity) (*entity.ShipmentEntity, error)
+	CountUndelivered(ctx context.Context, orderID int64) (int64, error)
+}
+
+type shipmentRepository struct {
+	db *gorm.DB
+}
+
+// CreateShipment implements ShipmentRepositoryInterface. It records a
+// shipment of req.Items, or of everything not yet shipped when req has no
+// items, and reports whether the order has now shipped in full. It fails
+// with "400" when the order can't ship or an item exceeds what is left of
+// it.
+func (s *shipmentRepository) CreateShipment(ctx context.Context, req entity.ShipmentEntity) (*entity.ShipmentEntity, bool, error) {
+	modelShipment := model.Shipment{}
+	fullyShipped := false
+
+	err := uow.DB(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		// Lock the order so two shipments can't both take what is left.
+		modelOrder := model.Order{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("OrderItems").
+			Where("id = ?", req.OrderID).
+			First(&modelOrder).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[ShipmentRepository-1] CreateShipment: Order not found")
+				return errors.New("404")
+			}
+			log.Errorf("[ShipmentRepository-2] CreateShipment: %v", err)
+			return err
+		}
+
+		if !isShippable(entity.NormalizeOrderStatus(modelOrder.Status)) {
+			log.Infof("[ShipmentRepository-3] CreateShipment: Order %d is %s", modelOrder.ID, modelOrder.Status)
+			return errors.New("400")
+		}
+
+		shipped, err := shippedQuantities(tx, modelOrder.ID)
+		if err != nil {
+			log.Errorf("[ShipmentRepository-4] CreateShipment: %v", err)
+			return err
+		}
+
+		remaining := make(map[int64]int64, len(modelOrder.OrderItems))
+		for _, item := range modelOrder.OrderItems {
+			remaining[item.ID] = item.Quantity - shipped[item.ID]
+		}
+
+		items := req.Items
+		if len(items) == 0 {
+			for _, item := range modelOrder.OrderItems {
+				if remaining[item.ID] > 0 {
+					items = append(items, entity.ShipmentItemEntity{OrderItemID: item.ID, Quantity: remaining[item.ID]})
+				}
+			}
+		}
+		if len(items) == 0 {
+			log.Infof("[ShipmentRepository-5] CreateShipment: Order %d has nothing left to ship", modelOrder.ID)
+			return errors.New("400")
+		}
+
+		for _, item := range items {
+			left, ok := remaining[item.OrderItemID]
+			if !ok || item.Quantity <= 0 || item.Quantity > left {
+				log.Infof("[ShipmentRepository-6] CreateShipment: Cannot ship %d of order item %d", item.Quantity, item.OrderItemID)
+				return errors.New("400")
+			}
+			remaining[item.OrderItemID] = left - item.Quantity
+			modelShipment.Items = append(modelShipment.Items, model.ShipmentItem{
+				OrderItemID: item.OrderItemID,
+				Quantity:    item.Quantity,
+			})
+		}
+
+		modelShipment.OrderID = modelOrder.ID
+		modelShipment.Courier = req.Courier
+		modelShipment.TrackingNumber = req.TrackingNumber
+		modelShipment.TrackingURL = req.TrackingURL
+		modelShipment.Provider = req.Provider
+		modelShipment.Service = req.Service
+		modelShipment.Status = req.Status
+		if modelShipment.Status == "" {
+			modelShipment.Status = shipping.TrackingStatusInTransit
+		}
+		modelShipment.CreatedBy = req.CreatedBy
+		modelShipment.ShippedAt = time.Now()
+		if err := tx.Create(&modelShipment).Error; err != nil {
+			log.Errorf("[ShipmentRepository-7] CreateShipment: %v", err)
+			return err
+		}
+
+		fullyShipped = true
+		for _, left := range remaining {
+			if left > 0 {
+				fullyShipped = false
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return toShipmentEntity(modelShipment), fullyShipped, nil
+}
+
+// GetByOrderID implements ShipmentRepositoryInterface. Shipments come in
+// the order they were sent.
+func (s *shipmentRepository) GetByOrderID(ctx context.Context, orderID int64) ([]entity.ShipmentEntity, error) {
+	var modelShipments []model.Shipment
+	if err := uow.DB(ctx, s.db).
+		Preload("Items").
+		Preload("Events", orderEvents).
+		Where("order_id = ?", orderID).
+		Order("shipped_at ASC, id ASC").
+		Find(&modelShipments).Error; err != nil {
+		log.Errorf("[ShipmentRepository-1] GetByOrderID: %v", err)
+		return nil, err
+	}
+
+	shipments := make([]entity.ShipmentEntity, 0, len(modelShipments))
+	for _, modelShipment := range modelShipments {
+		shipments = append(shipments, *toShipmentEntity(modelShipment))
+	}
+
+	return shipments, nil
+}
+
+// GetByID implements ShipmentRepositoryInterface.
+func (s *shipmentRepository) GetByID(ctx context.Context, shipmentID int64) (*entity.ShipmentEntity, error) {
+	modelShipment := model.Shipment{}
+	if err := uow.DB(ctx, s.db).
+		Preload("Items").
+		Preload("Events", orderEvents).
+		Where("id = ?", shipmentID).
+		First(&modelShipment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Infof("[ShipmentRepository-1] GetByID: Shipment not found")
+			return nil, errors.New("404")
+		}
+		log.Errorf("[ShipmentRepository-2] GetByID: %v", err)
+		return nil, err
+	}
+
+	return toShipmentEntity(modelShipment), nil
+}
+
+// GetByTrackingNumber implements ShipmentRepositoryInterface. It finds a
+// shipment booked through provider by the courier's tracking number.
+func (s *shipmentRepository) GetByTrackingNumber(ctx context.Context, provider, trackingNumber string) (*entity.ShipmentEntity, error) {
+	modelShipment := model.Shipment{}
+	if err := uow.DB(ctx, s.db).
+		Where("provider = ? AND tracking_number = ?", provider, trackingNumber).
+		Order("id DESC").
+		First(&modelShipment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Infof("[ShipmentRepository-1] GetByTrackingNumber: Shipment not found")
+			return nil, errors.New("404")
+		}
+		log.Errorf("[ShipmentRepository-2] GetByTrackingNumber: %v", err)
+		return nil, err
+	}
+
+	return toShipmentEntity(modelShipment), nil
+}
+
+// RecordTrackingEvents implements ShipmentRepositoryInterface. Events
+// already recorded are skipped. The shipment takes the status of its
+// latest event, and is stamped delivered when that is the delivery. It
+// returns the updated shipment.
+func (s *shipmentRepository) RecordTrackingEvents(ctx context.Context, shipmentID int64, events []entity.ShipmentTrackingEventEntity) (*entity.ShipmentEntity, error) {
+	err := uow.DB(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		modelShipment := model.Shipment{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", shipmentID).
+			First(&modelShipment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[ShipmentRepository-1] RecordTrackingEvents: Shipment not found")
+				return errors.New("404")
+			}
+			log.Errorf("[ShipmentRepository-2] RecordTrackingEvents: %v", err)
+			return err
+		}
+
+		for _, event := range events {
+			modelEvent := model.ShipmentTrackingEvent{
+				ShipmentID:  shipmentID,
+				Status:      event.Status,
+				Description: event.Description,
+				Location:    event.Location,
+				OccurredAt:  event.OccurredAt,
+			}
+			if err := tx.Clauses(trackingEventConflict).Create(&modelEvent).Error; err != nil {
+				log.Errorf("[ShipmentRepository-3] RecordTrackingEvents: %v", err)
+				return err
+			}
+		}
+
+		latest := model.ShipmentTrackingEvent{}
+		if err := tx.Where("shipment_id = ?", shipmentID).
+			Order("occurred_at DESC, id DESC").
+			First(&latest).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			log.Errorf("[ShipmentRepository-4] RecordTrackingEvents: %v", err)
+			return err
+		}
+
+		now := time.Now()
+		modelShipment.Status = latest.Status
+		modelShipment.UpdatedAt = &now
+		if latest.Status == shipping.TrackingStatusDelivered && modelShipment.DeliveredAt == nil {
+			modelShipment.DeliveredAt = &latest.OccurredAt
+		}
+		if err := tx.Model(&modelShipment).
+			Select("status", "delivered_at", "updated_at").
+			Updates(&modelShipment).Error; err != nil {
+			log.Errorf("[ShipmentRepository-5] RecordTrackingEvents: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, shipmentID)
+}
+
+// CountUndelivered implements ShipmentRepositoryInterface.
+func (s *shipmentRepository) CountUndelivered(ctx context.Context, orderID int64) (int64, error) {
+	var count int64
+	if err := uow.DB(ctx, s.db).Model(&model.Shipment{}).
+		Where("order_id = ? AND status <> ?", orderID, shipping.TrackingStatusDelivered).
+		Count(&count).Error; err != nil {
+		log.Errorf("[ShipmentRepository-1] CountUndelivered: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func orderEvents(db *gorm.DB) *gorm.DB {
+	return db.Order("occurred_at ASC, id ASC")
+}
+
+func isShippable(status string) bool {
+	for _, shippable := range shippableStatuses {
+		if status == shippable {
+			return true
+		}
+	}
+	return false
+}
+
+// shippedQuantities returns how much of each of an order's items has
+// shipped so far, by order item.
+func shippedQuantities(tx *gorm.DB, orderID int64) (map[int64]int64, error) {
+	var rows []struct {
+		OrderItemID int64
+		Quantity    int64
+	}
+	err := tx.Table("shipment_items").
+		Select("shipment_items.order_item_id, SUM(shipment_items.quantity) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id").
+		Where("shipments.order_id = ?", orderID).
+		Group("shipment_items.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	shipped := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		shipped[row.OrderItemID] = row.Quantity
+	}
+	return shipped, nil
+}
+
+func toShipmentEntity(modelShipment model.Shipment) *entity.ShipmentEntity {
+	shipment := &entity.ShipmentEntity{
+		ID:             modelShipment.ID,
+		OrderID:        modelShipment.OrderID,
+		Courier:        modelShipment.Courier,
+		TrackingNumber: modelShipment.TrackingNumber,
+		TrackingURL:    modelShipment.TrackingURL,
+		Provider:       modelShipment.Provider,
+		Service:        modelShipment.Service,
+		Status:         modelShipment.Status,
+		CreatedBy:      modelShipment.CreatedBy,
+		ShippedAt:      modelShipment.ShippedAt,
+		DeliveredAt:    modelShipment.DeliveredAt,
+		Items:          []entity.ShipmentItemEntity{},
+		Events:         []entity.ShipmentTrackingEventEntity{},
+	}
+	for _, item := range modelShipment.Items {
+		shipment.Items = append(shipment.Items, entity.ShipmentItemEntity{
+			ID:          item.ID,
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+	for _, event := range modelShipment.Events {
+		shipment.Events = append(shipment.Events, entity.ShipmentTrackingEventEntity{
+			Status:      event.Status,
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.OccurredAt,
+		})
+	}
+	return shipment
+}
+
+func NewShipmentRepository(db *gorm.DB) ShipmentRepositoryInterface {
+	return &shipmentRepository{db: db}
+}
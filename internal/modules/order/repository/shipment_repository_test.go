@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+
+	"tofash/internal/modules/order/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/schema"
+)
+
+func TestTrackingEventConflict_MatchesUniqueIndex(t *testing.T) {
+	s, err := schema.Parse(&model.ShipmentTrackingEvent{}, &sync.Map{}, schema.NamingStrategy{})
+	assert.NoError(t, err)
+
+	idx := s.LookIndex("idx_shipment_tracking_events_unique")
+	if assert.NotNil(t, idx) {
+		assert.Equal(t, "UNIQUE", idx.Class)
+		columns := []string{}
+		for _, field := range idx.Fields {
+			columns = append(columns, field.DBName)
+		}
+
+		conflict := []string{}
+		for _, column := range trackingEventConflict.Columns {
+			conflict = append(conflict, column.Name)
+		}
+		assert.Equal(t, columns, conflict)
+	}
+}
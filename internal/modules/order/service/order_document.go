@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tofash/internal/modules/order/document"
+	"tofash/internal/modules/order/entity"
+
+	"github.com/labstack/gommon/log"
+)
+
+const pdfContentType = "application/pdf"
+
+// Invoice implements OrderServiceInterface. Buyers only get invoices for
+// their own orders.
+func (o *orderService) Invoice(ctx context.Context, orderID, buyerID int64) (*entity.OrderDocument, error) {
+	order, err := o.GetDetailCustomer(ctx, orderID)
+	if err != nil {
+		log.Errorf("[OrderService-1] Invoice: %v", err)
+		return nil, err
+	}
+
+	if order.BuyerId != buyerID {
+		return nil, errors.New("404")
+	}
+
+	return o.invoice(*order), nil
+}
+
+// PackingSlip implements OrderServiceInterface.
+func (o *orderService) PackingSlip(ctx context.Context, orderID int64) (*entity.OrderDocument, error) {
+	order, err := o.GetDetailCustomer(ctx, orderID)
+	if err != nil {
+		log.Errorf("[OrderService-1] PackingSlip: %v", err)
+		return nil, err
+	}
+
+	return &entity.OrderDocument{
+		Filename:    fmt.Sprintf("packing-slip-%s.pdf", order.OrderCode),
+		ContentType: pdfContentType,
+		Content:     document.PackingSlip(*order, o.store()),
+	}, nil
+}
+
+func (o *orderService) invoice(order entity.OrderEntity) *entity.OrderDocument {
+	return &entity.OrderDocument{
+		Filename:    fmt.Sprintf("invoice-%s.pdf", order.OrderCode),
+		ContentType: pdfContentType,
+		Content:     document.Invoice(order, o.store()),
+	}
+}
+
+func (o *orderService) store() document.Store {
+	return document.Store{
+		Name:    o.cfg.Order.StoreName,
+		Address: o.cfg.Order.StoreAddress,
+		Phone:   o.cfg.Order.StorePhone,
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"time"
+	"tofash/internal/modules/order/entity"
+
+	"github.com/labstack/gommon/log"
+)
+
+// exportBatchSize is how many orders ExportOrders loads per query.
+const exportBatchSize = 200
+
+// ExportOrders implements OrderServiceInterface. It walks the orders
+// matching query in id order, filling in buyer and product names, and hands
+// them to fn one at a time, so only one batch is in memory. Each batch
+// starts after the last id of the one before, so orders changing status
+// mid-export can't shift rows between pages, and orders created after the
+// export starts are left out.
+func (o *orderService) ExportOrders(ctx context.Context, query entity.QueryStringEntity, fn func(entity.OrderEntity) error) error {
+	snapshot := time.Now()
+	var lastID int64
+
+	for {
+		orders, err := o.repo.GetForExport(ctx, query, snapshot, lastID, exportBatchSize)
+		if err != nil {
+			log.Errorf("[OrderService-1] ExportOrders: %v", err)
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err := o.enrichOrders(ctx, orders); err != nil {
+			log.Errorf("[OrderService-2] ExportOrders: %v", err)
+			return err
+		}
+
+		for _, order := range orders {
+			if err := fn(order); err != nil {
+				log.Errorf("[OrderService-3] ExportOrders: %v", err)
+				return err
+			}
+		}
+
+		if len(orders) < exportBatchSize {
+			return nil
+		}
+		lastID = orders[len(orders)-1].ID
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"tofash/internal/modules/order/entity"
+
+	"github.com/labstack/gommon/log"
+)
+
+// enrichOrders fills in the buyer and product details of orders with one
+// user lookup and one product lookup, however many orders and items there
+// are. Buyers or products that no longer exist leave their fields empty
+// instead of failing the whole page.
+func (o *orderService) enrichOrders(ctx context.Context, orders []entity.OrderEntity) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	buyerIDs, productIDs := []int64{}, []int64{}
+	seenBuyers, seenProducts := map[int64]bool{}, map[int64]bool{}
+	for _, order := range orders {
+		if !seenBuyers[order.BuyerId] {
+			seenBuyers[order.BuyerId] = true
+			buyerIDs = append(buyerIDs, order.BuyerId)
+		}
+		for _, item := range order.OrderItems {
+			if !seenProducts[item.ProductID] {
+				seenProducts[item.ProductID] = true
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+	}
+
+	buyers, err := o.userSvc.GetByIDs(ctx, buyerIDs)
+	if err != nil {
+		log.Errorf("[OrderService-1] enrichOrders: %v", err)
+		return err
+	}
+
+	products, err := o.productSvc.GetByIDs(ctx, productIDs)
+	if err != nil {
+		log.Errorf("[OrderService-2] enrichOrders: %v", err)
+		return err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		if buyer, ok := buyers[order.BuyerId]; ok {
+			order.BuyerName = buyer.Name
+			order.BuyerEmail = buyer.Email
+			order.BuyerPhone = buyer.Phone
+			order.BuyerAddress = buyer.Address
+		}
+
+		for j := range order.OrderItems {
+			item := &order.OrderItems[j]
+			product, ok := products[item.ProductID]
+			if !ok {
+				continue
+			}
+
+			item.ProductName = product.Name
+			item.ProductUnit = product.Unit
+			item.ProductWeight = int64(product.Weight)
+			// Items from before prices were stored fall back to the
+			// current one; exchange replacements are free on purpose.
+			if item.Price == 0 && order.PaymentMethod != PaymentMethodExchange {
+				item.Price = int64(product.SalePrice)
+			}
+
+			// The variant's own picture, else the product's, else its
+			// first variant's.
+			item.ProductImage = product.Image
+			for _, child := range product.Child {
+				if child.ID == item.VariantID && child.Image != "" {
+					item.ProductImage = child.Image
+				}
+			}
+			if item.ProductImage == "" && len(product.Child) > 0 {
+				item.ProductImage = product.Child[0].Image
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/shipping"
+	productEntity "tofash/internal/modules/product/entity"
+
+	"github.com/labstack/gommon/log"
+)
+
+const ShippingTypeDelivery = "Delivery"
+
+// PriceMismatchError is returned by CreateOrder when the total the client
+// submitted differs from the server-side price. Pricing carries the
+// breakdown the client should have used.
+type PriceMismatchError struct {
+	Submitted int64
+	Pricing   entity.OrderPricing
+}
+
+func (e *PriceMismatchError) Error() string {
+	return fmt.Sprintf("total amount %d does not match the order total %d", e.Submitted, e.Pricing.GrandTotal)
+}
+
+// InsufficientStockError is returned when an item asks for more units than
+// the product, or its variant, has left.
+type InsufficientStockError struct {
+	ProductID int64
+	Requested int64
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("product %d does not have %d unit(s) in stock", e.ProductID, e.Requested)
+}
+
+// priceOrder checks stock, prices every item at its current sale price,
+// using the variant's price when the item names one, and charges shipping
+// by the parcel's weight and the buyer's distance.
+func (o *orderService) priceOrder(ctx context.Context, req entity.OrderEntity) (entity.OrderPricing, error) {
+	pricing, weightGrams, err := o.priceItems(ctx, req.OrderItems)
+	if err != nil {
+		return entity.OrderPricing{}, err
+	}
+
+	var destination *shipping.Location
+	if o.shipping.Charges(req.ShippingType) {
+		destination, err = o.buyerLocation(ctx, req.BuyerId)
+		if err != nil {
+			log.Errorf("[OrderService-1] priceOrder: %v", err)
+			return entity.OrderPricing{}, err
+		}
+	}
+
+	quote, err := o.shipping.Quote(req.ShippingType, weightGrams, destination)
+	if err != nil {
+		log.Errorf("[OrderService-2] priceOrder: %v", err)
+		return entity.OrderPricing{}, err
+	}
+
+	pricing.ShippingFee = quote.Fee
+	pricing.GrandTotal = pricing.Subtotal - pricing.Discount + pricing.ShippingFee
+	return pricing, nil
+}
+
+// QuoteShipping implements OrderServiceInterface. It quotes every shipping
+// type that has rates for req's items, sent to the buyer.
+func (o *orderService) QuoteShipping(ctx context.Context, req entity.OrderEntity) ([]entity.ShippingQuote, error) {
+	_, weightGrams, err := o.priceItems(ctx, req.OrderItems)
+	if err != nil {
+		log.Errorf("[OrderService-1] QuoteShipping: %v", err)
+		return nil, err
+	}
+
+	destination, err := o.buyerLocation(ctx, req.BuyerId)
+	if err != nil {
+		log.Errorf("[OrderService-2] QuoteShipping: %v", err)
+		return nil, err
+	}
+
+	quotes := []entity.ShippingQuote{}
+	for _, shippingType := range o.shipping.ShippingTypes() {
+		quote, err := o.shipping.Quote(shippingType, weightGrams, destination)
+		if err != nil {
+			quotes = append(quotes, entity.ShippingQuote{ShippingType: shippingType, WeightGrams: weightGrams, Reason: err.Error()})
+			continue
+		}
+		quotes = append(quotes, entity.ShippingQuote{
+			ShippingType: quote.ShippingType,
+			WeightGrams:  quote.WeightGrams,
+			DistanceKm:   math.Round(quote.DistanceKm*10) / 10,
+			Fee:          quote.Fee,
+			Available:    true,
+		})
+	}
+
+	return quotes, nil
+}
+
+// buyerLocation returns where the buyer's address is, or nil if their
+// profile has no coordinates.
+func (o *orderService) buyerLocation(ctx context.Context, buyerID int64) (*shipping.Location, error) {
+	buyer, err := o.userSvc.GetCustomerByID(ctx, buyerID)
+	if err != nil {
+		return nil, err
+	}
+
+	location, ok := shipping.ParseLocation(buyer.Lat, buyer.Lng)
+	if !ok {
+		return nil, nil
+	}
+	return &location, nil
+}
+
+// priceItems prices items without shipping and weighs them in grams.
+func (o *orderService) priceItems(ctx context.Context, items []entity.OrderItemEntity) (entity.OrderPricing, int64, error) {
+	pricing := entity.OrderPricing{}
+	weightGrams := int64(0)
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			log.Errorf("[OrderService-1] priceOrder: invalid quantity %d for product %d", item.Quantity, item.ProductID)
+			return entity.OrderPricing{}, 0, errors.New("400")
+		}
+
+		product, err := o.productSvc.GetByID(ctx, item.ProductID)
+		if err != nil {
+			log.Errorf("[OrderService-2] priceOrder: %v", err)
+			if err.Error() == "404" {
+				return entity.OrderPricing{}, 0, errors.New("400")
+			}
+			return entity.OrderPricing{}, 0, err
+		}
+
+		priced, ok := matchVariant(product, item)
+		if !ok {
+			log.Errorf("[OrderService-3] priceOrder: product %d has no variant %q/%q/%q", item.ProductID, item.SKU, item.Size, item.Color)
+			return entity.OrderPricing{}, 0, errors.New("400")
+		}
+
+		// The reservation made with the order has the final say; this only
+		// turns away orders that can't possibly be filled.
+		if int64(priced.Stock) < item.Quantity {
+			return entity.OrderPricing{}, 0, &InsufficientStockError{ProductID: item.ProductID, Requested: item.Quantity}
+		}
+
+		unitPrice := toRupiah(priced.SalePrice)
+		regularPrice := toRupiah(priced.RegulerPrice)
+		if regularPrice < unitPrice {
+			regularPrice = unitPrice
+		}
+
+		line := entity.OrderPricingLine{
+			ProductID:    item.ProductID,
+			VariantID:    priced.ID,
+			SKU:          item.SKU,
+			Size:         item.Size,
+			Color:        item.Color,
+			Quantity:     item.Quantity,
+			RegularPrice: regularPrice,
+			UnitPrice:    unitPrice,
+			LineTotal:    unitPrice * item.Quantity,
+		}
+		pricing.Lines = append(pricing.Lines, line)
+		pricing.Subtotal += regularPrice * item.Quantity
+		pricing.Discount += (regularPrice - unitPrice) * item.Quantity
+		weightGrams += itemWeight(product, priced) * item.Quantity
+	}
+
+	pricing.GrandTotal = pricing.Subtotal - pricing.Discount
+	return pricing, weightGrams, nil
+}
+
+// matchVariant returns the product itself when the item names no variant,
+// otherwise the child whose SKU, or size and colour, match the item.
+func matchVariant(product *productEntity.ProductEntity, item entity.OrderItemEntity) (*productEntity.ProductEntity, bool) {
+	if item.SKU == "" && item.Size == "" && item.Color == "" {
+		return product, true
+	}
+
+	candidates := append([]productEntity.ProductEntity{*product}, product.Child...)
+	for i := range candidates {
+		variant := &candidates[i]
+		if item.SKU != "" {
+			if strings.EqualFold(variant.SKU, item.SKU) {
+				return variant, true
+			}
+			continue
+		}
+		if strings.EqualFold(variant.Size, item.Size) && strings.EqualFold(variant.Color, item.Color) {
+			return variant, true
+		}
+	}
+	return nil, false
+}
+
+// itemWeight is one unit's weight in grams. Variants without a weight of
+// their own weigh what the product does.
+func itemWeight(product, priced *productEntity.ProductEntity) int64 {
+	if priced.Weight > 0 {
+		return shipping.ToGrams(int64(priced.Weight), priced.Unit)
+	}
+	return shipping.ToGrams(int64(product.Weight), product.Unit)
+}
+
+func toRupiah(price float64) int64 {
+	return int64(math.Round(price))
+}
@@ -2,36 +2,65 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 	"tofash/internal/config"
 	"tofash/internal/modules/order/entity"
 	"tofash/internal/modules/order/repository"
+	"tofash/internal/modules/order/shipping"
 	"tofash/internal/modules/order/utils/conv"
 	productService "tofash/internal/modules/product/service"
-	jobRepository "tofash/internal/modules/system/repository"
 	userService "tofash/internal/modules/user/service"
+	"tofash/internal/shared/async"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 )
 
 type OrderServiceInterface interface {
 	GetAll(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error)
+	ExportOrders(ctx context.Context, query entity.QueryStringEntity, fn func(entity.OrderEntity) error) error
 	GetByID(ctx context.Context, orderID int64) (*entity.OrderEntity, error)
 	CreateOrder(ctx context.Context, req entity.OrderEntity) (int64, error)
-	UpdateStatus(ctx context.Context, req entity.OrderEntity) error
+	CreateExchangeOrder(ctx context.Context, req entity.OrderEntity) (int64, error)
+	QuoteOrder(ctx context.Context, req entity.OrderEntity) (entity.OrderPricing, error)
+	QuoteShipping(ctx context.Context, req entity.OrderEntity) ([]entity.ShippingQuote, error)
+	UpdateStatus(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) error
+	CancelOrder(ctx context.Context, orderID int64, reason string, actor entity.OrderActor) error
+	StartPayment(ctx context.Context, orderID int64, method string) error
+	ExpireOverdueOrders(ctx context.Context) (int64, error)
 	GetAllCustomer(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error)
 	GetDetailCustomer(ctx context.Context, orderID int64) (*entity.OrderEntity, error)
+	Invoice(ctx context.Context, orderID, buyerID int64) (*entity.OrderDocument, error)
+	PackingSlip(ctx context.Context, orderID int64) (*entity.OrderDocument, error)
 	DeleteByID(ctx context.Context, orderID int64) error
 	GetOrderByOrderCode(ctx context.Context, orderCode string) (*entity.OrderEntity, error)
 	GetPublicOrderIDByOrderCode(ctx context.Context, orderCode string) (int64, error)
 }
 
+// stockReservationGrace keeps an unpaid order's stock held a little past
+// its payment deadline, so the stock is given back by the order expiring
+// rather than the reservation running out while the order can still be
+// paid.
+const stockReservationGrace = 15 * time.Minute
+
+// PaymentMethodExchange marks orders placed by CreateExchangeOrder, which
+// are never paid for.
+const PaymentMethodExchange = "exchange"
+
+// expiryBatchSize caps how many orders one ExpireOverdueOrders run expires.
+const expiryBatchSize = 100
+
 type orderService struct {
 	repo       repository.OrderRepositoryInterface
 	cfg        *config.Config
 	productSvc productService.ProductServiceInterface
 	userSvc    userService.UserServiceInterface
-	jobRepo    jobRepository.JobRepositoryInterface
+	queue      async.Enqueuer
+	uow        uow.UnitOfWorkInterface
+	shipping   shipping.CalculatorInterface
 }
 
 // GetPublicOrderIDByOrderCode implements OrderServiceInterface.
@@ -53,30 +82,13 @@ func (o *orderService) GetOrderByOrderCode(ctx context.Context, orderCode string
 		return nil, err
 	}
 
-	userResponse, err := o.userSvc.GetCustomerByID(ctx, result.BuyerId)
-	if err != nil {
-		log.Errorf("[OrderService-3] GetOrderByOrderCode: %v", err)
+	orders := []entity.OrderEntity{*result}
+	if err := o.enrichOrders(ctx, orders); err != nil {
+		log.Errorf("[OrderService-2] GetOrderByOrderCode: %v", err)
 		return nil, err
 	}
 
-	result.BuyerName = userResponse.Name
-	result.BuyerEmail = userResponse.Email
-	result.BuyerPhone = userResponse.Phone
-	result.BuyerAddress = userResponse.Address
-
-	for key, val := range result.OrderItems {
-		productResponse, err := o.productSvc.GetByID(ctx, val.ProductID)
-		if err != nil {
-			log.Errorf("[OrderService-4] GetOrderByOrderCode: %v", err)
-			return nil, err
-		}
-
-		result.OrderItems[key].ProductImage = productResponse.Image
-		result.OrderItems[key].ProductName = productResponse.Name
-		result.OrderItems[key].Price = int64(productResponse.SalePrice)
-	}
-
-	return result, nil
+	return &orders[0], nil
 }
 
 // DeleteByID implements OrderServiceInterface.
@@ -102,156 +114,411 @@ func (o *orderService) DeleteByID(ctx context.Context, orderID int64) error {
 func (o *orderService) GetDetailCustomer(ctx context.Context, orderID int64) (*entity.OrderEntity, error) {
 	result, err := o.repo.GetByID(ctx, orderID)
 	if err != nil {
-		log.Errorf("[OrderService-1] GetByID: %v", err)
+		log.Errorf("[OrderService-1] GetDetailCustomer: %v", err)
 		return nil, err
 	}
 
-	userResponse, err := o.userSvc.GetCustomerByID(ctx, result.BuyerId)
-	if err != nil {
-		log.Errorf("[OrderService-3] GetByID: %v", err)
+	orders := []entity.OrderEntity{*result}
+	if err := o.enrichOrders(ctx, orders); err != nil {
+		log.Errorf("[OrderService-2] GetDetailCustomer: %v", err)
 		return nil, err
 	}
 
-	result.BuyerName = userResponse.Name
-	result.BuyerEmail = userResponse.Email
-	result.BuyerPhone = userResponse.Phone
-	result.BuyerAddress = userResponse.Address
-
-	for key, val := range result.OrderItems {
-		productResponse, err := o.productSvc.GetByID(ctx, val.ProductID)
-		if err != nil {
-			log.Errorf("[OrderService-3] GetByID: %v", err)
-			return nil, err
-		}
-
-		result.OrderItems[key].ProductImage = productResponse.Image
-		if len(productResponse.Child) > 0 {
-			result.OrderItems[key].ProductImage = productResponse.Child[0].Image
-		}
-		result.OrderItems[key].ProductName = productResponse.Name
-		result.OrderItems[key].Price = int64(productResponse.SalePrice)
-		result.OrderItems[key].ProductWeight = int64(productResponse.Weight)
-		result.OrderItems[key].ProductUnit = productResponse.Unit
-	}
-
-	return result, nil
+	return &orders[0], nil
 }
 
 // GetAllCustomer implements OrderServiceInterface.
 func (o *orderService) GetAllCustomer(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error) {
 	results, count, total, err := o.repo.GetAll(ctx, queryString)
 	if err != nil {
+		log.Errorf("[OrderService-1] GetAllCustomer: %v", err)
+		return nil, 0, 0, err
+	}
+
+	if err := o.enrichOrders(ctx, results); err != nil {
 		log.Errorf("[OrderService-2] GetAllCustomer: %v", err)
 		return nil, 0, 0, err
 	}
 
-	for key, val := range results {
-		userResponse, err := o.userSvc.GetCustomerByID(ctx, val.BuyerId)
+	return results, count, total, nil
+}
+
+// UpdateStatus implements OrderServiceInterface.
+func (o *orderService) UpdateStatus(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) error {
+	// The status change, its history row and the follow-up jobs commit
+	// together.
+	err := o.uow.Do(ctx, func(ctx context.Context) error {
+		buyerID, statusOrder, orderCode, err := o.repo.UpdateStatus(ctx, req, actor)
 		if err != nil {
-			log.Errorf("[OrderService-4] GetAllCustomer: %v", err)
-			return nil, 0, 0, err
+			log.Errorf("[OrderService-1] UpdateStatus: %v", err)
+			return err
 		}
 
-		results[key].BuyerName = userResponse.Name
-		results[key].BuyerEmail = userResponse.Email
-		results[key].BuyerPhone = userResponse.Phone
-		results[key].BuyerAddress = userResponse.Address
+		switch statusOrder {
+		case entity.OrderStatusPaid:
+			if err := o.commitReservations(ctx, req.ID); err != nil {
+				log.Errorf("[OrderService-2] UpdateStatus: %v", err)
+				return err
+			}
+		case entity.OrderStatusCancelled:
+			if err := o.queueCancellation(ctx, req.ID, orderCode, req.Remarks); err != nil {
+				log.Errorf("[OrderService-2] UpdateStatus: %v", err)
+				return err
+			}
+		case entity.OrderStatusExpired:
+			if err := o.queueExpiry(ctx, req.ID, orderCode); err != nil {
+				log.Errorf("[OrderService-2] UpdateStatus: %v", err)
+				return err
+			}
+		}
 
-		for key2, res := range val.OrderItems {
+		userResponse, err := o.userSvc.GetCustomerByID(ctx, buyerID)
+		if err != nil {
+			log.Errorf("[OrderService-3] UpdateStatus: %v", err)
+			return err
+		}
 
-			productResponse, err := o.productSvc.GetByID(ctx, res.ProductID)
-			if err != nil {
-				log.Errorf("[OrderService-5] GetAllCustomer: %v", err)
-				return nil, 0, 0, err
-			}
+		message := fmt.Sprintf("Hello,\n\nYour order with ID %s has been updated to status: %s.\n\nThank you for shopping with us!", orderCode, statusOrder)
+		if statusOrder == entity.OrderStatusExpired {
+			message = fmt.Sprintf("Hello,\n\nYour order with ID %s has expired because its payment was not completed in time, and the items have been released.\n\nYou are welcome to place a new order at any time.", orderCode)
+		}
 
-			val.OrderItems[key2].ProductImage = productResponse.Image
-			val.OrderItems[key2].ProductName = productResponse.Name
-			val.OrderItems[key2].Price = int64(productResponse.SalePrice)
-			val.OrderItems[key2].Quantity = res.Quantity
-			val.OrderItems[key2].ProductUnit = productResponse.Unit
-			val.OrderItems[key2].ProductWeight = int64(productResponse.Weight)
+		payload := map[string]interface{}{
+			"receiver_email": userResponse.Email,
+			"subject":        "Update Status Order",
+			"message":        message,
+			"type":           "UPDATE_STATUS",
+			"receiver_id":    buyerID,
 		}
+		// The Paid email carries the invoice, which its own job renders
+		// once the order is committed.
+		topic := "email_notification"
+		if statusOrder == entity.OrderStatusPaid {
+			topic = "order_invoice_email"
+			payload["order_id"] = req.ID
+		}
+
+		// A replayed status change must not email the buyer twice.
+		dedupKey := fmt.Sprintf("order_status_email:%s:%s", orderCode, statusOrder)
+		if err := o.queue.Enqueue(ctx, topic, payload, async.WithDedupKey(dedupKey, 0)); err != nil {
+			log.Errorf("[OrderService-4] UpdateStatus: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return results, count, total, nil
+	return nil
 }
 
-// UpdateStatus implements OrderServiceInterface.
-func (o *orderService) UpdateStatus(ctx context.Context, req entity.OrderEntity) error {
-	buyerID, statusOrder, orderCode, err := o.repo.UpdateStatus(ctx, req)
+// StartPayment implements OrderServiceInterface. It applies method's
+// payment window to a pending order, counted from when it was placed, moves
+// the order's stock reservations to the new deadline, and fails with "400"
+// if the order can no longer be paid.
+func (o *orderService) StartPayment(ctx context.Context, orderID int64, method string) error {
+	return o.uow.Do(ctx, func(ctx context.Context) error {
+		if err := o.repo.StartPayment(ctx, orderID, method, o.paymentWindow(method)); err != nil {
+			log.Errorf("[OrderService-1] StartPayment: %v", err)
+			return err
+		}
+
+		order, err := o.repo.GetByID(ctx, orderID)
+		if err != nil {
+			log.Errorf("[OrderService-2] StartPayment: %v", err)
+			return err
+		}
+
+		expiresAt := reservationExpiry(order.PaymentDueAt)
+		for _, item := range order.OrderItems {
+			if err := o.productSvc.ExtendReservation(ctx, fmt.Sprintf("order_item:%d", item.ID), expiresAt); err != nil {
+				log.Errorf("[OrderService-3] StartPayment: %v", err)
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ExpireOverdueOrders implements OrderServiceInterface. Pending orders past
+// their payment deadline are expired, which releases their stock, expires
+// their payment and tells the buyer.
+func (o *orderService) ExpireOverdueOrders(ctx context.Context) (int64, error) {
+	orderIDs, err := o.repo.GetOverdueOrderIDs(ctx, time.Now(), expiryBatchSize)
 	if err != nil {
-		log.Errorf("[OrderService-1] UpdateStatus: %v", err)
+		log.Errorf("[OrderService-1] ExpireOverdueOrders: %v", err)
+		return 0, err
+	}
+
+	var expired int64
+	for _, orderID := range orderIDs {
+		err := o.UpdateStatus(ctx, entity.OrderEntity{
+			ID:      orderID,
+			Status:  entity.OrderStatusExpired,
+			Remarks: "payment window passed",
+		}, entity.SystemActor)
+		if err != nil {
+			// Paid or cancelled since it was listed.
+			if err.Error() == "400" {
+				continue
+			}
+			log.Errorf("[OrderService-2] ExpireOverdueOrders: %v", err)
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// CancelOrder implements OrderServiceInterface. Customers may only cancel
+// their own orders; whether the order can still be cancelled is up to the
+// status lifecycle.
+func (o *orderService) CancelOrder(ctx context.Context, orderID int64, reason string, actor entity.OrderActor) error {
+	if actor.Role == entity.OrderActorCustomer {
+		order, err := o.repo.GetByID(ctx, orderID)
+		if err != nil {
+			log.Errorf("[OrderService-1] CancelOrder: %v", err)
+			return err
+		}
+		if order.BuyerId != actor.ID {
+			log.Infof("[OrderService-2] CancelOrder: order %d does not belong to user %d", orderID, actor.ID)
+			return errors.New("404")
+		}
+	}
+
+	return o.UpdateStatus(ctx, entity.OrderEntity{
+		ID:      orderID,
+		Status:  entity.OrderStatusCancelled,
+		Remarks: reason,
+	}, actor)
+}
+
+// queueCancellation gives back the stock of every item, closes the order's
+// payment if it is still pending, so the customer can't pay a cancelled
+// order, and refunds it if it was paid. Each job is a no-op when there is
+// nothing to undo.
+func (o *orderService) queueCancellation(ctx context.Context, orderID int64, orderCode, reason string) error {
+	if err := o.queueStockRelease(ctx, orderID); err != nil {
 		return err
 	}
 
-	userResponse, err := o.userSvc.GetCustomerByID(ctx, buyerID)
-	if err != nil {
-		log.Errorf("[OrderService-3] UpdateStatus: %v", err)
+	expirePayload := map[string]interface{}{
+		"order_id":   orderID,
+		"order_code": orderCode,
+	}
+	if err := o.queue.Enqueue(ctx, "payment_expire", expirePayload, async.WithDedupKey(fmt.Sprintf("payment_expire:order:%d", orderID), 0)); err != nil {
 		return err
 	}
 
-	// Create Job for Email Notification
-	message := fmt.Sprintf("Hello,\n\nYour order with ID %s has been updated to status: %s.\n\nThank you for shopping with us!", orderCode, statusOrder)
+	payload := map[string]interface{}{
+		"order_id":   orderID,
+		"order_code": orderCode,
+		"reason":     reason,
+	}
+	return o.queue.Enqueue(ctx, "payment_refund", payload, async.WithDedupKey(fmt.Sprintf("payment_refund:order:%d", orderID), 0))
+}
+
+// queueExpiry releases an expired order's stock and expires its payment.
+func (o *orderService) queueExpiry(ctx context.Context, orderID int64, orderCode string) error {
+	if err := o.queueStockRelease(ctx, orderID); err != nil {
+		return err
+	}
 
 	payload := map[string]interface{}{
-		"receiver_email": userResponse.Email,
-		"subject":        "Update Status Order",
-		"message":        message,
-		"type":           "UPDATE_STATUS",
-		"receiver_id":    buyerID,
+		"order_id":   orderID,
+		"order_code": orderCode,
 	}
+	return o.queue.Enqueue(ctx, "payment_expire", payload, async.WithDedupKey(fmt.Sprintf("payment_expire:order:%d", orderID), 0))
+}
 
-	err = o.jobRepo.CreateJob(ctx, "email_notification", payload)
+// queueStockRelease gives back the stock held or taken by an order's items.
+func (o *orderService) queueStockRelease(ctx context.Context, orderID int64) error {
+	order, err := o.repo.GetByID(ctx, orderID)
 	if err != nil {
-		log.Errorf("[OrderService] Failed to queue email job: %v", err)
+		return err
+	}
+
+	for _, item := range order.OrderItems {
+		reference := fmt.Sprintf("order_item:%d", item.ID)
+		payload := map[string]interface{}{
+			"product_id": item.StockProductID(),
+			"quantity":   item.Quantity,
+			"reference":  reference,
+		}
+		if err := o.queue.Enqueue(ctx, "stock_restore", payload, async.WithDedupKey("stock_restore:"+reference, 0)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Push Notif? Can use same job or separate. old code had both.
-	// For simplicity, let's assume 'email_notification' job handles both or we add 'push_notification'.
-	// In worker.go we only implemented 'email_notification' handler.
-	// Let's stick to email for now as primary content.
+// reserveStock holds stock for each of an order's items, referenced by
+// item so the hold can later be committed or released.
+func (o *orderService) reserveStock(ctx context.Context, orderID int64) error {
+	order, err := o.repo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
 
+	// Lock products in a fixed order so two orders sharing products can't
+	// deadlock.
+	items := append([]entity.OrderItemEntity(nil), order.OrderItems...)
+	sort.Slice(items, func(i, j int) bool { return items[i].StockProductID() < items[j].StockProductID() })
+
+	expiresAt := reservationExpiry(order.PaymentDueAt)
+	for _, item := range items {
+		reference := fmt.Sprintf("order_item:%d", item.ID)
+		err := o.productSvc.ReserveStock(ctx, item.StockProductID(), int(item.Quantity), reference, expiresAt)
+		if errors.Is(err, productService.ErrInsufficientStock) {
+			return &InsufficientStockError{ProductID: item.ProductID, Requested: item.Quantity}
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// commitReservations keeps the stock held for a paid order's items.
+func (o *orderService) commitReservations(ctx context.Context, orderID int64) error {
+	order, err := o.repo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range order.OrderItems {
+		if err := o.productSvc.CommitReservation(ctx, fmt.Sprintf("order_item:%d", item.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *orderService) paymentWindow(method string) time.Duration {
+	if o.cfg == nil {
+		return config.DefaultPaymentWindow
+	}
+	return o.cfg.Order.PaymentWindow(method)
+}
+
+// reservationExpiry is when the stock of an order due for payment at dueAt
+// stops being held. Orders without a deadline are committed as soon as
+// they are placed, so their reservations only need the grace period.
+func reservationExpiry(dueAt *time.Time) time.Time {
+	if dueAt == nil {
+		return time.Now().Add(stockReservationGrace)
+	}
+	return dueAt.Add(stockReservationGrace)
+}
+
 // CreateOrder implements OrderServiceInterface.
 func (o *orderService) CreateOrder(ctx context.Context, req entity.OrderEntity) (int64, error) {
-	req.OrderCode = conv.GenerateOrderCode()
-	shippingFee := 0
-	if req.ShippingType == "Delivery" {
-		shippingFee = 5000
-	}
-	req.ShippingFee = int64(shippingFee)
-	req.Status = "Pending"
-	orderID, err := o.repo.CreateOrder(ctx, req)
+	pricing, err := o.priceOrder(ctx, req)
 	if err != nil {
 		log.Errorf("[OrderService-1] CreateOrder: %v", err)
 		return 0, err
 	}
+	if req.TotalAmount != pricing.GrandTotal {
+		return 0, &PriceMismatchError{Submitted: req.TotalAmount, Pricing: pricing}
+	}
 
-	_, err = o.GetByID(ctx, orderID)
+	for i, line := range pricing.Lines {
+		req.OrderItems[i].Price = line.UnitPrice
+		req.OrderItems[i].VariantID = line.VariantID
+	}
+	req.Subtotal = pricing.Subtotal
+	req.Discount = pricing.Discount
+	req.ShippingFee = pricing.ShippingFee
+	req.TotalAmount = pricing.GrandTotal
+	req.OrderCode = conv.GenerateOrderCode()
+	req.Status = entity.OrderStatusPending
+	paymentDueAt := time.Now().Add(o.paymentWindow(req.PaymentMethod))
+	req.PaymentDueAt = &paymentDueAt
+
+	// The order and its stock reservations commit together: if any item is
+	// out of stock, no order is placed.
+	var orderID int64
+	err = o.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		orderID, err = o.repo.CreateOrder(ctx, req)
+		if err != nil {
+			log.Errorf("[OrderService-2] CreateOrder: %v", err)
+			return err
+		}
+
+		if err := o.reserveStock(ctx, orderID); err != nil {
+			log.Errorf("[OrderService-3] CreateOrder: %v", err)
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
-		log.Errorf("[OrderService-2] CreateOrder: %v", err)
+		return 0, err
 	}
 
-	// No need to publish order to queue for ES anymore
-	// if err := o.publisherRabbitMQ.PublishOrderToQueue(*resultData); err != nil { ... }
+	return orderID, nil
+}
 
-	// Stock Update Jobs
-	for _, orderItem := range req.OrderItems {
-		payload := map[string]interface{}{
-			"product_id": orderItem.ProductID,
-			"quantity":   orderItem.Quantity,
+// CreateExchangeOrder implements OrderServiceInterface. It places the
+// replacement for a returned item as an order that is already paid and
+// costs nothing, and takes its stock straight away.
+func (o *orderService) CreateExchangeOrder(ctx context.Context, req entity.OrderEntity) (int64, error) {
+	now := time.Now()
+	for i := range req.OrderItems {
+		req.OrderItems[i].Price = 0
+	}
+	req.OrderCode = conv.GenerateOrderCode()
+	req.OrderDate = now.Format("2006-01-02")
+	req.OrderTime = now.Format("15:04:05")
+	req.Status = entity.OrderStatusPaid
+	req.PaymentMethod = PaymentMethodExchange
+	req.PaymentDueAt = nil
+	req.Subtotal, req.Discount, req.ShippingFee, req.TotalAmount = 0, 0, 0, 0
+
+	var orderID int64
+	err := o.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		orderID, err = o.repo.CreateOrder(ctx, req)
+		if err != nil {
+			log.Errorf("[OrderService-1] CreateExchangeOrder: %v", err)
+			return err
 		}
-		if err := o.jobRepo.CreateJob(ctx, "stock_update", payload); err != nil {
-			log.Errorf("[OrderService] Failed to queue stock update job: %v", err)
+
+		if err := o.reserveStock(ctx, orderID); err != nil {
+			log.Errorf("[OrderService-2] CreateExchangeOrder: %v", err)
+			return err
+		}
+		if err := o.commitReservations(ctx, orderID); err != nil {
+			log.Errorf("[OrderService-3] CreateExchangeOrder: %v", err)
+			return err
 		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return orderID, nil
 }
 
+// QuoteOrder implements OrderServiceInterface. It prices req the way
+// CreateOrder would, without placing it.
+func (o *orderService) QuoteOrder(ctx context.Context, req entity.OrderEntity) (entity.OrderPricing, error) {
+	pricing, err := o.priceOrder(ctx, req)
+	if err != nil {
+		log.Errorf("[OrderService-1] QuoteOrder: %v", err)
+		return entity.OrderPricing{}, err
+	}
+
+	return pricing, nil
+}
+
 // GetByID implements OrderServiceInterface.
 func (o *orderService) GetByID(ctx context.Context, orderID int64) (*entity.OrderEntity, error) {
 	result, err := o.repo.GetByID(ctx, orderID)
@@ -260,70 +527,39 @@ func (o *orderService) GetByID(ctx context.Context, orderID int64) (*entity.Orde
 		return nil, err
 	}
 
-	userResponse, err := o.userSvc.GetCustomerByID(ctx, result.BuyerId)
-	if err != nil {
+	orders := []entity.OrderEntity{*result}
+	if err := o.enrichOrders(ctx, orders); err != nil {
 		log.Errorf("[OrderService-2] GetByID: %v", err)
 		return nil, err
 	}
 
-	result.BuyerName = userResponse.Name
-	result.BuyerEmail = userResponse.Email
-	result.BuyerPhone = userResponse.Phone
-	result.BuyerAddress = userResponse.Address
-
-	for key, val := range result.OrderItems {
-		productResponse, err := o.productSvc.GetByID(ctx, val.ProductID)
-		if err != nil {
-			log.Errorf("[OrderService-3] GetByID: %v", err)
-			return nil, err
-		}
-
-		result.OrderItems[key].ProductImage = productResponse.Image
-		result.OrderItems[key].ProductName = productResponse.Name
-		result.OrderItems[key].Price = int64(productResponse.SalePrice)
-	}
-
-	return result, nil
+	return &orders[0], nil
 }
 
 // GetAll implements OrderServiceInterface.
 func (o *orderService) GetAll(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error) {
 	results, count, total, err := o.repo.GetAll(ctx, queryString)
 	if err != nil {
-		log.Errorf("[OrderService-2] GetAll: %v", err)
+		log.Errorf("[OrderService-1] GetAll: %v", err)
 		return nil, 0, 0, err
 	}
 
-	for key, val := range results {
-
-		userResponse, err := o.userSvc.GetCustomerByID(ctx, val.BuyerId)
-		if err != nil {
-			log.Errorf("[OrderService-4] GetAll: %v", err)
-			return nil, 0, 0, err
-		}
-		results[key].BuyerName = userResponse.Name
-
-		for key2, res := range val.OrderItems {
-
-			productResponse, err := o.productSvc.GetByID(ctx, res.ProductID)
-			if err != nil {
-				log.Errorf("[OrderService-5] GetAll: %v", err)
-				return nil, 0, 0, err
-			}
-
-			val.OrderItems[key2].ProductImage = productResponse.Image
-		}
+	if err := o.enrichOrders(ctx, results); err != nil {
+		log.Errorf("[OrderService-2] GetAll: %v", err)
+		return nil, 0, 0, err
 	}
 
 	return results, count, total, nil
 }
 
-func NewOrderService(repo repository.OrderRepositoryInterface, cfg *config.Config, jobRepo jobRepository.JobRepositoryInterface, productSvc productService.ProductServiceInterface, userSvc userService.UserServiceInterface) OrderServiceInterface {
+func NewOrderService(repo repository.OrderRepositoryInterface, cfg *config.Config, uow uow.UnitOfWorkInterface, queue async.Enqueuer, productSvc productService.ProductServiceInterface, userSvc userService.UserServiceInterface) OrderServiceInterface {
 	return &orderService{
 		repo:       repo,
 		cfg:        cfg,
-		jobRepo:    jobRepo,
+		uow:        uow,
+		queue:      queue,
 		productSvc: productSvc,
 		userSvc:    userSvc,
+		shipping:   shipping.NewCalculator(cfg),
 	}
 }
@@ -3,12 +3,16 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"tofash/internal/config"
 	"tofash/internal/modules/order/entity"
 	productEntity "tofash/internal/modules/product/entity"
+	productService "tofash/internal/modules/product/service"
 	userEntity "tofash/internal/modules/user/entity"
+	"tofash/internal/shared/async"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,11 +21,13 @@ import (
 
 type mockOrderRepo struct {
 	getAllFn              func(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error)
+	getForExportFn        func(ctx context.Context, queryString entity.QueryStringEntity, createdBefore time.Time, afterID int64, limit int) ([]entity.OrderEntity, error)
 	getByIDFn             func(ctx context.Context, orderID int64) (*entity.OrderEntity, error)
 	createOrderFn         func(ctx context.Context, req entity.OrderEntity) (int64, error)
-	updateStatusFn        func(ctx context.Context, req entity.OrderEntity) (int64, string, string, error)
+	updateStatusFn        func(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) (int64, string, string, error)
 	deleteOrderFn         func(ctx context.Context, orderID int64) error
 	getOrderByOrderCodeFn func(ctx context.Context, orderCode string) (*entity.OrderEntity, error)
+	getOverdueOrderIDsFn  func(ctx context.Context, now time.Time, limit int) ([]int64, error)
 }
 
 func (m *mockOrderRepo) GetAll(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error) {
@@ -31,6 +37,13 @@ func (m *mockOrderRepo) GetAll(ctx context.Context, queryString entity.QueryStri
 	return nil, 0, 0, nil
 }
 
+func (m *mockOrderRepo) GetForExport(ctx context.Context, queryString entity.QueryStringEntity, createdBefore time.Time, afterID int64, limit int) ([]entity.OrderEntity, error) {
+	if m.getForExportFn != nil {
+		return m.getForExportFn(ctx, queryString, createdBefore, afterID, limit)
+	}
+	return nil, nil
+}
+
 func (m *mockOrderRepo) GetByID(ctx context.Context, orderID int64) (*entity.OrderEntity, error) {
 	if m.getByIDFn != nil {
 		return m.getByIDFn(ctx, orderID)
@@ -45,9 +58,9 @@ func (m *mockOrderRepo) CreateOrder(ctx context.Context, req entity.OrderEntity)
 	return 0, nil
 }
 
-func (m *mockOrderRepo) UpdateStatus(ctx context.Context, req entity.OrderEntity) (int64, string, string, error) {
+func (m *mockOrderRepo) UpdateStatus(ctx context.Context, req entity.OrderEntity, actor entity.OrderActor) (int64, string, string, error) {
 	if m.updateStatusFn != nil {
-		return m.updateStatusFn(ctx, req)
+		return m.updateStatusFn(ctx, req, actor)
 	}
 	return 0, "", "", nil
 }
@@ -66,58 +79,48 @@ func (m *mockOrderRepo) GetOrderByOrderCode(ctx context.Context, orderCode strin
 	return nil, nil
 }
 
-type mockOrderPublisher struct {
-	publishUpdateStockFn               func(productID int64, quantity int64)
-	publishOrderToQueueFn              func(order entity.OrderEntity) error
-	publishSendEmailUpdateStatusFn     func(email, message, queuename string, userID int64) error
-	publishDeleteOrderFromQueueFn      func(orderID int64) error
-	publishSendPushNotifUpdateStatusFn func(message, queuename string, userID int64) error
-	publishUpdateStatusFn              func(queuename string, orderID int64, status string) error
+func (m *mockOrderRepo) StartPayment(ctx context.Context, orderID int64, method string, window time.Duration) error {
+	return nil
 }
 
-func (m *mockOrderPublisher) PublishUpdateStock(productID int64, quantity int64) {
-	if m.publishUpdateStockFn != nil {
-		m.publishUpdateStockFn(productID, quantity)
+func (m *mockOrderRepo) GetOverdueOrderIDs(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	if m.getOverdueOrderIDsFn != nil {
+		return m.getOverdueOrderIDsFn(ctx, now, limit)
 	}
+	return nil, nil
 }
 
-func (m *mockOrderPublisher) PublishOrderToQueue(order entity.OrderEntity) error {
-	if m.publishOrderToQueueFn != nil {
-		return m.publishOrderToQueueFn(order)
-	}
-	return nil
+type mockQueue struct {
+	enqueueFn func(ctx context.Context, topic string, payload interface{}) error
 }
 
-func (m *mockOrderPublisher) PublishSendEmailUpdateStatus(email, message, queuename string, userID int64) error {
-	if m.publishSendEmailUpdateStatusFn != nil {
-		return m.publishSendEmailUpdateStatusFn(email, message, queuename, userID)
+func (m *mockQueue) Enqueue(ctx context.Context, topic string, payload interface{}, _ ...async.EnqueueOption) error {
+	if m.enqueueFn != nil {
+		return m.enqueueFn(ctx, topic, payload)
 	}
 	return nil
 }
 
-func (m *mockOrderPublisher) PublishDeleteOrderFromQueue(orderID int64) error {
-	if m.publishDeleteOrderFromQueueFn != nil {
-		return m.publishDeleteOrderFromQueueFn(orderID)
-	}
-	return nil
+// mockUnitOfWork runs fn directly and records whether it failed, standing
+// in for a rollback.
+type mockUnitOfWork struct {
+	rolledBack bool
 }
 
-func (m *mockOrderPublisher) PublishSendPushNotifUpdateStatus(message, queuename string, userID int64) error {
-	if m.publishSendPushNotifUpdateStatusFn != nil {
-		return m.publishSendPushNotifUpdateStatusFn(message, queuename, userID)
-	}
-	return nil
-}
-
-func (m *mockOrderPublisher) PublishUpdateStatus(queuename string, orderID int64, status string) error {
-	if m.publishUpdateStatusFn != nil {
-		return m.publishUpdateStatusFn(queuename, orderID, status)
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		m.rolledBack = true
+		return err
 	}
 	return nil
 }
 
 type mockProductService struct {
-	getByIDFn func(ctx context.Context, productID int64) (*productEntity.ProductEntity, error)
+	getByIDFn    func(ctx context.Context, productID int64) (*productEntity.ProductEntity, error)
+	reserveFn    func(ctx context.Context, productID int64, quantity int, reference string) error
+	committed    []string
+	extended     map[string]time.Time
+	batchLookups int
 }
 
 func (m *mockProductService) GetAll(ctx context.Context, query productEntity.QueryStringProduct) ([]productEntity.ProductEntity, int64, int64, error) {
@@ -131,6 +134,17 @@ func (m *mockProductService) GetByID(ctx context.Context, productID int64) (*pro
 	return nil, nil
 }
 
+func (m *mockProductService) GetByIDs(ctx context.Context, productIDs []int64) (map[int64]*productEntity.ProductEntity, error) {
+	m.batchLookups++
+	products := map[int64]*productEntity.ProductEntity{}
+	for _, productID := range productIDs {
+		if product, err := m.GetByID(ctx, productID); err == nil && product != nil {
+			products[productID] = product
+		}
+	}
+	return products, nil
+}
+
 func (m *mockProductService) Create(ctx context.Context, req productEntity.ProductEntity) error {
 	return nil
 }
@@ -147,12 +161,45 @@ func (m *mockProductService) SearchProducts(ctx context.Context, query productEn
 	return nil, 0, 0, nil
 }
 
-func (m *mockProductService) UpdateStock(ctx context.Context, productID int64, quantity int) error {
+func (m *mockProductService) UpdateStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+
+func (m *mockProductService) RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+
+func (m *mockProductService) ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+
+func (m *mockProductService) ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error {
+	if m.reserveFn != nil {
+		return m.reserveFn(ctx, productID, quantity, reference)
+	}
 	return nil
 }
 
+func (m *mockProductService) CommitReservation(ctx context.Context, reference string) error {
+	m.committed = append(m.committed, reference)
+	return nil
+}
+
+func (m *mockProductService) ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error {
+	if m.extended == nil {
+		m.extended = map[string]time.Time{}
+	}
+	m.extended[reference] = expiresAt
+	return nil
+}
+
+func (m *mockProductService) ReleaseExpiredReservations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
 type mockUserService struct {
-	getByIDFn func(ctx context.Context, userID int64) (*userEntity.UserEntity, error)
+	getByIDFn    func(ctx context.Context, userID int64) (*userEntity.UserEntity, error)
+	batchLookups int
 }
 
 func (m *mockUserService) SignIn(ctx context.Context, req userEntity.UserEntity) (*userEntity.UserEntity, string, error) {
@@ -197,6 +244,17 @@ func (m *mockUserService) GetCustomerByID(ctx context.Context, customerID int64)
 	return nil, nil
 }
 
+func (m *mockUserService) GetByIDs(ctx context.Context, userIDs []int64) (map[int64]*userEntity.UserEntity, error) {
+	m.batchLookups++
+	users := map[int64]*userEntity.UserEntity{}
+	for _, userID := range userIDs {
+		if user, err := m.GetCustomerByID(ctx, userID); err == nil && user != nil {
+			users[userID] = user
+		}
+	}
+	return users, nil
+}
+
 func (m *mockUserService) CreateCustomer(ctx context.Context, req userEntity.UserEntity) error {
 	return nil
 }
@@ -205,6 +263,10 @@ func (m *mockUserService) UpdateCustomer(ctx context.Context, req userEntity.Use
 	return nil
 }
 
+func (m *mockUserService) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockUserService) DeleteCustomer(ctx context.Context, customerID int64) error {
 	return nil
 }
@@ -224,7 +286,7 @@ func TestOrderService_GetAll_Success(t *testing.T) {
 		return &productEntity.ProductEntity{ID: 1, Name: "Product"}, nil
 	}}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, nil, mockProductSvc, mockUserSvc)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
 	result, total, page, err := svc.GetAll(ctx, entity.QueryStringEntity{})
 	assert.NoError(t, err)
 	assert.Equal(t, expected, result)
@@ -246,12 +308,37 @@ func TestOrderService_GetByID_Success(t *testing.T) {
 		return &productEntity.ProductEntity{ID: 1, Name: "Product"}, nil
 	}}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, nil, mockProductSvc, mockUserSvc)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
 	result, err := svc.GetByID(ctx, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, "John Doe", result.BuyerName)
 }
 
+func TestOrderService_GetByID_LegacyPricesSkipExchangeOrders(t *testing.T) {
+	ctx := context.Background()
+	orders := map[int64]*entity.OrderEntity{
+		1: {ID: 1, BuyerId: 10, PaymentMethod: "cod", OrderItems: []entity.OrderItemEntity{{ProductID: 1, Quantity: 1}}},
+		2: {ID: 2, BuyerId: 10, PaymentMethod: PaymentMethodExchange, OrderItems: []entity.OrderItemEntity{{ProductID: 1, Quantity: 1}}},
+	}
+	mockRepo := &mockOrderRepo{getByIDFn: func(_ context.Context, orderID int64) (*entity.OrderEntity, error) {
+		return orders[orderID], nil
+	}}
+	mockUserSvc := &mockUserService{}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{ID: 1, Name: "Product", SalePrice: 90000}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
+
+	legacy, err := svc.GetByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(90000), legacy.OrderItems[0].Price)
+
+	exchange, err := svc.GetByID(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), exchange.OrderItems[0].Price)
+	assert.Equal(t, "Product", exchange.OrderItems[0].ProductName)
+}
+
 func TestOrderService_CreateOrder_Success(t *testing.T) {
 	ctx := context.Background()
 	createdID := int64(42)
@@ -272,49 +359,307 @@ func TestOrderService_CreateOrder_Success(t *testing.T) {
 		},
 		getByIDFn: func(_ context.Context, id int64) (*entity.OrderEntity, error) {
 			if id == createdID {
-				return &orderReq, nil
+				created := orderReq
+				created.OrderItems = []entity.OrderItemEntity{{ID: 9, ProductID: 1, VariantID: 1, Quantity: 2}}
+				return &created, nil
 			}
 			return nil, errors.New("not found")
 		},
 	}
-	mockPub := &mockOrderPublisher{publishOrderToQueueFn: func(o entity.OrderEntity) error { return nil }}
 	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, _ int64) (*userEntity.UserEntity, error) {
 		return &userEntity.UserEntity{ID: 10, Name: "John"}, nil
 	}}
-	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
-		return &productEntity.ProductEntity{ID: 1, Name: "Product"}, nil
-	}}
+	var reserved []string
+	mockProductSvc := &mockProductService{
+		getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+			return &productEntity.ProductEntity{ID: 1, Name: "Product", SalePrice: 50000, Stock: 10}, nil
+		},
+		reserveFn: func(_ context.Context, productID int64, quantity int, reference string) error {
+			reserved = append(reserved, fmt.Sprintf("%d:%d:%s", productID, quantity, reference))
+			return nil
+		},
+	}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, mockPub, mockProductSvc, mockUserSvc)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, &mockQueue{}, mockProductSvc, mockUserSvc)
 	result, err := svc.CreateOrder(ctx, orderReq)
 	assert.NoError(t, err)
 	assert.Equal(t, createdID, result)
+	assert.Equal(t, []string{"1:2:order_item:9"}, reserved)
+}
+
+func TestOrderService_CreateOrder_OutOfStockRollsBack(t *testing.T) {
+	ctx := context.Background()
+	orderReq := entity.OrderEntity{
+		OrderDate: "2025-12-28",
+		OrderItems: []entity.OrderItemEntity{
+			{ProductID: 1, Quantity: 2},
+		},
+	}
+	mockRepo := &mockOrderRepo{
+		createOrderFn: func(_ context.Context, _ entity.OrderEntity) (int64, error) {
+			return 42, nil
+		},
+		getByIDFn: func(_ context.Context, _ int64) (*entity.OrderEntity, error) {
+			return &orderReq, nil
+		},
+	}
+	// Another buyer took the last units between pricing and reserving.
+	mockProductSvc := &mockProductService{
+		getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+			return &productEntity.ProductEntity{ID: 1, Name: "Product", Stock: 10}, nil
+		},
+		reserveFn: func(_ context.Context, _ int64, _ int, _ string) error {
+			return productService.ErrInsufficientStock
+		},
+	}
+	mockUow := &mockUnitOfWork{}
+	svc := NewOrderService(mockRepo, &config.Config{}, mockUow, &mockQueue{}, mockProductSvc, nil)
+	_, err := svc.CreateOrder(ctx, orderReq)
+	var outOfStock *InsufficientStockError
+	assert.ErrorAs(t, err, &outOfStock)
+	assert.True(t, mockUow.rolledBack)
+}
+
+func TestOrderService_CreateOrder_PricesVariantsServerSide(t *testing.T) {
+	ctx := context.Background()
+	orderReq := entity.OrderEntity{
+		OrderDate:    "2025-12-28",
+		ShippingType: "Delivery",
+		TotalAmount:  1000,
+		OrderItems: []entity.OrderItemEntity{
+			{ProductID: 1, Quantity: 2, Size: "L", Color: "Black"},
+		},
+	}
+	var created entity.OrderEntity
+	mockRepo := &mockOrderRepo{
+		createOrderFn: func(_ context.Context, req entity.OrderEntity) (int64, error) {
+			created = req
+			return 42, nil
+		},
+		getByIDFn: func(_ context.Context, _ int64) (*entity.OrderEntity, error) {
+			return &created, nil
+		},
+	}
+	mockJobs := &mockQueue{enqueueFn: func(_ context.Context, _ string, _ interface{}) error { return nil }}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{
+			ID: 1, RegulerPrice: 100000, SalePrice: 90000, Stock: 5, Weight: 600, Unit: "gram",
+			Child: []productEntity.ProductEntity{
+				{ID: 2, Size: "M", Color: "Black", RegulerPrice: 100000, SalePrice: 90000, Stock: 5},
+				{ID: 3, Size: "L", Color: "Black", RegulerPrice: 120000, SalePrice: 100000, Stock: 5},
+			},
+		}, nil
+	}}
+	// The buyer lives next to the store; two 600g shirts bill as 2kg.
+	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, _ int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: 10, Lat: "-6.2000", Lng: "106.8166"}, nil
+	}}
+	cfg := &config.Config{App: config.App{LatitudeRef: "-6.2000", LongitudeRef: "106.8166"}}
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, mockJobs, mockProductSvc, mockUserSvc)
+
+	_, err := svc.CreateOrder(ctx, orderReq)
+	var mismatch *PriceMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, entity.OrderPricing{
+		Lines: []entity.OrderPricingLine{{
+			ProductID: 1, VariantID: 3, Size: "L", Color: "Black", Quantity: 2,
+			RegularPrice: 120000, UnitPrice: 100000, LineTotal: 200000,
+		}},
+		Subtotal:    240000,
+		Discount:    40000,
+		ShippingFee: 7000,
+		GrandTotal:  207000,
+	}, mismatch.Pricing)
+	assert.Empty(t, created.OrderCode)
+
+	orderReq.TotalAmount = mismatch.Pricing.GrandTotal
+	_, err = svc.CreateOrder(ctx, orderReq)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(207000), created.TotalAmount)
+	assert.Equal(t, int64(100000), created.OrderItems[0].Price)
+}
+
+func TestOrderService_CreateOrder_UnknownVariant(t *testing.T) {
+	orderReq := entity.OrderEntity{
+		OrderItems: []entity.OrderItemEntity{{ProductID: 1, Quantity: 1, SKU: "NOPE"}},
+	}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{ID: 1, SKU: "TEE-BASE", SalePrice: 90000, Stock: 5}, nil
+	}}
+	svc := NewOrderService(&mockOrderRepo{}, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, nil)
+
+	_, err := svc.CreateOrder(context.Background(), orderReq)
+	assert.EqualError(t, err, "400")
+}
+
+func TestOrderService_QuoteOrder_InsufficientStock(t *testing.T) {
+	orderReq := entity.OrderEntity{
+		OrderItems: []entity.OrderItemEntity{{ProductID: 1, Quantity: 3}},
+	}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, _ int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{ID: 1, SalePrice: 90000, Stock: 2}, nil
+	}}
+	svc := NewOrderService(&mockOrderRepo{}, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, nil)
+
+	_, err := svc.QuoteOrder(context.Background(), orderReq)
+	var outOfStock *InsufficientStockError
+	assert.ErrorAs(t, err, &outOfStock)
+	assert.Equal(t, int64(3), outOfStock.Requested)
 }
 
 func TestOrderService_UpdateStatus_Success(t *testing.T) {
 	ctx := context.Background()
-	orderReq := entity.OrderEntity{ID: 5, Status: "Confirmed"}
+	orderReq := entity.OrderEntity{ID: 5, Status: entity.OrderStatusPaid}
+	admin := entity.OrderActor{ID: 1, Role: "Super Admin"}
+	var gotActor entity.OrderActor
 	mockRepo := &mockOrderRepo{
-		updateStatusFn: func(_ context.Context, _ entity.OrderEntity) (int64, string, string, error) {
-			return 10, "Confirmed", "ORD-001", nil
+		updateStatusFn: func(_ context.Context, _ entity.OrderEntity, actor entity.OrderActor) (int64, string, string, error) {
+			gotActor = actor
+			return 10, entity.OrderStatusPaid, "ORD-001", nil
+		},
+		getByIDFn: func(_ context.Context, _ int64) (*entity.OrderEntity, error) {
+			return &entity.OrderEntity{ID: 5, OrderItems: []entity.OrderItemEntity{{ID: 3}, {ID: 4}}}, nil
 		},
 	}
-	mockPub := &mockOrderPublisher{publishUpdateStatusFn: func(queuename string, orderID int64, status string) error { return nil }}
+	var email map[string]interface{}
+	mockJobs := &mockQueue{enqueueFn: func(_ context.Context, topic string, payload interface{}) error {
+		if topic == "order_invoice_email" {
+			email = payload.(map[string]interface{})
+		}
+		return nil
+	}}
 	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, _ int64) (*userEntity.UserEntity, error) {
 		return &userEntity.UserEntity{ID: 10, Name: "User"}, nil
 	}}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, productID int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{ID: productID, Name: "Linen Shirt", SalePrice: 100000}, nil
+	}}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, mockPub, nil, mockUserSvc)
-	err := svc.UpdateStatus(ctx, orderReq)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, mockJobs, mockProductSvc, mockUserSvc)
+	err := svc.UpdateStatus(ctx, orderReq, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, admin, gotActor)
+	assert.Equal(t, []string{"order_item:3", "order_item:4"}, mockProductSvc.committed)
+
+	// The Paid email goes through the invoice job, which renders the PDF
+	// itself; only the order ID travels in the payload.
+	assert.Equal(t, int64(5), email["order_id"])
+	assert.NotContains(t, email, "attachments")
+}
+
+func TestOrderService_CancelOrder_QueuesRestockAndRefund(t *testing.T) {
+	ctx := context.Background()
+	order := entity.OrderEntity{
+		ID:      7,
+		BuyerId: 10,
+		OrderItems: []entity.OrderItemEntity{
+			{ID: 70, ProductID: 1, Quantity: 2},
+			{ID: 71, ProductID: 2, Quantity: 1},
+		},
+	}
+	mockRepo := &mockOrderRepo{
+		getByIDFn: func(_ context.Context, _ int64) (*entity.OrderEntity, error) {
+			return &order, nil
+		},
+		updateStatusFn: func(_ context.Context, req entity.OrderEntity, _ entity.OrderActor) (int64, string, string, error) {
+			return 10, req.Status, "ORD-007", nil
+		},
+	}
+	var queued []string
+	mockJobs := &mockQueue{enqueueFn: func(_ context.Context, topic string, payload interface{}) error {
+		if p, ok := payload.(map[string]interface{}); ok && p["reference"] != nil {
+			topic += ":" + p["reference"].(string)
+		}
+		queued = append(queued, topic)
+		return nil
+	}}
+	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, _ int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: 10}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, mockJobs, nil, mockUserSvc)
+
+	err := svc.CancelOrder(ctx, 7, "changed my mind", entity.OrderActor{ID: 10, Role: entity.OrderActorCustomer})
 	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"stock_restore:order_item:70",
+		"stock_restore:order_item:71",
+		"payment_expire",
+		"payment_refund",
+		"email_notification",
+	}, queued)
+}
+
+func TestOrderService_StartPayment_HoldsStockUntilNewDeadline(t *testing.T) {
+	dueAt := time.Now().Add(48 * time.Hour)
+	mockRepo := &mockOrderRepo{getByIDFn: func(_ context.Context, orderID int64) (*entity.OrderEntity, error) {
+		return &entity.OrderEntity{ID: orderID, PaymentDueAt: &dueAt, OrderItems: []entity.OrderItemEntity{{ID: 70}, {ID: 71}}}, nil
+	}}
+	mockProductSvc := &mockProductService{}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, nil)
+
+	assert.NoError(t, svc.StartPayment(context.Background(), 7, "midtrans"))
+	assert.Equal(t, map[string]time.Time{
+		"order_item:70": dueAt.Add(stockReservationGrace),
+		"order_item:71": dueAt.Add(stockReservationGrace),
+	}, mockProductSvc.extended)
+}
+
+func TestOrderService_ExpireOverdueOrders_ReleasesStockAndPayment(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := &mockOrderRepo{
+		getOverdueOrderIDsFn: func(_ context.Context, _ time.Time, _ int) ([]int64, error) {
+			return []int64{7, 8}, nil
+		},
+		getByIDFn: func(_ context.Context, orderID int64) (*entity.OrderEntity, error) {
+			return &entity.OrderEntity{ID: orderID, OrderItems: []entity.OrderItemEntity{{ID: orderID * 10, ProductID: 1, Quantity: 1}}}, nil
+		},
+		updateStatusFn: func(_ context.Context, req entity.OrderEntity, _ entity.OrderActor) (int64, string, string, error) {
+			// Order 8 was paid between listing and expiring.
+			if req.ID == 8 {
+				return 0, "", "", errors.New("400")
+			}
+			return 10, req.Status, "ORD-007", nil
+		},
+	}
+	var queued []string
+	mockJobs := &mockQueue{enqueueFn: func(_ context.Context, topic string, payload interface{}) error {
+		if p, ok := payload.(map[string]interface{}); ok && p["reference"] != nil {
+			topic += ":" + p["reference"].(string)
+		}
+		queued = append(queued, topic)
+		return nil
+	}}
+	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, _ int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: 10}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, mockJobs, nil, mockUserSvc)
+
+	expired, err := svc.ExpireOverdueOrders(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+	assert.Equal(t, []string{
+		"stock_restore:order_item:70",
+		"payment_expire",
+		"email_notification",
+	}, queued)
+}
+
+func TestOrderService_CancelOrder_RejectsOtherCustomers(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := &mockOrderRepo{getByIDFn: func(_ context.Context, _ int64) (*entity.OrderEntity, error) {
+		return &entity.OrderEntity{ID: 7, BuyerId: 10}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, &mockQueue{}, nil, nil)
+
+	err := svc.CancelOrder(ctx, 7, "", entity.OrderActor{ID: 11, Role: entity.OrderActorCustomer})
+	assert.EqualError(t, err, "404")
 }
 
 func TestOrderService_DeleteByID_Success(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := &mockOrderRepo{deleteOrderFn: func(_ context.Context, _ int64) error { return nil }}
-	mockPub := &mockOrderPublisher{publishDeleteOrderFromQueueFn: func(orderID int64) error { return nil }}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, mockPub, nil, nil)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, &mockQueue{}, nil, nil)
 	err := svc.DeleteByID(ctx, 10)
 	assert.NoError(t, err)
 }
@@ -333,7 +678,7 @@ func TestOrderService_GetOrderByOrderCode_Success(t *testing.T) {
 		return &productEntity.ProductEntity{ID: 1, Name: "Product"}, nil
 	}}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, nil, mockProductSvc, mockUserSvc)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
 	result, err := svc.GetOrderByOrderCode(ctx, "ORD-001")
 	assert.NoError(t, err)
 	assert.Equal(t, "Jane Doe", result.BuyerName)
@@ -345,8 +690,84 @@ func TestOrderService_GetAll_ErrorPropagation(t *testing.T) {
 		return nil, 0, 0, errors.New("db error")
 	}}
 	cfg := &config.Config{}
-	svc := NewOrderService(mockRepo, cfg, nil, nil, nil)
+	svc := NewOrderService(mockRepo, cfg, &mockUnitOfWork{}, nil, nil, nil)
 	_, _, _, err := svc.GetAll(ctx, entity.QueryStringEntity{})
 	assert.Error(t, err)
 	assert.Equal(t, "db error", err.Error())
 }
+
+func TestOrderService_ExportOrders_PagesByLastID(t *testing.T) {
+	var afterIDs []int64
+	var snapshots []time.Time
+	mockRepo := &mockOrderRepo{getForExportFn: func(_ context.Context, q entity.QueryStringEntity, createdBefore time.Time, afterID int64, limit int) ([]entity.OrderEntity, error) {
+		assert.Equal(t, entity.OrderStatusPaid, q.Status)
+		afterIDs = append(afterIDs, afterID)
+		snapshots = append(snapshots, createdBefore)
+		var orders []entity.OrderEntity
+		for id := afterID + 1; id <= 250 && len(orders) < limit; id++ {
+			orders = append(orders, entity.OrderEntity{ID: id, OrderCode: fmt.Sprintf("ORD-%d", id), BuyerId: 10, OrderItems: []entity.OrderItemEntity{{ProductID: 1}}})
+		}
+		return orders, nil
+	}}
+	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, userID int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: userID, Name: "Siti"}, nil
+	}}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, productID int64) (*productEntity.ProductEntity, error) {
+		return &productEntity.ProductEntity{ID: productID, Name: "Linen Shirt"}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
+
+	var exported []entity.OrderEntity
+	err := svc.ExportOrders(context.Background(), entity.QueryStringEntity{Status: entity.OrderStatusPaid}, func(order entity.OrderEntity) error {
+		exported = append(exported, order)
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, exported, 250) {
+		assert.Equal(t, "ORD-250", exported[249].OrderCode)
+		assert.Equal(t, "Siti", exported[249].BuyerName)
+		assert.Equal(t, "Linen Shirt", exported[249].OrderItems[0].ProductName)
+	}
+
+	// The second batch starts after the first one's last id, and both see
+	// the same snapshot.
+	assert.Equal(t, []int64{0, 200}, afterIDs)
+	assert.Equal(t, snapshots[0], snapshots[1])
+}
+
+func TestOrderService_GetAllCustomer_BatchesLookups(t *testing.T) {
+	orders := []entity.OrderEntity{
+		{ID: 1, BuyerId: 10, OrderItems: []entity.OrderItemEntity{{ProductID: 1}, {ProductID: 2, VariantID: 21}}},
+		{ID: 2, BuyerId: 11, OrderItems: []entity.OrderItemEntity{{ProductID: 1, Price: 80000}}},
+		{ID: 3, BuyerId: 10, OrderItems: []entity.OrderItemEntity{{ProductID: 3}}},
+	}
+	mockRepo := &mockOrderRepo{getAllFn: func(_ context.Context, _ entity.QueryStringEntity) ([]entity.OrderEntity, int64, int64, error) {
+		return orders, 3, 1, nil
+	}}
+	mockUserSvc := &mockUserService{getByIDFn: func(_ context.Context, userID int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: userID, Name: fmt.Sprintf("Buyer %d", userID)}, nil
+	}}
+	mockProductSvc := &mockProductService{getByIDFn: func(_ context.Context, productID int64) (*productEntity.ProductEntity, error) {
+		if productID == 3 {
+			return nil, errors.New("404")
+		}
+		return &productEntity.ProductEntity{
+			ID: productID, Name: fmt.Sprintf("Product %d", productID), Image: "parent.jpg", SalePrice: 90000,
+			Child: []productEntity.ProductEntity{{ID: productID*10 + 1, Image: "variant.jpg"}},
+		}, nil
+	}}
+	svc := NewOrderService(mockRepo, &config.Config{}, &mockUnitOfWork{}, nil, mockProductSvc, mockUserSvc)
+
+	results, _, _, err := svc.GetAllCustomer(context.Background(), entity.QueryStringEntity{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mockUserSvc.batchLookups)
+	assert.Equal(t, 1, mockProductSvc.batchLookups)
+
+	assert.Equal(t, "Buyer 11", results[1].BuyerName)
+	assert.Equal(t, "parent.jpg", results[0].OrderItems[0].ProductImage)
+	assert.Equal(t, "variant.jpg", results[0].OrderItems[1].ProductImage)
+	assert.Equal(t, int64(90000), results[0].OrderItems[0].Price)
+	assert.Equal(t, int64(80000), results[1].OrderItems[0].Price)
+	// A deleted product leaves its item blank instead of failing the page.
+	assert.Empty(t, results[2].OrderItems[0].ProductName)
+}
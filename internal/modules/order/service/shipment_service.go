@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"tofash/internal/config"
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/repository"
+	"tofash/internal/modules/order/shipping"
+	userService "tofash/internal/modules/user/service"
+	"tofash/internal/shared/async"
+	"tofash/internal/shared/uow"
+
+	"github.com/labstack/gommon/log"
+)
+
+type ShipmentServiceInterface interface {
+	CreateShipment(ctx context.Context, req entity.ShipmentEntity, actor entity.OrderActor) (*entity.ShipmentEntity, error)
+	BookShipment(ctx context.Context, req entity.ShipmentEntity, weightGrams int64, actor entity.OrderActor) (*entity.ShipmentEntity, error)
+	CourierRates(ctx context.Context, orderID, weightGrams int64) ([]entity.CourierRate, error)
+	TrackShipment(ctx context.Context, shipmentID int64) (*entity.ShipmentEntity, error)
+	HandleTrackingWebhook(ctx context.Context, provider string, header http.Header, body []byte) error
+	GetByOrderID(ctx context.Context, orderID int64) ([]entity.ShipmentEntity, error)
+	GetByOrderIDCustomer(ctx context.Context, orderID, buyerID int64) ([]entity.ShipmentEntity, error)
+}
+
+type shipmentService struct {
+	repo      repository.ShipmentRepositoryInterface
+	orderRepo repository.OrderRepositoryInterface
+	cfg       *config.Config
+	uow       uow.UnitOfWorkInterface
+	queue     async.Enqueuer
+	userSvc   userService.UserServiceInterface
+	providers map[string]shipping.ShippingProvider
+}
+
+// CreateShipment implements ShipmentServiceInterface. It records the
+// shipment, moves the order to Partially Shipped or Shipped and emails the
+// buyer the courier and tracking link, all in one transaction.
+func (s *shipmentService) CreateShipment(ctx context.Context, req entity.ShipmentEntity, actor entity.OrderActor) (*entity.ShipmentEntity, error) {
+	order, err := s.orderRepo.GetByID(ctx, req.OrderID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] CreateShipment: %v", err)
+		return nil, err
+	}
+
+	if req.TrackingURL == "" {
+		req.TrackingURL = s.trackingURL(req.Courier, req.TrackingNumber)
+	}
+	req.CreatedBy = actor.ID
+
+	var shipment *entity.ShipmentEntity
+	err = s.uow.Do(ctx, func(ctx context.Context) error {
+		created, fullyShipped, err := s.repo.CreateShipment(ctx, req)
+		if err != nil {
+			log.Errorf("[ShipmentService-2] CreateShipment: %v", err)
+			return err
+		}
+		shipment = created
+
+		status := entity.OrderStatusPartiallyShipped
+		if fullyShipped {
+			status = entity.OrderStatusShipped
+		}
+		// Further parcels of a partially shipped order leave its status alone.
+		if status != entity.NormalizeOrderStatus(order.Status) {
+			_, _, _, err := s.orderRepo.UpdateStatus(ctx, entity.OrderEntity{
+				ID:      order.ID,
+				Status:  status,
+				Remarks: fmt.Sprintf("%s %s", req.Courier, req.TrackingNumber),
+			}, actor)
+			if err != nil {
+				log.Errorf("[ShipmentService-3] CreateShipment: %v", err)
+				return err
+			}
+		}
+
+		userResponse, err := s.userSvc.GetCustomerByID(ctx, order.BuyerId)
+		if err != nil {
+			log.Errorf("[ShipmentService-4] CreateShipment: %v", err)
+			return err
+		}
+
+		message := fmt.Sprintf("Hello,\n\nPart of your order with ID %s is on its way with %s.\n\nTracking number: %s", order.OrderCode, req.Courier, req.TrackingNumber)
+		if fullyShipped {
+			message = fmt.Sprintf("Hello,\n\nYour order with ID %s is on its way with %s.\n\nTracking number: %s", order.OrderCode, req.Courier, req.TrackingNumber)
+		}
+		if req.TrackingURL != "" {
+			message += fmt.Sprintf("\nTrack your parcel: %s", req.TrackingURL)
+		}
+		message += "\n\nThank you for shopping with us!"
+
+		payload := map[string]interface{}{
+			"receiver_email": userResponse.Email,
+			"subject":        "Your Order Has Shipped",
+			"message":        message,
+			"type":           "SHIPMENT",
+			"receiver_id":    order.BuyerId,
+		}
+		dedupKey := fmt.Sprintf("shipment_email:%d", shipment.ID)
+		if err := s.queue.Enqueue(ctx, "email_notification", payload, async.WithDedupKey(dedupKey, 0)); err != nil {
+			log.Errorf("[ShipmentService-5] CreateShipment: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shipment, nil
+}
+
+// BookShipment implements ShipmentServiceInterface. It books a pickup of
+// the parcel, weighing weightGrams, with req.Provider's req.Service and
+// records it as a shipment like CreateShipment does. Each parcel of an
+// order is booked under its own reference, so retrying a booking whose
+// shipment failed to save reuses the courier's booking.
+func (s *shipmentService) BookShipment(ctx context.Context, req entity.ShipmentEntity, weightGrams int64, actor entity.OrderActor) (*entity.ShipmentEntity, error) {
+	provider, ok := s.providers[req.Provider]
+	if !ok {
+		return nil, shipping.ErrUnknownProvider
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, req.OrderID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] BookShipment: %v", err)
+		return nil, err
+	}
+
+	existing, err := s.repo.GetByOrderID(ctx, order.ID)
+	if err != nil {
+		log.Errorf("[ShipmentService-2] BookShipment: %v", err)
+		return nil, err
+	}
+
+	destination, err := s.buyerAddress(ctx, order.BuyerId)
+	if err != nil {
+		log.Errorf("[ShipmentService-3] BookShipment: %v", err)
+		return nil, err
+	}
+
+	itemCount := int64(0)
+	for _, item := range req.Items {
+		itemCount += item.Quantity
+	}
+	if len(req.Items) == 0 {
+		for _, item := range order.OrderItems {
+			itemCount += item.Quantity
+		}
+	}
+
+	booking, err := provider.CreateBooking(ctx, shipping.BookingRequest{
+		Reference:   fmt.Sprintf("%s-%d", order.OrderCode, len(existing)+1),
+		Service:     req.Service,
+		Origin:      s.storeAddress(),
+		Destination: destination,
+		WeightGrams: weightGrams,
+		ItemCount:   itemCount,
+	})
+	if err != nil {
+		log.Errorf("[ShipmentService-4] BookShipment: %v", err)
+		return nil, err
+	}
+
+	req.Courier = booking.Courier
+	req.Service = booking.Service
+	req.TrackingNumber = booking.TrackingNumber
+	req.TrackingURL = booking.TrackingURL
+	req.Status = shipping.TrackingStatusBooked
+	return s.CreateShipment(ctx, req, actor)
+}
+
+// CourierRates implements ShipmentServiceInterface. It asks every courier
+// integration what sending the order's parcel would cost.
+func (s *shipmentService) CourierRates(ctx context.Context, orderID, weightGrams int64) ([]entity.CourierRate, error) {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] CourierRates: %v", err)
+		return nil, err
+	}
+
+	destination, err := s.buyerAddress(ctx, order.BuyerId)
+	if err != nil {
+		log.Errorf("[ShipmentService-2] CourierRates: %v", err)
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rates := []entity.CourierRate{}
+	for _, name := range names {
+		quoted, err := s.providers[name].Quote(ctx, shipping.RateRequest{
+			Origin:      s.storeAddress(),
+			Destination: destination,
+			WeightGrams: weightGrams,
+		})
+		if err != nil {
+			// One courier being down shouldn't hide the others' rates.
+			log.Errorf("[ShipmentService-3] CourierRates: %s: %v", name, err)
+			continue
+		}
+		for _, rate := range quoted {
+			rates = append(rates, entity.CourierRate{
+				Provider: name,
+				Courier:  rate.Courier,
+				Service:  rate.Service,
+				Fee:      rate.Fee,
+				EtaDays:  rate.EtaDays,
+			})
+		}
+	}
+
+	return rates, nil
+}
+
+// TrackShipment implements ShipmentServiceInterface. It pulls the latest
+// tracking from the courier the shipment was booked with. Shipments
+// entered by hand can't be tracked and fail with "400".
+func (s *shipmentService) TrackShipment(ctx context.Context, shipmentID int64) (*entity.ShipmentEntity, error) {
+	shipment, err := s.repo.GetByID(ctx, shipmentID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] TrackShipment: %v", err)
+		return nil, err
+	}
+
+	provider, ok := s.providers[shipment.Provider]
+	if !ok {
+		log.Infof("[ShipmentService-2] TrackShipment: Shipment %d has no courier integration", shipmentID)
+		return nil, errors.New("400")
+	}
+
+	events, err := provider.Track(ctx, shipment.TrackingNumber)
+	if err != nil {
+		log.Errorf("[ShipmentService-3] TrackShipment: %v", err)
+		return nil, err
+	}
+
+	return s.applyTracking(ctx, shipment, events)
+}
+
+// HandleTrackingWebhook implements ShipmentServiceInterface. Events for
+// parcels we don't know are logged and dropped, so the courier stops
+// resending them.
+func (s *shipmentService) HandleTrackingWebhook(ctx context.Context, providerName string, header http.Header, body []byte) error {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return shipping.ErrUnknownProvider
+	}
+
+	events, err := provider.ParseWebhook(header, body)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] HandleTrackingWebhook: %v", err)
+		return err
+	}
+
+	byTrackingNumber := map[string][]shipping.TrackingEvent{}
+	trackingNumbers := []string{}
+	for _, event := range events {
+		if _, ok := byTrackingNumber[event.TrackingNumber]; !ok {
+			trackingNumbers = append(trackingNumbers, event.TrackingNumber)
+		}
+		byTrackingNumber[event.TrackingNumber] = append(byTrackingNumber[event.TrackingNumber], event)
+	}
+
+	for _, trackingNumber := range trackingNumbers {
+		shipment, err := s.repo.GetByTrackingNumber(ctx, providerName, trackingNumber)
+		if err != nil {
+			if err.Error() == "404" {
+				log.Infof("[ShipmentService-2] HandleTrackingWebhook: No %s shipment %s", providerName, trackingNumber)
+				continue
+			}
+			log.Errorf("[ShipmentService-3] HandleTrackingWebhook: %v", err)
+			return err
+		}
+
+		if _, err := s.applyTracking(ctx, shipment, byTrackingNumber[trackingNumber]); err != nil {
+			log.Errorf("[ShipmentService-4] HandleTrackingWebhook: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTracking records events against the shipment and, once every
+// parcel of a fully shipped order has arrived, marks the order Delivered
+// and tells the buyer.
+func (s *shipmentService) applyTracking(ctx context.Context, shipment *entity.ShipmentEntity, events []shipping.TrackingEvent) (*entity.ShipmentEntity, error) {
+	tracked := make([]entity.ShipmentTrackingEventEntity, 0, len(events))
+	for _, event := range events {
+		tracked = append(tracked, entity.ShipmentTrackingEventEntity{
+			Status:      event.Status,
+			Description: event.Description,
+			Location:    event.Location,
+			OccurredAt:  event.OccurredAt,
+		})
+	}
+
+	var updated *entity.ShipmentEntity
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.repo.RecordTrackingEvents(ctx, shipment.ID, tracked)
+		if err != nil {
+			log.Errorf("[ShipmentService-1] applyTracking: %v", err)
+			return err
+		}
+		if updated.Status != shipping.TrackingStatusDelivered {
+			return nil
+		}
+
+		order, err := s.orderRepo.GetByID(ctx, updated.OrderID)
+		if err != nil {
+			log.Errorf("[ShipmentService-2] applyTracking: %v", err)
+			return err
+		}
+		// Parcels still to be sent keep the order open.
+		if entity.NormalizeOrderStatus(order.Status) != entity.OrderStatusShipped {
+			return nil
+		}
+
+		undelivered, err := s.repo.CountUndelivered(ctx, order.ID)
+		if err != nil {
+			log.Errorf("[ShipmentService-3] applyTracking: %v", err)
+			return err
+		}
+		if undelivered > 0 {
+			return nil
+		}
+
+		_, _, _, err = s.orderRepo.UpdateStatus(ctx, entity.OrderEntity{
+			ID:      order.ID,
+			Status:  entity.OrderStatusDelivered,
+			Remarks: "All parcels delivered",
+		}, entity.SystemActor)
+		if err != nil {
+			log.Errorf("[ShipmentService-4] applyTracking: %v", err)
+			return err
+		}
+
+		userResponse, err := s.userSvc.GetCustomerByID(ctx, order.BuyerId)
+		if err != nil {
+			log.Errorf("[ShipmentService-5] applyTracking: %v", err)
+			return err
+		}
+
+		payload := map[string]interface{}{
+			"receiver_email": userResponse.Email,
+			"subject":        "Update Status Order",
+			"message":        fmt.Sprintf("Hello,\n\nYour order with ID %s has been delivered.\n\nThank you for shopping with us!", order.OrderCode),
+			"type":           "UPDATE_STATUS",
+			"receiver_id":    order.BuyerId,
+		}
+		// Shares UpdateStatus's key, so an admin marking the order
+		// delivered as well doesn't email twice.
+		dedupKey := fmt.Sprintf("order_status_email:%s:%s", order.OrderCode, entity.OrderStatusDelivered)
+		if err := s.queue.Enqueue(ctx, "email_notification", payload, async.WithDedupKey(dedupKey, 0)); err != nil {
+			log.Errorf("[ShipmentService-6] applyTracking: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// buyerAddress is where the buyer's parcels go.
+func (s *shipmentService) buyerAddress(ctx context.Context, buyerID int64) (shipping.Address, error) {
+	buyer, err := s.userSvc.GetCustomerByID(ctx, buyerID)
+	if err != nil {
+		return shipping.Address{}, err
+	}
+
+	address := shipping.Address{Name: buyer.Name, Phone: buyer.Phone, Address: buyer.Address}
+	if location, ok := shipping.ParseLocation(buyer.Lat, buyer.Lng); ok {
+		address.Location = &location
+	}
+	return address, nil
+}
+
+// storeAddress is where parcels are picked up.
+func (s *shipmentService) storeAddress() shipping.Address {
+	address := shipping.Address{
+		Name:    s.cfg.Order.StoreName,
+		Phone:   s.cfg.Order.StorePhone,
+		Address: s.cfg.Order.StoreAddress,
+	}
+	if location, ok := shipping.ParseLocation(s.cfg.App.LatitudeRef, s.cfg.App.LongitudeRef); ok {
+		address.Location = &location
+	}
+	return address
+}
+
+// GetByOrderID implements ShipmentServiceInterface.
+func (s *shipmentService) GetByOrderID(ctx context.Context, orderID int64) ([]entity.ShipmentEntity, error) {
+	shipments, err := s.repo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] GetByOrderID: %v", err)
+		return nil, err
+	}
+
+	return shipments, nil
+}
+
+// GetByOrderIDCustomer implements ShipmentServiceInterface. Orders of other
+// buyers are reported as "404".
+func (s *shipmentService) GetByOrderIDCustomer(ctx context.Context, orderID, buyerID int64) ([]entity.ShipmentEntity, error) {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		log.Errorf("[ShipmentService-1] GetByOrderIDCustomer: %v", err)
+		return nil, err
+	}
+	if order.BuyerId != buyerID {
+		log.Infof("[ShipmentService-2] GetByOrderIDCustomer: Order %d does not belong to buyer %d", orderID, buyerID)
+		return nil, errors.New("404")
+	}
+
+	return s.GetByOrderID(ctx, orderID)
+}
+
+// trackingURL fills the configured template in, or returns "" when there
+// is none.
+func (s *shipmentService) trackingURL(courier, trackingNumber string) string {
+	return strings.NewReplacer(
+		"{courier}", url.QueryEscape(courier),
+		"{tracking_number}", url.QueryEscape(trackingNumber),
+	).Replace(s.cfg.Order.TrackingURLTemplate)
+}
+
+func NewShipmentService(repo repository.ShipmentRepositoryInterface, orderRepo repository.OrderRepositoryInterface, cfg *config.Config, uow uow.UnitOfWorkInterface, queue async.Enqueuer, userSvc userService.UserServiceInterface, providers ...shipping.ShippingProvider) ShipmentServiceInterface {
+	byName := make(map[string]shipping.ShippingProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &shipmentService{
+		repo:      repo,
+		orderRepo: orderRepo,
+		cfg:       cfg,
+		uow:       uow,
+		queue:     queue,
+		userSvc:   userSvc,
+		providers: byName,
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+
+	"tofash/internal/config"
+	"tofash/internal/modules/order/entity"
+	"tofash/internal/modules/order/repository"
+	"tofash/internal/modules/order/shipping"
+	userEntity "tofash/internal/modules/user/entity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockShipmentRepo struct {
+	repository.ShipmentRepositoryInterface
+	fullyShipped bool
+	created      *entity.ShipmentEntity
+	events       []entity.ShipmentTrackingEventEntity
+	undelivered  int64
+}
+
+func (m *mockShipmentRepo) GetByTrackingNumber(ctx context.Context, provider, trackingNumber string) (*entity.ShipmentEntity, error) {
+	if trackingNumber != "FK1" {
+		return nil, errors.New("404")
+	}
+	return &entity.ShipmentEntity{ID: 5, OrderID: 7, Provider: provider, TrackingNumber: trackingNumber}, nil
+}
+
+func (m *mockShipmentRepo) GetByID(ctx context.Context, shipmentID int64) (*entity.ShipmentEntity, error) {
+	if m.created == nil || m.created.ID != shipmentID {
+		return nil, errors.New("404")
+	}
+	return m.created, nil
+}
+
+// RecordTrackingEvents skips events the shipment already has, as the
+// unique index on shipment_tracking_events does.
+func (m *mockShipmentRepo) RecordTrackingEvents(ctx context.Context, shipmentID int64, events []entity.ShipmentTrackingEventEntity) (*entity.ShipmentEntity, error) {
+	for _, event := range events {
+		duplicate := false
+		for _, stored := range m.events {
+			if stored.Status == event.Status && stored.OccurredAt.Equal(event.OccurredAt) {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			m.events = append(m.events, event)
+		}
+	}
+	return &entity.ShipmentEntity{ID: shipmentID, OrderID: 7, Status: m.events[len(m.events)-1].Status, Events: m.events}, nil
+}
+
+func (m *mockShipmentRepo) GetByOrderID(ctx context.Context, orderID int64) ([]entity.ShipmentEntity, error) {
+	return nil, nil
+}
+
+func (m *mockShipmentRepo) CountUndelivered(ctx context.Context, orderID int64) (int64, error) {
+	return m.undelivered, nil
+}
+
+func (m *mockShipmentRepo) CreateShipment(ctx context.Context, req entity.ShipmentEntity) (*entity.ShipmentEntity, bool, error) {
+	req.ID = 5
+	m.created = &req
+	return &req, m.fullyShipped, nil
+}
+
+type shipmentFixture struct {
+	shipments *mockShipmentRepo
+	statuses  []string
+	emails    []map[string]interface{}
+	svc       ShipmentServiceInterface
+}
+
+func newShipmentFixture(orderStatus string, fullyShipped bool) *shipmentFixture {
+	f := &shipmentFixture{shipments: &mockShipmentRepo{fullyShipped: fullyShipped}}
+	orders := &mockOrderRepo{
+		getByIDFn: func(_ context.Context, orderID int64) (*entity.OrderEntity, error) {
+			return &entity.OrderEntity{ID: orderID, OrderCode: "ORD-007", BuyerId: 10, Status: orderStatus}, nil
+		},
+		updateStatusFn: func(_ context.Context, req entity.OrderEntity, _ entity.OrderActor) (int64, string, string, error) {
+			f.statuses = append(f.statuses, req.Status)
+			return 10, req.Status, "ORD-007", nil
+		},
+	}
+	queue := &mockQueue{enqueueFn: func(_ context.Context, topic string, payload interface{}) error {
+		f.emails = append(f.emails, payload.(map[string]interface{}))
+		return nil
+	}}
+	users := &mockUserService{getByIDFn: func(_ context.Context, userID int64) (*userEntity.UserEntity, error) {
+		return &userEntity.UserEntity{ID: userID, Email: "buyer@example.com"}, nil
+	}}
+	cfg := &config.Config{Order: config.Order{TrackingURLTemplate: "https://track.example.com/{courier}?awb={tracking_number}"}}
+	f.svc = NewShipmentService(f.shipments, orders, cfg, &mockUnitOfWork{}, queue, users, shipping.NewFakeProvider("secret"))
+	return f
+}
+
+func TestShipmentService_CreateShipment_Partial(t *testing.T) {
+	f := newShipmentFixture(entity.OrderStatusPaid, false)
+
+	shipment, err := f.svc.CreateShipment(context.Background(), entity.ShipmentEntity{
+		OrderID: 7, Courier: "JNE", TrackingNumber: "JN 123",
+		Items: []entity.ShipmentItemEntity{{OrderItemID: 70, Quantity: 1}},
+	}, entity.OrderActor{ID: 1, Role: "Admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://track.example.com/JNE?awb=JN+123", shipment.TrackingURL)
+	assert.Equal(t, int64(1), f.shipments.created.CreatedBy)
+	assert.Equal(t, []string{entity.OrderStatusPartiallyShipped}, f.statuses)
+	assert.Len(t, f.emails, 1)
+	assert.Equal(t, "SHIPMENT", f.emails[0]["type"])
+	assert.Contains(t, f.emails[0]["message"], "https://track.example.com/JNE?awb=JN+123")
+}
+
+func TestShipmentService_CreateShipment_CompletesOrder(t *testing.T) {
+	// A further partial parcel keeps the order Partially Shipped.
+	f := newShipmentFixture(entity.OrderStatusPartiallyShipped, false)
+	_, err := f.svc.CreateShipment(context.Background(), entity.ShipmentEntity{OrderID: 7, Courier: "JNE", TrackingNumber: "JN2"}, entity.OrderActor{ID: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, f.statuses)
+	assert.Len(t, f.emails, 1)
+
+	f = newShipmentFixture(entity.OrderStatusPartiallyShipped, true)
+	shipment, err := f.svc.CreateShipment(context.Background(), entity.ShipmentEntity{
+		OrderID: 7, Courier: "JNE", TrackingNumber: "JN3", TrackingURL: "https://jne.example.com/JN3",
+	}, entity.OrderActor{ID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://jne.example.com/JN3", shipment.TrackingURL)
+	assert.Equal(t, []string{entity.OrderStatusShipped}, f.statuses)
+}
+
+func TestShipmentService_GetByOrderIDCustomer_OtherBuyer(t *testing.T) {
+	f := newShipmentFixture(entity.OrderStatusShipped, true)
+
+	_, err := f.svc.GetByOrderIDCustomer(context.Background(), 7, 11)
+	assert.EqualError(t, err, "404")
+}
+
+func signedWebhook(body string) http.Header {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	header := http.Header{}
+	header.Set(shipping.FakeSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestShipmentService_HandleTrackingWebhook_DeliversOrder(t *testing.T) {
+	ctx := context.Background()
+	body := `{"tracking_number":"FK1","status":"delivered","occurred_at":"2026-03-03T15:00:00Z"}`
+
+	// Another parcel is still on its way.
+	f := newShipmentFixture(entity.OrderStatusShipped, true)
+	f.shipments.undelivered = 1
+	assert.NoError(t, f.svc.HandleTrackingWebhook(ctx, shipping.FakeProviderName, signedWebhook(body), []byte(body)))
+	assert.Len(t, f.shipments.events, 1)
+	assert.Empty(t, f.statuses)
+
+	f = newShipmentFixture(entity.OrderStatusShipped, true)
+	assert.NoError(t, f.svc.HandleTrackingWebhook(ctx, shipping.FakeProviderName, signedWebhook(body), []byte(body)))
+	assert.Equal(t, []string{entity.OrderStatusDelivered}, f.statuses)
+	assert.Len(t, f.emails, 1)
+
+	// Forged calls and unknown parcels change nothing.
+	f = newShipmentFixture(entity.OrderStatusShipped, true)
+	err := f.svc.HandleTrackingWebhook(ctx, shipping.FakeProviderName, http.Header{}, []byte(body))
+	assert.ErrorIs(t, err, shipping.ErrInvalidWebhook)
+	other := `{"tracking_number":"FK2","status":"delivered"}`
+	assert.NoError(t, f.svc.HandleTrackingWebhook(ctx, shipping.FakeProviderName, signedWebhook(other), []byte(other)))
+	assert.Empty(t, f.shipments.events)
+}
+
+func TestShipmentService_BookShipment(t *testing.T) {
+	f := newShipmentFixture(entity.OrderStatusPaid, true)
+
+	shipment, err := f.svc.BookShipment(context.Background(), entity.ShipmentEntity{
+		OrderID: 7, Provider: shipping.FakeProviderName, Service: "YES",
+	}, 1200, entity.OrderActor{ID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "FAKE", shipment.Courier)
+	assert.Equal(t, shipping.TrackingStatusBooked, f.shipments.created.Status)
+	assert.Regexp(t, `^FK[0-9A-F]{10}$`, shipment.TrackingNumber)
+	assert.Equal(t, []string{entity.OrderStatusShipped}, f.statuses)
+
+	_, err = f.svc.BookShipment(context.Background(), entity.ShipmentEntity{OrderID: 7, Provider: "jne"}, 1200, entity.OrderActor{ID: 1})
+	assert.ErrorIs(t, err, shipping.ErrUnknownProvider)
+}
+
+func TestShipmentService_TrackShipment_TwiceStoresEventsOnce(t *testing.T) {
+	ctx := context.Background()
+	f := newShipmentFixture(entity.OrderStatusPaid, true)
+	shipment, err := f.svc.BookShipment(ctx, entity.ShipmentEntity{
+		OrderID: 7, Provider: shipping.FakeProviderName, Service: "REG",
+	}, 1200, entity.OrderActor{ID: 1})
+	assert.NoError(t, err)
+
+	_, err = f.svc.TrackShipment(ctx, shipment.ID)
+	assert.NoError(t, err)
+	tracked := len(f.shipments.events)
+	assert.Equal(t, 1, tracked)
+
+	_, err = f.svc.TrackShipment(ctx, shipment.ID)
+	assert.NoError(t, err)
+	assert.Len(t, f.shipments.events, tracked)
+}
@@ -0,0 +1,188 @@
+package shipping
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeProviderName is the name the stub courier registers under.
+const FakeProviderName = "fake"
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook's body.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// fakeTrip is when, after booking, the stub courier reports each status.
+var fakeTrip = []struct {
+	after       time.Duration
+	status      string
+	description string
+	location    string
+}{
+	{0, TrackingStatusBooked, "Pickup booked", "Origin hub"},
+	{2 * time.Hour, TrackingStatusPickedUp, "Parcel picked up", "Origin hub"},
+	{6 * time.Hour, TrackingStatusInTransit, "Parcel left the sorting centre", "Sorting centre"},
+	{24 * time.Hour, TrackingStatusOutForDelivery, "Parcel is out for delivery", "Destination hub"},
+	{30 * time.Hour, TrackingStatusDelivered, "Parcel delivered", "Destination"},
+}
+
+type fakeProvider struct {
+	secret string
+	now    func() time.Time
+
+	mu       sync.Mutex
+	bookings map[string]fakeBooking
+}
+
+type fakeBooking struct {
+	booking  Booking
+	bookedAt time.Time
+}
+
+// Name implements ShippingProvider.
+func (f *fakeProvider) Name() string {
+	return FakeProviderName
+}
+
+// Quote implements ShippingProvider. Regular service costs 9000 for the
+// first kilogram and 3000 for each one after it, plus 1000 for every 50km
+// or part of it when both ends have a location; express costs double.
+func (f *fakeProvider) Quote(ctx context.Context, req RateRequest) ([]Rate, error) {
+	fee := 9000 + (billableKg(req.WeightGrams)-1)*3000
+	if req.Origin.Location != nil && req.Destination.Location != nil {
+		distance := HaversineDistance(req.Origin.Location.Lat, req.Origin.Location.Lng, req.Destination.Location.Lat, req.Destination.Location.Lng)
+		fee += int64(math.Ceil(distance/50)) * 1000
+	}
+
+	return []Rate{
+		{Courier: "FAKE", Service: "REG", Fee: fee, EtaDays: 3},
+		{Courier: "FAKE", Service: "YES", Fee: fee * 2, EtaDays: 1},
+	}, nil
+}
+
+// CreateBooking implements ShippingProvider. The tracking number is
+// derived from the reference, so rebooking it changes nothing.
+func (f *fakeProvider) CreateBooking(ctx context.Context, req BookingRequest) (*Booking, error) {
+	rates, _ := f.Quote(ctx, RateRequest{Origin: req.Origin, Destination: req.Destination, WeightGrams: req.WeightGrams})
+	var rate *Rate
+	for i := range rates {
+		if strings.EqualFold(rates[i].Service, req.Service) {
+			rate = &rates[i]
+		}
+	}
+	if rate == nil {
+		return nil, fmt.Errorf("fake courier has no service %q", req.Service)
+	}
+
+	sum := sha1.Sum([]byte(req.Reference))
+	trackingNumber := "FK" + strings.ToUpper(hex.EncodeToString(sum[:5]))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, ok := f.bookings[trackingNumber]; ok {
+		booking := existing.booking
+		return &booking, nil
+	}
+
+	booking := Booking{
+		Courier:        rate.Courier,
+		Service:        rate.Service,
+		TrackingNumber: trackingNumber,
+		Fee:            rate.Fee,
+	}
+	f.bookings[trackingNumber] = fakeBooking{booking: booking, bookedAt: f.now()}
+	return &booking, nil
+}
+
+// Track implements ShippingProvider. A parcel moves through fakeTrip as
+// time passes after its booking.
+func (f *fakeProvider) Track(ctx context.Context, trackingNumber string) ([]TrackingEvent, error) {
+	f.mu.Lock()
+	booked, ok := f.bookings[trackingNumber]
+	f.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownTrackingNumber
+	}
+
+	now := f.now()
+	events := []TrackingEvent{}
+	for _, step := range fakeTrip {
+		occurredAt := booked.bookedAt.Add(step.after)
+		if occurredAt.After(now) {
+			break
+		}
+		events = append(events, TrackingEvent{
+			TrackingNumber: trackingNumber,
+			Status:         step.status,
+			Description:    step.description,
+			Location:       step.location,
+			OccurredAt:     occurredAt,
+		})
+	}
+	return events, nil
+}
+
+// fakeWebhook is the body the stub courier posts.
+type fakeWebhook struct {
+	TrackingNumber string    `json:"tracking_number"`
+	Status         string    `json:"status"`
+	Description    string    `json:"description"`
+	Location       string    `json:"location"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// ParseWebhook implements ShippingProvider. Calls must be signed with the
+// shared secret in FakeSignatureHeader; without a secret none are
+// accepted.
+func (f *fakeProvider) ParseWebhook(header http.Header, body []byte) ([]TrackingEvent, error) {
+	if f.secret == "" {
+		return nil, ErrInvalidWebhook
+	}
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, signFake(f.secret, body)) {
+		return nil, ErrInvalidWebhook
+	}
+
+	payload := fakeWebhook{}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.TrackingNumber == "" || payload.Status == "" {
+		return nil, ErrInvalidWebhook
+	}
+	if payload.OccurredAt.IsZero() {
+		payload.OccurredAt = f.now()
+	}
+
+	return []TrackingEvent{{
+		TrackingNumber: payload.TrackingNumber,
+		Status:         payload.Status,
+		Description:    payload.Description,
+		Location:       payload.Location,
+		OccurredAt:     payload.OccurredAt,
+	}}, nil
+}
+
+func signFake(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// NewFakeProvider returns a stub courier that books, tracks and quotes
+// deterministically without leaving the process. Bookings live in memory
+// only. Its webhooks are signed with secret.
+func NewFakeProvider(secret string) ShippingProvider {
+	return &fakeProvider{
+		secret:   secret,
+		now:      time.Now,
+		bookings: map[string]fakeBooking{},
+	}
+}
@@ -0,0 +1,61 @@
+package shipping
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeProvider_BookAndTrack(t *testing.T) {
+	ctx := context.Background()
+	bookedAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	provider := NewFakeProvider("secret").(*fakeProvider)
+	provider.now = func() time.Time { return bookedAt }
+
+	rates, err := provider.Quote(ctx, RateRequest{WeightGrams: 1500})
+	assert.NoError(t, err)
+	assert.Equal(t, []Rate{
+		{Courier: "FAKE", Service: "REG", Fee: 12000, EtaDays: 3},
+		{Courier: "FAKE", Service: "YES", Fee: 24000, EtaDays: 1},
+	}, rates)
+
+	req := BookingRequest{Reference: "ORD-7-1", Service: "reg", WeightGrams: 1500}
+	booking, err := provider.CreateBooking(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12000), booking.Fee)
+	again, err := provider.CreateBooking(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, booking.TrackingNumber, again.TrackingNumber)
+
+	provider.now = func() time.Time { return bookedAt.Add(7 * time.Hour) }
+	events, err := provider.Track(ctx, booking.TrackingNumber)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, TrackingStatusInTransit, events[2].Status)
+
+	_, err = provider.Track(ctx, "FK0000000000")
+	assert.ErrorIs(t, err, ErrUnknownTrackingNumber)
+}
+
+func TestFakeProvider_ParseWebhook(t *testing.T) {
+	provider := NewFakeProvider("secret")
+	body := []byte(`{"tracking_number":"FK1","status":"delivered","occurred_at":"2026-03-03T15:00:00Z"}`)
+
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, hex.EncodeToString(signFake("secret", body)))
+	events, err := provider.ParseWebhook(header, body)
+	assert.NoError(t, err)
+	assert.Equal(t, TrackingStatusDelivered, events[0].Status)
+	assert.Equal(t, "FK1", events[0].TrackingNumber)
+
+	header.Set(FakeSignatureHeader, hex.EncodeToString(signFake("other", body)))
+	_, err = provider.ParseWebhook(header, body)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+
+	_, err = NewFakeProvider("").ParseWebhook(header, body)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+}
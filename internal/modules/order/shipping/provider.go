@@ -0,0 +1,94 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Tracking statuses couriers report, in the order a parcel goes through
+// them. Failed and Returned end a trip without delivery.
+const (
+	TrackingStatusBooked         = "booked"
+	TrackingStatusPickedUp       = "picked_up"
+	TrackingStatusInTransit      = "in_transit"
+	TrackingStatusOutForDelivery = "out_for_delivery"
+	TrackingStatusDelivered      = "delivered"
+	TrackingStatusFailed         = "failed"
+	TrackingStatusReturned       = "returned"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider name nobody registered.
+	ErrUnknownProvider = errors.New("unknown shipping provider")
+	// ErrUnknownTrackingNumber is returned when the courier has no parcel
+	// with the tracking number.
+	ErrUnknownTrackingNumber = errors.New("unknown tracking number")
+	// ErrInvalidWebhook is returned for webhook calls that are unsigned,
+	// wrongly signed or malformed.
+	ErrInvalidWebhook = errors.New("invalid tracking webhook")
+)
+
+// Address is one end of a parcel's trip.
+type Address struct {
+	Name     string
+	Phone    string
+	Address  string
+	Location *Location
+}
+
+type RateRequest struct {
+	Origin      Address
+	Destination Address
+	WeightGrams int64
+}
+
+// Rate is what a courier charges for one of its services.
+type Rate struct {
+	Courier string
+	Service string
+	Fee     int64
+	EtaDays int
+}
+
+// BookingRequest asks a courier to pick a parcel up. Reference identifies
+// the parcel on our side; booking the same reference twice returns the
+// first booking.
+type BookingRequest struct {
+	Reference   string
+	Service     string
+	Origin      Address
+	Destination Address
+	WeightGrams int64
+	ItemCount   int64
+}
+
+type Booking struct {
+	Courier        string
+	Service        string
+	TrackingNumber string
+	TrackingURL    string
+	Fee            int64
+}
+
+// TrackingEvent is one step of a parcel's trip, as the courier reports it.
+type TrackingEvent struct {
+	TrackingNumber string
+	Status         string
+	Description    string
+	Location       string
+	OccurredAt     time.Time
+}
+
+// ShippingProvider is a courier integration: live rates, pickup booking
+// and tracking, both pulled with Track and pushed to our webhook.
+type ShippingProvider interface {
+	Name() string
+	Quote(ctx context.Context, req RateRequest) ([]Rate, error)
+	CreateBooking(ctx context.Context, req BookingRequest) (*Booking, error)
+	Track(ctx context.Context, trackingNumber string) ([]TrackingEvent, error)
+	// ParseWebhook checks an inbound tracking call is genuine and returns
+	// the events it carries, or ErrInvalidWebhook.
+	ParseWebhook(header http.Header, body []byte) ([]TrackingEvent, error)
+}
@@ -0,0 +1,192 @@
+package shipping
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"tofash/internal/config"
+)
+
+var (
+	// ErrNoDestination is returned when a shipping type that is charged by
+	// distance has no location to deliver to.
+	ErrNoDestination = errors.New("delivery address has no location")
+	// ErrOutOfRange is returned when no rate of the shipping type reaches
+	// the destination.
+	ErrOutOfRange = errors.New("delivery address is out of range")
+)
+
+// DefaultRates apply when no rates are configured.
+var DefaultRates = []config.ShippingRate{
+	{ShippingType: "Delivery", MaxDistanceKm: 10, BaseFee: 5000, PerKgFee: 2000},
+	{ShippingType: "Delivery", MaxDistanceKm: 30, BaseFee: 9000, PerKgFee: 3000},
+	{ShippingType: "Delivery", MaxDistanceKm: 0, BaseFee: 15000, PerKgFee: 5000},
+}
+
+// Location is a point on the map in decimal degrees.
+type Location struct {
+	Lat float64
+	Lng float64
+}
+
+// ParseLocation reads a location stored as strings, as users and the store
+// reference point are. ok is false when either is missing or malformed.
+func ParseLocation(lat, lng string) (Location, bool) {
+	parsedLat, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	parsedLng, err2 := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if err1 != nil || err2 != nil {
+		return Location{}, false
+	}
+	return Location{Lat: parsedLat, Lng: parsedLng}, true
+}
+
+// Quote is the fee of sending WeightGrams of goods DistanceKm with
+// ShippingType.
+type Quote struct {
+	ShippingType string
+	WeightGrams  int64
+	DistanceKm   float64
+	Fee          int64
+}
+
+type CalculatorInterface interface {
+	Charges(shippingType string) bool
+	ShippingTypes() []string
+	Quote(shippingType string, weightGrams int64, destination *Location) (Quote, error)
+}
+
+type calculator struct {
+	rates  map[string][]config.ShippingRate
+	types  []string
+	origin *Location
+}
+
+// Charges implements CalculatorInterface. Shipping types without rates,
+// such as pickup, are free.
+func (c *calculator) Charges(shippingType string) bool {
+	_, ok := c.rates[strings.ToLower(shippingType)]
+	return ok
+}
+
+// ShippingTypes implements CalculatorInterface. Types come as configured.
+func (c *calculator) ShippingTypes() []string {
+	return append([]string(nil), c.types...)
+}
+
+// Quote implements CalculatorInterface. It picks the nearest distance band
+// that reaches destination and charges its base fee for the first
+// kilogram and its per-kilogram fee for every kilogram, or part of one,
+// after that.
+func (c *calculator) Quote(shippingType string, weightGrams int64, destination *Location) (Quote, error) {
+	quote := Quote{ShippingType: shippingType, WeightGrams: weightGrams}
+
+	rates, ok := c.rates[strings.ToLower(shippingType)]
+	if !ok {
+		return quote, nil
+	}
+	if destination == nil || c.origin == nil {
+		return Quote{}, ErrNoDestination
+	}
+
+	quote.DistanceKm = HaversineDistance(c.origin.Lat, c.origin.Lng, destination.Lat, destination.Lng)
+	for _, rate := range rates {
+		if rate.MaxDistanceKm > 0 && quote.DistanceKm > rate.MaxDistanceKm {
+			continue
+		}
+
+		quote.Fee = rate.BaseFee
+		if extraKg := billableKg(weightGrams) - 1; extraKg > 0 {
+			quote.Fee += extraKg * rate.PerKgFee
+		}
+		return quote, nil
+	}
+
+	return Quote{}, ErrOutOfRange
+}
+
+// billableKg rounds weightGrams up to whole kilograms, at least one.
+func billableKg(weightGrams int64) int64 {
+	kg := (weightGrams + 999) / 1000
+	if kg < 1 {
+		return 1
+	}
+	return kg
+}
+
+// gramsPerUnit converts the weight units products are listed in.
+var gramsPerUnit = map[string]float64{
+	"mg":       0.001,
+	"g":        1,
+	"gr":       1,
+	"gram":     1,
+	"grams":    1,
+	"ons":      100,
+	"kg":       1000,
+	"kilo":     1000,
+	"kilogram": 1000,
+}
+
+// ToGrams converts a product weight in unit to grams. Units that are not
+// weights, such as "pcs", are taken to be grams, the products' default.
+func ToGrams(weight int64, unit string) int64 {
+	factor, ok := gramsPerUnit[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok {
+		factor = 1
+	}
+	return int64(math.Round(float64(weight) * factor))
+}
+
+// HaversineDistance returns the great-circle distance between two points
+// in kilometres.
+func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371 // radius bumi dalam kilometer
+
+	dLat := (lat2 - lat1) * (math.Pi / 180)
+	dLon := (lon2 - lon1) * (math.Pi / 180)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*(math.Pi/180))*math.Cos(lat2*(math.Pi/180))*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return R * c //kilometer
+}
+
+// NewCalculator prices with cfg's rates, or DefaultRates, measuring from
+// the store's reference point.
+func NewCalculator(cfg *config.Config) CalculatorInterface {
+	c := &calculator{rates: map[string][]config.ShippingRate{}}
+
+	rates := DefaultRates
+	if cfg != nil {
+		if len(cfg.Order.ShippingRates) > 0 {
+			rates = cfg.Order.ShippingRates
+		}
+		if origin, ok := ParseLocation(cfg.App.LatitudeRef, cfg.App.LongitudeRef); ok {
+			c.origin = &origin
+		}
+	}
+
+	for _, rate := range rates {
+		key := strings.ToLower(rate.ShippingType)
+		if _, ok := c.rates[key]; !ok {
+			c.types = append(c.types, rate.ShippingType)
+		}
+		c.rates[key] = append(c.rates[key], rate)
+	}
+	// Nearest band first; the unbounded one goes last.
+	for key := range c.rates {
+		bands := c.rates[key]
+		sort.SliceStable(bands, func(i, j int) bool {
+			if bands[i].MaxDistanceKm == 0 || bands[j].MaxDistanceKm == 0 {
+				return bands[j].MaxDistanceKm == 0 && bands[i].MaxDistanceKm != 0
+			}
+			return bands[i].MaxDistanceKm < bands[j].MaxDistanceKm
+		})
+	}
+
+	return c
+}
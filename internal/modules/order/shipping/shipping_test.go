@@ -0,0 +1,60 @@
+package shipping
+
+import (
+	"testing"
+
+	"tofash/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCalculator() CalculatorInterface {
+	return NewCalculator(&config.Config{
+		App: config.App{LatitudeRef: "-6.2000", LongitudeRef: "106.8166"},
+		Order: config.Order{ShippingRates: []config.ShippingRate{
+			{ShippingType: "Delivery", MaxDistanceKm: 0, BaseFee: 15000, PerKgFee: 5000},
+			{ShippingType: "Delivery", MaxDistanceKm: 10, BaseFee: 5000, PerKgFee: 2000},
+		}},
+	})
+}
+
+func TestCalculator_QuoteByWeightAndDistance(t *testing.T) {
+	c := newTestCalculator()
+
+	// Next door, 2.5kg bills as 3kg.
+	quote, err := c.Quote("Delivery", 2500, &Location{Lat: -6.2000, Lng: 106.8166})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000+2*2000), quote.Fee)
+
+	// Bandung is well past the 10km band.
+	quote, err = c.Quote("delivery", 800, &Location{Lat: -6.9175, Lng: 107.6191})
+	assert.NoError(t, err)
+	assert.InDelta(t, 119, quote.DistanceKm, 2)
+	assert.Equal(t, int64(15000), quote.Fee)
+}
+
+func TestCalculator_Quote_Unpriced(t *testing.T) {
+	c := newTestCalculator()
+
+	quote, err := c.Quote("Pickup", 5000, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, quote.Fee)
+	assert.False(t, c.Charges("Pickup"))
+
+	_, err = c.Quote("Delivery", 5000, nil)
+	assert.ErrorIs(t, err, ErrNoDestination)
+
+	bounded := NewCalculator(&config.Config{
+		App:   config.App{LatitudeRef: "-6.2000", LongitudeRef: "106.8166"},
+		Order: config.Order{ShippingRates: DefaultRates[:2]},
+	})
+	_, err = bounded.Quote("Delivery", 1000, &Location{Lat: -6.9175, Lng: 107.6191})
+	assert.ErrorIs(t, err, ErrOutOfRange)
+}
+
+func TestToGrams(t *testing.T) {
+	assert.Equal(t, int64(1500), ToGrams(1500, ""))
+	assert.Equal(t, int64(2000), ToGrams(2, "Kg"))
+	assert.Equal(t, int64(300), ToGrams(3, "ons"))
+	assert.Equal(t, int64(250), ToGrams(250, "pcs"))
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payment_logs_payment_reference;
+ALTER TABLE payment_logs DROP COLUMN IF EXISTS reference;
+ALTER TABLE payment_logs DROP COLUMN IF EXISTS amount;
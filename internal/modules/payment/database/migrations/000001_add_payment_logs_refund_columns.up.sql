@@ -0,0 +1,5 @@
+ALTER TABLE payment_logs ADD COLUMN IF NOT EXISTS amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payment_logs ADD COLUMN IF NOT EXISTS reference VARCHAR(100) NULL;
+
+-- A retried partial refund is recognised by its refund key.
+CREATE INDEX IF NOT EXISTS idx_payment_logs_payment_reference ON payment_logs(payment_id, reference);
@@ -1,5 +1,36 @@
 package entity
 
+// Payment statuses. Gateway callbacks write them in lower case, so compare
+// with strings.EqualFold.
+const (
+	PaymentStatusPending  = "Pending"
+	PaymentStatusSuccess  = "Success"
+	PaymentStatusFailed   = "Failed"
+	PaymentStatusExpired  = "Expired"
+	PaymentStatusRefunded = "Refunded"
+
+	// PaymentStatusPartiallyRefunded is only logged: a payment with part of
+	// it refunded stays Success.
+	PaymentStatusPartiallyRefunded = "Partially Refunded"
+)
+
+// MidtransPaymentStatus maps a Midtrans transaction_status to the status
+// UpdateStatusByOrderCode takes.
+func MidtransPaymentStatus(transactionStatus string) string {
+	switch transactionStatus {
+	case "capture", "settlement":
+		return "success"
+	case "deny", "cancel":
+		return "failed"
+	case "expire":
+		return "expired"
+	case "pending":
+		return "pending"
+	default:
+		return "unknown"
+	}
+}
+
 type PaymentEntity struct {
 	ID                uint
 	OrderID           uint
@@ -244,17 +244,7 @@ func (ph *paymentHandler) MidtranswebHookHandler(c echo.Context) error {
 	transactionStatus := notificationPayload["transaction_status"].(string)
 	orderID := notificationPayload["order_id"].(string)
 
-	newStatus := ""
-	switch transactionStatus {
-	case "capture", "settlement":
-		newStatus = "success"
-	case "deny", "cancel", "expire":
-		newStatus = "failed"
-	case "pending":
-		newStatus = "pending"
-	default:
-		newStatus = "unknown"
-	}
+	newStatus := entity.MidtransPaymentStatus(transactionStatus)
 
 	if err := ph.paymentService.UpdateStatusByOrderCode(c.Request().Context(), orderID, newStatus); err != nil {
 		log.Errorf("[PaymentHandler-3] MidtranswebHookHandler: %v", err)
@@ -5,11 +5,15 @@ import (
 
 	"github.com/labstack/gommon/log"
 	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
 	"github.com/midtrans/midtrans-go/snap"
 )
 
 type MidtransClientInterface interface {
 	CreateTransaction(orderID string, amount int64, customerName, customerEmail string) (string, error)
+	RefundTransaction(orderID, refundKey string, amount int64, reason string) error
+	CancelTransaction(orderID string) error
+	TransactionStatus(orderID string) (string, error)
 }
 
 type midtransClient struct {
@@ -41,6 +45,54 @@ func (m *midtransClient) CreateTransaction(orderID string, amount int64, custome
 	return snapRes.Token, nil
 }
 
+// RefundTransaction implements MidtransClientInterface. Midtrans pays out
+// a refund key only once, so retrying a refund never pays out twice.
+func (m *midtransClient) RefundTransaction(orderID, refundKey string, amount int64, reason string) error {
+	var client coreapi.Client
+	client.New(m.cfg.Midtrans.ServerKey, midtrans.EnvironmentType(m.cfg.Midtrans.Environment))
+
+	_, midtransErr := client.RefundTransaction(orderID, &coreapi.RefundReq{
+		RefundKey: refundKey,
+		Amount:    amount,
+		Reason:    reason,
+	})
+	if midtransErr != nil {
+		log.Errorf("[MidtransClient-1] Failed to refund transaction: %v", midtransErr)
+		return midtransErr
+	}
+
+	return nil
+}
+
+// CancelTransaction implements MidtransClientInterface. It voids a pending
+// transaction so the customer can no longer pay it.
+func (m *midtransClient) CancelTransaction(orderID string) error {
+	var client coreapi.Client
+	client.New(m.cfg.Midtrans.ServerKey, midtrans.EnvironmentType(m.cfg.Midtrans.Environment))
+
+	if _, midtransErr := client.CancelTransaction(orderID); midtransErr != nil {
+		log.Errorf("[MidtransClient-1] Failed to cancel transaction: %v", midtransErr)
+		return midtransErr
+	}
+
+	return nil
+}
+
+// TransactionStatus implements MidtransClientInterface. It returns the
+// transaction_status Midtrans currently reports for orderID.
+func (m *midtransClient) TransactionStatus(orderID string) (string, error) {
+	var client coreapi.Client
+	client.New(m.cfg.Midtrans.ServerKey, midtrans.EnvironmentType(m.cfg.Midtrans.Environment))
+
+	res, midtransErr := client.CheckTransaction(orderID)
+	if midtransErr != nil {
+		log.Errorf("[MidtransClient-1] Failed to check transaction: %v", midtransErr)
+		return "", midtransErr
+	}
+
+	return res.TransactionStatus, nil
+}
+
 func NewMidtransClient(cfg *config.Config) MidtransClientInterface {
 	return &midtransClient{cfg: cfg}
 }
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/payment/service"
+	"tofash/internal/shared/async"
+)
+
+const TopicPaymentExpire = "payment_expire"
+
+// PaymentExpirePayload is enqueued by the order module when an order
+// expires or is cancelled.
+type PaymentExpirePayload struct {
+	OrderID   int64  `json:"order_id"`
+	OrderCode string `json:"order_code"`
+}
+
+func registerExpire(r async.Registry, paymentSvc service.PaymentServiceInterface) {
+	r.Register(TopicPaymentExpire, async.Typed(func(ctx context.Context, _ uint, data PaymentExpirePayload) error {
+		return paymentSvc.ExpirePayment(ctx, data.OrderID, data.OrderCode)
+	}))
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/payment/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/datatypes"
+)
+
+// TopicPaymentReconcile catches up on Midtrans webhooks that never arrived.
+const TopicPaymentReconcile = "payment_reconcile"
+
+func registerReconcile(r async.Registry, paymentSvc service.PaymentServiceInterface) {
+	r.Register(TopicPaymentReconcile, func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		reconciled, err := paymentSvc.ReconcilePending(ctx)
+		if err != nil {
+			return err
+		}
+		if reconciled > 0 {
+			log.Infof("[PaymentReconcileJob] Reconciled %d pending payment(s) with Midtrans", reconciled)
+		}
+		return nil
+	})
+}
+
+// RegisterSchedules declares the payment module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("*/10 * * * *", TopicPaymentReconcile, nil)
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/payment/service"
+	"tofash/internal/shared/async"
+)
+
+const TopicPaymentRefund = "payment_refund"
+
+// PaymentRefundPayload is enqueued by the order module when an order is
+// cancelled.
+type PaymentRefundPayload struct {
+	OrderID   int64  `json:"order_id"`
+	OrderCode string `json:"order_code"`
+	Reason    string `json:"reason"`
+}
+
+// RegisterHandlers plugs the payment module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, paymentSvc service.PaymentServiceInterface) {
+	r.Register(TopicPaymentRefund, async.Typed(func(ctx context.Context, _ uint, data PaymentRefundPayload) error {
+		return paymentSvc.RefundOrder(ctx, data.OrderID, data.OrderCode, data.Reason)
+	}))
+
+	registerExpire(r, paymentSvc)
+	registerReconcile(r, paymentSvc)
+}
@@ -3,9 +3,13 @@ package model
 import "time"
 
 type PaymentLog struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	PaymentID uint      `gorm:"not null;index" json:"payment_id"`
-	Status    string    `gorm:"type:varchar(50);not null" json:"status"`
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	PaymentID uint   `gorm:"not null;index" json:"payment_id"`
+	Status    string `gorm:"type:varchar(50);not null" json:"status"`
+	// Amount and Reference are set on partial refunds: how much was paid
+	// back and the refund key it was paid under.
+	Amount    int64     `gorm:"not null;default:0" json:"amount"`
+	Reference *string   `gorm:"type:varchar(100)" json:"reference,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
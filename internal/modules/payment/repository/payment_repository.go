@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"math"
+	"strings"
+	"time"
 	"tofash/internal/modules/payment/entity"
 	"tofash/internal/modules/payment/model"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepositoryInterface interface {
@@ -18,6 +22,9 @@ type PaymentRepositoryInterface interface {
 	GetAll(ctx context.Context, req entity.PaymentQueryStringRequest) ([]entity.PaymentEntity, int64, int64, error)
 	GetDetail(ctx context.Context, paymentID uint) (*entity.PaymentEntity, error)
 	GetByOrderID(ctx context.Context, orderID uint) error
+	FindByOrderID(ctx context.Context, orderID uint) (*entity.PaymentEntity, error)
+	GetPendingByMethod(ctx context.Context, method string, createdBefore time.Time, limit int) ([]entity.PaymentEntity, error)
+	RefundPartial(ctx context.Context, orderID uint, amount int64, refundKey string, refund func(payment entity.PaymentEntity) error) error
 }
 
 type paymentRepository struct {
@@ -28,7 +35,7 @@ type paymentRepository struct {
 func (p *paymentRepository) GetByOrderID(ctx context.Context, orderID uint) error {
 	modelPayment := model.Payment{}
 
-	if err := p.db.Where("order_id = ?", orderID).First(&modelPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Where("order_id = ?", orderID).First(&modelPayment).Error; err != nil {
 		log.Errorf("[PaymentRepository-1] GetByOrderID: %v", err)
 		return err
 	}
@@ -36,11 +43,145 @@ func (p *paymentRepository) GetByOrderID(ctx context.Context, orderID uint) erro
 	return nil
 }
 
+// FindByOrderID implements PaymentRepositoryInterface.
+func (p *paymentRepository) FindByOrderID(ctx context.Context, orderID uint) (*entity.PaymentEntity, error) {
+	modelPayment := model.Payment{}
+
+	if err := uow.DB(ctx, p.db).Where("order_id = ?", orderID).First(&modelPayment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Infof("[PaymentRepository-1] FindByOrderID: No payment found")
+			return nil, errors.New("404")
+		}
+		log.Errorf("[PaymentRepository-2] FindByOrderID: %v", err)
+		return nil, err
+	}
+
+	payment := entity.PaymentEntity{
+		ID:            modelPayment.ID,
+		OrderID:       modelPayment.OrderID,
+		UserID:        modelPayment.UserID,
+		PaymentMethod: modelPayment.PaymentMethod,
+		PaymentStatus: modelPayment.PaymentStatus,
+		GrossAmount:   modelPayment.GrossAmount,
+		PaymentAt:     modelPayment.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if modelPayment.PaymentGatewayID != nil {
+		payment.PaymentGatewayID = *modelPayment.PaymentGatewayID
+	}
+	if modelPayment.PaymentURL != nil {
+		payment.PaymentURL = *modelPayment.PaymentURL
+	}
+
+	return &payment, nil
+}
+
+// GetPendingByMethod implements PaymentRepositoryInterface. It returns up
+// to limit pending payments of method created before createdBefore, oldest
+// first.
+func (p *paymentRepository) GetPendingByMethod(ctx context.Context, method string, createdBefore time.Time, limit int) ([]entity.PaymentEntity, error) {
+	var modelPayments []model.Payment
+
+	err := uow.DB(ctx, p.db).
+		Where("payment_status ILIKE ? AND payment_method = ? AND created_at < ?", entity.PaymentStatusPending, method, createdBefore).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&modelPayments).Error
+	if err != nil {
+		log.Errorf("[PaymentRepository-1] GetPendingByMethod: %v", err)
+		return nil, err
+	}
+
+	entities := make([]entity.PaymentEntity, 0, len(modelPayments))
+	for _, val := range modelPayments {
+		entities = append(entities, entity.PaymentEntity{
+			ID:            val.ID,
+			OrderID:       val.OrderID,
+			UserID:        val.UserID,
+			PaymentMethod: val.PaymentMethod,
+			PaymentStatus: val.PaymentStatus,
+			GrossAmount:   val.GrossAmount,
+			PaymentAt:     val.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return entities, nil
+}
+
+// RefundPartial implements PaymentRepositoryInterface. It locks the order's
+// payment, checks that amount fits within what is left of it after earlier
+// partial refunds, calls refund and records it, all in one transaction, so
+// concurrent refunds can't pay back more than was paid. A refundKey that
+// is already recorded is a no-op. It fails with "404" when the order has
+// no payment and "400" when the payment isn't successful or amount doesn't
+// fit.
+func (p *paymentRepository) RefundPartial(ctx context.Context, orderID uint, amount int64, refundKey string, refund func(payment entity.PaymentEntity) error) error {
+	return uow.DB(ctx, p.db).Transaction(func(tx *gorm.DB) error {
+		modelPayment := model.Payment{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderID).First(&modelPayment).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[PaymentRepository-1] RefundPartial: No payment found")
+				return errors.New("404")
+			}
+			log.Errorf("[PaymentRepository-2] RefundPartial: %v", err)
+			return err
+		}
+
+		var recorded int64
+		if err := tx.Model(&model.PaymentLog{}).Where("payment_id = ? AND reference = ?", modelPayment.ID, refundKey).Count(&recorded).Error; err != nil {
+			log.Errorf("[PaymentRepository-3] RefundPartial: %v", err)
+			return err
+		}
+		if recorded > 0 {
+			return nil
+		}
+
+		var refunded int64
+		err = tx.Model(&model.PaymentLog{}).
+			Where("payment_id = ? AND status = ?", modelPayment.ID, entity.PaymentStatusPartiallyRefunded).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&refunded).Error
+		if err != nil {
+			log.Errorf("[PaymentRepository-4] RefundPartial: %v", err)
+			return err
+		}
+
+		if !strings.EqualFold(modelPayment.PaymentStatus, entity.PaymentStatusSuccess) || amount <= 0 || refunded+amount > int64(modelPayment.GrossAmount) {
+			log.Infof("[PaymentRepository-5] RefundPartial: cannot refund %d of payment %d (%s, %d already refunded)", amount, modelPayment.ID, modelPayment.PaymentStatus, refunded)
+			return errors.New("400")
+		}
+
+		err = refund(entity.PaymentEntity{
+			ID:            modelPayment.ID,
+			OrderID:       modelPayment.OrderID,
+			UserID:        modelPayment.UserID,
+			PaymentMethod: modelPayment.PaymentMethod,
+			PaymentStatus: modelPayment.PaymentStatus,
+			GrossAmount:   modelPayment.GrossAmount,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&model.PaymentLog{
+			PaymentID: modelPayment.ID,
+			Status:    entity.PaymentStatusPartiallyRefunded,
+			Amount:    amount,
+			Reference: &refundKey,
+		}).Error; err != nil {
+			log.Errorf("[PaymentRepository-6] RefundPartial: %v", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
 // GetDetail implements PaymentRepositoryInterface.
 func (p *paymentRepository) GetDetail(ctx context.Context, paymentID uint) (*entity.PaymentEntity, error) {
 	modelPayment := model.Payment{}
 
-	if err := p.db.Where("id = ?", paymentID).First(&modelPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Where("id = ?", paymentID).First(&modelPayment).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[PaymentRepository-1] GetDetail: No payment found")
@@ -69,7 +210,7 @@ func (p *paymentRepository) GetAll(ctx context.Context, req entity.PaymentQueryS
 	var countData int64
 	offset := (req.Page - 1) * req.Limit
 
-	sqlMain := p.db.
+	sqlMain := uow.DB(ctx, p.db).
 		Where("payment_method ILIKE ? OR payment_status ILIKE ?", "%"+req.Search+"%", "%"+req.Status+"%")
 
 	if req.UserID != 0 {
@@ -114,14 +255,14 @@ func (p *paymentRepository) GetAll(ctx context.Context, req entity.PaymentQueryS
 func (p *paymentRepository) UpdateStatusByOrderCode(ctx context.Context, orderID uint, status string) error {
 	modelPayment := model.Payment{}
 
-	if err := p.db.Where("order_id = ?", orderID).First(&modelPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Where("order_id = ?", orderID).First(&modelPayment).Error; err != nil {
 		log.Errorf("[PaymentRepository] UpdateStatusByOrderCode-1: %v", err)
 		return err
 	}
 
 	modelPayment.PaymentStatus = status
 
-	if err := p.db.Save(&modelPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Save(&modelPayment).Error; err != nil {
 		log.Errorf("[PaymentRepository] UpdateStatusByOrderCode-2: %v", err)
 		return err
 	}
@@ -136,7 +277,7 @@ func (p *paymentRepository) LogPayment(ctx context.Context, paymentID uint, stat
 		Status:    status,
 	}
 
-	if err := p.db.Create(&logPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Create(&logPayment).Error; err != nil {
 		log.Errorf("[PaymentRepository] LogPayment-1: %v", err)
 		return err
 	}
@@ -156,7 +297,7 @@ func (p *paymentRepository) CreatePayment(ctx context.Context, payment entity.Pa
 		PaymentURL:       &payment.PaymentURL,
 	}
 
-	if err := p.db.Create(&modelPayment).Error; err != nil {
+	if err := uow.DB(ctx, p.db).Create(&modelPayment).Error; err != nil {
 		log.Errorf("[PaymentRepository] Create-1: %v", err)
 		return err
 	}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	"tofash/internal/config"
+	orderEntity "tofash/internal/modules/order/entity"
 	orderService "tofash/internal/modules/order/service"
 	"tofash/internal/modules/payment/entity"
 	httpclient "tofash/internal/modules/payment/http_client"
 	"tofash/internal/modules/payment/repository"
 	userService "tofash/internal/modules/user/service"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 )
@@ -20,12 +24,24 @@ type PaymentServiceInterface interface {
 	UpdateStatusByOrderCode(ctx context.Context, orderCode, status string) error
 	GetAll(ctx context.Context, req entity.PaymentQueryStringRequest, accessToken string) ([]entity.PaymentEntity, int64, int64, error)
 	GetDetail(ctx context.Context, paymentID uint, accessToken string) (*entity.PaymentEntity, error)
+	RefundOrder(ctx context.Context, orderID int64, orderCode, reason string) error
+	RefundPartial(ctx context.Context, orderID int64, orderCode string, amount int64, refundKey, reason string) error
+	ExpirePayment(ctx context.Context, orderID int64, orderCode string) error
+	ReconcilePending(ctx context.Context) (int, error)
 }
 
+// reconcileAfter is how long a Midtrans payment may stay pending before
+// ReconcilePending asks Midtrans about it instead of waiting for the webhook.
+const reconcileAfter = 15 * time.Minute
+
+// reconcileBatchSize caps how many payments one ReconcilePending run checks.
+const reconcileBatchSize = 100
+
 type paymentService struct {
 	repo         repository.PaymentRepositoryInterface
 	midtrans     httpclient.MidtransClientInterface
 	cfg          *config.Config
+	uow          uow.UnitOfWorkInterface
 	orderService orderService.OrderServiceInterface
 	userService  userService.UserServiceInterface
 }
@@ -109,14 +125,210 @@ func (p *paymentService) UpdateStatusByOrderCode(ctx context.Context, orderCode
 		return err
 	}
 
-	if err = p.repo.UpdateStatusByOrderCode(ctx, uint(orderDetailID), status); err != nil {
-		log.Errorf("[PaymentService] UpdateStatusByOrderCode-2: %v", err)
+	// The payment and the order move together, so a failure in between
+	// cannot leave a settled payment on an unpaid order.
+	return p.uow.Do(ctx, func(ctx context.Context) error {
+		if err := p.repo.UpdateStatusByOrderCode(ctx, uint(orderDetailID), status); err != nil {
+			log.Errorf("[PaymentService] UpdateStatusByOrderCode-2: %v", err)
+			return err
+		}
+
+		// Settlement keeps the order's reserved stock; an expired payment
+		// expires the order, which releases it. Gateways resend
+		// notifications, so a transition that already happened ("400") is
+		// not an error.
+		var err error
+		switch {
+		case strings.EqualFold(status, entity.PaymentStatusSuccess):
+			err = p.orderService.UpdateStatus(ctx, orderEntity.OrderEntity{
+				ID:      orderDetailID,
+				Status:  orderEntity.OrderStatusPaid,
+				Remarks: "payment settled",
+			}, orderEntity.SystemActor)
+			if err != nil && err.Error() == "400" && p.orderClosed(ctx, orderDetailID) {
+				// The money arrived after the order was cancelled or
+				// expired and its stock released, so it goes back to the
+				// customer instead of reviving the order.
+				err = p.RefundOrder(ctx, orderDetailID, orderCode, "payment arrived after the order was closed")
+			}
+		case strings.EqualFold(status, entity.PaymentStatusExpired):
+			err = p.orderService.UpdateStatus(ctx, orderEntity.OrderEntity{
+				ID:      orderDetailID,
+				Status:  orderEntity.OrderStatusExpired,
+				Remarks: "payment expired",
+			}, orderEntity.SystemActor)
+		}
+		if err != nil && err.Error() != "400" {
+			log.Errorf("[PaymentService] UpdateStatusByOrderCode-3: %v", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// RefundOrder implements PaymentServiceInterface. It refunds a cancelled
+// order's successful payment and moves the order to Refunded in the same
+// transaction. Orders that were never paid, or are already refunded, are
+// left alone.
+func (p *paymentService) RefundOrder(ctx context.Context, orderID int64, orderCode, reason string) error {
+	return p.uow.Do(ctx, func(ctx context.Context) error {
+		return p.refundOrder(ctx, orderID, orderCode, reason)
+	})
+}
+
+func (p *paymentService) refundOrder(ctx context.Context, orderID int64, orderCode, reason string) error {
+	payment, err := p.repo.FindByOrderID(ctx, uint(orderID))
+	if err != nil {
+		if err.Error() == "404" {
+			return nil
+		}
+		log.Errorf("[PaymentService] RefundOrder-1: %v", err)
+		return err
+	}
+
+	if strings.EqualFold(payment.PaymentStatus, entity.PaymentStatusRefunded) {
+		return nil
+	}
+	if !strings.EqualFold(payment.PaymentStatus, entity.PaymentStatusSuccess) {
+		log.Infof("[PaymentService] RefundOrder-2: payment %d is %s, nothing to refund", payment.ID, payment.PaymentStatus)
+		return nil
+	}
+
+	// Cash on delivery is handed back by hand; only gateway payments need a
+	// refund call.
+	if payment.PaymentMethod == "midtrans" {
+		if err := p.midtrans.RefundTransaction(orderCode, "refund-"+orderCode, int64(payment.GrossAmount), reason); err != nil {
+			log.Errorf("[PaymentService] RefundOrder-3: %v", err)
+			return err
+		}
+	}
+
+	if err := p.repo.UpdateStatusByOrderCode(ctx, payment.OrderID, entity.PaymentStatusRefunded); err != nil {
+		log.Errorf("[PaymentService] RefundOrder-4: %v", err)
+		return err
+	}
+	if err := p.repo.LogPayment(ctx, payment.ID, entity.PaymentStatusRefunded); err != nil {
+		log.Errorf("[PaymentService] RefundOrder-5: %v", err)
+		return err
+	}
+
+	err = p.orderService.UpdateStatus(ctx, orderEntity.OrderEntity{
+		ID:      orderID,
+		Status:  orderEntity.OrderStatusRefunded,
+		Remarks: "payment refunded",
+	}, orderEntity.SystemActor)
+	if err != nil && err.Error() != "400" {
+		log.Errorf("[PaymentService] RefundOrder-6: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RefundPartial implements PaymentServiceInterface. It pays amount of an
+// order's successful payment back, e.g. for a returned item, and leaves the
+// order's status alone. refundKey identifies the refund so a retry does not
+// pay out twice. It fails with "400" when the order has no successful
+// payment or amount exceeds what is left of it after earlier refunds.
+func (p *paymentService) RefundPartial(ctx context.Context, orderID int64, orderCode string, amount int64, refundKey, reason string) error {
+	err := p.repo.RefundPartial(ctx, uint(orderID), amount, refundKey, func(payment entity.PaymentEntity) error {
+		if payment.PaymentMethod != "midtrans" {
+			return nil
+		}
+		return p.midtrans.RefundTransaction(orderCode, refundKey, amount, reason)
+	})
+	if err != nil {
+		log.Errorf("[PaymentService] RefundPartial-1: %v", err)
 		return err
 	}
 
 	return nil
 }
 
+// ExpirePayment implements PaymentServiceInterface. It closes the pending
+// payment of an order that expired or was cancelled unpaid so a late
+// settlement cannot go through; payments that already finished are left
+// alone.
+func (p *paymentService) ExpirePayment(ctx context.Context, orderID int64, orderCode string) error {
+	payment, err := p.repo.FindByOrderID(ctx, uint(orderID))
+	if err != nil {
+		if err.Error() == "404" {
+			return nil
+		}
+		log.Errorf("[PaymentService] ExpirePayment-1: %v", err)
+		return err
+	}
+
+	if !strings.EqualFold(payment.PaymentStatus, entity.PaymentStatusPending) {
+		return nil
+	}
+
+	// A failed cancel is not fatal: if the customer still pays, the
+	// settlement is refunded because the order is already closed.
+	if payment.PaymentMethod == "midtrans" {
+		if err := p.midtrans.CancelTransaction(orderCode); err != nil {
+			log.Errorf("[PaymentService] ExpirePayment-2: %v", err)
+		}
+	}
+
+	return p.uow.Do(ctx, func(ctx context.Context) error {
+		if err := p.repo.UpdateStatusByOrderCode(ctx, payment.OrderID, entity.PaymentStatusExpired); err != nil {
+			log.Errorf("[PaymentService] ExpirePayment-3: %v", err)
+			return err
+		}
+		if err := p.repo.LogPayment(ctx, payment.ID, entity.PaymentStatusExpired); err != nil {
+			log.Errorf("[PaymentService] ExpirePayment-4: %v", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ReconcilePending implements PaymentServiceInterface. It polls Midtrans
+// for payments still pending after reconcileAfter and applies any status
+// whose webhook never arrived, as UpdateStatusByOrderCode would. It returns
+// how many payments it moved on. A payment that can't be checked is logged
+// and skipped, so it doesn't hold up the rest of the batch.
+func (p *paymentService) ReconcilePending(ctx context.Context) (int, error) {
+	payments, err := p.repo.GetPendingByMethod(ctx, "midtrans", time.Now().Add(-reconcileAfter), reconcileBatchSize)
+	if err != nil {
+		log.Errorf("[PaymentService] ReconcilePending-1: %v", err)
+		return 0, err
+	}
+
+	reconciled := 0
+	for _, payment := range payments {
+		orderDetail, err := p.httpClientOrderService(int64(payment.OrderID))
+		if err != nil {
+			log.Errorf("[PaymentService] ReconcilePending-2: %v", err)
+			continue
+		}
+
+		// Snap transactions Midtrans has no record of yet (the customer
+		// never picked a channel) fail here and are left to expire.
+		transactionStatus, err := p.midtrans.TransactionStatus(orderDetail.OrderCode)
+		if err != nil {
+			log.Infof("[PaymentService] ReconcilePending-3: %s: %v", orderDetail.OrderCode, err)
+			continue
+		}
+
+		status := entity.MidtransPaymentStatus(transactionStatus)
+		if status == "pending" || status == "unknown" {
+			continue
+		}
+
+		if err := p.UpdateStatusByOrderCode(ctx, orderDetail.OrderCode, status); err != nil {
+			log.Errorf("[PaymentService] ReconcilePending-4: %v", err)
+			continue
+		}
+		reconciled++
+	}
+
+	return reconciled, nil
+}
+
 // ProcessPayment implements PaymentServiceInterface.
 func (p *paymentService) ProcessPayment(ctx context.Context, payment entity.PaymentEntity, accessToken string) (*entity.PaymentEntity, error) {
 	err := p.repo.GetByOrderID(ctx, uint(payment.OrderID))
@@ -126,10 +338,35 @@ func (p *paymentService) ProcessPayment(ctx context.Context, payment entity.Paym
 	}
 
 	if payment.PaymentMethod == "cod" {
-		payment.PaymentStatus = "Success"
-
-		if err := p.repo.CreatePayment(ctx, payment); err != nil {
-			log.Errorf("[PaymentService] ProcessPayment-2: %v", err)
+		payment.PaymentStatus = entity.PaymentStatusSuccess
+
+		// The payment, the order's payment window and its Paid status
+		// commit together.
+		err := p.uow.Do(ctx, func(ctx context.Context) error {
+			// Fails with "400" once the order's payment window has closed.
+			if err := p.orderService.StartPayment(ctx, int64(payment.OrderID), payment.PaymentMethod); err != nil {
+				log.Errorf("[PaymentService] ProcessPayment-9: %v", err)
+				return err
+			}
+
+			if err := p.repo.CreatePayment(ctx, payment); err != nil {
+				log.Errorf("[PaymentService] ProcessPayment-2: %v", err)
+				return err
+			}
+
+			// Cash on delivery counts as paid, so the order keeps its stock.
+			err := p.orderService.UpdateStatus(ctx, orderEntity.OrderEntity{
+				ID:      int64(payment.OrderID),
+				Status:  orderEntity.OrderStatusPaid,
+				Remarks: "cash on delivery",
+			}, orderEntity.SystemActor)
+			if err != nil && err.Error() != "400" {
+				log.Errorf("[PaymentService] ProcessPayment-3: %v", err)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
 			return nil, err
 		}
 
@@ -140,6 +377,12 @@ func (p *paymentService) ProcessPayment(ctx context.Context, payment entity.Paym
 	}
 
 	if payment.PaymentMethod == "midtrans" {
+		// Fails with "400" once the order's payment window has closed.
+		if err := p.orderService.StartPayment(ctx, int64(payment.OrderID), payment.PaymentMethod); err != nil {
+			log.Errorf("[PaymentService] ProcessPayment-9: %v", err)
+			return nil, err
+		}
+
 		var token map[string]interface{}
 		err := json.Unmarshal([]byte(accessToken), &token)
 		if err != nil {
@@ -164,7 +407,7 @@ func (p *paymentService) ProcessPayment(ctx context.Context, payment entity.Paym
 			log.Errorf("[PaymentService] ProcessPayment-7: %v", err)
 			return nil, err
 		}
-		payment.PaymentStatus = "Pending"
+		payment.PaymentStatus = entity.PaymentStatusPending
 		payment.PaymentGatewayID = transactionID
 
 		if err := p.repo.CreatePayment(ctx, payment); err != nil {
@@ -181,6 +424,16 @@ func (p *paymentService) ProcessPayment(ctx context.Context, payment entity.Paym
 	return nil, errors.New("Invalid payment method")
 }
 
+// orderClosed reports whether the order ended without being paid, so a
+// payment for it has to be refunded.
+func (p *paymentService) orderClosed(ctx context.Context, orderID int64) bool {
+	order, err := p.orderService.GetByID(ctx, orderID)
+	if err != nil {
+		return false
+	}
+	return order.Status == orderEntity.OrderStatusCancelled || order.Status == orderEntity.OrderStatusExpired
+}
+
 func (p *paymentService) httpClientOrderService(orderId int64) (*entity.OrderDetailHttpResponse, error) {
 	order, err := p.orderService.GetDetailCustomer(context.Background(), orderId)
 	if err != nil {
@@ -210,11 +463,12 @@ func (p *paymentService) httpClientPublicOrderIDByCodeService(orderCode string)
 	return p.orderService.GetPublicOrderIDByOrderCode(context.Background(), orderCode)
 }
 
-func NewPaymentService(repo repository.PaymentRepositoryInterface, cfg *config.Config, midtrans httpclient.MidtransClientInterface, orderService orderService.OrderServiceInterface, userService userService.UserServiceInterface) PaymentServiceInterface {
+func NewPaymentService(repo repository.PaymentRepositoryInterface, cfg *config.Config, uow uow.UnitOfWorkInterface, midtrans httpclient.MidtransClientInterface, orderService orderService.OrderServiceInterface, userService userService.UserServiceInterface) PaymentServiceInterface {
 	return &paymentService{
 		repo:         repo,
 		midtrans:     midtrans,
 		cfg:          cfg,
+		uow:          uow,
 		orderService: orderService,
 		userService:  userService,
 	}
@@ -27,7 +27,7 @@ func (cfg Config) ConnectionPostgres() (*Postgres, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&model.Category{}, &model.Product{})
+	db.AutoMigrate(&model.Category{}, &model.Product{}, &model.StockMovement{}, &model.StockReservation{})
 
 	sqlDB, err := db.DB()
 	if err != nil {
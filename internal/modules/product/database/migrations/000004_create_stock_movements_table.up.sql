@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "stock_movements" (
+    id SERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    quantity INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_stock_movements_reference_kind ON stock_movements(reference, kind);
+CREATE INDEX idx_stock_movements_product_id ON stock_movements(product_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS "stock_reservations" (
+    id SERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE UNIQUE INDEX idx_stock_reservations_reference ON stock_reservations(reference);
+CREATE INDEX idx_stock_reservations_product_id ON stock_reservations(product_id);
+CREATE INDEX idx_stock_reservations_status_expires_at ON stock_reservations(status, expires_at);
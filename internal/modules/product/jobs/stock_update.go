@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"tofash/internal/modules/product/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/datatypes"
+)
+
+const (
+	TopicStockUpdate                = "stock_update"
+	TopicStockRestore               = "stock_restore"
+	TopicStockReturn                = "stock_return"
+	TopicStockReservationExpiration = "stock_reservation_expiration"
+)
+
+// StockUpdatePayload is shared by stock_update, stock_restore and
+// stock_return. Reference ties an update and its restore together (e.g.
+// "order_item:42") so a restore only gives back stock its deduction actually
+// took; a return is keyed by its own reference (e.g. "return:7").
+type StockUpdatePayload struct {
+	ProductID int64  `json:"product_id"`
+	Quantity  int64  `json:"quantity"`
+	Reference string `json:"reference"`
+}
+
+// RegisterHandlers plugs the product module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, productSvc service.ProductServiceInterface) {
+	r.Register(TopicStockUpdate, async.Typed(func(ctx context.Context, _ uint, data StockUpdatePayload) error {
+		return productSvc.UpdateStock(ctx, data.ProductID, int(data.Quantity), data.Reference)
+	}))
+
+	r.Register(TopicStockRestore, async.Typed(func(ctx context.Context, _ uint, data StockUpdatePayload) error {
+		if data.Reference == "" {
+			return async.Permanent(errors.New("stock_restore requires a reference"))
+		}
+		return productSvc.RestoreStock(ctx, data.ProductID, int(data.Quantity), data.Reference)
+	}))
+
+	r.Register(TopicStockReturn, async.Typed(func(ctx context.Context, _ uint, data StockUpdatePayload) error {
+		if data.Reference == "" {
+			return async.Permanent(errors.New("stock_return requires a reference"))
+		}
+		return productSvc.ReturnStock(ctx, data.ProductID, int(data.Quantity), data.Reference)
+	}))
+
+	r.Register(TopicStockReservationExpiration, func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		released, err := productSvc.ReleaseExpiredReservations(ctx)
+		if err != nil {
+			return err
+		}
+		if released > 0 {
+			log.Infof("[StockReservationJob] Released %d expired stock reservation(s)", released)
+		}
+		return nil
+	})
+}
+
+// RegisterSchedules declares the product module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("*/5 * * * *", TopicStockReservationExpiration, nil)
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	StockMovementDeduct  = "deduct"
+	StockMovementRestore = "restore"
+	StockMovementReturn  = "return"
+)
+
+// StockMovement records a stock change made on behalf of a reference (an
+// order item, for instance). A reference is deducted and restored at most
+// once each, which makes both operations safe to retry.
+type StockMovement struct {
+	ID        int64     `gorm:"primaryKey"`
+	ProductID int64     `gorm:"column:product_id;not null;index"`
+	Reference string    `gorm:"column:reference;not null;size:255;uniqueIndex:idx_stock_movements_reference_kind,priority:1"`
+	Kind      string    `gorm:"column:kind;not null;size:20;uniqueIndex:idx_stock_movements_reference_kind,priority:2"`
+	Quantity  int       `gorm:"column:quantity;not null"`
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
+
+func (StockMovement) TableName() string {
+	return "stock_movements"
+}
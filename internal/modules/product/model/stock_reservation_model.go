@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	StockReservationHeld      = "held"
+	StockReservationCommitted = "committed"
+	StockReservationReleased  = "released"
+)
+
+// StockReservation holds stock for an unpaid order item. The stock is taken
+// from the product when the reservation is made (with a deduct movement);
+// committing keeps it, releasing gives it back through a restore movement.
+type StockReservation struct {
+	ID        int64     `gorm:"primaryKey"`
+	ProductID int64     `gorm:"column:product_id;not null;index"`
+	Reference string    `gorm:"column:reference;not null;size:255;uniqueIndex"`
+	Quantity  int       `gorm:"column:quantity;not null"`
+	Status    string    `gorm:"column:status;not null;size:20;index:idx_stock_reservations_status_expires_at,priority:1"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index:idx_stock_reservations_status_expires_at,priority:2"`
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (StockReservation) TableName() string {
+	return "stock_reservations"
+}
@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 	"tofash/internal/modules/product/entity"
 	"tofash/internal/modules/product/model"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Helper functions for JSON image conversion
@@ -41,10 +44,18 @@ func jsonToImages(jsonStr string) []string {
 type ProductRepositoryInterface interface {
 	GetAll(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
 	GetByID(ctx context.Context, productID int64) (*entity.ProductEntity, error)
+	GetByIDs(ctx context.Context, productIDs []int64) ([]entity.ProductEntity, error)
 	Create(ctx context.Context, req entity.ProductEntity) (int64, error)
 	Update(ctx context.Context, req entity.ProductEntity) error
 	Delete(ctx context.Context, productID int64) error
 	SearchProducts(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
+	DeductStock(ctx context.Context, productID int64, quantity int, reference string) error
+	RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error
+	ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error
+	ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error
+	CommitReservation(ctx context.Context, reference string) error
+	ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error
+	ReleaseExpiredReservations(ctx context.Context, now time.Time, limit int) (int64, error)
 }
 
 type productRepository struct {
@@ -283,6 +294,70 @@ func (p *productRepository) GetByID(ctx context.Context, productID int64) (*enti
 	}, nil
 }
 
+// GetByIDs implements ProductRepositoryInterface. It loads the products
+// and their variants, with categories, in a fixed number of queries
+// however many IDs are asked for; IDs with no product are left out.
+func (p *productRepository) GetByIDs(ctx context.Context, productIDs []int64) ([]entity.ProductEntity, error) {
+	if len(productIDs) == 0 {
+		return []entity.ProductEntity{}, nil
+	}
+
+	modelProducts := []model.Product{}
+	if err := p.db.WithContext(ctx).Preload("Category").Where("id IN ?", productIDs).Find(&modelProducts).Error; err != nil {
+		log.Errorf("[ProductRepository-1] GetByIDs: %v", err)
+		return nil, err
+	}
+
+	modelChildren := []model.Product{}
+	if err := p.db.WithContext(ctx).Preload("Category").Where("parent_id IN ?", productIDs).Order("id ASC").Find(&modelChildren).Error; err != nil {
+		log.Errorf("[ProductRepository-2] GetByIDs: %v", err)
+		return nil, err
+	}
+
+	children := map[int64][]entity.ProductEntity{}
+	for _, val := range modelChildren {
+		if val.ParentID == nil {
+			continue
+		}
+		children[*val.ParentID] = append(children[*val.ParentID], toProductEntity(val))
+	}
+
+	entities := make([]entity.ProductEntity, 0, len(modelProducts))
+	for _, val := range modelProducts {
+		product := toProductEntity(val)
+		product.Child = children[val.ID]
+		entities = append(entities, product)
+	}
+
+	return entities, nil
+}
+
+func toProductEntity(val model.Product) entity.ProductEntity {
+	return entity.ProductEntity{
+		ID:           val.ID,
+		CategorySlug: val.CategorySlug,
+		ParentID:     val.ParentID,
+		Name:         val.Name,
+		Image:        val.Image,
+		Images:       jsonToImages(val.ImagesJSON),
+		Description:  val.Description,
+		RegulerPrice: val.RegulerPrice,
+		SalePrice:    val.SalePrice,
+		Unit:         val.Unit,
+		Weight:       val.Weight,
+		Stock:        val.Stock,
+		Variant:      val.Variant,
+		// Fashion fields
+		SKU:          val.SKU,
+		Size:         val.Size,
+		Color:        val.Color,
+		Material:     val.Material,
+		Status:       val.Status,
+		CategoryName: val.Category.Name,
+		CreatedAt:    val.CreatedAt,
+	}
+}
+
 // GetAll implements ProductRepositoryInterface.
 func (p *productRepository) SearchProducts(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error) {
 	// Fallback to SQL (GetAll) as ES has been removed
@@ -361,6 +436,275 @@ func (p *productRepository) GetAll(ctx context.Context, query entity.QueryString
 	return respProducts, countData, int64(totalPage), nil
 }
 
+// ErrInsufficientStock is returned when a product has fewer units left than
+// a deduction or reservation asks for.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// DeductStock implements ProductRepositoryInterface. With a reference the
+// deduction is applied once, and skipped if the reference was already
+// restored (the order was cancelled before its stock was taken).
+func (p *productRepository) DeductStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return uow.DB(ctx, p.db).Transaction(func(tx *gorm.DB) error {
+		if _, err := deduct(tx, productID, quantity, reference); err != nil {
+			log.Errorf("[ProductRepository-1] DeductStock: %v", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// ReserveStock implements ProductRepositoryInterface. The stock is taken
+// straight away, so a second buyer of the last unit fails here rather than
+// after their order exists. It joins the caller's unit of work.
+func (p *productRepository) ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error {
+	return uow.DB(ctx, p.db).Transaction(func(tx *gorm.DB) error {
+		applied, err := deduct(tx, productID, quantity, reference)
+		if err != nil {
+			log.Errorf("[ProductRepository-1] ReserveStock: %v", err)
+			return err
+		}
+		if !applied {
+			return nil
+		}
+
+		return tx.Create(&model.StockReservation{
+			ProductID: productID,
+			Reference: reference,
+			Quantity:  quantity,
+			Status:    model.StockReservationHeld,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+}
+
+// CommitReservation implements ProductRepositoryInterface. References
+// without a held reservation are left alone; a released one is only logged,
+// since the payment it belongs to has already gone through.
+func (p *productRepository) CommitReservation(ctx context.Context, reference string) error {
+	db := uow.DB(ctx, p.db)
+	result := db.Model(&model.StockReservation{}).
+		Where("reference = ? AND status = ?", reference, model.StockReservationHeld).
+		Updates(map[string]interface{}{"status": model.StockReservationCommitted, "updated_at": time.Now()})
+	if result.Error != nil {
+		log.Errorf("[ProductRepository-1] CommitReservation: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var status []string
+	if err := db.Model(&model.StockReservation{}).Where("reference = ?", reference).Pluck("status", &status).Error; err != nil {
+		log.Errorf("[ProductRepository-2] CommitReservation: %v", err)
+		return err
+	}
+	if len(status) > 0 && status[0] == model.StockReservationReleased {
+		log.Errorf("[ProductRepository-3] CommitReservation: %s was released before it was paid, stock must be checked by hand", reference)
+	}
+	return nil
+}
+
+// ExtendReservation implements ProductRepositoryInterface. It moves the
+// expiry of reference's held reservation to expiresAt; committed and
+// released ones are left alone. It joins the caller's unit of work.
+func (p *productRepository) ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error {
+	err := uow.DB(ctx, p.db).Model(&model.StockReservation{}).
+		Where("reference = ? AND status = ?", reference, model.StockReservationHeld).
+		Updates(map[string]interface{}{"expires_at": expiresAt, "updated_at": time.Now()}).Error
+	if err != nil {
+		log.Errorf("[ProductRepository-1] ExtendReservation: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseExpiredReservations implements ProductRepositoryInterface. It
+// gives back the stock of up to limit held reservations that expired
+// before now.
+func (p *productRepository) ReleaseExpiredReservations(ctx context.Context, now time.Time, limit int) (int64, error) {
+	var expired []model.StockReservation
+	err := p.db.WithContext(ctx).
+		Where("status = ? AND expires_at < ?", model.StockReservationHeld, now).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&expired).Error
+	if err != nil {
+		log.Errorf("[ProductRepository-1] ReleaseExpiredReservations: %v", err)
+		return 0, err
+	}
+
+	var released int64
+	for _, reservation := range expired {
+		if err := p.RestoreStock(ctx, reservation.ProductID, reservation.Quantity, reservation.Reference); err != nil {
+			log.Errorf("[ProductRepository-2] ReleaseExpiredReservations: %v", err)
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// RestoreStock implements ProductRepositoryInterface. Stock is only given
+// back if the reference was deducted, to the product it was deducted from;
+// otherwise the restore is recorded so a late deduction is skipped. A
+// reservation for the reference is released.
+func (p *productRepository) RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return uow.DB(ctx, p.db).Transaction(func(tx *gorm.DB) error {
+		// A variant's stock is held on the variant's row, which need not be
+		// the product the caller knows about.
+		movements, err := stockMovements(tx, reference)
+		if err != nil {
+			log.Errorf("[ProductRepository-1] RestoreStock: %v", err)
+			return err
+		}
+		if deducted, ok := movements[model.StockMovementDeduct]; ok {
+			productID = deducted.ProductID
+			quantity = -deducted.Quantity
+		}
+
+		modelProduct, err := lockProduct(tx, productID)
+		if err != nil {
+			log.Errorf("[ProductRepository-2] RestoreStock: %v", err)
+			return err
+		}
+
+		movements, err = stockMovements(tx, reference)
+		if err != nil {
+			log.Errorf("[ProductRepository-3] RestoreStock: %v", err)
+			return err
+		}
+		if _, ok := movements[model.StockMovementRestore]; ok {
+			log.Infof("[ProductRepository-4] RestoreStock: %s already restored", reference)
+			return nil
+		}
+
+		restored := 0
+		if _, ok := movements[model.StockMovementDeduct]; ok {
+			restored = quantity
+			if err := tx.Model(modelProduct).Update("stock", gorm.Expr("stock + ?", quantity)).Error; err != nil {
+				log.Errorf("[ProductRepository-5] RestoreStock: %v", err)
+				return err
+			}
+		}
+
+		err = tx.Model(&model.StockReservation{}).
+			Where("reference = ? AND status <> ?", reference, model.StockReservationReleased).
+			Updates(map[string]interface{}{"status": model.StockReservationReleased, "updated_at": time.Now()}).Error
+		if err != nil {
+			log.Errorf("[ProductRepository-6] RestoreStock: %v", err)
+			return err
+		}
+
+		return tx.Create(&model.StockMovement{
+			ProductID: productID,
+			Reference: reference,
+			Kind:      model.StockMovementRestore,
+			Quantity:  restored,
+		}).Error
+	})
+}
+
+// ReturnStock implements ProductRepositoryInterface. It puts goods sent
+// back by a customer on the shelf again, once per reference.
+func (p *productRepository) ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return uow.DB(ctx, p.db).Transaction(func(tx *gorm.DB) error {
+		modelProduct, err := lockProduct(tx, productID)
+		if err != nil {
+			log.Errorf("[ProductRepository-1] ReturnStock: %v", err)
+			return err
+		}
+
+		movements, err := stockMovements(tx, reference)
+		if err != nil {
+			log.Errorf("[ProductRepository-2] ReturnStock: %v", err)
+			return err
+		}
+		if _, ok := movements[model.StockMovementReturn]; ok {
+			log.Infof("[ProductRepository-3] ReturnStock: %s already returned", reference)
+			return nil
+		}
+
+		if err := tx.Model(modelProduct).Update("stock", gorm.Expr("stock + ?", quantity)).Error; err != nil {
+			log.Errorf("[ProductRepository-4] ReturnStock: %v", err)
+			return err
+		}
+
+		return tx.Create(&model.StockMovement{
+			ProductID: productID,
+			Reference: reference,
+			Kind:      model.StockMovementReturn,
+			Quantity:  quantity,
+		}).Error
+	})
+}
+
+// deduct takes quantity from the product and records it against reference.
+// It reports false when the reference was already deducted or restored.
+func deduct(tx *gorm.DB, productID int64, quantity int, reference string) (bool, error) {
+	// The product row lock serialises movements of the same product, so a
+	// deduction and a restore of one reference can't both miss each other.
+	modelProduct, err := lockProduct(tx, productID)
+	if err != nil {
+		return false, err
+	}
+
+	if reference != "" {
+		movements, err := stockMovements(tx, reference)
+		if err != nil {
+			return false, err
+		}
+		if len(movements) > 0 {
+			log.Infof("[ProductRepository] deduct: %s already settled", reference)
+			return false, nil
+		}
+	}
+
+	if modelProduct.Stock < quantity {
+		return false, ErrInsufficientStock
+	}
+
+	if err := tx.Model(modelProduct).Update("stock", gorm.Expr("stock - ?", quantity)).Error; err != nil {
+		return false, err
+	}
+
+	if reference == "" {
+		return true, nil
+	}
+	err = tx.Create(&model.StockMovement{
+		ProductID: productID,
+		Reference: reference,
+		Kind:      model.StockMovementDeduct,
+		Quantity:  -quantity,
+	}).Error
+	return err == nil, err
+}
+
+func lockProduct(tx *gorm.DB, productID int64) (*model.Product, error) {
+	modelProduct := model.Product{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "stock").
+		Where("id = ?", productID).
+		First(&modelProduct).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("404")
+	}
+	return &modelProduct, err
+}
+
+// stockMovements returns the movements recorded for reference, by kind.
+func stockMovements(tx *gorm.DB, reference string) (map[string]model.StockMovement, error) {
+	var movements []model.StockMovement
+	if err := tx.Where("reference = ?", reference).Find(&movements).Error; err != nil {
+		return nil, err
+	}
+
+	byKind := make(map[string]model.StockMovement, len(movements))
+	for _, movement := range movements {
+		byKind[movement.Kind] = movement
+	}
+	return byKind, nil
+}
+
 func NewProductRepository(db *gorm.DB) ProductRepositoryInterface {
 	return &productRepository{db: db}
 }
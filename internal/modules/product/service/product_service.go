@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 	"tofash/internal/modules/product/entity"
 	"tofash/internal/modules/product/message"
 	"tofash/internal/modules/product/repository"
@@ -13,13 +14,27 @@ import (
 type ProductServiceInterface interface {
 	GetAll(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
 	GetByID(ctx context.Context, productID int64) (*entity.ProductEntity, error)
+	GetByIDs(ctx context.Context, productIDs []int64) (map[int64]*entity.ProductEntity, error)
 	Create(ctx context.Context, req entity.ProductEntity) error
 	Update(ctx context.Context, req entity.ProductEntity) error
 	Delete(ctx context.Context, productID int64) error
 	SearchProducts(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
-	UpdateStock(ctx context.Context, productID int64, quantity int) error
+	UpdateStock(ctx context.Context, productID int64, quantity int, reference string) error
+	RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error
+	ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error
+	ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error
+	CommitReservation(ctx context.Context, reference string) error
+	ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error
+	ReleaseExpiredReservations(ctx context.Context) (int64, error)
 }
 
+// ErrInsufficientStock is returned by ReserveStock and UpdateStock when the
+// product has too few units left.
+var ErrInsufficientStock = repository.ErrInsufficientStock
+
+// releaseBatchSize caps how many expired reservations one sweep releases.
+const releaseBatchSize = 500
+
 type productService struct {
 	repo              repository.ProductRepositoryInterface
 	publisherRabbitMQ message.PublishRabbitMQInterface
@@ -97,6 +112,22 @@ func (p *productService) GetByID(ctx context.Context, productID int64) (*entity.
 	return result, nil
 }
 
+// GetByIDs implements ProductServiceInterface. Products are keyed by ID;
+// unknown IDs are missing from the map rather than an error.
+func (p *productService) GetByIDs(ctx context.Context, productIDs []int64) (map[int64]*entity.ProductEntity, error) {
+	results, err := p.repo.GetByIDs(ctx, productIDs)
+	if err != nil {
+		log.Errorf("[ProductService-1] GetByIDs: %v", err)
+		return nil, err
+	}
+
+	products := make(map[int64]*entity.ProductEntity, len(results))
+	for i := range results {
+		products[results[i].ID] = &results[i]
+	}
+	return products, nil
+}
+
 // Update implements ProductServiceInterface.
 func (p *productService) Update(ctx context.Context, req entity.ProductEntity) error {
 	err := p.repo.Update(ctx, req)
@@ -111,31 +142,83 @@ func (p *productService) Update(ctx context.Context, req entity.ProductEntity) e
 	return nil
 }
 
-// UpdateStock implements ProductServiceInterface.
-func (p *productService) UpdateStock(ctx context.Context, productID int64, quantity int) error {
-	product, err := p.repo.GetByID(ctx, productID)
-	if err != nil {
-		log.Errorf("[ProductService] UpdateStock GetByID: %v", err)
+// UpdateStock implements ProductServiceInterface. It deducts quantity from
+// the product's stock; reference makes the deduction idempotent.
+func (p *productService) UpdateStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	if err := p.repo.DeductStock(ctx, productID, quantity, reference); err != nil {
+		log.Errorf("[ProductService-1] UpdateStock: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReserveStock implements ProductServiceInterface. It holds quantity for
+// reference until the reservation is committed, or released by RestoreStock
+// or once it expires.
+func (p *productService) ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error {
+	if err := p.repo.ReserveStock(ctx, productID, quantity, reference, expiresAt); err != nil {
+		log.Errorf("[ProductService-1] ReserveStock: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// CommitReservation implements ProductServiceInterface. The held stock is
+// kept for good.
+func (p *productService) CommitReservation(ctx context.Context, reference string) error {
+	if err := p.repo.CommitReservation(ctx, reference); err != nil {
+		log.Errorf("[ProductService-1] CommitReservation: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ExtendReservation implements ProductServiceInterface. A held reservation
+// for reference now expires at expiresAt.
+func (p *productService) ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error {
+	if err := p.repo.ExtendReservation(ctx, reference, expiresAt); err != nil {
+		log.Errorf("[ProductService-1] ExtendReservation: %v", err)
 		return err
 	}
 
-	if product == nil {
-		return errors.New("product not found")
+	return nil
+}
+
+// ReleaseExpiredReservations implements ProductServiceInterface.
+func (p *productService) ReleaseExpiredReservations(ctx context.Context) (int64, error) {
+	released, err := p.repo.ReleaseExpiredReservations(ctx, time.Now(), releaseBatchSize)
+	if err != nil {
+		log.Errorf("[ProductService-1] ReleaseExpiredReservations: %v", err)
+		return released, err
 	}
 
-	// Assuming Product.Stock is int or int64?
-	// Error was: mismatched types int and int64
-	// If product.Stock is int, then cast quantity to int.
-	// Let's check entity.
+	return released, nil
+}
 
-	// Assuming ProductEntity struct has Stock as int based on error.
-	if product.Stock < int(quantity) {
-		return errors.New("insufficient stock")
+// RestoreStock implements ProductServiceInterface. It gives back stock taken
+// by UpdateStock or ReserveStock for the same reference.
+func (p *productService) RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	if err := p.repo.RestoreStock(ctx, productID, quantity, reference); err != nil {
+		log.Errorf("[ProductService-1] RestoreStock: %v", err)
+		return err
 	}
 
-	product.Stock -= int(quantity)
+	return nil
+}
+
+// ReturnStock implements ProductServiceInterface. It adds quantity of
+// returned goods back to the product; retries with the same reference are
+// no-ops.
+func (p *productService) ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	if err := p.repo.ReturnStock(ctx, productID, quantity, reference); err != nil {
+		log.Errorf("[ProductService-1] ReturnStock: %v", err)
+		return err
+	}
 
-	return p.repo.Update(ctx, *product)
+	return nil
 }
 
 func NewProductService(repo repository.ProductRepositoryInterface, publisherRabbitMQ message.PublishRabbitMQInterface, repoCat repository.CategoryRepositoryInterface) ProductServiceInterface {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"tofash/internal/modules/product/entity"
 
@@ -13,12 +14,13 @@ import (
 // ----- Mock implementations -----
 
 type mockProductRepo struct {
-	getAllFn  func(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
-	getByIDFn func(ctx context.Context, id int64) (*entity.ProductEntity, error)
-	createFn  func(ctx context.Context, req entity.ProductEntity) (int64, error)
-	updateFn  func(ctx context.Context, req entity.ProductEntity) error
-	deleteFn  func(ctx context.Context, id int64) error
-	searchFn  func(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
+	getAllFn   func(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
+	getByIDFn  func(ctx context.Context, id int64) (*entity.ProductEntity, error)
+	getByIDsFn func(ctx context.Context, ids []int64) ([]entity.ProductEntity, error)
+	createFn   func(ctx context.Context, req entity.ProductEntity) (int64, error)
+	updateFn   func(ctx context.Context, req entity.ProductEntity) error
+	deleteFn   func(ctx context.Context, id int64) error
+	searchFn   func(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error)
 }
 
 func (m *mockProductRepo) GetAll(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error) {
@@ -27,6 +29,9 @@ func (m *mockProductRepo) GetAll(ctx context.Context, query entity.QueryStringPr
 func (m *mockProductRepo) GetByID(ctx context.Context, productID int64) (*entity.ProductEntity, error) {
 	return m.getByIDFn(ctx, productID)
 }
+func (m *mockProductRepo) GetByIDs(ctx context.Context, productIDs []int64) ([]entity.ProductEntity, error) {
+	return m.getByIDsFn(ctx, productIDs)
+}
 func (m *mockProductRepo) Create(ctx context.Context, req entity.ProductEntity) (int64, error) {
 	return m.createFn(ctx, req)
 }
@@ -39,6 +44,28 @@ func (m *mockProductRepo) Delete(ctx context.Context, productID int64) error {
 func (m *mockProductRepo) SearchProducts(ctx context.Context, query entity.QueryStringProduct) ([]entity.ProductEntity, int64, int64, error) {
 	return m.searchFn(ctx, query)
 }
+func (m *mockProductRepo) DeductStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+func (m *mockProductRepo) ReturnStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+
+func (m *mockProductRepo) RestoreStock(ctx context.Context, productID int64, quantity int, reference string) error {
+	return nil
+}
+func (m *mockProductRepo) ReserveStock(ctx context.Context, productID int64, quantity int, reference string, expiresAt time.Time) error {
+	return nil
+}
+func (m *mockProductRepo) CommitReservation(ctx context.Context, reference string) error {
+	return nil
+}
+func (m *mockProductRepo) ExtendReservation(ctx context.Context, reference string, expiresAt time.Time) error {
+	return nil
+}
+func (m *mockProductRepo) ReleaseExpiredReservations(ctx context.Context, now time.Time, limit int) (int64, error) {
+	return 0, nil
+}
 
 type mockCategoryRepo struct {
 	getAllFn          func(ctx context.Context, queryString entity.QueryStringEntity) ([]entity.CategoryEntity, int64, int64, error)
@@ -147,6 +174,20 @@ func TestProductService_GetByID_Success(t *testing.T) {
 	assert.Equal(t, "Category 1", result.CategoryName)
 }
 
+func TestProductService_GetByIDs_KeysByID(t *testing.T) {
+	mockRepo := &mockProductRepo{getByIDsFn: func(_ context.Context, ids []int64) ([]entity.ProductEntity, error) {
+		assert.Equal(t, []int64{1, 2, 3}, ids)
+		return []entity.ProductEntity{{ID: 3, Name: "Cap"}, {ID: 1, Name: "Shirt"}}, nil
+	}}
+	svc := NewProductService(mockRepo, nil, nil)
+	result, err := svc.GetByIDs(context.Background(), []int64{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "Shirt", result[1].Name)
+	assert.Equal(t, "Cap", result[3].Name)
+	assert.NotContains(t, result, int64(2))
+}
+
 func TestProductService_Create_Success(t *testing.T) {
 	ctx := context.Background()
 	createdID := int64(42)
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS "return_requests" (
+    id SERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    order_code VARCHAR(50) NOT NULL,
+    order_item_id BIGINT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    buyer_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    variant_id BIGINT NOT NULL DEFAULT 0,
+    type VARCHAR(20) NOT NULL,
+    quantity BIGINT NOT NULL,
+    unit_price BIGINT NOT NULL DEFAULT 0,
+    reason text NOT NULL,
+    photos_json text NULL,
+    status VARCHAR(20) NOT NULL,
+    exchange_sku VARCHAR(255) NULL,
+    exchange_size VARCHAR(255) NULL,
+    exchange_color VARCHAR(255) NULL,
+    exchange_variant_id BIGINT NOT NULL DEFAULT 0,
+    exchange_order_id BIGINT NULL REFERENCES orders(id) ON DELETE SET NULL,
+    restock BOOLEAN NOT NULL DEFAULT FALSE,
+    refund_amount BIGINT NOT NULL DEFAULT 0,
+    admin_note text NULL,
+    reviewed_by BIGINT NULL,
+    received_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX idx_return_requests_order_id ON return_requests(order_id);
+CREATE INDEX idx_return_requests_order_item_id ON return_requests(order_item_id);
+CREATE INDEX idx_return_requests_buyer_id ON return_requests(buyer_id);
+CREATE INDEX idx_return_requests_status ON return_requests(status);
@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"io"
+	"time"
+)
+
+// Return types: what the customer gets back for the returned item.
+const (
+	ReturnTypeRefund   = "refund"
+	ReturnTypeExchange = "exchange"
+)
+
+// ReturnEntity is a customer's request to send back part or all of one
+// order item. The product, variant and unit price are copied from the
+// order item when the request is made.
+type ReturnEntity struct {
+	ID          int64    `json:"id"`
+	OrderID     int64    `json:"order_id"`
+	OrderCode   string   `json:"order_code"`
+	OrderItemID int64    `json:"order_item_id"`
+	BuyerID     int64    `json:"buyer_id"`
+	ProductID   int64    `json:"product_id"`
+	VariantID   int64    `json:"variant_id"`
+	Type        string   `json:"type"`
+	Quantity    int64    `json:"quantity"`
+	UnitPrice   int64    `json:"unit_price"`
+	Reason      string   `json:"reason"`
+	PhotoURLs   []string `json:"photo_urls"`
+	Status      string   `json:"status"`
+	// The replacement asked for by an exchange: another size or colour of
+	// the same product, named by SKU or by size and colour.
+	ExchangeSKU       string `json:"exchange_sku"`
+	ExchangeSize      string `json:"exchange_size"`
+	ExchangeColor     string `json:"exchange_color"`
+	ExchangeVariantID int64  `json:"exchange_variant_id"`
+	ExchangeOrderID   int64  `json:"exchange_order_id"`
+	// Restock tells whether the received goods went back on the shelf.
+	Restock      bool       `json:"restock"`
+	RefundAmount int64      `json:"refund_amount"`
+	AdminNote    string     `json:"admin_note"`
+	ReviewedBy   int64      `json:"reviewed_by"`
+	ReceivedAt   *time.Time `json:"received_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// StockProductID is the product row whose stock the returned goods belong
+// to: the ordered variant, or the product itself.
+func (r ReturnEntity) StockProductID() int64 {
+	if r.VariantID != 0 {
+		return r.VariantID
+	}
+	return r.ProductID
+}
+
+// ReturnPhoto is a picture of the returned item, uploaded with the request.
+type ReturnPhoto struct {
+	FileName string
+	Content  io.Reader
+}
+
+type QueryStringEntity struct {
+	Status  string
+	BuyerID int64
+	Page    int64
+	Limit   int64
+}
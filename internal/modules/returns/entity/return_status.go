@@ -0,0 +1,31 @@
+package entity
+
+// Return statuses, in lifecycle order.
+const (
+	ReturnStatusRequested = "Requested"
+	ReturnStatusApproved  = "Approved"
+	ReturnStatusRejected  = "Rejected"
+	ReturnStatusReceived  = "Received"
+	ReturnStatusRefunded  = "Refunded"
+	ReturnStatusExchanged = "Exchanged"
+)
+
+// returnStatusTransitions lists the statuses each status may move to. A
+// received return ends as a refund or an exchange, depending on its type;
+// Rejected, Refunded and Exchanged are final.
+var returnStatusTransitions = map[string][]string{
+	ReturnStatusRequested: {ReturnStatusApproved, ReturnStatusRejected},
+	ReturnStatusApproved:  {ReturnStatusReceived, ReturnStatusRejected},
+	ReturnStatusReceived:  {ReturnStatusRefunded, ReturnStatusExchanged},
+}
+
+// CanTransitionReturnStatus reports whether a return in status from may be
+// moved to status to.
+func CanTransitionReturnStatus(from, to string) bool {
+	for _, next := range returnStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
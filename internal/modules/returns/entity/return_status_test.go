@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransitionReturnStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{ReturnStatusRequested, ReturnStatusApproved, true},
+		{ReturnStatusRequested, ReturnStatusRejected, true},
+		{ReturnStatusRequested, ReturnStatusReceived, false},
+		{ReturnStatusApproved, ReturnStatusReceived, true},
+		{ReturnStatusApproved, ReturnStatusRefunded, false},
+		{ReturnStatusReceived, ReturnStatusRefunded, true},
+		{ReturnStatusReceived, ReturnStatusExchanged, true},
+		{ReturnStatusReceived, ReturnStatusRejected, false},
+		{ReturnStatusRejected, ReturnStatusApproved, false},
+		{ReturnStatusRefunded, ReturnStatusExchanged, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CanTransitionReturnStatus(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
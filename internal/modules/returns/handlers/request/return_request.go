@@ -0,0 +1,23 @@
+package request
+
+// CreateReturnRequest is sent as multipart form data, with up to five
+// pictures of the item in "photos".
+type CreateReturnRequest struct {
+	OrderID       int64  `form:"order_id" validate:"required"`
+	OrderItemID   int64  `form:"order_item_id" validate:"required"`
+	Quantity      int64  `form:"quantity" validate:"required,min=1"`
+	Type          string `form:"type" validate:"required,oneof=refund exchange"`
+	Reason        string `form:"reason" validate:"required"`
+	ExchangeSKU   string `form:"exchange_sku"`
+	ExchangeSize  string `form:"exchange_size"`
+	ExchangeColor string `form:"exchange_color"`
+}
+
+type ReviewReturnRequest struct {
+	Note string `json:"note"`
+}
+
+type ReceiveReturnRequest struct {
+	Restock *bool  `json:"restock" validate:"required"`
+	Note    string `json:"note"`
+}
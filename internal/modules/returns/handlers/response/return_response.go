@@ -0,0 +1,27 @@
+package response
+
+type ReturnResponse struct {
+	ID                int64    `json:"id"`
+	OrderID           int64    `json:"order_id"`
+	OrderCode         string   `json:"order_code"`
+	OrderItemID       int64    `json:"order_item_id"`
+	BuyerID           int64    `json:"buyer_id"`
+	ProductID         int64    `json:"product_id"`
+	VariantID         int64    `json:"variant_id"`
+	Type              string   `json:"type"`
+	Quantity          int64    `json:"quantity"`
+	UnitPrice         int64    `json:"unit_price"`
+	Reason            string   `json:"reason"`
+	PhotoURLs         []string `json:"photo_urls"`
+	Status            string   `json:"status"`
+	ExchangeSKU       string   `json:"exchange_sku,omitempty"`
+	ExchangeSize      string   `json:"exchange_size,omitempty"`
+	ExchangeColor     string   `json:"exchange_color,omitempty"`
+	ExchangeVariantID int64    `json:"exchange_variant_id,omitempty"`
+	ExchangeOrderID   int64    `json:"exchange_order_id,omitempty"`
+	Restock           bool     `json:"restock"`
+	RefundAmount      int64    `json:"refund_amount"`
+	AdminNote         string   `json:"admin_note"`
+	ReceivedAt        string   `json:"received_at,omitempty"`
+	CreatedAt         string   `json:"created_at"`
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	"tofash/internal/modules/order/utils/conv"
+	"tofash/internal/modules/returns/entity"
+	"tofash/internal/modules/returns/handlers/request"
+	"tofash/internal/modules/returns/handlers/response"
+	"tofash/internal/modules/returns/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	maxReturnPhotos    = 5
+	maxReturnPhotoSize = 5 << 20
+)
+
+type ReturnHandlerInterface interface {
+	CreateReturn(c echo.Context) error
+	GetAllCustomer(c echo.Context) error
+	GetDetailCustomer(c echo.Context) error
+	GetAllAdmin(c echo.Context) error
+	GetByIDAdmin(c echo.Context) error
+	Approve(c echo.Context) error
+	Reject(c echo.Context) error
+	Receive(c echo.Context) error
+}
+
+type returnHandler struct {
+	returnService service.ReturnServiceInterface
+}
+
+// CreateReturn implements ReturnHandlerInterface.
+func (h *returnHandler) CreateReturn(c echo.Context) error {
+	var (
+		ctx = c.Request().Context()
+		req = request.CreateReturnRequest{}
+	)
+
+	jwtUserData, err := customerUser(c)
+	if err != nil {
+		log.Errorf("[ReturnHandler-1] CreateReturn: %v", err)
+		return c.JSON(http.StatusUnauthorized, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[ReturnHandler-2] CreateReturn: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+	if err := c.Validate(&req); err != nil {
+		log.Errorf("[ReturnHandler-3] CreateReturn: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+	}
+
+	photos := []entity.ReturnPhoto{}
+	if form, err := c.MultipartForm(); err == nil {
+		files := form.File["photos"]
+		if len(files) > maxReturnPhotos {
+			return c.JSON(http.StatusUnprocessableEntity, response.ResponseError("at most 5 photos can be uploaded"))
+		}
+		for _, file := range files {
+			if file.Size > maxReturnPhotoSize || !strings.HasPrefix(file.Header.Get("Content-Type"), "image/") {
+				return c.JSON(http.StatusUnprocessableEntity, response.ResponseError("photos must be images of at most 5 MB"))
+			}
+			src, err := file.Open()
+			if err != nil {
+				log.Errorf("[ReturnHandler-4] CreateReturn: %v", err)
+				return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+			}
+			defer src.Close()
+			photos = append(photos, entity.ReturnPhoto{FileName: file.Filename, Content: src})
+		}
+	}
+
+	returnID, err := h.returnService.RequestReturn(ctx, entity.ReturnEntity{
+		OrderID:       req.OrderID,
+		OrderItemID:   req.OrderItemID,
+		BuyerID:       jwtUserData.UserID,
+		Type:          req.Type,
+		Quantity:      req.Quantity,
+		Reason:        req.Reason,
+		ExchangeSKU:   req.ExchangeSKU,
+		ExchangeSize:  req.ExchangeSize,
+		ExchangeColor: req.ExchangeColor,
+	}, photos)
+	if err != nil {
+		log.Errorf("[ReturnHandler-5] CreateReturn: %v", err)
+		var outOfStock *orderService.InsufficientStockError
+		switch {
+		case errors.Is(err, service.ErrNotReturnable), errors.Is(err, service.ErrInvalidExchange):
+			return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+		case errors.As(err, &outOfStock):
+			return c.JSON(http.StatusConflict, response.ResponseError("the replacement is out of stock"))
+		case err.Error() == "404":
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusCreated, response.ResponseSuccess("success", map[string]interface{}{
+		"return_id": returnID,
+	}))
+}
+
+// GetAllCustomer implements ReturnHandlerInterface.
+func (h *returnHandler) GetAllCustomer(c echo.Context) error {
+	jwtUserData, err := customerUser(c)
+	if err != nil {
+		log.Errorf("[ReturnHandler-1] GetAllCustomer: %v", err)
+		return c.JSON(http.StatusUnauthorized, response.ResponseError(err.Error()))
+	}
+
+	return h.list(c, jwtUserData.UserID)
+}
+
+// GetAllAdmin implements ReturnHandlerInterface.
+func (h *returnHandler) GetAllAdmin(c echo.Context) error {
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[ReturnHandler-1] GetAllAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	return h.list(c, 0)
+}
+
+func (h *returnHandler) list(c echo.Context, buyerID int64) error {
+	ctx := c.Request().Context()
+
+	var page int64 = 1
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		page, _ = conv.StringToInt64(pageStr)
+		if page <= 0 {
+			page = 1
+		}
+	}
+
+	var perPage int64 = 10
+	if perPageStr := c.QueryParam("perPage"); perPageStr != "" {
+		perPage, _ = conv.StringToInt64(perPageStr)
+		if perPage <= 0 {
+			perPage = 10
+		}
+	}
+
+	results, totalData, totalPage, err := h.returnService.GetAll(ctx, entity.QueryStringEntity{
+		Status:  c.QueryParam("status"),
+		BuyerID: buyerID,
+		Page:    page,
+		Limit:   perPage,
+	})
+	if err != nil {
+		log.Errorf("[ReturnHandler-2] GetAll: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	respReturns := []response.ReturnResponse{}
+	for _, result := range results {
+		respReturns = append(respReturns, toReturnResponse(result))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccessWithPagination("success", respReturns, page, totalData, totalPage, perPage))
+}
+
+// GetDetailCustomer implements ReturnHandlerInterface.
+func (h *returnHandler) GetDetailCustomer(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	jwtUserData, err := customerUser(c)
+	if err != nil {
+		log.Errorf("[ReturnHandler-1] GetDetailCustomer: %v", err)
+		return c.JSON(http.StatusUnauthorized, response.ResponseError(err.Error()))
+	}
+
+	returnID, err := conv.StringToInt64(c.Param("returnID"))
+	if err != nil {
+		log.Errorf("[ReturnHandler-2] GetDetailCustomer: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid returnID"))
+	}
+
+	result, err := h.returnService.GetDetailCustomer(ctx, returnID, jwtUserData.UserID)
+	if err != nil {
+		log.Errorf("[ReturnHandler-3] GetDetailCustomer: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", toReturnResponse(*result)))
+}
+
+// GetByIDAdmin implements ReturnHandlerInterface.
+func (h *returnHandler) GetByIDAdmin(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, err := adminUser(c); err != nil {
+		log.Errorf("[ReturnHandler-1] GetByIDAdmin: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	returnID, err := conv.StringToInt64(c.Param("returnID"))
+	if err != nil {
+		log.Errorf("[ReturnHandler-2] GetByIDAdmin: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid returnID"))
+	}
+
+	result, err := h.returnService.GetByID(ctx, returnID)
+	if err != nil {
+		log.Errorf("[ReturnHandler-3] GetByIDAdmin: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", toReturnResponse(*result)))
+}
+
+// Approve implements ReturnHandlerInterface.
+func (h *returnHandler) Approve(c echo.Context) error {
+	return h.review(c, func(returnID, adminID int64, note string) error {
+		return h.returnService.Approve(c.Request().Context(), returnID, note, adminID)
+	})
+}
+
+// Reject implements ReturnHandlerInterface.
+func (h *returnHandler) Reject(c echo.Context) error {
+	return h.review(c, func(returnID, adminID int64, note string) error {
+		return h.returnService.Reject(c.Request().Context(), returnID, note, adminID)
+	})
+}
+
+func (h *returnHandler) review(c echo.Context, decide func(returnID, adminID int64, note string) error) error {
+	req := request.ReviewReturnRequest{}
+
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[ReturnHandler-1] Review: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[ReturnHandler-2] Review: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+
+	returnID, err := conv.StringToInt64(c.Param("returnID"))
+	if err != nil {
+		log.Errorf("[ReturnHandler-3] Review: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid returnID"))
+	}
+
+	if err := decide(returnID, jwtUserData.UserID, req.Note); err != nil {
+		log.Errorf("[ReturnHandler-4] Review: %v", err)
+		return reviewError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
+}
+
+// Receive implements ReturnHandlerInterface.
+func (h *returnHandler) Receive(c echo.Context) error {
+	var (
+		ctx = c.Request().Context()
+		req = request.ReceiveReturnRequest{}
+	)
+
+	jwtUserData, err := adminUser(c)
+	if err != nil {
+		log.Errorf("[ReturnHandler-1] Receive: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	if err := c.Bind(&req); err != nil {
+		log.Errorf("[ReturnHandler-2] Receive: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError(err.Error()))
+	}
+	if err := c.Validate(&req); err != nil {
+		log.Errorf("[ReturnHandler-3] Receive: %v", err)
+		return c.JSON(http.StatusUnprocessableEntity, response.ResponseError(err.Error()))
+	}
+
+	returnID, err := conv.StringToInt64(c.Param("returnID"))
+	if err != nil {
+		log.Errorf("[ReturnHandler-4] Receive: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid returnID"))
+	}
+
+	if err := h.returnService.Receive(ctx, returnID, *req.Restock, req.Note, jwtUserData.UserID); err != nil {
+		log.Errorf("[ReturnHandler-5] Receive: %v", err)
+		return reviewError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
+}
+
+func reviewError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNotReturnable):
+		return c.JSON(http.StatusConflict, response.ResponseError(err.Error()))
+	case err.Error() == "404":
+		return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+	case err.Error() == "400":
+		return c.JSON(http.StatusConflict, response.ResponseError("return is not in a state that allows this"))
+	}
+	return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+}
+
+func toReturnResponse(result entity.ReturnEntity) response.ReturnResponse {
+	resp := response.ReturnResponse{
+		ID:                result.ID,
+		OrderID:           result.OrderID,
+		OrderCode:         result.OrderCode,
+		OrderItemID:       result.OrderItemID,
+		BuyerID:           result.BuyerID,
+		ProductID:         result.ProductID,
+		VariantID:         result.VariantID,
+		Type:              result.Type,
+		Quantity:          result.Quantity,
+		UnitPrice:         result.UnitPrice,
+		Reason:            result.Reason,
+		PhotoURLs:         result.PhotoURLs,
+		Status:            result.Status,
+		ExchangeSKU:       result.ExchangeSKU,
+		ExchangeSize:      result.ExchangeSize,
+		ExchangeColor:     result.ExchangeColor,
+		ExchangeVariantID: result.ExchangeVariantID,
+		ExchangeOrderID:   result.ExchangeOrderID,
+		Restock:           result.Restock,
+		RefundAmount:      result.RefundAmount,
+		AdminNote:         result.AdminNote,
+		CreatedAt:         result.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if result.ReceivedAt != nil {
+		resp.ReceivedAt = result.ReceivedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+// customerUser returns the caller's token data.
+func customerUser(c echo.Context) (orderEntity.JwtUserData, error) {
+	jwtUserData := orderEntity.JwtUserData{}
+
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		return jwtUserData, errors.New("data token not found")
+	}
+
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		return jwtUserData, err
+	}
+
+	return jwtUserData, nil
+}
+
+// adminUser returns the caller's token data, rejecting customers; the admin
+// group only checks that the caller is logged in.
+func adminUser(c echo.Context) (orderEntity.JwtUserData, error) {
+	jwtUserData, err := customerUser(c)
+	if err != nil {
+		return jwtUserData, err
+	}
+
+	if jwtUserData.RoleName == "" || jwtUserData.RoleName == "Customer" {
+		return jwtUserData, errors.New("customer cannot access admin routes")
+	}
+
+	return jwtUserData, nil
+}
+
+func NewReturnHandler(returnService service.ReturnServiceInterface) ReturnHandlerInterface {
+	return &returnHandler{returnService: returnService}
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/returns/service"
+	"tofash/internal/shared/async"
+)
+
+const TopicReturnResolve = "return_resolve"
+
+// ReturnResolvePayload is enqueued when the goods of a return are received.
+type ReturnResolvePayload struct {
+	ReturnID int64 `json:"return_id"`
+}
+
+// RegisterHandlers plugs the returns module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, returnSvc service.ReturnServiceInterface) {
+	r.Register(TopicReturnResolve, async.Typed(func(ctx context.Context, _ uint, data ReturnResolvePayload) error {
+		err := returnSvc.Resolve(ctx, data.ReturnID)
+		// A missing return, or an order with nothing left to refund, won't
+		// get better on retry.
+		if err != nil && (err.Error() == "404" || err.Error() == "400") {
+			return async.Permanent(err)
+		}
+		return err
+	}))
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// ReturnRequest is a customer's request to send back an order item, from
+// the request through to its refund or exchange.
+type ReturnRequest struct {
+	ID                int64      `gorm:"primaryKey"`
+	OrderID           int64      `gorm:"column:order_id;not null;index"`
+	OrderCode         string     `gorm:"column:order_code;not null;size:50"`
+	OrderItemID       int64      `gorm:"column:order_item_id;not null;index"`
+	BuyerID           int64      `gorm:"column:buyer_id;not null;index"`
+	ProductID         int64      `gorm:"column:product_id;not null"`
+	VariantID         int64      `gorm:"column:variant_id;not null;default:0"`
+	Type              string     `gorm:"column:type;not null;size:20"`
+	Quantity          int64      `gorm:"column:quantity;not null"`
+	UnitPrice         int64      `gorm:"column:unit_price;not null;default:0"`
+	Reason            string     `gorm:"column:reason;not null"`
+	PhotosJSON        string     `gorm:"column:photos_json;type:text"`
+	Status            string     `gorm:"column:status;not null;size:20;index"`
+	ExchangeSKU       string     `gorm:"column:exchange_sku"`
+	ExchangeSize      string     `gorm:"column:exchange_size"`
+	ExchangeColor     string     `gorm:"column:exchange_color"`
+	ExchangeVariantID int64      `gorm:"column:exchange_variant_id;not null;default:0"`
+	ExchangeOrderID   *int64     `gorm:"column:exchange_order_id"`
+	Restock           bool       `gorm:"column:restock;not null;default:false"`
+	RefundAmount      int64      `gorm:"column:refund_amount;not null;default:0"`
+	AdminNote         string     `gorm:"column:admin_note"`
+	ReviewedBy        *int64     `gorm:"column:reviewed_by"`
+	ReceivedAt        *time.Time `gorm:"column:received_at"`
+	CreatedAt         time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt         *time.Time `gorm:"column:updated_at"`
+}
+
+func (ReturnRequest) TableName() string {
+	return "return_requests"
+}
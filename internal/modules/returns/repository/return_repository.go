@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+	"tofash/internal/modules/returns/entity"
+	"tofash/internal/modules/returns/model"
+	"tofash/internal/shared/uow"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReturnRepositoryInterface interface {
+	Create(ctx context.Context, req entity.ReturnEntity) (int64, error)
+	GetByID(ctx context.Context, returnID int64) (*entity.ReturnEntity, error)
+	GetAll(ctx context.Context, query entity.QueryStringEntity) ([]entity.ReturnEntity, int64, int64, error)
+	ReturnedQuantity(ctx context.Context, orderItemID, excludeReturnID int64) (int64, error)
+	UpdateStatus(ctx context.Context, req entity.ReturnEntity) (*entity.ReturnEntity, error)
+}
+
+type returnRepository struct {
+	db *gorm.DB
+}
+
+// Create implements ReturnRepositoryInterface.
+func (r *returnRepository) Create(ctx context.Context, req entity.ReturnEntity) (int64, error) {
+	photosJSON, err := json.Marshal(req.PhotoURLs)
+	if err != nil {
+		log.Errorf("[ReturnRepository-1] Create: %v", err)
+		return 0, err
+	}
+
+	modelReturn := model.ReturnRequest{
+		OrderID:           req.OrderID,
+		OrderCode:         req.OrderCode,
+		OrderItemID:       req.OrderItemID,
+		BuyerID:           req.BuyerID,
+		ProductID:         req.ProductID,
+		VariantID:         req.VariantID,
+		Type:              req.Type,
+		Quantity:          req.Quantity,
+		UnitPrice:         req.UnitPrice,
+		Reason:            req.Reason,
+		PhotosJSON:        string(photosJSON),
+		Status:            req.Status,
+		ExchangeSKU:       req.ExchangeSKU,
+		ExchangeSize:      req.ExchangeSize,
+		ExchangeColor:     req.ExchangeColor,
+		ExchangeVariantID: req.ExchangeVariantID,
+		RefundAmount:      req.RefundAmount,
+	}
+
+	if err := uow.DB(ctx, r.db).Create(&modelReturn).Error; err != nil {
+		log.Errorf("[ReturnRepository-2] Create: %v", err)
+		return 0, err
+	}
+
+	return modelReturn.ID, nil
+}
+
+// GetByID implements ReturnRepositoryInterface.
+func (r *returnRepository) GetByID(ctx context.Context, returnID int64) (*entity.ReturnEntity, error) {
+	modelReturn := model.ReturnRequest{}
+	if err := uow.DB(ctx, r.db).Where("id = ?", returnID).First(&modelReturn).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Infof("[ReturnRepository-1] GetByID: Return not found")
+			return nil, errors.New("404")
+		}
+		log.Errorf("[ReturnRepository-2] GetByID: %v", err)
+		return nil, err
+	}
+
+	return toEntity(modelReturn), nil
+}
+
+// GetAll implements ReturnRepositoryInterface. Newest requests come first.
+func (r *returnRepository) GetAll(ctx context.Context, query entity.QueryStringEntity) ([]entity.ReturnEntity, int64, int64, error) {
+	var (
+		modelReturns []model.ReturnRequest
+		countData    int64
+	)
+	offset := (query.Page - 1) * query.Limit
+
+	sqlMain := uow.DB(ctx, r.db).Model(&model.ReturnRequest{})
+	if query.Status != "" {
+		sqlMain = sqlMain.Where("status = ?", query.Status)
+	}
+	if query.BuyerID != 0 {
+		sqlMain = sqlMain.Where("buyer_id = ?", query.BuyerID)
+	}
+
+	if err := sqlMain.Count(&countData).Error; err != nil {
+		log.Errorf("[ReturnRepository-1] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	totalPage := int(math.Ceil(float64(countData) / float64(query.Limit)))
+	if err := sqlMain.Order("created_at DESC, id DESC").Limit(int(query.Limit)).Offset(int(offset)).Find(&modelReturns).Error; err != nil {
+		log.Errorf("[ReturnRepository-2] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	if len(modelReturns) == 0 {
+		log.Infof("[ReturnRepository-3] GetAll: No return found")
+		return nil, 0, 0, errors.New("404")
+	}
+
+	results := make([]entity.ReturnEntity, 0, len(modelReturns))
+	for _, modelReturn := range modelReturns {
+		results = append(results, *toEntity(modelReturn))
+	}
+
+	return results, countData, int64(totalPage), nil
+}
+
+// ReturnedQuantity implements ReturnRepositoryInterface. It sums the
+// quantity of an order item already claimed by returns that were not
+// rejected, leaving out excludeReturnID. Every return of the item is
+// locked, in id order, so inside a unit of work concurrent checks of the
+// same item take turns instead of both passing.
+func (r *returnRepository) ReturnedQuantity(ctx context.Context, orderItemID, excludeReturnID int64) (int64, error) {
+	var modelReturns []model.ReturnRequest
+	err := uow.DB(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "quantity", "status").
+		Where("order_item_id = ?", orderItemID).
+		Order("id ASC").
+		Find(&modelReturns).Error
+	if err != nil {
+		log.Errorf("[ReturnRepository-1] ReturnedQuantity: %v", err)
+		return 0, err
+	}
+
+	var quantity int64
+	for _, modelReturn := range modelReturns {
+		if modelReturn.ID != excludeReturnID && modelReturn.Status != entity.ReturnStatusRejected {
+			quantity += modelReturn.Quantity
+		}
+	}
+
+	return quantity, nil
+}
+
+// UpdateStatus implements ReturnRepositoryInterface. It moves the return to
+// req.Status if the lifecycle allows it, otherwise fails with "400". The
+// admin note, reviewer, restock decision, receipt time and exchange order
+// are written when req carries them. It returns the updated return.
+func (r *returnRepository) UpdateStatus(ctx context.Context, req entity.ReturnEntity) (*entity.ReturnEntity, error) {
+	modelReturn := model.ReturnRequest{}
+
+	err := uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		// Lock the row so two concurrent transitions can't both pass the check.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", req.ID).
+			First(&modelReturn).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Infof("[ReturnRepository-1] UpdateStatus: Return not found")
+				return errors.New("404")
+			}
+			log.Errorf("[ReturnRepository-2] UpdateStatus: %v", err)
+			return err
+		}
+
+		if !entity.CanTransitionReturnStatus(modelReturn.Status, req.Status) {
+			log.Infof("[ReturnRepository-3] UpdateStatus: Invalid status transition %s -> %s", modelReturn.Status, req.Status)
+			return errors.New("400")
+		}
+
+		now := time.Now()
+		modelReturn.Status = req.Status
+		modelReturn.UpdatedAt = &now
+		if req.AdminNote != "" {
+			modelReturn.AdminNote = req.AdminNote
+		}
+		if req.ReviewedBy != 0 {
+			modelReturn.ReviewedBy = &req.ReviewedBy
+		}
+		if req.Status == entity.ReturnStatusReceived {
+			modelReturn.Restock = req.Restock
+			modelReturn.ReceivedAt = &now
+		}
+		if req.ExchangeOrderID != 0 {
+			modelReturn.ExchangeOrderID = &req.ExchangeOrderID
+		}
+
+		if err := tx.Model(&modelReturn).
+			Select("status", "updated_at", "admin_note", "reviewed_by", "restock", "received_at", "exchange_order_id").
+			Updates(&modelReturn).Error; err != nil {
+			log.Errorf("[ReturnRepository-4] UpdateStatus: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(modelReturn), nil
+}
+
+func toEntity(modelReturn model.ReturnRequest) *entity.ReturnEntity {
+	photoURLs := []string{}
+	if modelReturn.PhotosJSON != "" {
+		if err := json.Unmarshal([]byte(modelReturn.PhotosJSON), &photoURLs); err != nil {
+			log.Errorf("Failed to unmarshal return photos: %v", err)
+		}
+	}
+
+	result := &entity.ReturnEntity{
+		ID:                modelReturn.ID,
+		OrderID:           modelReturn.OrderID,
+		OrderCode:         modelReturn.OrderCode,
+		OrderItemID:       modelReturn.OrderItemID,
+		BuyerID:           modelReturn.BuyerID,
+		ProductID:         modelReturn.ProductID,
+		VariantID:         modelReturn.VariantID,
+		Type:              modelReturn.Type,
+		Quantity:          modelReturn.Quantity,
+		UnitPrice:         modelReturn.UnitPrice,
+		Reason:            modelReturn.Reason,
+		PhotoURLs:         photoURLs,
+		Status:            modelReturn.Status,
+		ExchangeSKU:       modelReturn.ExchangeSKU,
+		ExchangeSize:      modelReturn.ExchangeSize,
+		ExchangeColor:     modelReturn.ExchangeColor,
+		ExchangeVariantID: modelReturn.ExchangeVariantID,
+		Restock:           modelReturn.Restock,
+		RefundAmount:      modelReturn.RefundAmount,
+		AdminNote:         modelReturn.AdminNote,
+		ReceivedAt:        modelReturn.ReceivedAt,
+		CreatedAt:         modelReturn.CreatedAt,
+	}
+	if modelReturn.ExchangeOrderID != nil {
+		result.ExchangeOrderID = *modelReturn.ExchangeOrderID
+	}
+	if modelReturn.ReviewedBy != nil {
+		result.ReviewedBy = *modelReturn.ReviewedBy
+	}
+	if modelReturn.UpdatedAt != nil {
+		result.UpdatedAt = *modelReturn.UpdatedAt
+	}
+	return result
+}
+
+func NewReturnRepository(db *gorm.DB) ReturnRepositoryInterface {
+	return &returnRepository{db: db}
+}
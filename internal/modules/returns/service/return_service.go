@@ -0,0 +1,414 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	paymentService "tofash/internal/modules/payment/service"
+	"tofash/internal/modules/product/storage"
+	"tofash/internal/modules/returns/entity"
+	"tofash/internal/modules/returns/repository"
+	userService "tofash/internal/modules/user/service"
+	"tofash/internal/shared/async"
+	"tofash/internal/shared/uow"
+
+	"github.com/google/uuid"
+	"github.com/labstack/gommon/log"
+)
+
+var (
+	// ErrNotReturnable is returned when the order has not been delivered,
+	// or more of the item is claimed than is left to return.
+	ErrNotReturnable = errors.New("order item cannot be returned")
+	// ErrInvalidExchange is returned when an exchange does not name
+	// another size or colour of the returned product.
+	ErrInvalidExchange = errors.New("exchange must name another size or colour of the same product")
+)
+
+type ReturnServiceInterface interface {
+	RequestReturn(ctx context.Context, req entity.ReturnEntity, photos []entity.ReturnPhoto) (int64, error)
+	GetAll(ctx context.Context, query entity.QueryStringEntity) ([]entity.ReturnEntity, int64, int64, error)
+	GetByID(ctx context.Context, returnID int64) (*entity.ReturnEntity, error)
+	GetDetailCustomer(ctx context.Context, returnID, buyerID int64) (*entity.ReturnEntity, error)
+	Approve(ctx context.Context, returnID int64, note string, adminID int64) error
+	Reject(ctx context.Context, returnID int64, note string, adminID int64) error
+	Receive(ctx context.Context, returnID int64, restock bool, note string, adminID int64) error
+	Resolve(ctx context.Context, returnID int64) error
+}
+
+type returnService struct {
+	repo       repository.ReturnRepositoryInterface
+	uow        uow.UnitOfWorkInterface
+	queue      async.Enqueuer
+	storage    storage.SupabaseInterface
+	orderSvc   orderService.OrderServiceInterface
+	paymentSvc paymentService.PaymentServiceInterface
+	userSvc    userService.UserServiceInterface
+}
+
+// RequestReturn implements ReturnServiceInterface. Customers may return
+// items of their own delivered orders, up to the quantity not already
+// claimed by another return. Photos are uploaded once the request checks
+// out.
+func (s *returnService) RequestReturn(ctx context.Context, req entity.ReturnEntity, photos []entity.ReturnPhoto) (int64, error) {
+	order, err := s.orderSvc.GetByID(ctx, req.OrderID)
+	if err != nil {
+		log.Errorf("[ReturnService-1] RequestReturn: %v", err)
+		return 0, err
+	}
+	if order.BuyerId != req.BuyerID {
+		log.Infof("[ReturnService-2] RequestReturn: order %d does not belong to user %d", req.OrderID, req.BuyerID)
+		return 0, errors.New("404")
+	}
+	if orderEntity.NormalizeOrderStatus(order.Status) != orderEntity.OrderStatusDelivered {
+		return 0, ErrNotReturnable
+	}
+
+	item, err := s.checkQuantity(ctx, order, req.OrderItemID, 0, req.Quantity)
+	if err != nil {
+		log.Errorf("[ReturnService-3] RequestReturn: %v", err)
+		return 0, err
+	}
+
+	req.OrderCode = order.OrderCode
+	req.ProductID = item.ProductID
+	req.VariantID = item.VariantID
+	req.UnitPrice = item.Price
+	req.Status = entity.ReturnStatusRequested
+
+	switch req.Type {
+	case entity.ReturnTypeRefund:
+		req.RefundAmount = item.Price * req.Quantity
+		req.ExchangeSKU, req.ExchangeSize, req.ExchangeColor = "", "", ""
+	case entity.ReturnTypeExchange:
+		req.ExchangeVariantID, err = s.exchangeVariant(ctx, *item, req)
+		if err != nil {
+			log.Errorf("[ReturnService-4] RequestReturn: %v", err)
+			return 0, err
+		}
+	default:
+		return 0, errors.New("400")
+	}
+
+	for _, photo := range photos {
+		path := fmt.Sprintf("public/returns/%d/%s_%d%s", order.ID, uuid.New().String(), time.Now().Unix(), filepath.Ext(photo.FileName))
+		url, err := s.storage.UploadFile(path, photo.Content)
+		if err != nil {
+			log.Errorf("[ReturnService-5] RequestReturn: %v", err)
+			return 0, err
+		}
+		req.PhotoURLs = append(req.PhotoURLs, url)
+	}
+
+	returnID, err := s.repo.Create(ctx, req)
+	if err != nil {
+		log.Errorf("[ReturnService-6] RequestReturn: %v", err)
+		return 0, err
+	}
+
+	return returnID, nil
+}
+
+// GetAll implements ReturnServiceInterface.
+func (s *returnService) GetAll(ctx context.Context, query entity.QueryStringEntity) ([]entity.ReturnEntity, int64, int64, error) {
+	results, count, total, err := s.repo.GetAll(ctx, query)
+	if err != nil {
+		log.Errorf("[ReturnService-1] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	return results, count, total, nil
+}
+
+// GetByID implements ReturnServiceInterface.
+func (s *returnService) GetByID(ctx context.Context, returnID int64) (*entity.ReturnEntity, error) {
+	result, err := s.repo.GetByID(ctx, returnID)
+	if err != nil {
+		log.Errorf("[ReturnService-1] GetByID: %v", err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetDetailCustomer implements ReturnServiceInterface. Other customers'
+// returns are reported as not found.
+func (s *returnService) GetDetailCustomer(ctx context.Context, returnID, buyerID int64) (*entity.ReturnEntity, error) {
+	result, err := s.GetByID(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if result.BuyerID != buyerID {
+		return nil, errors.New("404")
+	}
+
+	return result, nil
+}
+
+// Approve implements ReturnServiceInterface. The claimed quantity is
+// checked again, as another return of the same item may have been
+// requested since. The check holds the item's returns locked until the
+// approval commits, so two approvals cannot both pass it.
+func (s *returnService) Approve(ctx context.Context, returnID int64, note string, adminID int64) error {
+	ret, err := s.repo.GetByID(ctx, returnID)
+	if err != nil {
+		log.Errorf("[ReturnService-1] Approve: %v", err)
+		return err
+	}
+
+	order, err := s.orderSvc.GetByID(ctx, ret.OrderID)
+	if err != nil {
+		log.Errorf("[ReturnService-2] Approve: %v", err)
+		return err
+	}
+
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if _, err := s.checkQuantity(ctx, order, ret.OrderItemID, ret.ID, ret.Quantity); err != nil {
+			log.Errorf("[ReturnService-3] Approve: %v", err)
+			return err
+		}
+
+		updated, err := s.repo.UpdateStatus(ctx, entity.ReturnEntity{
+			ID:         returnID,
+			Status:     entity.ReturnStatusApproved,
+			AdminNote:  note,
+			ReviewedBy: adminID,
+		})
+		if err != nil {
+			log.Errorf("[ReturnService-4] Approve: %v", err)
+			return err
+		}
+
+		message := fmt.Sprintf("Your return request #%d for order %s has been approved. Please send the item back to us.", updated.ID, updated.OrderCode)
+		return s.notifyBuyer(ctx, updated, message)
+	})
+}
+
+// Reject implements ReturnServiceInterface.
+func (s *returnService) Reject(ctx context.Context, returnID int64, note string, adminID int64) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		ret, err := s.repo.UpdateStatus(ctx, entity.ReturnEntity{
+			ID:         returnID,
+			Status:     entity.ReturnStatusRejected,
+			AdminNote:  note,
+			ReviewedBy: adminID,
+		})
+		if err != nil {
+			log.Errorf("[ReturnService-1] Reject: %v", err)
+			return err
+		}
+
+		message := fmt.Sprintf("Your return request #%d for order %s has been rejected.", ret.ID, ret.OrderCode)
+		return s.notifyBuyer(ctx, ret, message)
+	})
+}
+
+// Receive implements ReturnServiceInterface. It records that the goods
+// came back, puts them on the shelf again when restock is set, and queues
+// the refund or exchange.
+func (s *returnService) Receive(ctx context.Context, returnID int64, restock bool, note string, adminID int64) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		ret, err := s.repo.UpdateStatus(ctx, entity.ReturnEntity{
+			ID:         returnID,
+			Status:     entity.ReturnStatusReceived,
+			Restock:    restock,
+			AdminNote:  note,
+			ReviewedBy: adminID,
+		})
+		if err != nil {
+			log.Errorf("[ReturnService-1] Receive: %v", err)
+			return err
+		}
+
+		reference := fmt.Sprintf("return:%d", ret.ID)
+		if restock {
+			payload := map[string]interface{}{
+				"product_id": ret.StockProductID(),
+				"quantity":   ret.Quantity,
+				"reference":  reference,
+			}
+			if err := s.queue.Enqueue(ctx, "stock_return", payload, async.WithDedupKey("stock_return:"+reference, 0)); err != nil {
+				log.Errorf("[ReturnService-2] Receive: %v", err)
+				return err
+			}
+		}
+
+		payload := map[string]interface{}{"return_id": ret.ID}
+		if err := s.queue.Enqueue(ctx, "return_resolve", payload, async.WithDedupKey("return_resolve:"+reference, 0)); err != nil {
+			log.Errorf("[ReturnService-3] Receive: %v", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Resolve implements ReturnServiceInterface. A received refund return is
+// paid back for the returned quantity; a received exchange gets a free
+// replacement order. Returns that are not waiting for this are left alone,
+// so the job that calls it can be retried.
+func (s *returnService) Resolve(ctx context.Context, returnID int64) error {
+	ret, err := s.repo.GetByID(ctx, returnID)
+	if err != nil {
+		log.Errorf("[ReturnService-1] Resolve: %v", err)
+		return err
+	}
+	if ret.Status != entity.ReturnStatusReceived {
+		return nil
+	}
+
+	if ret.Type == entity.ReturnTypeRefund {
+		// The refund key makes a retried refund a no-op at the gateway.
+		refundKey := fmt.Sprintf("return-%d", ret.ID)
+		reason := fmt.Sprintf("return #%d: %s", ret.ID, ret.Reason)
+		if err := s.paymentSvc.RefundPartial(ctx, ret.OrderID, ret.OrderCode, ret.RefundAmount, refundKey, reason); err != nil {
+			log.Errorf("[ReturnService-2] Resolve: %v", err)
+			return err
+		}
+
+		return s.uow.Do(ctx, func(ctx context.Context) error {
+			updated, err := s.repo.UpdateStatus(ctx, entity.ReturnEntity{ID: ret.ID, Status: entity.ReturnStatusRefunded})
+			if err != nil {
+				log.Errorf("[ReturnService-3] Resolve: %v", err)
+				return err
+			}
+
+			message := fmt.Sprintf("We have received the item of your return #%d for order %s and refunded Rp %d.", updated.ID, updated.OrderCode, updated.RefundAmount)
+			return s.notifyBuyer(ctx, updated, message)
+		})
+	}
+
+	order, err := s.orderSvc.GetByID(ctx, ret.OrderID)
+	if err != nil {
+		log.Errorf("[ReturnService-4] Resolve: %v", err)
+		return err
+	}
+
+	// The replacement order and the return's new status commit together,
+	// so a retry never places a second replacement.
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		exchangeOrderID, err := s.orderSvc.CreateExchangeOrder(ctx, orderEntity.OrderEntity{
+			BuyerId:      ret.BuyerID,
+			ShippingType: order.ShippingType,
+			Remarks:      fmt.Sprintf("Exchange for return #%d of order %s", ret.ID, ret.OrderCode),
+			OrderItems: []orderEntity.OrderItemEntity{{
+				ProductID: ret.ProductID,
+				VariantID: ret.ExchangeVariantID,
+				Quantity:  ret.Quantity,
+				SKU:       ret.ExchangeSKU,
+				Size:      ret.ExchangeSize,
+				Color:     ret.ExchangeColor,
+			}},
+		})
+		if err != nil {
+			log.Errorf("[ReturnService-5] Resolve: %v", err)
+			return err
+		}
+
+		updated, err := s.repo.UpdateStatus(ctx, entity.ReturnEntity{
+			ID:              ret.ID,
+			Status:          entity.ReturnStatusExchanged,
+			ExchangeOrderID: exchangeOrderID,
+		})
+		if err != nil {
+			log.Errorf("[ReturnService-6] Resolve: %v", err)
+			return err
+		}
+
+		message := fmt.Sprintf("We have received the item of your return #%d for order %s. Your replacement has been placed as order #%d.", updated.ID, updated.OrderCode, exchangeOrderID)
+		return s.notifyBuyer(ctx, updated, message)
+	})
+}
+
+// checkQuantity returns the order item being returned, making sure
+// quantity is no more than what returns other than excludeReturnID have
+// left of it.
+func (s *returnService) checkQuantity(ctx context.Context, order *orderEntity.OrderEntity, orderItemID, excludeReturnID, quantity int64) (*orderEntity.OrderItemEntity, error) {
+	var item *orderEntity.OrderItemEntity
+	for i := range order.OrderItems {
+		if order.OrderItems[i].ID == orderItemID {
+			item = &order.OrderItems[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, errors.New("404")
+	}
+
+	returned, err := s.repo.ReturnedQuantity(ctx, orderItemID, excludeReturnID)
+	if err != nil {
+		return nil, err
+	}
+	if quantity <= 0 || returned+quantity > item.Quantity {
+		return nil, ErrNotReturnable
+	}
+
+	return item, nil
+}
+
+// exchangeVariant resolves the replacement an exchange asks for to the
+// product row it will be taken from. It must be another variant of the
+// returned product, currently in stock.
+func (s *returnService) exchangeVariant(ctx context.Context, item orderEntity.OrderItemEntity, req entity.ReturnEntity) (int64, error) {
+	pricing, err := s.orderSvc.QuoteOrder(ctx, orderEntity.OrderEntity{
+		OrderItems: []orderEntity.OrderItemEntity{{
+			ProductID: item.ProductID,
+			Quantity:  req.Quantity,
+			SKU:       req.ExchangeSKU,
+			Size:      req.ExchangeSize,
+			Color:     req.ExchangeColor,
+		}},
+	})
+	if err != nil {
+		if err.Error() == "400" {
+			return 0, ErrInvalidExchange
+		}
+		return 0, err
+	}
+
+	variantID := pricing.Lines[0].VariantID
+	if variantID == item.StockProductID() {
+		return 0, ErrInvalidExchange
+	}
+
+	return variantID, nil
+}
+
+// notifyBuyer emails the buyer about their return, once per status.
+func (s *returnService) notifyBuyer(ctx context.Context, ret *entity.ReturnEntity, message string) error {
+	userResponse, err := s.userSvc.GetCustomerByID(ctx, ret.BuyerID)
+	if err != nil {
+		return err
+	}
+
+	if ret.AdminNote != "" && ret.Status != entity.ReturnStatusRefunded && ret.Status != entity.ReturnStatusExchanged {
+		message += "\n\nNote from our team: " + ret.AdminNote
+	}
+	payload := map[string]interface{}{
+		"receiver_email": userResponse.Email,
+		"subject":        "Update Status Return",
+		"message":        fmt.Sprintf("Hello,\n\n%s\n\nThank you for shopping with us!", message),
+		"type":           "UPDATE_STATUS",
+		"receiver_id":    ret.BuyerID,
+	}
+
+	dedupKey := fmt.Sprintf("return_status_email:%d:%s", ret.ID, ret.Status)
+	return s.queue.Enqueue(ctx, "email_notification", payload, async.WithDedupKey(dedupKey, 0))
+}
+
+func NewReturnService(repo repository.ReturnRepositoryInterface, unitOfWork uow.UnitOfWorkInterface, queue async.Enqueuer, storage storage.SupabaseInterface, orderSvc orderService.OrderServiceInterface, paymentSvc paymentService.PaymentServiceInterface, userSvc userService.UserServiceInterface) ReturnServiceInterface {
+	return &returnService{
+		repo:       repo,
+		uow:        unitOfWork,
+		queue:      queue,
+		storage:    storage,
+		orderSvc:   orderSvc,
+		paymentSvc: paymentSvc,
+		userSvc:    userSvc,
+	}
+}
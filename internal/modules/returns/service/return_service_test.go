@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	orderEntity "tofash/internal/modules/order/entity"
+	orderService "tofash/internal/modules/order/service"
+	paymentService "tofash/internal/modules/payment/service"
+	"tofash/internal/modules/returns/entity"
+	"tofash/internal/modules/returns/repository"
+	userEntity "tofash/internal/modules/user/entity"
+	userService "tofash/internal/modules/user/service"
+	"tofash/internal/shared/async"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockReturnRepo struct {
+	repository.ReturnRepositoryInterface
+	returns  map[int64]*entity.ReturnEntity
+	returned int64
+	// checkedInTx records whether the last quantity check ran inside a
+	// unit of work, where the repository's row locks hold.
+	checkedInTx bool
+}
+
+func (m *mockReturnRepo) Create(ctx context.Context, req entity.ReturnEntity) (int64, error) {
+	req.ID = int64(len(m.returns) + 1)
+	m.returns[req.ID] = &req
+	return req.ID, nil
+}
+
+func (m *mockReturnRepo) GetByID(ctx context.Context, returnID int64) (*entity.ReturnEntity, error) {
+	ret, ok := m.returns[returnID]
+	if !ok {
+		return nil, errors.New("404")
+	}
+	copied := *ret
+	return &copied, nil
+}
+
+func (m *mockReturnRepo) ReturnedQuantity(ctx context.Context, orderItemID, excludeReturnID int64) (int64, error) {
+	m.checkedInTx = ctx.Value(mockTxKey{}) != nil
+	return m.returned, nil
+}
+
+func (m *mockReturnRepo) UpdateStatus(ctx context.Context, req entity.ReturnEntity) (*entity.ReturnEntity, error) {
+	ret := m.returns[req.ID]
+	if !entity.CanTransitionReturnStatus(ret.Status, req.Status) {
+		return nil, errors.New("400")
+	}
+	ret.Status = req.Status
+	if req.Status == entity.ReturnStatusReceived {
+		ret.Restock = req.Restock
+	}
+	if req.ExchangeOrderID != 0 {
+		ret.ExchangeOrderID = req.ExchangeOrderID
+	}
+	copied := *ret
+	return &copied, nil
+}
+
+type mockOrderService struct {
+	orderService.OrderServiceInterface
+	order    orderEntity.OrderEntity
+	quote    orderEntity.OrderPricing
+	exchange *orderEntity.OrderEntity
+}
+
+func (m *mockOrderService) GetByID(ctx context.Context, orderID int64) (*orderEntity.OrderEntity, error) {
+	order := m.order
+	return &order, nil
+}
+
+func (m *mockOrderService) QuoteOrder(ctx context.Context, req orderEntity.OrderEntity) (orderEntity.OrderPricing, error) {
+	return m.quote, nil
+}
+
+func (m *mockOrderService) CreateExchangeOrder(ctx context.Context, req orderEntity.OrderEntity) (int64, error) {
+	m.exchange = &req
+	return 99, nil
+}
+
+type mockPaymentService struct {
+	paymentService.PaymentServiceInterface
+	refunded  int64
+	refundKey string
+}
+
+func (m *mockPaymentService) RefundPartial(ctx context.Context, orderID int64, orderCode string, amount int64, refundKey, reason string) error {
+	m.refunded += amount
+	m.refundKey = refundKey
+	return nil
+}
+
+type mockUserService struct {
+	userService.UserServiceInterface
+}
+
+func (m *mockUserService) GetCustomerByID(ctx context.Context, customerID int64) (*userEntity.UserEntity, error) {
+	return &userEntity.UserEntity{ID: customerID, Email: "buyer@example.com"}, nil
+}
+
+type mockStorage struct {
+	paths []string
+}
+
+func (m *mockStorage) UploadFile(path string, file io.Reader) (string, error) {
+	m.paths = append(m.paths, path)
+	return "https://storage.example.com/" + path, nil
+}
+
+type mockQueue struct {
+	topics []string
+}
+
+func (m *mockQueue) Enqueue(ctx context.Context, topic string, payload interface{}, _ ...async.EnqueueOption) error {
+	m.topics = append(m.topics, topic)
+	return nil
+}
+
+type mockUnitOfWork struct{}
+
+type mockTxKey struct{}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(context.WithValue(ctx, mockTxKey{}, true))
+}
+
+type returnFixture struct {
+	repo     *mockReturnRepo
+	orders   *mockOrderService
+	payments *mockPaymentService
+	storage  *mockStorage
+	queue    *mockQueue
+	svc      ReturnServiceInterface
+}
+
+func newReturnFixture() *returnFixture {
+	f := &returnFixture{
+		repo: &mockReturnRepo{returns: map[int64]*entity.ReturnEntity{}},
+		orders: &mockOrderService{order: orderEntity.OrderEntity{
+			ID: 7, OrderCode: "ORD-7", BuyerId: 10, Status: orderEntity.OrderStatusDelivered, ShippingType: "Delivery",
+			OrderItems: []orderEntity.OrderItemEntity{{ID: 70, ProductID: 1, VariantID: 3, Quantity: 2, Price: 100000, Size: "L"}},
+		}},
+		payments: &mockPaymentService{},
+		storage:  &mockStorage{},
+		queue:    &mockQueue{},
+	}
+	f.svc = NewReturnService(f.repo, &mockUnitOfWork{}, f.queue, f.storage, f.orders, f.payments, &mockUserService{})
+	return f
+}
+
+func TestReturnService_RequestReturn_Refund(t *testing.T) {
+	f := newReturnFixture()
+
+	returnID, err := f.svc.RequestReturn(context.Background(), entity.ReturnEntity{
+		OrderID: 7, OrderItemID: 70, BuyerID: 10, Type: entity.ReturnTypeRefund, Quantity: 1, Reason: "torn seam",
+	}, []entity.ReturnPhoto{{FileName: "seam.jpg"}})
+	assert.NoError(t, err)
+
+	ret := f.repo.returns[returnID]
+	assert.Equal(t, entity.ReturnStatusRequested, ret.Status)
+	assert.Equal(t, int64(100000), ret.RefundAmount)
+	assert.Equal(t, int64(3), ret.StockProductID())
+	assert.Len(t, ret.PhotoURLs, 1)
+	assert.Contains(t, f.storage.paths[0], "public/returns/7/")
+}
+
+func TestReturnService_RequestReturn_RejectsIneligible(t *testing.T) {
+	ctx := context.Background()
+	req := entity.ReturnEntity{OrderID: 7, OrderItemID: 70, BuyerID: 10, Type: entity.ReturnTypeRefund, Quantity: 1}
+
+	f := newReturnFixture()
+	f.repo.returned = 2
+	_, err := f.svc.RequestReturn(ctx, req, nil)
+	assert.ErrorIs(t, err, ErrNotReturnable)
+
+	f = newReturnFixture()
+	f.orders.order.Status = orderEntity.OrderStatusShipped
+	_, err = f.svc.RequestReturn(ctx, req, nil)
+	assert.ErrorIs(t, err, ErrNotReturnable)
+
+	f = newReturnFixture()
+	req.BuyerID = 11
+	_, err = f.svc.RequestReturn(ctx, req, nil)
+	assert.EqualError(t, err, "404")
+	assert.Empty(t, f.repo.returns)
+}
+
+func TestReturnService_RequestReturn_ExchangeNeedsAnotherVariant(t *testing.T) {
+	f := newReturnFixture()
+	f.orders.quote = orderEntity.OrderPricing{Lines: []orderEntity.OrderPricingLine{{ProductID: 1, VariantID: 3}}}
+	req := entity.ReturnEntity{OrderID: 7, OrderItemID: 70, BuyerID: 10, Type: entity.ReturnTypeExchange, Quantity: 1, ExchangeSize: "L"}
+
+	_, err := f.svc.RequestReturn(context.Background(), req, nil)
+	assert.ErrorIs(t, err, ErrInvalidExchange)
+
+	f.orders.quote.Lines[0].VariantID = 2
+	req.ExchangeSize = "M"
+	returnID, err := f.svc.RequestReturn(context.Background(), req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), f.repo.returns[returnID].ExchangeVariantID)
+}
+
+func TestReturnService_Approve_ChecksQuantityInTheApproval(t *testing.T) {
+	ctx := context.Background()
+	f := newReturnFixture()
+	f.repo.returns[1] = &entity.ReturnEntity{
+		ID: 1, OrderID: 7, OrderCode: "ORD-7", OrderItemID: 70, BuyerID: 10, Quantity: 1,
+		Type: entity.ReturnTypeRefund, Status: entity.ReturnStatusRequested,
+	}
+
+	// Another return has claimed the rest of the item in the meantime.
+	f.repo.returned = 2
+	assert.ErrorIs(t, f.svc.Approve(ctx, 1, "", 1), ErrNotReturnable)
+	assert.Equal(t, entity.ReturnStatusRequested, f.repo.returns[1].Status)
+
+	f.repo.returned = 1
+	assert.NoError(t, f.svc.Approve(ctx, 1, "", 1))
+	assert.True(t, f.repo.checkedInTx)
+	assert.Equal(t, entity.ReturnStatusApproved, f.repo.returns[1].Status)
+}
+
+func TestReturnService_ReceiveAndResolveExchange(t *testing.T) {
+	ctx := context.Background()
+	f := newReturnFixture()
+	f.repo.returns[1] = &entity.ReturnEntity{
+		ID: 1, OrderID: 7, OrderCode: "ORD-7", BuyerID: 10, ProductID: 1, VariantID: 3, Quantity: 1,
+		Type: entity.ReturnTypeExchange, Status: entity.ReturnStatusApproved, ExchangeSize: "M", ExchangeVariantID: 2,
+	}
+
+	assert.NoError(t, f.svc.Receive(ctx, 1, true, "", 1))
+	assert.Equal(t, []string{"stock_return", "return_resolve"}, f.queue.topics)
+
+	assert.NoError(t, f.svc.Resolve(ctx, 1))
+	assert.Equal(t, entity.ReturnStatusExchanged, f.repo.returns[1].Status)
+	assert.Equal(t, int64(99), f.repo.returns[1].ExchangeOrderID)
+	assert.Equal(t, int64(2), f.orders.exchange.OrderItems[0].VariantID)
+	assert.Equal(t, "Delivery", f.orders.exchange.ShippingType)
+
+	// A retried job finds the return resolved and does nothing.
+	f.orders.exchange = nil
+	assert.NoError(t, f.svc.Resolve(ctx, 1))
+	assert.Nil(t, f.orders.exchange)
+}
+
+func TestReturnService_ResolveRefund(t *testing.T) {
+	ctx := context.Background()
+	f := newReturnFixture()
+	f.repo.returns[1] = &entity.ReturnEntity{
+		ID: 1, OrderID: 7, OrderCode: "ORD-7", BuyerID: 10, Quantity: 1, RefundAmount: 100000,
+		Type: entity.ReturnTypeRefund, Status: entity.ReturnStatusReceived,
+	}
+
+	assert.NoError(t, f.svc.Resolve(ctx, 1))
+	assert.Equal(t, entity.ReturnStatusRefunded, f.repo.returns[1].Status)
+	assert.Equal(t, int64(100000), f.payments.refunded)
+	assert.Equal(t, "return-1", f.payments.refundKey)
+	assert.Equal(t, []string{"email_notification"}, f.queue.topics)
+}
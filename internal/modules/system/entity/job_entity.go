@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+type JobQueryString struct {
+	Topic     string
+	Status    string
+	StartDate *time.Time
+	EndDate   *time.Time
+	Page      int64
+	Limit     int64
+}
+
+type JwtUserData struct {
+	UserID   int64  `json:"user_id"`
+	RoleName string `json:"role_name"`
+	Email    string `json:"email"`
+}
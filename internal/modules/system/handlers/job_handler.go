@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tofash/internal/modules/system/entity"
+	"tofash/internal/modules/system/handlers/response"
+	"tofash/internal/modules/system/service"
+	"tofash/internal/shared/utils/conv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+type JobHandlerInterface interface {
+	GetAll(c echo.Context) error
+	GetByID(c echo.Context) error
+	Retry(c echo.Context) error
+	Cancel(c echo.Context) error
+	PurgeCompleted(c echo.Context) error
+}
+
+type jobHandler struct {
+	jobService service.JobServiceInterface
+}
+
+// GetAll implements JobHandlerInterface.
+func (j *jobHandler) GetAll(c echo.Context) error {
+	var (
+		ctx     = c.Request().Context()
+		respJob = []response.JobList{}
+	)
+
+	if err := requireSuperAdmin(c); err != nil {
+		log.Errorf("[JobHandler-1] GetAll: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	var page int64 = 1
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		page, _ = conv.StringToInt64(pageStr)
+		if page <= 0 {
+			page = 1
+		}
+	}
+
+	var perPage int64 = 10
+	if perPageStr := c.QueryParam("perPage"); perPageStr != "" {
+		perPage, _ = conv.StringToInt64(perPageStr)
+		if perPage <= 0 {
+			perPage = 10
+		}
+	}
+
+	reqEntity := entity.JobQueryString{
+		Topic:  c.QueryParam("topic"),
+		Status: c.QueryParam("status"),
+		Page:   page,
+		Limit:  perPage,
+	}
+
+	if startStr := c.QueryParam("start_date"); startStr != "" {
+		startDate, err := time.Parse("2006-01-02", startStr)
+		if err != nil {
+			log.Errorf("[JobHandler-2] GetAll: %v", err)
+			return c.JSON(http.StatusBadRequest, response.ResponseError("start_date must be YYYY-MM-DD"))
+		}
+		reqEntity.StartDate = &startDate
+	}
+
+	if endStr := c.QueryParam("end_date"); endStr != "" {
+		endDate, err := time.Parse("2006-01-02", endStr)
+		if err != nil {
+			log.Errorf("[JobHandler-3] GetAll: %v", err)
+			return c.JSON(http.StatusBadRequest, response.ResponseError("end_date must be YYYY-MM-DD"))
+		}
+		// end_date is inclusive
+		endDate = endDate.AddDate(0, 0, 1)
+		reqEntity.EndDate = &endDate
+	}
+
+	results, totalData, totalPage, err := j.jobService.GetAll(ctx, reqEntity)
+	if err != nil {
+		log.Errorf("[JobHandler-4] GetAll: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	for _, result := range results {
+		respJob = append(respJob, response.JobList{
+			ID:           result.ID,
+			Topic:        result.Topic,
+			Status:       result.Status,
+			Attempts:     result.Attempts,
+			MaxAttempts:  result.MaxAttempts,
+			RunAt:        result.RunAt.Format(dateTimeLayout),
+			ErrorMessage: result.ErrorMessage,
+			CreatedAt:    result.CreatedAt.Format(dateTimeLayout),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccessWithPagination("success", respJob, page, totalData, totalPage, perPage))
+}
+
+// GetByID implements JobHandlerInterface.
+func (j *jobHandler) GetByID(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := requireSuperAdmin(c); err != nil {
+		log.Errorf("[JobHandler-1] GetByID: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	jobID, err := conv.StringToUint(c.Param("id"))
+	if err != nil || jobID == 0 {
+		log.Errorf("[JobHandler-2] GetByID: invalid job id %q", c.Param("id"))
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid job id"))
+	}
+
+	result, err := j.jobService.GetByID(ctx, jobID)
+	if err != nil {
+		log.Errorf("[JobHandler-3] GetByID: %v", err)
+		if err.Error() == "404" {
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	respJob := response.JobDetail{
+		ID:           result.ID,
+		Topic:        result.Topic,
+		Status:       result.Status,
+		Payload:      json.RawMessage(result.Payload),
+		Attempts:     result.Attempts,
+		MaxAttempts:  result.MaxAttempts,
+		RunAt:        result.RunAt.Format(dateTimeLayout),
+		LockedBy:     result.LockedBy,
+		ErrorMessage: result.ErrorMessage,
+		CreatedAt:    result.CreatedAt.Format(dateTimeLayout),
+		UpdatedAt:    result.UpdatedAt.Format(dateTimeLayout),
+	}
+	if result.DedupKey != nil {
+		respJob.DedupKey = *result.DedupKey
+	}
+	if result.LeaseExpiresAt != nil {
+		respJob.LeaseExpiresAt = result.LeaseExpiresAt.Format(dateTimeLayout)
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", respJob))
+}
+
+// Retry implements JobHandlerInterface.
+func (j *jobHandler) Retry(c echo.Context) error {
+	return j.changeStatus(c, "Retry", "only failed or dead jobs can be retried", j.jobService.Retry)
+}
+
+// Cancel implements JobHandlerInterface.
+func (j *jobHandler) Cancel(c echo.Context) error {
+	return j.changeStatus(c, "Cancel", "only pending jobs can be cancelled", j.jobService.Cancel)
+}
+
+func (j *jobHandler) changeStatus(c echo.Context, action, invalidMsg string, apply func(ctx context.Context, jobID uint) error) error {
+	ctx := c.Request().Context()
+
+	if err := requireSuperAdmin(c); err != nil {
+		log.Errorf("[JobHandler-1] %s: %v", action, err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	jobID, err := conv.StringToUint(c.Param("id"))
+	if err != nil || jobID == 0 {
+		log.Errorf("[JobHandler-2] %s: invalid job id %q", action, c.Param("id"))
+		return c.JSON(http.StatusBadRequest, response.ResponseError("invalid job id"))
+	}
+
+	if err := apply(ctx, jobID); err != nil {
+		log.Errorf("[JobHandler-3] %s: %v", action, err)
+		switch err.Error() {
+		case "404":
+			return c.JSON(http.StatusNotFound, response.ResponseError("data not found"))
+		case "400":
+			return c.JSON(http.StatusConflict, response.ResponseError(invalidMsg))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", nil))
+}
+
+// PurgeCompleted implements JobHandlerInterface.
+func (j *jobHandler) PurgeCompleted(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := requireSuperAdmin(c); err != nil {
+		log.Errorf("[JobHandler-1] PurgeCompleted: %v", err)
+		return c.JSON(http.StatusForbidden, response.ResponseError(err.Error()))
+	}
+
+	olderThanDays, err := strconv.Atoi(c.QueryParam("older_than_days"))
+	if err != nil {
+		log.Errorf("[JobHandler-2] PurgeCompleted: %v", err)
+		return c.JSON(http.StatusBadRequest, response.ResponseError("older_than_days must be a positive number of days"))
+	}
+
+	purged, err := j.jobService.PurgeCompleted(ctx, olderThanDays)
+	if err != nil {
+		log.Errorf("[JobHandler-3] PurgeCompleted: %v", err)
+		if err.Error() == "400" {
+			return c.JSON(http.StatusBadRequest, response.ResponseError("older_than_days must be a positive number of days"))
+		}
+		return c.JSON(http.StatusInternalServerError, response.ResponseError(err.Error()))
+	}
+
+	return c.JSON(http.StatusOK, response.ResponseSuccess("success", map[string]int64{
+		"purged": purged,
+	}))
+}
+
+// requireSuperAdmin rejects anyone but Super Admin; the admin group only
+// checks that the caller is logged in.
+func requireSuperAdmin(c echo.Context) error {
+	user, _ := c.Get("user").(string)
+	if user == "" {
+		return errors.New("data token not found")
+	}
+
+	jwtUserData := entity.JwtUserData{}
+	if err := json.Unmarshal([]byte(user), &jwtUserData); err != nil {
+		return err
+	}
+
+	if jwtUserData.RoleName != "Super Admin" {
+		return errors.New("only Super Admin can manage jobs")
+	}
+
+	return nil
+}
+
+func NewJobHandler(jobService service.JobServiceInterface) JobHandlerInterface {
+	return &jobHandler{jobService: jobService}
+}
@@ -0,0 +1,30 @@
+package response
+
+import "encoding/json"
+
+type JobList struct {
+	ID           uint   `json:"id"`
+	Topic        string `json:"topic"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	MaxAttempts  int    `json:"max_attempts"`
+	RunAt        string `json:"run_at"`
+	ErrorMessage string `json:"error_message"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type JobDetail struct {
+	ID             uint            `json:"id"`
+	Topic          string          `json:"topic"`
+	Status         string          `json:"status"`
+	Payload        json.RawMessage `json:"payload"`
+	DedupKey       string          `json:"dedup_key"`
+	Attempts       int             `json:"attempts"`
+	MaxAttempts    int             `json:"max_attempts"`
+	RunAt          string          `json:"run_at"`
+	LockedBy       string          `json:"locked_by"`
+	LeaseExpiresAt string          `json:"lease_expires_at"`
+	ErrorMessage   string          `json:"error_message"`
+	CreatedAt      string          `json:"created_at"`
+	UpdatedAt      string          `json:"updated_at"`
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/system/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+)
+
+const TopicJobPurge = "job_purge"
+
+type JobPurgePayload struct {
+	OlderThanDays int `json:"older_than_days"`
+}
+
+// completedJobRetentionDays is how long completed jobs stay visible in the
+// admin job list.
+const completedJobRetentionDays = 7
+
+// RegisterHandlers plugs the system module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, jobSvc service.JobServiceInterface) {
+	r.Register(TopicJobPurge, async.Typed(func(ctx context.Context, _ uint, data JobPurgePayload) error {
+		if data.OlderThanDays < 1 {
+			data.OlderThanDays = completedJobRetentionDays
+		}
+
+		purged, err := jobSvc.PurgeCompleted(ctx, data.OlderThanDays)
+		if err != nil {
+			return err
+		}
+		log.Infof("[JobPurgeJob] Deleted %d completed job(s) older than %d days", purged, data.OlderThanDays)
+		return nil
+	}))
+}
+
+// RegisterSchedules declares the system module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("0 3 * * *", TopicJobPurge, JobPurgePayload{OlderThanDays: completedJobRetentionDays})
+}
@@ -6,16 +6,54 @@ import (
 	"gorm.io/datatypes"
 )
 
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+	JobStatusDead       = "dead"
+	JobStatusCancelled  = "cancelled"
+
+	// DefaultJobMaxAttempts is used when a job is enqueued without an explicit limit.
+	DefaultJobMaxAttempts = 5
+)
+
+// DefaultDedupWindow is how long a dedup key blocks duplicates when the
+// producer does not set its own window.
+const DefaultDedupWindow = 24 * time.Hour
+
 type Job struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Topic        string         `gorm:"index;size:255;not null" json:"topic"`
-	Payload      datatypes.JSON `gorm:"type:jsonb" json:"payload"`
-	Status       string         `gorm:"index;size:50;default:'pending'" json:"status"` // pending, processing, completed, failed
-	ErrorMessage string         `gorm:"type:text" json:"error_message"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Topic       string         `gorm:"index;size:255;not null" json:"topic"`
+	Payload     datatypes.JSON `gorm:"type:jsonb" json:"payload"`
+	Status      string         `gorm:"index;index:idx_jobs_status_run_at,priority:1;size:50;default:'pending'" json:"status"` // pending, processing, completed, failed, dead, cancelled
+	Attempts    int            `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int            `gorm:"not null;default:5" json:"max_attempts"`
+	// DedupKey is set by producers that must not enqueue the same work twice.
+	// It is released (set to NULL) once its dedup window has passed.
+	DedupKey *string `gorm:"size:255;uniqueIndex" json:"dedup_key"`
+	// RunAt is the earliest time the job may be picked up; retries push it forward.
+	RunAt time.Time `gorm:"index;index:idx_jobs_status_run_at,priority:2;not null;default:CURRENT_TIMESTAMP" json:"run_at"`
+	// LockedBy and LeaseExpiresAt identify the worker currently processing
+	// the job; an expired lease is returned to pending by the reaper.
+	LockedBy       string     `gorm:"size:255" json:"locked_by"`
+	LeaseExpiresAt *time.Time `gorm:"index" json:"lease_expires_at"`
+	// ErrorMessage holds the last error returned by the handler.
+	ErrorMessage string    `gorm:"type:text" json:"error_message"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 func (Job) TableName() string {
 	return "jobs"
 }
+
+// JobQueueStats is the number of jobs of one topic in one status. For
+// pending jobs OldestRunAt is the run_at of the longest-waiting runnable
+// job, nil when none is due yet.
+type JobQueueStats struct {
+	Topic       string
+	Status      string
+	Count       int64
+	OldestRunAt *time.Time
+}
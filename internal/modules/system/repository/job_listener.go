@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// JobNotifyChannel is the Postgres channel CreateJob notifies on. The
+// notification payload is the job topic.
+const JobNotifyChannel = "jobs_created"
+
+type JobListenerInterface interface {
+	// Listen blocks until ctx is done, calling onNotify with the topic of
+	// every job enqueued for immediate execution. Dropped connections are
+	// re-established automatically.
+	Listen(ctx context.Context, onNotify func(topic string))
+}
+
+type jobListener struct {
+	db             *gorm.DB
+	reconnectDelay time.Duration
+}
+
+func NewJobListener(db *gorm.DB) JobListenerInterface {
+	return &jobListener{db: db, reconnectDelay: 5 * time.Second}
+}
+
+func (l *jobListener) Listen(ctx context.Context, onNotify func(topic string)) {
+	for ctx.Err() == nil {
+		err := l.listenOnce(ctx, onNotify)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Errorf("[JobListener] LISTEN %s interrupted: %v", JobNotifyChannel, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.reconnectDelay):
+		}
+	}
+}
+
+// listenOnce takes a dedicated connection out of the pool and waits for
+// notifications on it. The connection is always discarded afterwards so a
+// session still subscribed to the channel never goes back to the pool.
+func (l *jobListener) listenOnce(ctx context.Context, onNotify func(topic string)) error {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var listenErr error
+	_ = conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			listenErr = errors.New("job listener requires the pgx driver")
+			return driver.ErrBadConn
+		}
+
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+JobNotifyChannel); err != nil {
+			listenErr = err
+			return driver.ErrBadConn
+		}
+		log.Infof("[JobListener] Listening on %s", JobNotifyChannel)
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				listenErr = err
+				return driver.ErrBadConn
+			}
+			onNotify(notification.Payload)
+		}
+	})
+
+	return listenErr
+}
@@ -2,21 +2,70 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
+	"math/rand"
+	"sort"
 	"time"
 
+	"tofash/internal/modules/system/entity"
 	"tofash/internal/modules/system/model"
+	"tofash/internal/shared/metrics"
+	"tofash/internal/shared/uow"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/gommon/log"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type JobRepositoryInterface interface {
-	CreateJob(ctx context.Context, topic string, payload interface{}) error
-	FetchPendingJobs(ctx context.Context, limit int) ([]model.Job, error)
-	UpdateJobStatus(ctx context.Context, jobID uint, status string, errorMsg string) error
+	CreateJob(ctx context.Context, topic string, payload interface{}, opts ...JobOption) (*model.Job, error)
+	CreateJobAt(ctx context.Context, topic string, payload interface{}, runAt time.Time, opts ...JobOption) (*model.Job, error)
+	CreateJobIn(ctx context.Context, topic string, payload interface{}, delay time.Duration, opts ...JobOption) (*model.Job, error)
+	ClaimJobs(ctx context.Context, workerID string, topic string, limit int, lease time.Duration) ([]model.Job, error)
+	ExtendLease(ctx context.Context, jobID uint, workerID string, lease time.Duration) error
+	ReleaseExpiredLeases(ctx context.Context) (int64, error)
+	DeadLetterUnknownTopics(ctx context.Context, knownTopics []string, runnableBefore time.Time) (int64, error)
+	UpdateJobStatus(ctx context.Context, jobID uint, workerID string, status string, errorMsg string) error
+	RetryJob(ctx context.Context, job model.Job, errorMsg string) error
+
+	GetAll(ctx context.Context, query entity.JobQueryString) ([]model.Job, int64, int64, error)
+	GetByID(ctx context.Context, jobID uint) (*model.Job, error)
+	RequeueJob(ctx context.Context, jobID uint) error
+	CancelJob(ctx context.Context, jobID uint) error
+	PurgeCompletedJobs(ctx context.Context, olderThan time.Time) (int64, error)
+
+	QueueStats(ctx context.Context) ([]model.JobQueueStats, error)
+}
+
+// ErrLeaseLost is returned by ExtendLease when the worker no longer owns the job.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// JobOption tunes a single enqueue call.
+type JobOption func(*jobOptions)
+
+type jobOptions struct {
+	dedupKey    string
+	dedupWindow time.Duration
+}
+
+// WithDedupKey makes the enqueue idempotent: while a job with the same key
+// was created within window, CreateJob returns that job instead of
+// inserting a new one. A zero window uses model.DefaultDedupWindow.
+func WithDedupKey(key string, window time.Duration) JobOption {
+	return func(o *jobOptions) {
+		o.dedupKey = key
+		o.dedupWindow = window
+	}
 }
 
+const (
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
 type jobRepository struct {
 	db *gorm.DB
 }
@@ -25,55 +74,440 @@ func NewJobRepository(db *gorm.DB) JobRepositoryInterface {
 	return &jobRepository{db: db}
 }
 
-func (r *jobRepository) CreateJob(ctx context.Context, topic string, payload interface{}) error {
-	jsonPayload, ok := payload.(datatypes.JSON)
-	if !ok {
-		// Try to cast to byte array if valid JSON byte
-		if bytes, isBytes := payload.([]byte); isBytes {
-			jsonPayload = datatypes.JSON(bytes)
-		} else {
-			// Fallback: This simple repo expects datatypes.JSON or compatible.
-			// In production you might want json.Marshal here if payload is struct.
-			// But for now let's assume valid datatypes.JSON is passed or let it fail.
-			return errors.New("invalid payload type, expected datatypes.JSON or []byte")
-		}
+func (r *jobRepository) CreateJob(ctx context.Context, topic string, payload interface{}, opts ...JobOption) (*model.Job, error) {
+	return r.CreateJobAt(ctx, topic, payload, time.Now(), opts...)
+}
+
+// CreateJobIn enqueues a job that becomes runnable after the given delay.
+func (r *jobRepository) CreateJobIn(ctx context.Context, topic string, payload interface{}, delay time.Duration, opts ...JobOption) (*model.Job, error) {
+	return r.CreateJobAt(ctx, topic, payload, time.Now().Add(delay), opts...)
+}
+
+// CreateJobAt enqueues a job that the worker will not pick up before runAt.
+// With WithDedupKey, an existing job holding the key is returned instead.
+func (r *jobRepository) CreateJobAt(ctx context.Context, topic string, payload interface{}, runAt time.Time, opts ...JobOption) (*model.Job, error) {
+	options := jobOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	jsonPayload, err := toJobPayload(payload)
+	if err != nil {
+		return nil, err
 	}
 
 	job := model.Job{
-		Topic:   topic,
-		Payload: jsonPayload,
-		Status:  "pending",
+		Topic:       topic,
+		Payload:     jsonPayload,
+		Status:      model.JobStatusPending,
+		MaxAttempts: model.DefaultJobMaxAttempts,
+		RunAt:       runAt,
+	}
+
+	if options.dedupKey != "" {
+		existing, err := r.claimDedupKey(ctx, options.dedupKey, options.dedupWindow)
+		if err != nil {
+			log.Errorf("[JobRepository-1] CreateJobAt: %v", err)
+			return nil, err
+		}
+		if existing != nil {
+			log.Infof("[JobRepository-2] CreateJobAt: %s already queued as job %d", options.dedupKey, existing.ID)
+			return existing, nil
+		}
+		job.DedupKey = &options.dedupKey
+	}
+
+	// The insert runs in its own (nested) transaction so a unique violation
+	// from a concurrent producer doesn't abort the caller's transaction.
+	err = uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		if job.DedupKey != nil && isUniqueViolation(err) {
+			existing, findErr := r.findByDedupKey(ctx, *job.DedupKey)
+			if findErr == nil {
+				return existing, nil
+			}
+		}
+		log.Errorf("[JobRepository-3] CreateJobAt: %v", err)
+		return nil, err
+	}
+
+	uow.AfterCommit(ctx, func() {
+		metrics.JobsEnqueued.WithLabelValues(topic).Inc()
+	})
+
+	// Wake listening workers right away. Jobs scheduled for later are
+	// picked up by the fallback poll. Inside a transaction Postgres holds
+	// the notification until commit.
+	if !runAt.After(time.Now()) {
+		if err := uow.DB(ctx, r.db).Exec("SELECT pg_notify(?, ?)", JobNotifyChannel, topic).Error; err != nil {
+			log.Warnf("[JobRepository] CreateJobAt: notify failed, job %d waits for the next poll: %v", job.ID, err)
+		}
+	}
+
+	return &job, nil
+}
+
+// claimDedupKey returns the job holding key if it was created within the
+// dedup window. Otherwise it releases the key from any older job so a new
+// job can take it.
+func (r *jobRepository) claimDedupKey(ctx context.Context, key string, window time.Duration) (*model.Job, error) {
+	if window <= 0 {
+		window = model.DefaultDedupWindow
 	}
-	return r.db.WithContext(ctx).Create(&job).Error
+
+	existing, err := r.findByDedupKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if existing.CreatedAt.After(time.Now().Add(-window)) {
+		return existing, nil
+	}
+
+	err = uow.DB(ctx, r.db).
+		Model(&model.Job{}).
+		Where("id = ? AND dedup_key = ?", existing.ID, key).
+		Update("dedup_key", nil).Error
+	return nil, err
+}
+
+func (r *jobRepository) findByDedupKey(ctx context.Context, key string) (*model.Job, error) {
+	var job model.Job
+	if err := uow.DB(ctx, r.db).Where("dedup_key = ?", key).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// toJobPayload accepts raw JSON as datatypes.JSON or []byte and marshals
+// anything else (maps, structs) to JSON.
+func toJobPayload(payload interface{}) (datatypes.JSON, error) {
+	switch p := payload.(type) {
+	case datatypes.JSON:
+		return p, nil
+	case []byte:
+		return datatypes.JSON(p), nil
+	case nil:
+		return nil, errors.New("job payload is required")
+	}
+
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(bytes), nil
 }
 
-func (r *jobRepository) FetchPendingJobs(ctx context.Context, limit int) ([]model.Job, error) {
+// ClaimJobs atomically moves up to limit runnable jobs of a topic to
+// processing and leases them to workerID until the lease expires. The inner SELECT skips
+// rows already locked by another claimer, so concurrent replicas never
+// receive the same job.
+func (r *jobRepository) ClaimJobs(ctx context.Context, workerID string, topic string, limit int, lease time.Duration) ([]model.Job, error) {
 	var jobs []model.Job
+	now := time.Now()
 
-	// Use raw SQL to ensure correct FOR UPDATE SKIP LOCKED placement
-	// This prevents duplicate processing when server restarts or multiple workers run
 	err := r.db.WithContext(ctx).
-		Raw(`SELECT * FROM "jobs"
-		     WHERE status = ?
-		     ORDER BY created_at ASC
-		     LIMIT ?
-		     FOR UPDATE SKIP LOCKED`, "pending", limit).
+		Raw(`UPDATE "jobs"
+		     SET status = ?, locked_by = ?, lease_expires_at = ?, updated_at = ?
+		     WHERE id IN (
+		         SELECT id FROM "jobs"
+		         WHERE status = ? AND topic = ? AND run_at <= ?
+		         ORDER BY run_at ASC, id ASC
+		         LIMIT ?
+		         FOR UPDATE SKIP LOCKED
+		     )
+		     RETURNING *`,
+			model.JobStatusProcessing, workerID, now.Add(lease), now,
+			model.JobStatusPending, topic, now, limit).
 		Scan(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the subquery order.
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].RunAt.Equal(jobs[j].RunAt) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].RunAt.Before(jobs[j].RunAt)
+	})
+
+	return jobs, nil
+}
+
+// ExtendLease pushes the lease of a job still held by workerID forward.
+// It returns ErrLeaseLost when the job was reaped or claimed by someone else.
+func (r *jobRepository) ExtendLease(ctx context.Context, jobID uint, workerID string, lease time.Duration) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&model.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ?", jobID, model.JobStatusProcessing, workerID).
+		Updates(map[string]interface{}{
+			"lease_expires_at": now.Add(lease),
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseExpiredLeases returns jobs whose worker stopped heartbeating to
+// pending. The lost run counts as an attempt, so a job that keeps crashing
+// its worker still ends up dead.
+func (r *jobRepository) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Exec(`UPDATE "jobs"
+		      SET attempts = attempts + 1,
+		          status = CASE WHEN attempts + 1 >= max_attempts THEN ? ELSE ? END,
+		          error_message = ?,
+		          locked_by = '',
+		          lease_expires_at = NULL,
+		          updated_at = ?
+		      WHERE status = ? AND lease_expires_at < ?`,
+			model.JobStatusDead, model.JobStatusPending,
+			"lease expired before the job finished",
+			now, model.JobStatusProcessing, now)
+
+	return result.RowsAffected, result.Error
+}
+
+// DeadLetterUnknownTopics moves pending jobs whose topic is not in
+// knownTopics, and that became runnable before runnableBefore, to dead.
+func (r *jobRepository) DeadLetterUnknownTopics(ctx context.Context, knownTopics []string, runnableBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Model(&model.Job{}).
+		Where("status = ? AND run_at < ? AND topic NOT IN ?", model.JobStatusPending, runnableBefore, knownTopics).
+		Updates(map[string]interface{}{
+			"status":        model.JobStatusDead,
+			"error_message": "no handler registered for topic",
+			"updated_at":    time.Now(),
+		})
 
-	return jobs, err
+	return result.RowsAffected, result.Error
 }
 
-func (r *jobRepository) UpdateJobStatus(ctx context.Context, jobID uint, status string, errorMsg string) error {
+// UpdateJobStatus settles a job still held by workerID. It returns
+// ErrLeaseLost when the lease was reaped or the job claimed by someone else,
+// so a slow worker can't overwrite the outcome of the run that replaced it.
+func (r *jobRepository) UpdateJobStatus(ctx context.Context, jobID uint, workerID string, status string, errorMsg string) error {
 	updates := map[string]interface{}{
-		"status":     status,
-		"updated_at": time.Now(),
+		"status":           status,
+		"locked_by":        "",
+		"lease_expires_at": nil,
+		"updated_at":       time.Now(),
 	}
 	if errorMsg != "" {
 		updates["error_message"] = errorMsg
 	}
 
-	return r.db.WithContext(ctx).
+	return r.settleJob(ctx, jobID, workerID, updates)
+}
+
+// RetryJob records a failed attempt. The job goes back to pending with an
+// exponential backoff, or to dead once it has used all of its attempts.
+// Like UpdateJobStatus, it returns ErrLeaseLost unless job.LockedBy still
+// holds the job.
+func (r *jobRepository) RetryJob(ctx context.Context, job model.Job, errorMsg string) error {
+	attempts := job.Attempts + 1
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = model.DefaultJobMaxAttempts
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"error_message":    errorMsg,
+		"locked_by":        "",
+		"lease_expires_at": nil,
+		"updated_at":       now,
+	}
+
+	if attempts >= maxAttempts {
+		updates["status"] = model.JobStatusDead
+	} else {
+		updates["status"] = model.JobStatusPending
+		updates["run_at"] = now.Add(RetryBackoff(attempts))
+	}
+
+	return r.settleJob(ctx, job.ID, job.LockedBy, updates)
+}
+
+// settleJob applies updates to a processing job leased to workerID.
+func (r *jobRepository) settleJob(ctx context.Context, jobID uint, workerID string, updates map[string]interface{}) error {
+	result := r.db.WithContext(ctx).
 		Model(&model.Job{}).
-		Where("id = ?", jobID).
-		Updates(updates).Error
+		Where("id = ? AND status = ? AND locked_by = ?", jobID, model.JobStatusProcessing, workerID).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// RetryBackoff returns the delay before the next attempt: the base delay
+// doubled for every previous attempt, capped at retryMaxDelay, plus up to
+// 20% random jitter so failed jobs don't retry in lockstep.
+func RetryBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := retryMaxDelay
+	if attempt <= 20 {
+		delay = retryBaseDelay << (attempt - 1)
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
+
+// GetAll lists jobs for the admin API, newest first.
+func (r *jobRepository) GetAll(ctx context.Context, query entity.JobQueryString) ([]model.Job, int64, int64, error) {
+	var jobs []model.Job
+	var countData int64
+	offset := (query.Page - 1) * query.Limit
+
+	sqlMain := r.db.WithContext(ctx).Model(&model.Job{})
+	if query.Topic != "" {
+		sqlMain = sqlMain.Where("topic = ?", query.Topic)
+	}
+	if query.Status != "" {
+		sqlMain = sqlMain.Where("status = ?", query.Status)
+	}
+	if query.StartDate != nil {
+		sqlMain = sqlMain.Where("created_at >= ?", *query.StartDate)
+	}
+	if query.EndDate != nil {
+		sqlMain = sqlMain.Where("created_at < ?", *query.EndDate)
+	}
+
+	if err := sqlMain.Count(&countData).Error; err != nil {
+		log.Errorf("[JobRepository-1] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	totalPage := int(math.Ceil(float64(countData) / float64(query.Limit)))
+	if err := sqlMain.Order("created_at DESC").Limit(int(query.Limit)).Offset(int(offset)).Find(&jobs).Error; err != nil {
+		log.Errorf("[JobRepository-2] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	if len(jobs) == 0 {
+		log.Infof("[JobRepository-3] GetAll: No job found")
+		return nil, 0, 0, errors.New("404")
+	}
+
+	return jobs, countData, int64(totalPage), nil
+}
+
+func (r *jobRepository) GetByID(ctx context.Context, jobID uint) (*model.Job, error) {
+	var job model.Job
+	if err := r.db.WithContext(ctx).Where("id = ?", jobID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Infof("[JobRepository-1] GetByID: Job not found")
+			return nil, errors.New("404")
+		}
+		log.Errorf("[JobRepository-2] GetByID: %v", err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// RequeueJob puts a failed or dead job back on the queue with a fresh set
+// of attempts. Jobs in any other state are rejected with "400".
+func (r *jobRepository) RequeueJob(ctx context.Context, jobID uint) error {
+	now := time.Now()
+	return r.transition(ctx, jobID, []string{model.JobStatusFailed, model.JobStatusDead}, map[string]interface{}{
+		"status":     model.JobStatusPending,
+		"attempts":   0,
+		"run_at":     now,
+		"updated_at": now,
+	})
+}
+
+// CancelJob stops a pending job from ever running. Jobs in any other state
+// are rejected with "400".
+func (r *jobRepository) CancelJob(ctx context.Context, jobID uint) error {
+	return r.transition(ctx, jobID, []string{model.JobStatusPending}, map[string]interface{}{
+		"status":     model.JobStatusCancelled,
+		"updated_at": time.Now(),
+	})
+}
+
+// transition applies updates only while the job is in one of the from
+// states, so a job claimed by a worker in the meantime is left untouched.
+func (r *jobRepository) transition(ctx context.Context, jobID uint, from []string, updates map[string]interface{}) error {
+	result := r.db.WithContext(ctx).
+		Model(&model.Job{}).
+		Where("id = ? AND status IN ?", jobID, from).
+		Updates(updates)
+	if result.Error != nil {
+		log.Errorf("[JobRepository-1] transition: %v", result.Error)
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.GetByID(ctx, jobID); err != nil {
+			return err
+		}
+		log.Infof("[JobRepository-2] transition: Invalid status transition for job %d", jobID)
+		return errors.New("400")
+	}
+
+	return nil
+}
+
+// PurgeCompletedJobs deletes completed jobs last updated before olderThan.
+func (r *jobRepository) PurgeCompletedJobs(ctx context.Context, olderThan time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND updated_at < ?", model.JobStatusCompleted, olderThan).
+		Delete(&model.Job{})
+	if result.Error != nil {
+		log.Errorf("[JobRepository-1] PurgeCompletedJobs: %v", result.Error)
+	}
+
+	return result.RowsAffected, result.Error
+}
+
+// QueueStats counts pending and processing jobs per topic for the queue
+// depth and age gauges.
+func (r *jobRepository) QueueStats(ctx context.Context) ([]model.JobQueueStats, error) {
+	var stats []model.JobQueueStats
+	err := r.db.WithContext(ctx).
+		Model(&model.Job{}).
+		Select("topic, status, COUNT(*) AS count, MIN(CASE WHEN run_at <= NOW() THEN run_at END) AS oldest_run_at").
+		Where("status IN ?", []string{model.JobStatusPending, model.JobStatusProcessing}).
+		Group("topic, status").
+		Scan(&stats).Error
+	if err != nil {
+		log.Errorf("[JobRepository-1] QueueStats: %v", err)
+		return nil, err
+	}
+
+	return stats, nil
 }
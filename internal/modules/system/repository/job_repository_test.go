@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff_GrowsExponentiallyWithJitter(t *testing.T) {
+	for attempt := 1; attempt <= 5; attempt++ {
+		base := retryBaseDelay << (attempt - 1)
+		delay := RetryBackoff(attempt)
+		assert.GreaterOrEqual(t, delay, base)
+		assert.LessOrEqual(t, delay, base+base/5)
+	}
+}
+
+func TestRetryBackoff_CappedAtMaxDelay(t *testing.T) {
+	for _, attempt := range []int{12, 30, 100} {
+		delay := RetryBackoff(attempt)
+		assert.GreaterOrEqual(t, delay, retryMaxDelay)
+		assert.LessOrEqual(t, delay, retryMaxDelay+retryMaxDelay/5)
+	}
+	assert.GreaterOrEqual(t, RetryBackoff(0), 5*time.Second)
+}
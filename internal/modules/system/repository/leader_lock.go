@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// SchedulerLockKey is the advisory lock key held by the replica that runs
+// the cron scheduler.
+const SchedulerLockKey int64 = 0x746f66617368 // "tofash"
+
+type LeaderLockInterface interface {
+	// Lead blocks until ctx is done. Whenever this process holds the lock it
+	// calls lead with a context that is cancelled as soon as the lock is
+	// lost, then goes back to waiting for it.
+	Lead(ctx context.Context, lead func(ctx context.Context))
+}
+
+type leaderLock struct {
+	db            *gorm.DB
+	key           int64
+	retryInterval time.Duration
+	checkInterval time.Duration
+}
+
+// NewLeaderLock elects a leader among replicas with a session-level Postgres
+// advisory lock. The lock lives as long as the connection holding it, so a
+// crashed leader releases it automatically.
+func NewLeaderLock(db *gorm.DB, key int64) LeaderLockInterface {
+	return &leaderLock{
+		db:            db,
+		key:           key,
+		retryInterval: 15 * time.Second,
+		checkInterval: 10 * time.Second,
+	}
+}
+
+func (l *leaderLock) Lead(ctx context.Context, lead func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		if err := l.leadOnce(ctx, lead); err != nil {
+			log.Errorf("[LeaderLock] Lock %d: %v", l.key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.retryInterval):
+		}
+	}
+}
+
+// leadOnce tries to take the lock on a dedicated connection and, if it
+// succeeds, runs lead until ctx is done or the connection stops answering.
+func (l *leaderLock) leadOnce(ctx context.Context, lead func(ctx context.Context)) error {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	// Never hand a session that may still hold the lock back to the pool.
+	defer discardConn(conn)
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired {
+		return nil
+	}
+	log.Infof("[LeaderLock] Acquired lock %d", l.key)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(l.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return nil
+		case <-done:
+			cancel()
+			return nil
+		case <-ticker.C:
+			if err := conn.PingContext(ctx); err != nil && ctx.Err() == nil {
+				log.Warnf("[LeaderLock] Lost lock %d", l.key)
+				cancel()
+				<-done
+				return err
+			}
+		}
+	}
+}
+
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
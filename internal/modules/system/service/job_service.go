@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"tofash/internal/modules/system/entity"
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+
+	"github.com/labstack/gommon/log"
+)
+
+type JobServiceInterface interface {
+	GetAll(ctx context.Context, query entity.JobQueryString) ([]model.Job, int64, int64, error)
+	GetByID(ctx context.Context, jobID uint) (*model.Job, error)
+	Retry(ctx context.Context, jobID uint) error
+	Cancel(ctx context.Context, jobID uint) error
+	PurgeCompleted(ctx context.Context, olderThanDays int) (int64, error)
+}
+
+type jobService struct {
+	repo repository.JobRepositoryInterface
+}
+
+// GetAll implements JobServiceInterface.
+func (j *jobService) GetAll(ctx context.Context, query entity.JobQueryString) ([]model.Job, int64, int64, error) {
+	results, count, total, err := j.repo.GetAll(ctx, query)
+	if err != nil {
+		log.Errorf("[JobService-1] GetAll: %v", err)
+		return nil, 0, 0, err
+	}
+
+	return results, count, total, nil
+}
+
+// GetByID implements JobServiceInterface.
+func (j *jobService) GetByID(ctx context.Context, jobID uint) (*model.Job, error) {
+	result, err := j.repo.GetByID(ctx, jobID)
+	if err != nil {
+		log.Errorf("[JobService-1] GetByID: %v", err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Retry implements JobServiceInterface.
+func (j *jobService) Retry(ctx context.Context, jobID uint) error {
+	if err := j.repo.RequeueJob(ctx, jobID); err != nil {
+		log.Errorf("[JobService-1] Retry: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Cancel implements JobServiceInterface.
+func (j *jobService) Cancel(ctx context.Context, jobID uint) error {
+	if err := j.repo.CancelJob(ctx, jobID); err != nil {
+		log.Errorf("[JobService-1] Cancel: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeCompleted implements JobServiceInterface.
+func (j *jobService) PurgeCompleted(ctx context.Context, olderThanDays int) (int64, error) {
+	if olderThanDays < 1 {
+		log.Errorf("[JobService-1] PurgeCompleted: invalid older_than_days %d", olderThanDays)
+		return 0, errors.New("400")
+	}
+
+	purged, err := j.repo.PurgeCompletedJobs(ctx, time.Now().AddDate(0, 0, -olderThanDays))
+	if err != nil {
+		log.Errorf("[JobService-2] PurgeCompleted: %v", err)
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func NewJobService(repo repository.JobRepositoryInterface) JobServiceInterface {
+	return &jobService{repo: repo}
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"context"
+
+	"tofash/internal/modules/user/service"
+	"tofash/internal/shared/async"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/datatypes"
+)
+
+const TopicVerificationTokenCleanup = "verification_token_cleanup"
+
+// RegisterHandlers plugs the user module's background jobs into the worker.
+func RegisterHandlers(r async.Registry, userSvc service.UserServiceInterface) {
+	r.Register(TopicVerificationTokenCleanup, func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		purged, err := userSvc.PurgeExpiredTokens(ctx)
+		if err != nil {
+			return err
+		}
+		log.Infof("[TokenCleanupJob] Deleted %d expired verification token(s)", purged)
+		return nil
+	})
+}
+
+// RegisterSchedules declares the user module's recurring jobs.
+func RegisterSchedules(c async.Cron) error {
+	return c.Schedule("@hourly", TopicVerificationTokenCleanup, nil)
+}
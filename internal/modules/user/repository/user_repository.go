@@ -8,6 +8,7 @@ import (
 	"time"
 	"tofash/internal/modules/user/entity"
 	"tofash/internal/modules/user/model"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
@@ -24,6 +25,7 @@ type UserRepositoryInterface interface {
 	// Modul Customers Admin
 	GetCustomerAll(ctx context.Context, query entity.QueryStringCustomer) ([]entity.UserEntity, int64, int64, error)
 	GetCustomerByID(ctx context.Context, customerID int64) (*entity.UserEntity, error)
+	GetByIDs(ctx context.Context, userIDs []int64) ([]entity.UserEntity, error)
 	CreateCustomer(ctx context.Context, req entity.UserEntity) (int64, error)
 	UpdateCustomer(ctx context.Context, req entity.UserEntity) error
 	DeleteCustomer(ctx context.Context, customerID int64) error
@@ -36,7 +38,7 @@ type userRepository struct {
 // DeleteCustomer implements UserRepositoryInterface.
 func (u *userRepository) DeleteCustomer(ctx context.Context, customerID int64) error {
 	modelUser := model.User{}
-	if err := u.db.Where("id =?", customerID).First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =?", customerID).First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[UserRepository-1] DeleteCustomer: User not found")
@@ -46,7 +48,7 @@ func (u *userRepository) DeleteCustomer(ctx context.Context, customerID int64) e
 		return err
 	}
 
-	if err := u.db.Delete(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Delete(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-3] DeleteCustomer: %v", err)
 		return err
 	}
@@ -57,13 +59,13 @@ func (u *userRepository) DeleteCustomer(ctx context.Context, customerID int64) e
 func (u *userRepository) UpdateCustomer(ctx context.Context, req entity.UserEntity) error {
 	modelRole := model.Role{}
 
-	if err := u.db.Where("id =?", req.RoleID).First(&modelRole).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =?", req.RoleID).First(&modelRole).Error; err != nil {
 		log.Fatalf("[UserRepository-1] UpdateCustomer: %v", err)
 		return err
 	}
 
 	modelUser := model.User{}
-	if err := u.db.Where("id =?", req.ID).First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =?", req.ID).First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[UserRepository-2] UpdateCustomer: User not found")
@@ -96,7 +98,7 @@ func (u *userRepository) UpdateCustomer(ctx context.Context, req entity.UserEnti
 		modelUser.Password = req.Password
 	}
 
-	if err := u.db.Save(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Save(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-4] UpdateCustomer: %v", err)
 		return err
 	}
@@ -108,7 +110,7 @@ func (u *userRepository) UpdateCustomer(ctx context.Context, req entity.UserEnti
 func (u *userRepository) CreateCustomer(ctx context.Context, req entity.UserEntity) (int64, error) {
 	modelRole := model.Role{}
 
-	if err := u.db.Where("id =?", req.RoleID).First(&modelRole).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =?", req.RoleID).First(&modelRole).Error; err != nil {
 		log.Fatalf("[UserRepository-1] CreateCustomer: %v", err)
 		return 0, err
 	}
@@ -126,7 +128,7 @@ func (u *userRepository) CreateCustomer(ctx context.Context, req entity.UserEnti
 		IsVerified: true,
 	}
 
-	if err := u.db.Create(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Create(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-2] CreateCustomer: %v", err)
 		return 0, err
 	}
@@ -138,7 +140,7 @@ func (u *userRepository) CreateCustomer(ctx context.Context, req entity.UserEnti
 func (u *userRepository) GetCustomerByID(ctx context.Context, customerID int64) (*entity.UserEntity, error) {
 	modelUser := model.User{}
 
-	if err := u.db.Where("id = ?", customerID).Preload("Roles").First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id = ?", customerID).Preload("Roles").First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Infof("[UserRepository-1] GetCustomerByID: User not found")
@@ -166,6 +168,36 @@ func (u *userRepository) GetCustomerByID(ctx context.Context, customerID int64)
 	}, nil
 }
 
+// GetByIDs implements UserRepositoryInterface. It loads all the users in
+// one query; IDs with no user are left out.
+func (u *userRepository) GetByIDs(ctx context.Context, userIDs []int64) ([]entity.UserEntity, error) {
+	if len(userIDs) == 0 {
+		return []entity.UserEntity{}, nil
+	}
+
+	modelUsers := []model.User{}
+	if err := uow.DB(ctx, u.db).Where("id IN ?", userIDs).Find(&modelUsers).Error; err != nil {
+		log.Errorf("[UserRepository-1] GetByIDs: %v", err)
+		return nil, err
+	}
+
+	entities := make([]entity.UserEntity, 0, len(modelUsers))
+	for _, val := range modelUsers {
+		entities = append(entities, entity.UserEntity{
+			ID:      val.ID,
+			Name:    val.Name,
+			Email:   val.Email,
+			Address: val.Address,
+			Lat:     val.Lat,
+			Lng:     val.Lng,
+			Phone:   val.Phone,
+			Photo:   val.Photo,
+		})
+	}
+
+	return entities, nil
+}
+
 // GetCustomerAll implements UserRepositoryInterface.
 func (u *userRepository) GetCustomerAll(ctx context.Context, query entity.QueryStringCustomer) ([]entity.UserEntity, int64, int64, error) {
 	modelUsers := []model.User{}
@@ -174,7 +206,7 @@ func (u *userRepository) GetCustomerAll(ctx context.Context, query entity.QueryS
 	order := fmt.Sprintf("%s %s", query.OrderBy, query.OrderType)
 	offset := (query.Page - 1) * query.Limit
 
-	sqlMain := u.db.Preload("Roles", "name = ?", "Customer").
+	sqlMain := uow.DB(ctx, u.db).Preload("Roles", "name = ?", "Customer").
 		Where("name ILIKE ? OR email ILIKE ? OR phone ILIKE ?", "%"+query.Search+"%", "%"+query.Search+"%", "%"+query.Search+"%")
 
 	if err := sqlMain.Model(&modelUsers).Count(&countData).Error; err != nil {
@@ -223,7 +255,7 @@ func (u *userRepository) UpdateDataUser(ctx context.Context, req entity.UserEnti
 		Photo:   req.Photo,
 	}
 
-	if err := u.db.Where("id = ? AND is_verified = true", req.ID).First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id = ? AND is_verified = true", req.ID).First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Errorf("[UserRepository-1] UpdateDataUser: %v", err)
@@ -238,7 +270,7 @@ func (u *userRepository) UpdateDataUser(ctx context.Context, req entity.UserEnti
 	modelUser.Address = req.Address
 	modelUser.Phone = req.Phone
 
-	if err := u.db.UpdateColumns(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).UpdateColumns(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-3] UpdateDataUser: %v", err)
 		return err
 	}
@@ -250,7 +282,7 @@ func (u *userRepository) UpdateDataUser(ctx context.Context, req entity.UserEnti
 func (u *userRepository) GetUserByID(ctx context.Context, userID int64) (*entity.UserEntity, error) {
 	modelUser := model.User{}
 
-	if err := u.db.Where("id =? AND is_verified = true", userID).Preload("Roles").First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =? AND is_verified = true", userID).Preload("Roles").First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Errorf("[UserRepository-1] GetUserByID: %v", err)
@@ -277,7 +309,7 @@ func (u *userRepository) GetUserByID(ctx context.Context, userID int64) (*entity
 func (u *userRepository) UpdatePasswordByID(ctx context.Context, req entity.UserEntity) error {
 	modelUser := model.User{}
 
-	if err := u.db.Where("id =?", req.ID).First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id =?", req.ID).First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Errorf("[UserRepository-1] UpdatePasswordByID: %v", err)
@@ -288,7 +320,7 @@ func (u *userRepository) UpdatePasswordByID(ctx context.Context, req entity.User
 	}
 
 	modelUser.Password = req.Password
-	if err := u.db.Save(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Save(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-3] UpdatePasswordByID: %v", err)
 		return err
 	}
@@ -300,7 +332,7 @@ func (u *userRepository) UpdatePasswordByID(ctx context.Context, req entity.User
 func (u *userRepository) UpdateUserVerified(ctx context.Context, userID int64) (*entity.UserEntity, error) {
 	modelUser := model.User{}
 
-	if err := u.db.Where("id = ?", userID).Preload("Roles").First(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Where("id = ?", userID).Preload("Roles").First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Errorf("[UserRepository-1] UpdateUserVerified: %v", err)
@@ -311,7 +343,7 @@ func (u *userRepository) UpdateUserVerified(ctx context.Context, userID int64) (
 	}
 
 	modelUser.IsVerified = true
-	if err := u.db.Save(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Save(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-3] UpdateUserVerified: %v", err)
 		return nil, err
 	}
@@ -334,7 +366,7 @@ func (u *userRepository) UpdateUserVerified(ctx context.Context, userID int64) (
 func (u *userRepository) CreateUserAccount(ctx context.Context, req entity.UserEntity) (int64, error) {
 	var roleID int64
 
-	if err := u.db.Select("id").
+	if err := uow.DB(ctx, u.db).Select("id").
 		Where("name = ?", "Customer").
 		Model(&model.Role{}).
 		Scan(&roleID).
@@ -350,7 +382,7 @@ func (u *userRepository) CreateUserAccount(ctx context.Context, req entity.UserE
 		Roles:    []model.Role{{ID: roleID}},
 	}
 
-	if err := u.db.Create(&modelUser).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Create(&modelUser).Error; err != nil {
 		log.Errorf("[UserRepository-2] CreateUserAccount: %v", err)
 		return 0, err
 	}
@@ -362,7 +394,7 @@ func (u *userRepository) CreateUserAccount(ctx context.Context, req entity.UserE
 		ExpiresAt: time.Now().Add(time.Hour),
 	}
 
-	if err := u.db.Create(&modelVerify).Error; err != nil {
+	if err := uow.DB(ctx, u.db).Create(&modelVerify).Error; err != nil {
 		log.Errorf("[UserRepository-3] CreateUserAccount: %v", err)
 		return 0, err
 	}
@@ -374,7 +406,7 @@ func (u *userRepository) CreateUserAccount(ctx context.Context, req entity.UserE
 func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*entity.UserEntity, error) {
 	modelUser := model.User{}
 
-	if err := u.db.Where("email = ? AND is_verified = ?", email, true).
+	if err := uow.DB(ctx, u.db).Where("email = ? AND is_verified = ?", email, true).
 		Preload("Roles").First(&modelUser).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
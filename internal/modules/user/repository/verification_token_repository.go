@@ -6,6 +6,7 @@ import (
 	"time"
 	"tofash/internal/modules/user/entity"
 	"tofash/internal/modules/user/model"
+	"tofash/internal/shared/uow"
 
 	"github.com/labstack/gommon/log"
 	"gorm.io/gorm"
@@ -14,6 +15,7 @@ import (
 type VerificationTokenRepositoryInterface interface {
 	CreateVerificationToken(ctx context.Context, req entity.VerificationTokenEntity) error
 	GetDataByToken(ctx context.Context, token string) (*entity.VerificationTokenEntity, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
 }
 
 type verificationTokenRepository struct {
@@ -24,7 +26,7 @@ type verificationTokenRepository struct {
 func (v *verificationTokenRepository) GetDataByToken(ctx context.Context, token string) (*entity.VerificationTokenEntity, error) {
 	modelToken := model.VerificationToken{}
 
-	if err := v.db.Where("token =?", token).First(&modelToken).Error; err != nil {
+	if err := uow.DB(ctx, v.db).Where("token =?", token).First(&modelToken).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			err = errors.New("404")
 			log.Errorf("[VerificationTokenRepository-1] GetDataByToken: %v", err)
@@ -58,7 +60,7 @@ func (v *verificationTokenRepository) CreateVerificationToken(ctx context.Contex
 		TokenType: req.TokenType,
 	}
 
-	if err := v.db.Create(&modelVerificationToken).Error; err != nil {
+	if err := uow.DB(ctx, v.db).Create(&modelVerificationToken).Error; err != nil {
 		log.Errorf("[VerificationTokenRepository-1] CreateVerificationToken: %v", err)
 		return err
 	}
@@ -66,6 +68,17 @@ func (v *verificationTokenRepository) CreateVerificationToken(ctx context.Contex
 	return nil
 }
 
+// DeleteExpired implements VerificationTokenRepositoryInterface.
+func (v *verificationTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := uow.DB(ctx, v.db).Unscoped().Where("expires_at < ?", before).Delete(&model.VerificationToken{})
+	if result.Error != nil {
+		log.Errorf("[VerificationTokenRepository-1] DeleteExpired: %v", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
 func NewVerificationTokenRepository(db *gorm.DB) VerificationTokenRepositoryInterface {
 	return &verificationTokenRepository{db: db}
 }
@@ -8,10 +8,11 @@ import (
 	"time"
 	"tofash/internal/config"
 	"tofash/internal/modules/user/entity"
-	"tofash/internal/modules/user/message"
 	"tofash/internal/modules/user/repository"
 	"tofash/internal/modules/user/utils"
 	"tofash/internal/modules/user/utils/conv"
+	"tofash/internal/shared/async"
+	"tofash/internal/shared/uow"
 
 	"github.com/google/uuid"
 	"github.com/labstack/gommon/log"
@@ -29,9 +30,12 @@ type UserServiceInterface interface {
 	// Modul Customers Admin
 	GetCustomerAll(ctx context.Context, query entity.QueryStringCustomer) ([]entity.UserEntity, int64, int64, error)
 	GetCustomerByID(ctx context.Context, customerID int64) (*entity.UserEntity, error)
+	GetByIDs(ctx context.Context, userIDs []int64) (map[int64]*entity.UserEntity, error)
 	CreateCustomer(ctx context.Context, req entity.UserEntity) error
 	UpdateCustomer(ctx context.Context, req entity.UserEntity) error
 	DeleteCustomer(ctx context.Context, customerID int64) error
+
+	PurgeExpiredTokens(ctx context.Context) (int64, error)
 }
 
 type userService struct {
@@ -39,6 +43,19 @@ type userService struct {
 	cfg        *config.Config
 	jwtService JwtServiceInterface
 	repoToken  repository.VerificationTokenRepositoryInterface
+	queue      async.Enqueuer
+	uow        uow.UnitOfWorkInterface
+}
+
+// PurgeExpiredTokens implements UserServiceInterface.
+func (u *userService) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	purged, err := u.repoToken.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		log.Errorf("[UserService-1] PurgeExpiredTokens: %v", err)
+		return 0, err
+	}
+
+	return purged, nil
 }
 
 // DeleteCustomer implements UserServiceInterface.
@@ -60,22 +77,23 @@ func (u *userService) UpdateCustomer(ctx context.Context, req entity.UserEntity)
 		req.Password = password
 	}
 
-	err := u.repo.UpdateCustomer(ctx, req)
-	if err != nil {
-		log.Fatalf("[UserService-2] UpdateCustomer: %v", err)
-		return err
-	}
+	return u.uow.Do(ctx, func(ctx context.Context) error {
+		err := u.repo.UpdateCustomer(ctx, req)
+		if err != nil {
+			log.Errorf("[UserService-2] UpdateCustomer: %v", err)
+			return err
+		}
 
-	if passwordNoencrypt != "" {
-		messageparam := fmt.Sprintf("You're account has been updated. Please login use: \n Email: %s\nPassword: %s", req.Email, passwordNoencrypt)
-		go message.PublishMessage(req.ID,
-			req.Email,
-			messageparam,
-			utils.NOTIF_EMAIL_UPDATE_CUSTOMER,
-			"Updated Data")
-	}
+		if passwordNoencrypt != "" {
+			messageparam := fmt.Sprintf("You're account has been updated. Please login use: \n Email: %s\nPassword: %s", req.Email, passwordNoencrypt)
+			if err := u.queueEmail(ctx, req.ID, req.Email, messageparam, utils.NOTIF_EMAIL_UPDATE_CUSTOMER, "Updated Data"); err != nil {
+				log.Errorf("[UserService-3] UpdateCustomer: %v", err)
+				return err
+			}
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // CreateCustomer implements UserServiceInterface.
@@ -88,20 +106,21 @@ func (u *userService) CreateCustomer(ctx context.Context, req entity.UserEntity)
 	}
 
 	req.Password = password
-	userID, err := u.repo.CreateCustomer(ctx, req)
-	if err != nil {
-		log.Fatalf("[UserService-2] CreateCustomer: %v", err)
-		return err
-	}
+	return u.uow.Do(ctx, func(ctx context.Context) error {
+		userID, err := u.repo.CreateCustomer(ctx, req)
+		if err != nil {
+			log.Errorf("[UserService-2] CreateCustomer: %v", err)
+			return err
+		}
 
-	messageparam := fmt.Sprintf("You have been registered in Sayur Project. Please login use: \n Email: %s\nPassword: %s", req.Email, passwordNoEncrypt)
-	go message.PublishMessage(userID,
-		req.Email,
-		messageparam,
-		utils.NOTIF_EMAIL_CREATE_CUSTOMER,
-		"Account Exists")
+		messageparam := fmt.Sprintf("You have been registered in Sayur Project. Please login use: \n Email: %s\nPassword: %s", req.Email, passwordNoEncrypt)
+		if err := u.queueEmail(ctx, userID, req.Email, messageparam, utils.NOTIF_EMAIL_CREATE_CUSTOMER, "Account Exists"); err != nil {
+			log.Errorf("[UserService-3] CreateCustomer: %v", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // GetCustomerByID implements UserServiceInterface.
@@ -109,6 +128,22 @@ func (u *userService) GetCustomerByID(ctx context.Context, customerID int64) (*e
 	return u.repo.GetCustomerByID(ctx, customerID)
 }
 
+// GetByIDs implements UserServiceInterface. Users are keyed by ID; unknown
+// IDs are missing from the map rather than an error.
+func (u *userService) GetByIDs(ctx context.Context, userIDs []int64) (map[int64]*entity.UserEntity, error) {
+	results, err := u.repo.GetByIDs(ctx, userIDs)
+	if err != nil {
+		log.Errorf("[UserService-1] GetByIDs: %v", err)
+		return nil, err
+	}
+
+	users := make(map[int64]*entity.UserEntity, len(results))
+	for i := range results {
+		users[results[i].ID] = &results[i]
+	}
+	return users, nil
+}
+
 // GetCustomerAll implements UserServiceInterface.
 func (u *userService) GetCustomerAll(ctx context.Context, query entity.QueryStringCustomer) ([]entity.UserEntity, int64, int64, error) {
 	return u.repo.GetCustomerAll(ctx, query)
@@ -223,21 +258,22 @@ func (u *userService) ForgotPassword(ctx context.Context, req entity.UserEntity)
 		TokenType: utils.NOTIF_EMAIL_FORGOT_PASSWORD,
 	}
 
-	err = u.repoToken.CreateVerificationToken(ctx, reqEntity)
-	if err != nil {
-		log.Errorf("[UserService-2] ForgotPassword: %v", err)
-		return err
-	}
+	return u.uow.Do(ctx, func(ctx context.Context) error {
+		err := u.repoToken.CreateVerificationToken(ctx, reqEntity)
+		if err != nil {
+			log.Errorf("[UserService-2] ForgotPassword: %v", err)
+			return err
+		}
 
-	urlForgot := fmt.Sprintf("%s/auth/update-password?token=%s", u.cfg.App.UrlFrontFE, token)
-	messageparam := fmt.Sprintf("Please click link below for reset password: %v", urlForgot)
-	go message.PublishMessage(user.ID,
-		req.Email,
-		messageparam,
-		utils.NOTIF_EMAIL_FORGOT_PASSWORD,
-		"Reset Password")
+		urlForgot := fmt.Sprintf("%s/auth/update-password?token=%s", u.cfg.App.UrlFrontFE, token)
+		messageparam := fmt.Sprintf("Please click link below for reset password: %v", urlForgot)
+		if err := u.queueEmail(ctx, user.ID, req.Email, messageparam, utils.NOTIF_EMAIL_FORGOT_PASSWORD, "Reset Password"); err != nil {
+			log.Errorf("[UserService-3] ForgotPassword: %v", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // CreateUserAccount implements UserServiceInterface.
@@ -251,23 +287,22 @@ func (u *userService) CreateUserAccount(ctx context.Context, req entity.UserEnti
 	req.Password = password
 	req.Token = uuid.New().String()
 
-	userID, err := u.repo.CreateUserAccount(ctx, req)
-	if err != nil {
-		log.Errorf("[UserService-2] CreateUserAccount: %v", err)
-		return err
-	}
+	return u.uow.Do(ctx, func(ctx context.Context) error {
+		userID, err := u.repo.CreateUserAccount(ctx, req)
+		if err != nil {
+			log.Errorf("[UserService-2] CreateUserAccount: %v", err)
+			return err
+		}
 
-	verifyURL := fmt.Sprintf("%s/auth/verify-account?token=%s", u.cfg.App.UrlFrontFE, req.Token)
-	verifyMsg := fmt.Sprintf("Please verify your account by clicking the link: %s", verifyURL)
-	go message.PublishMessage(
-		userID,
-		req.Email,
-		verifyMsg,
-		utils.NOTIF_EMAIL_VERIFICATION,
-		"Verify Your Account",
-	)
+		verifyURL := fmt.Sprintf("%s/auth/verify-account?token=%s", u.cfg.App.UrlFrontFE, req.Token)
+		verifyMsg := fmt.Sprintf("Please verify your account by clicking the link: %s", verifyURL)
+		if err := u.queueEmail(ctx, userID, req.Email, verifyMsg, utils.NOTIF_EMAIL_VERIFICATION, "Verify Your Account"); err != nil {
+			log.Errorf("[UserService-3] CreateUserAccount: %v", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // SignIn implements UserServiceInterface.
@@ -321,11 +356,27 @@ func (u *userService) SignIn(ctx context.Context, req entity.UserEntity) (*entit
 	return user, token, nil
 }
 
-func NewUserService(repo repository.UserRepositoryInterface, cfg *config.Config, jwtService JwtServiceInterface, repoToken repository.VerificationTokenRepositoryInterface) UserServiceInterface {
+// queueEmail enqueues an email_notification job. Inside a unit of work it
+// commits together with the caller's writes.
+func (u *userService) queueEmail(ctx context.Context, userID int64, email, body, notifType, subject string) error {
+	payload := map[string]interface{}{
+		"receiver_email": email,
+		"subject":        subject,
+		"message":        body,
+		"type":           notifType,
+		"receiver_id":    userID,
+	}
+
+	return u.queue.Enqueue(ctx, "email_notification", payload)
+}
+
+func NewUserService(repo repository.UserRepositoryInterface, cfg *config.Config, jwtService JwtServiceInterface, repoToken repository.VerificationTokenRepositoryInterface, uow uow.UnitOfWorkInterface, queue async.Enqueuer) UserServiceInterface {
 	return &userService{
 		repo:       repo,
 		cfg:        cfg,
 		jwtService: jwtService,
 		repoToken:  repoToken,
+		uow:        uow,
+		queue:      queue,
 	}
 }
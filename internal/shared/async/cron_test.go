@@ -0,0 +1,50 @@
+package async
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_RejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	base := time.Date(2026, 3, 14, 10, 7, 30, 0, time.UTC) // Saturday
+
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2026, 3, 15, 3, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either may match.
+		{"0 0 20 * 1", time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)},
+		// A stepped "*" still counts as unrestricted, so both must match:
+		// the first odd-numbered Monday.
+		{"0 0 */2 * 1", time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		s, err := parseCron(tc.spec)
+		require.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.want, s.next(base), tc.spec)
+	}
+}
+
+func TestCronSchedule_NextNeverMatches(t *testing.T) {
+	s, err := parseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.next(time.Now()).IsZero())
+}
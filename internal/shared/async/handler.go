@@ -0,0 +1,44 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/datatypes"
+)
+
+// HandlerFunc processes the payload of a single job. jobID stays the same
+// across retries, so handlers can use it to make side effects idempotent.
+// Returning an error reschedules the job according to its retry policy,
+// unless the error is wrapped with Permanent.
+type HandlerFunc func(ctx context.Context, jobID uint, payload datatypes.JSON) error
+
+// Typed adapts a handler that works on a decoded payload into a HandlerFunc.
+// Payloads that cannot be decoded are treated as permanent failures, since
+// retrying them would never succeed.
+func Typed[T any](fn func(ctx context.Context, jobID uint, payload T) error) HandlerFunc {
+	return func(ctx context.Context, jobID uint, payload datatypes.JSON) error {
+		var data T
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return Permanent(fmt.Errorf("decode payload: %w", err))
+		}
+		return fn(ctx, jobID, data)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying; the worker moves the job
+// straight to the dead state.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
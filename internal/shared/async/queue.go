@@ -0,0 +1,136 @@
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tofash/internal/config"
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+
+	"gorm.io/datatypes"
+)
+
+// Enqueuer is the producer side of the job queue. Services and the
+// scheduler depend on it rather than on a particular backend.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, topic string, payload interface{}, opts ...EnqueueOption) error
+}
+
+// Queue is a job backend the worker can consume from.
+type Queue interface {
+	Enqueuer
+	// Claim reserves up to limit runnable jobs of topic for workerID until
+	// lease expires.
+	Claim(ctx context.Context, workerID, topic string, limit int, lease time.Duration) ([]model.Job, error)
+	// Extend renews the reservation of a running job. It returns
+	// ErrLeaseLost once the job may be handed to someone else.
+	Extend(ctx context.Context, job model.Job, workerID string, lease time.Duration) error
+	// Complete, Retry and Kill settle a claimed job. Retry schedules the
+	// next attempt with backoff, or kills the job once it is out of attempts.
+	// They return ErrLeaseLost, and change nothing, once the lease is gone.
+	Complete(ctx context.Context, job model.Job) error
+	Retry(ctx context.Context, job model.Job, errMsg string) error
+	Kill(ctx context.Context, job model.Job, errMsg string) error
+	// Sweep runs periodic housekeeping: jobs held by crashed workers are
+	// returned to the queue, and jobs of topics outside knownTopics that
+	// were runnable before unknownBefore are killed.
+	Sweep(ctx context.Context, knownTopics []string, unknownBefore time.Time) error
+}
+
+// Notifier is implemented by queues that announce new jobs, so the worker
+// can wake up immediately and poll only as a fallback.
+type Notifier interface {
+	// Listen blocks until ctx is done, calling onReady with the topic of
+	// every job that becomes runnable.
+	Listen(ctx context.Context, onReady func(topic string))
+}
+
+// StatsReporter is implemented by queues that can count their jobs for the
+// queue depth and age gauges.
+type StatsReporter interface {
+	Stats(ctx context.Context) ([]model.JobQueueStats, error)
+}
+
+// ErrLeaseLost is returned by Queue.Extend when the job is no longer
+// reserved for the worker.
+var ErrLeaseLost = repository.ErrLeaseLost
+
+// EnqueueOption tunes a single Enqueue call.
+type EnqueueOption func(*enqueueOptions)
+
+type enqueueOptions struct {
+	runAt       time.Time
+	dedupKey    string
+	dedupWindow time.Duration
+}
+
+func newEnqueueOptions(opts []EnqueueOption) enqueueOptions {
+	options := enqueueOptions{runAt: time.Now()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithDelay makes the job runnable only after d.
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) { o.runAt = time.Now().Add(d) }
+}
+
+// WithRunAt makes the job runnable only at or after t.
+func WithRunAt(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) { o.runAt = t }
+}
+
+// WithDedupKey drops the enqueue if a job with the same key was enqueued
+// within window (model.DefaultDedupWindow when zero). Backends that cannot
+// deduplicate ignore it.
+func WithDedupKey(key string, window time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.dedupKey = key
+		o.dedupWindow = window
+	}
+}
+
+// toPayload encodes a job payload the same way the Postgres backend
+// stores it: raw JSON is kept as is, anything else is marshalled.
+func toPayload(payload interface{}) (datatypes.JSON, error) {
+	switch p := payload.(type) {
+	case datatypes.JSON:
+		return p, nil
+	case []byte:
+		return datatypes.JSON(p), nil
+	case nil:
+		return nil, errors.New("job payload is required")
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(raw), nil
+}
+
+const (
+	QueueBackendPostgres = "postgres"
+	QueueBackendRabbitMQ = "rabbitmq"
+	QueueBackendMemory   = "memory"
+)
+
+// NewQueue builds the backend selected by cfg.JobQueue.Backend, defaulting
+// to the Postgres jobs table.
+func NewQueue(cfg *config.Config, jobRepo repository.JobRepositoryInterface, listener repository.JobListenerInterface) (Queue, error) {
+	switch cfg.JobQueue.Backend {
+	case "", QueueBackendPostgres:
+		return NewPostgresQueue(jobRepo, listener), nil
+	case QueueBackendRabbitMQ:
+		return NewRabbitMQQueue(cfg.RabbitMQ, jobRepo), nil
+	case QueueBackendMemory:
+		return NewMemoryQueue(), nil
+	}
+	return nil, fmt.Errorf("unknown job queue backend %q", cfg.JobQueue.Backend)
+}
@@ -0,0 +1,284 @@
+package async
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+	"tofash/internal/shared/metrics"
+	"tofash/internal/shared/uow"
+
+	"gorm.io/datatypes"
+)
+
+// MemoryQueue keeps jobs in process memory. It implements the same
+// semantics as the Postgres backend (leases, retries, dedup keys) and is
+// meant for tests and local runs; jobs are lost on restart.
+type MemoryQueue struct {
+	mu        sync.Mutex
+	nextID    uint
+	jobs      map[uint]*model.Job
+	dedup     map[string]uint
+	listeners map[int]func(topic string)
+	nextSub   int
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		// Job IDs start from the boot time so a restart does not hand out
+		// IDs that handlers have already recorded.
+		nextID:    uint(time.Now().UnixNano()),
+		jobs:      make(map[uint]*model.Job),
+		dedup:     make(map[string]uint),
+		listeners: make(map[int]func(topic string)),
+	}
+}
+
+// Jobs returns a copy of every job of topic, oldest first.
+func (q *MemoryQueue) Jobs(topic string) []model.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []model.Job
+	for _, job := range q.jobs {
+		if job.Topic == topic {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// Enqueue inside a unit of work adds the job once the transaction commits
+// and drops it on rollback, as the Postgres backend would.
+func (q *MemoryQueue) Enqueue(ctx context.Context, topic string, payload interface{}, opts ...EnqueueOption) error {
+	options := newEnqueueOptions(opts)
+
+	data, err := toPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	uow.AfterCommit(ctx, func() { q.add(topic, data, options) })
+	return nil
+}
+
+func (q *MemoryQueue) add(topic string, data datatypes.JSON, options enqueueOptions) {
+	q.mu.Lock()
+	now := time.Now()
+	if options.dedupKey != "" {
+		window := options.dedupWindow
+		if window <= 0 {
+			window = model.DefaultDedupWindow
+		}
+		if id, ok := q.dedup[options.dedupKey]; ok && q.jobs[id].CreatedAt.After(now.Add(-window)) {
+			q.mu.Unlock()
+			return
+		}
+	}
+
+	q.nextID++
+	job := &model.Job{
+		ID:          q.nextID,
+		Topic:       topic,
+		Payload:     data,
+		Status:      model.JobStatusPending,
+		MaxAttempts: model.DefaultJobMaxAttempts,
+		RunAt:       options.runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if options.dedupKey != "" {
+		key := options.dedupKey
+		job.DedupKey = &key
+		q.dedup[key] = job.ID
+	}
+	q.jobs[job.ID] = job
+	metrics.JobsEnqueued.WithLabelValues(topic).Inc()
+
+	var listeners []func(string)
+	if !job.RunAt.After(now) {
+		for _, l := range q.listeners {
+			listeners = append(listeners, l)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, l := range listeners {
+		l(topic)
+	}
+}
+
+func (q *MemoryQueue) Claim(_ context.Context, workerID, topic string, limit int, lease time.Duration) ([]model.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var runnable []*model.Job
+	for _, job := range q.jobs {
+		if job.Topic == topic && job.Status == model.JobStatusPending && !job.RunAt.After(now) {
+			runnable = append(runnable, job)
+		}
+	}
+	sort.Slice(runnable, func(i, j int) bool {
+		if !runnable[i].RunAt.Equal(runnable[j].RunAt) {
+			return runnable[i].RunAt.Before(runnable[j].RunAt)
+		}
+		return runnable[i].ID < runnable[j].ID
+	})
+	if len(runnable) > limit {
+		runnable = runnable[:limit]
+	}
+
+	claimed := make([]model.Job, 0, len(runnable))
+	for _, job := range runnable {
+		expires := now.Add(lease)
+		job.Status = model.JobStatusProcessing
+		job.LockedBy = workerID
+		job.LeaseExpiresAt = &expires
+		job.UpdatedAt = now
+		claimed = append(claimed, *job)
+	}
+	return claimed, nil
+}
+
+func (q *MemoryQueue) Extend(_ context.Context, job model.Job, workerID string, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stored, ok := q.jobs[job.ID]
+	if !ok || stored.Status != model.JobStatusProcessing || stored.LockedBy != workerID {
+		return ErrLeaseLost
+	}
+	expires := time.Now().Add(lease)
+	stored.LeaseExpiresAt = &expires
+	return nil
+}
+
+func (q *MemoryQueue) Complete(_ context.Context, job model.Job) error {
+	return q.settle(job, func(stored *model.Job) {
+		stored.Status = model.JobStatusCompleted
+	})
+}
+
+func (q *MemoryQueue) Retry(_ context.Context, job model.Job, errMsg string) error {
+	return q.settle(job, func(stored *model.Job) {
+		stored.Attempts = job.Attempts + 1
+		stored.ErrorMessage = errMsg
+		if stored.Attempts >= stored.MaxAttempts {
+			stored.Status = model.JobStatusDead
+			return
+		}
+		stored.Status = model.JobStatusPending
+		stored.RunAt = time.Now().Add(repository.RetryBackoff(stored.Attempts))
+	})
+}
+
+func (q *MemoryQueue) Kill(_ context.Context, job model.Job, errMsg string) error {
+	return q.settle(job, func(stored *model.Job) {
+		stored.Status = model.JobStatusDead
+		stored.ErrorMessage = errMsg
+	})
+}
+
+// settle applies a claimed job's outcome, as long as job.LockedBy still
+// holds its lease.
+func (q *MemoryQueue) settle(job model.Job, apply func(stored *model.Job)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stored, ok := q.jobs[job.ID]
+	if !ok || stored.Status != model.JobStatusProcessing || stored.LockedBy != job.LockedBy {
+		return ErrLeaseLost
+	}
+	apply(stored)
+	stored.LockedBy = ""
+	stored.LeaseExpiresAt = nil
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (q *MemoryQueue) Sweep(_ context.Context, knownTopics []string, unknownBefore time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	known := make(map[string]bool, len(knownTopics))
+	for _, topic := range knownTopics {
+		known[topic] = true
+	}
+
+	now := time.Now()
+	for _, job := range q.jobs {
+		switch {
+		case job.Status == model.JobStatusProcessing && job.LeaseExpiresAt != nil && job.LeaseExpiresAt.Before(now):
+			// The lost run counts as an attempt, as in the Postgres backend.
+			job.Attempts++
+			job.Status = model.JobStatusPending
+			if job.Attempts >= job.MaxAttempts {
+				job.Status = model.JobStatusDead
+			}
+			job.ErrorMessage = "lease expired before the job finished"
+			job.LockedBy = ""
+			job.LeaseExpiresAt = nil
+			job.UpdatedAt = now
+		case len(known) > 0 && job.Status == model.JobStatusPending && !known[job.Topic] && job.RunAt.Before(unknownBefore):
+			job.Status = model.JobStatusDead
+			job.ErrorMessage = "no handler registered for topic " + job.Topic
+		}
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Stats(_ context.Context) ([]model.JobQueueStats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	type key struct{ topic, status string }
+	byKey := make(map[key]*model.JobQueueStats)
+	now := time.Now()
+	for _, job := range q.jobs {
+		if job.Status != model.JobStatusPending && job.Status != model.JobStatusProcessing {
+			continue
+		}
+		k := key{job.Topic, job.Status}
+		s, ok := byKey[k]
+		if !ok {
+			s = &model.JobQueueStats{Topic: job.Topic, Status: job.Status}
+			byKey[k] = s
+		}
+		s.Count++
+		if job.Status == model.JobStatusPending && !job.RunAt.After(now) && (s.OldestRunAt == nil || job.RunAt.Before(*s.OldestRunAt)) {
+			runAt := job.RunAt
+			s.OldestRunAt = &runAt
+		}
+	}
+
+	stats := make([]model.JobQueueStats, 0, len(byKey))
+	for _, s := range byKey {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Topic != stats[j].Topic {
+			return stats[i].Topic < stats[j].Topic
+		}
+		return stats[i].Status < stats[j].Status
+	})
+	return stats, nil
+}
+
+func (q *MemoryQueue) Listen(ctx context.Context, onReady func(topic string)) {
+	q.mu.Lock()
+	q.nextSub++
+	id := q.nextSub
+	q.listeners[id] = onReady
+	q.mu.Unlock()
+
+	<-ctx.Done()
+
+	q.mu.Lock()
+	delete(q.listeners, id)
+	q.mu.Unlock()
+}
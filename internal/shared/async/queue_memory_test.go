@@ -0,0 +1,151 @@
+package async
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tofash/internal/modules/system/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestMemoryQueue_ClaimRespectsRunAtAndLeases(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	require.NoError(t, q.Enqueue(ctx, "mail", map[string]string{"to": "a"}))
+	require.NoError(t, q.Enqueue(ctx, "mail", map[string]string{"to": "b"}, WithDelay(time.Hour)))
+
+	jobs, err := q.Claim(ctx, "w1", "mail", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.JSONEq(t, `{"to":"a"}`, string(jobs[0].Payload))
+
+	// A claimed job is not handed out again, and only its owner may extend it.
+	again, err := q.Claim(ctx, "w2", "mail", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+	assert.NoError(t, q.Extend(ctx, jobs[0], "w1", time.Minute))
+	assert.ErrorIs(t, q.Extend(ctx, jobs[0], "w2", time.Minute), ErrLeaseLost)
+}
+
+func TestMemoryQueue_DedupKey(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+
+	require.NoError(t, q.Enqueue(ctx, "stock", datatypes.JSON(`{}`), WithDedupKey("order:1", 0)))
+	require.NoError(t, q.Enqueue(ctx, "stock", datatypes.JSON(`{}`), WithDedupKey("order:1", 0)))
+	require.NoError(t, q.Enqueue(ctx, "stock", datatypes.JSON(`{}`), WithDedupKey("order:2", 0)))
+
+	assert.Len(t, q.Jobs("stock"), 2)
+}
+
+func TestMemoryQueue_RetryUntilDead(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	require.NoError(t, q.Enqueue(ctx, "flaky", datatypes.JSON(`{}`)))
+	require.NoError(t, q.Enqueue(ctx, "flaky", datatypes.JSON(`{}`)))
+
+	jobs, err := q.Claim(ctx, "w1", "flaky", 2, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	require.NoError(t, q.Retry(ctx, jobs[0], "boom"))
+	stored := q.Jobs("flaky")[0]
+	assert.Equal(t, model.JobStatusPending, stored.Status)
+	assert.True(t, stored.RunAt.After(time.Now()))
+
+	last := jobs[1]
+	last.Attempts = last.MaxAttempts - 1
+	require.NoError(t, q.Retry(ctx, last, "boom"))
+	assert.Equal(t, model.JobStatusDead, q.Jobs("flaky")[1].Status)
+}
+
+func TestMemoryQueue_SettlingAReapedJobIsLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	require.NoError(t, q.Enqueue(ctx, "slow", datatypes.JSON(`{}`)))
+
+	stale, err := q.Claim(ctx, "w1", "slow", 1, -time.Second)
+	require.NoError(t, err)
+	require.NoError(t, q.Sweep(ctx, []string{"slow"}, time.Now()))
+	fresh, err := q.Claim(ctx, "w2", "slow", 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, fresh, 1)
+
+	// The first worker finishing late must not overwrite the second's run.
+	before := q.Jobs("slow")[0]
+	assert.ErrorIs(t, q.Complete(ctx, stale[0]), ErrLeaseLost)
+	assert.ErrorIs(t, q.Retry(ctx, stale[0], "late"), ErrLeaseLost)
+	assert.ErrorIs(t, q.Kill(ctx, stale[0], "late"), ErrLeaseLost)
+	stored := q.Jobs("slow")[0]
+	assert.Equal(t, model.JobStatusProcessing, stored.Status)
+	assert.Equal(t, "w2", stored.LockedBy)
+	assert.Equal(t, before.Attempts, stored.Attempts)
+	assert.Equal(t, before.ErrorMessage, stored.ErrorMessage)
+
+	require.NoError(t, q.Complete(ctx, fresh[0]))
+	assert.Equal(t, model.JobStatusCompleted, q.Jobs("slow")[0].Status)
+	assert.ErrorIs(t, q.Complete(ctx, fresh[0]), ErrLeaseLost)
+}
+
+func TestMemoryQueue_SweepReleasesExpiredLeasesAndUnknownTopics(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	require.NoError(t, q.Enqueue(ctx, "known", datatypes.JSON(`{}`)))
+	require.NoError(t, q.Enqueue(ctx, "orphan", datatypes.JSON(`{}`)))
+
+	_, err := q.Claim(ctx, "w1", "known", 1, -time.Second)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Sweep(ctx, []string{"known"}, time.Now().Add(time.Second)))
+	assert.Equal(t, model.JobStatusPending, q.Jobs("known")[0].Status)
+	assert.Equal(t, 1, q.Jobs("known")[0].Attempts)
+	assert.Equal(t, model.JobStatusDead, q.Jobs("orphan")[0].Status)
+}
+
+func TestMemoryQueue_ExpiredLeasesRunOutOfAttempts(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	require.NoError(t, q.Enqueue(ctx, "crashy", datatypes.JSON(`{}`)))
+
+	for i := 0; i < model.DefaultJobMaxAttempts; i++ {
+		jobs, err := q.Claim(ctx, "w1", "crashy", 1, -time.Second)
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		require.NoError(t, q.Sweep(ctx, nil, time.Now()))
+	}
+	assert.Equal(t, model.JobStatusDead, q.Jobs("crashy")[0].Status)
+}
+
+func TestWorker_RunsJobsFromMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	w := NewWorker(q).(*worker)
+
+	done := make(chan string, 1)
+	w.Register("greet", Typed(func(_ context.Context, _ uint, p testPayload) error {
+		done <- p.Value
+		return nil
+	}))
+	go w.Run()
+	defer func() { _ = w.Shutdown(ctx) }()
+
+	// The listener is registered asynchronously; keep enqueueing until the
+	// worker picks one up through the notification path.
+	deadline := time.After(2 * time.Second)
+	require.NoError(t, q.Enqueue(ctx, "greet", testPayload{Value: "hi"}))
+	for {
+		select {
+		case got := <-done:
+			assert.Equal(t, "hi", got)
+			return
+		case <-deadline:
+			t.Fatal("job was not processed")
+		case <-time.After(50 * time.Millisecond):
+			w.notify()
+		}
+	}
+}
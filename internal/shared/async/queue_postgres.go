@@ -0,0 +1,99 @@
+package async
+
+import (
+	"context"
+	"time"
+
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+
+	"github.com/labstack/gommon/log"
+)
+
+// postgresQueue keeps jobs in the jobs table. Enqueue joins the caller's
+// unit of work, so jobs commit or roll back with the business write.
+type postgresQueue struct {
+	jobRepo repository.JobRepositoryInterface
+}
+
+// listeningPostgresQueue adds LISTEN/NOTIFY wake-ups to postgresQueue.
+type listeningPostgresQueue struct {
+	*postgresQueue
+	listener repository.JobListenerInterface
+}
+
+// NewPostgresQueue is the default backend. With a listener the worker is
+// woken through LISTEN/NOTIFY; without one it relies on polling.
+func NewPostgresQueue(jobRepo repository.JobRepositoryInterface, listener repository.JobListenerInterface) Queue {
+	q := &postgresQueue{jobRepo: jobRepo}
+	if listener == nil {
+		return q
+	}
+	return &listeningPostgresQueue{postgresQueue: q, listener: listener}
+}
+
+func (q *listeningPostgresQueue) Listen(ctx context.Context, onReady func(topic string)) {
+	q.listener.Listen(ctx, onReady)
+}
+
+func (q *postgresQueue) Enqueue(ctx context.Context, topic string, payload interface{}, opts ...EnqueueOption) error {
+	options := newEnqueueOptions(opts)
+
+	var jobOpts []repository.JobOption
+	if options.dedupKey != "" {
+		jobOpts = append(jobOpts, repository.WithDedupKey(options.dedupKey, options.dedupWindow))
+	}
+
+	_, err := q.jobRepo.CreateJobAt(ctx, topic, payload, options.runAt, jobOpts...)
+	return err
+}
+
+func (q *postgresQueue) Claim(ctx context.Context, workerID, topic string, limit int, lease time.Duration) ([]model.Job, error) {
+	return q.jobRepo.ClaimJobs(ctx, workerID, topic, limit, lease)
+}
+
+func (q *postgresQueue) Extend(ctx context.Context, job model.Job, workerID string, lease time.Duration) error {
+	return q.jobRepo.ExtendLease(ctx, job.ID, workerID, lease)
+}
+
+func (q *postgresQueue) Complete(ctx context.Context, job model.Job) error {
+	return q.jobRepo.UpdateJobStatus(ctx, job.ID, job.LockedBy, model.JobStatusCompleted, "")
+}
+
+func (q *postgresQueue) Retry(ctx context.Context, job model.Job, errMsg string) error {
+	return q.jobRepo.RetryJob(ctx, job, errMsg)
+}
+
+func (q *postgresQueue) Kill(ctx context.Context, job model.Job, errMsg string) error {
+	return q.jobRepo.UpdateJobStatus(ctx, job.ID, job.LockedBy, model.JobStatusDead, errMsg)
+}
+
+func (q *postgresQueue) Stats(ctx context.Context) ([]model.JobQueueStats, error) {
+	return q.jobRepo.QueueStats(ctx)
+}
+
+// Sweep returns expired leases to pending and dead-letters unknown topics.
+// Only jobs runnable before unknownBefore are dead-lettered, so a replica
+// running an older build doesn't kill topics a newer replica handles.
+func (q *postgresQueue) Sweep(ctx context.Context, knownTopics []string, unknownBefore time.Time) error {
+	released, err := q.jobRepo.ReleaseExpiredLeases(ctx)
+	if err != nil {
+		return err
+	}
+	if released > 0 {
+		log.Warnf("[PostgresQueue] Released %d job(s) with expired leases", released)
+	}
+
+	if len(knownTopics) == 0 {
+		return nil
+	}
+
+	moved, err := q.jobRepo.DeadLetterUnknownTopics(ctx, knownTopics, unknownBefore)
+	if err != nil {
+		return err
+	}
+	if moved > 0 {
+		log.Warnf("[PostgresQueue] Moved %d job(s) with unregistered topics to dead", moved)
+	}
+	return nil
+}
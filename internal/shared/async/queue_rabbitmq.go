@@ -0,0 +1,477 @@
+package async
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"tofash/internal/config"
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+	"tofash/internal/shared/metrics"
+	"tofash/internal/shared/uow"
+
+	"github.com/labstack/gommon/log"
+	"github.com/streadway/amqp"
+	"gorm.io/datatypes"
+)
+
+const (
+	headerJobID       = "x-job-id"
+	headerAttempts    = "x-attempts"
+	headerMaxAttempts = "x-max-attempts"
+	headerRunAt       = "x-run-at"
+	headerError       = "x-error"
+
+	// maxDelayTier caps the delay queues at about 18 hours; longer delays
+	// hop through it more than once.
+	maxDelayTier = 1 << 16 * time.Second
+
+	// outboxBatchSize and outboxLease bound one relay claim on the outbox.
+	outboxBatchSize = 100
+	outboxLease     = time.Minute
+)
+
+// rabbitMQQueue keeps each topic in a durable queue of the same name. Dead
+// jobs go to "<topic>.dead". Delayed jobs and retries wait in
+// "<topic>.delay.<n>s" queues whose messages expire back into the topic
+// queue; delays are rounded down to a power of two seconds and re-delayed
+// on claim until they are due, so one slow tier never blocks a faster one.
+//
+// The broker can't join a database transaction, so Enqueue inside a unit
+// of work writes the job to the Postgres jobs table instead, as an outbox
+// row committed with the caller's writes. After the commit the row is
+// claimed, published and marked completed; rows left behind by a failed
+// publish or a crash are relayed by Sweep. A crash between publish and
+// completion publishes the job twice, so handlers must stay idempotent.
+//
+// Compared with the Postgres backend:
+//   - Dedup keys only apply inside a unit of work, where they are checked
+//     against the outbox.
+//   - Delayed jobs enqueued inside a unit of work wait in the outbox and
+//     are published by the first Sweep after they are due.
+//   - A claim lasts as long as the connection: the broker redelivers
+//     unacknowledged jobs when it drops, and jobs of unknown topics simply
+//     wait in their queue.
+//   - It does not report queue depth; use the broker's own metrics.
+type rabbitMQQueue struct {
+	cfg      config.RabbitMQ
+	outbox   repository.JobRepositoryInterface
+	relayID  string
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	chClosed chan *amqp.Error
+	gen      int
+	declared map[string]bool
+	inFlight map[uint]rabbitDelivery
+}
+
+type rabbitDelivery struct {
+	delivery amqp.Delivery
+	gen      int
+}
+
+// NewRabbitMQQueue connects lazily, on first use, through config.NewRabbitMQ
+// and reconnects after the connection or channel is lost. outbox holds the
+// jobs enqueued inside a unit of work until they are published.
+func NewRabbitMQQueue(cfg config.RabbitMQ, outbox repository.JobRepositoryInterface) Queue {
+	return &rabbitMQQueue{
+		cfg:      cfg,
+		outbox:   outbox,
+		relayID:  "outbox-" + newWorkerID(),
+		declared: make(map[string]bool),
+		inFlight: make(map[uint]rabbitDelivery),
+	}
+}
+
+// channel returns the open channel, reconnecting if needed. Callers hold mu.
+func (q *rabbitMQQueue) channel() (*amqp.Channel, error) {
+	if q.ch != nil && !q.conn.IsClosed() {
+		select {
+		case <-q.chClosed:
+		default:
+			return q.ch, nil
+		}
+	}
+	q.reset()
+
+	conn, err := config.NewRabbitMQ(q.cfg)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	q.conn = conn
+	q.ch = ch
+	q.chClosed = ch.NotifyClose(make(chan *amqp.Error, 1))
+	q.gen++
+	q.declared = make(map[string]bool)
+	return ch, nil
+}
+
+// reset drops the current connection. Deliveries received on it become
+// unsettleable and will be redelivered by the broker.
+func (q *rabbitMQQueue) reset() {
+	if q.ch != nil {
+		_ = q.ch.Close()
+	}
+	if q.conn != nil {
+		_ = q.conn.Close()
+	}
+	q.conn, q.ch = nil, nil
+}
+
+func (q *rabbitMQQueue) declare(ch *amqp.Channel, name string, args amqp.Table) error {
+	if q.declared[name] {
+		return nil
+	}
+	if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		q.reset()
+		return err
+	}
+	q.declared[name] = true
+	return nil
+}
+
+func (q *rabbitMQQueue) Enqueue(ctx context.Context, topic string, payload interface{}, opts ...EnqueueOption) error {
+	options := newEnqueueOptions(opts)
+
+	if uow.InTransaction(ctx) {
+		return q.enqueueOutbox(ctx, topic, payload, options)
+	}
+
+	data, err := toPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers: amqp.Table{
+			headerJobID:       rand.Int63n(math.MaxInt64-1) + 1,
+			headerAttempts:    int64(0),
+			headerMaxAttempts: int64(model.DefaultJobMaxAttempts),
+			headerRunAt:       options.runAt.UnixMilli(),
+		},
+		Body: data,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.publish(topic, msg, time.Until(options.runAt)); err != nil {
+		log.Errorf("[RabbitMQQueue] Failed to publish %s job: %v", topic, err)
+		return err
+	}
+	metrics.JobsEnqueued.WithLabelValues(topic).Inc()
+	return nil
+}
+
+// enqueueOutbox writes the job to the outbox in the caller's transaction
+// and relays it once that commits.
+func (q *rabbitMQQueue) enqueueOutbox(ctx context.Context, topic string, payload interface{}, options enqueueOptions) error {
+	var jobOpts []repository.JobOption
+	if options.dedupKey != "" {
+		jobOpts = append(jobOpts, repository.WithDedupKey(options.dedupKey, options.dedupWindow))
+	}
+	if _, err := q.outbox.CreateJobAt(ctx, topic, payload, options.runAt, jobOpts...); err != nil {
+		return err
+	}
+
+	uow.AfterCommit(ctx, func() {
+		if err := q.relayOutbox(context.Background(), topic); err != nil {
+			log.Errorf("[RabbitMQQueue] Failed to relay %s jobs: %v", topic, err)
+		}
+	})
+	return nil
+}
+
+// relayOutbox publishes the due outbox jobs of topic. Claiming first means
+// two replicas relaying at once never publish the same row. A job whose
+// publish fails is retried with backoff, like a failed run.
+func (q *rabbitMQQueue) relayOutbox(ctx context.Context, topic string) error {
+	for {
+		jobs, err := q.outbox.ClaimJobs(ctx, q.relayID, topic, outboxBatchSize, outboxLease)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			msg := amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Headers: amqp.Table{
+					headerJobID:       int64(job.ID),
+					headerAttempts:    int64(0),
+					headerMaxAttempts: int64(job.MaxAttempts),
+					headerRunAt:       job.RunAt.UnixMilli(),
+				},
+				Body: job.Payload,
+			}
+
+			q.mu.Lock()
+			err := q.publish(topic, msg, 0)
+			q.mu.Unlock()
+			if err != nil {
+				if retryErr := q.outbox.RetryJob(ctx, job, err.Error()); retryErr != nil {
+					log.Errorf("[RabbitMQQueue] Failed to reschedule outbox job %d: %v", job.ID, retryErr)
+				}
+				return err
+			}
+			metrics.JobsEnqueued.WithLabelValues(topic).Inc()
+
+			if err := q.outbox.UpdateJobStatus(ctx, job.ID, q.relayID, model.JobStatusCompleted, ""); err != nil {
+				log.Errorf("[RabbitMQQueue] Failed to complete outbox job %d: %v", job.ID, err)
+			}
+		}
+
+		if len(jobs) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+// publish sends msg to the topic queue, or to a delay queue when delay is
+// positive. Callers hold mu.
+func (q *rabbitMQQueue) publish(topic string, msg amqp.Publishing, delay time.Duration) error {
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+	if err := q.declare(ch, topic, nil); err != nil {
+		return err
+	}
+
+	target := topic
+	if delay >= time.Second {
+		tier := delayTier(delay)
+		target = fmt.Sprintf("%s.delay.%ds", topic, int64(tier/time.Second))
+		err := q.declare(ch, target, amqp.Table{
+			"x-message-ttl":             tier.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": topic,
+			// Idle delay queues clean themselves up.
+			"x-expires": (tier + time.Hour).Milliseconds(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ch.Publish("", target, false, false, msg); err != nil {
+		q.reset()
+		return err
+	}
+	return nil
+}
+
+// delayTier rounds d down to a power of two seconds, capped at maxDelayTier.
+func delayTier(d time.Duration) time.Duration {
+	tier := time.Second
+	for tier*2 <= d && tier < maxDelayTier {
+		tier *= 2
+	}
+	return tier
+}
+
+func (q *rabbitMQQueue) Claim(_ context.Context, _ string, topic string, limit int, _ time.Duration) ([]model.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch, err := q.channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.declare(ch, topic, nil); err != nil {
+		return nil, err
+	}
+
+	var jobs []model.Job
+	for len(jobs) < limit {
+		delivery, ok, err := ch.Get(topic, false)
+		if err != nil {
+			q.reset()
+			return jobs, err
+		}
+		if !ok {
+			break
+		}
+
+		runAt := time.UnixMilli(headerInt(delivery.Headers, headerRunAt))
+		if wait := time.Until(runAt); wait >= time.Second {
+			if err := q.requeue(topic, delivery, delivery.Headers, wait); err != nil {
+				return jobs, err
+			}
+			continue
+		}
+
+		job := model.Job{
+			ID:          uint(headerInt(delivery.Headers, headerJobID)),
+			Topic:       topic,
+			Payload:     datatypes.JSON(delivery.Body),
+			Status:      model.JobStatusProcessing,
+			Attempts:    int(headerInt(delivery.Headers, headerAttempts)),
+			MaxAttempts: int(headerInt(delivery.Headers, headerMaxAttempts)),
+			RunAt:       runAt,
+		}
+		if job.MaxAttempts <= 0 {
+			job.MaxAttempts = model.DefaultJobMaxAttempts
+		}
+		q.inFlight[job.ID] = rabbitDelivery{delivery: delivery, gen: q.gen}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// requeue republishes a delivery with new headers and acknowledges the
+// original. Callers hold mu.
+func (q *rabbitMQQueue) requeue(target string, delivery amqp.Delivery, headers amqp.Table, delay time.Duration) error {
+	msg := amqp.Publishing{
+		ContentType:  delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         delivery.Body,
+	}
+	if err := q.publish(target, msg, delay); err != nil {
+		return err
+	}
+	return delivery.Ack(false)
+}
+
+// Extend has nothing to renew: a claim lasts until the connection drops,
+// at which point the broker redelivers the job and the lease is lost.
+func (q *rabbitMQQueue) Extend(_ context.Context, job model.Job, _ string, _ time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held, ok := q.inFlight[job.ID]
+	if !ok || held.gen != q.gen || q.ch == nil || q.conn.IsClosed() {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *rabbitMQQueue) Complete(_ context.Context, job model.Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held, ok := q.take(job.ID)
+	if !ok {
+		return ErrLeaseLost
+	}
+	return held.delivery.Ack(false)
+}
+
+func (q *rabbitMQQueue) Retry(ctx context.Context, job model.Job, errMsg string) error {
+	attempts := job.Attempts + 1
+	if attempts >= job.MaxAttempts {
+		return q.Kill(ctx, job, errMsg)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held, ok := q.take(job.ID)
+	if !ok {
+		return ErrLeaseLost
+	}
+
+	delay := repository.RetryBackoff(attempts)
+	headers := copyHeaders(held.delivery.Headers)
+	headers[headerAttempts] = int64(attempts)
+	headers[headerRunAt] = time.Now().Add(delay).UnixMilli()
+	headers[headerError] = errMsg
+	return q.requeue(job.Topic, held.delivery, headers, delay)
+}
+
+func (q *rabbitMQQueue) Kill(_ context.Context, job model.Job, errMsg string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held, ok := q.take(job.ID)
+	if !ok {
+		return ErrLeaseLost
+	}
+
+	ch, err := q.channel()
+	if err != nil {
+		return err
+	}
+	dead := job.Topic + ".dead"
+	if err := q.declare(ch, dead, nil); err != nil {
+		return err
+	}
+
+	headers := copyHeaders(held.delivery.Headers)
+	headers[headerAttempts] = int64(job.Attempts + 1)
+	headers[headerError] = errMsg
+	msg := amqp.Publishing{
+		ContentType:  held.delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         held.delivery.Body,
+	}
+	if err := ch.Publish("", dead, false, false, msg); err != nil {
+		q.reset()
+		return err
+	}
+	return held.delivery.Ack(false)
+}
+
+// take removes a job from the in-flight set if it was received on the
+// current connection. Callers hold mu.
+func (q *rabbitMQQueue) take(jobID uint) (rabbitDelivery, bool) {
+	held, ok := q.inFlight[jobID]
+	delete(q.inFlight, jobID)
+	return held, ok && held.gen == q.gen
+}
+
+// Sweep relays outbox jobs that are due or whose earlier relay failed.
+// Outbox rows of topics outside knownTopics are left for a replica that
+// handles them.
+func (q *rabbitMQQueue) Sweep(ctx context.Context, knownTopics []string, _ time.Time) error {
+	if _, err := q.outbox.ReleaseExpiredLeases(ctx); err != nil {
+		return err
+	}
+	for _, topic := range knownTopics {
+		if err := q.relayOutbox(ctx, topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyHeaders(h amqp.Table) amqp.Table {
+	out := make(amqp.Table, len(h)+1)
+	for k, v := range h {
+		out[k] = v
+	}
+	return out
+}
+
+func headerInt(h amqp.Table, key string) int64 {
+	switch v := h[key].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package async
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"tofash/internal/modules/system/repository"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Cron is the part of the scheduler that modules use to declare recurring
+// jobs at wiring time.
+type Cron interface {
+	// Schedule enqueues a job on topic with payload every time spec
+	// matches. Each topic can be scheduled once.
+	Schedule(spec, topic string, payload interface{}) error
+}
+
+type SchedulerInterface interface {
+	Cron
+	// Run schedules jobs whenever this replica holds the scheduler lock,
+	// until Shutdown is called.
+	Run()
+	// Shutdown stops scheduling and waits for Run to return or ctx to
+	// expire.
+	Shutdown(ctx context.Context) error
+}
+
+type cronEntry struct {
+	spec     string
+	topic    string
+	payload  interface{}
+	schedule *cronSchedule
+	next     time.Time
+}
+
+type scheduler struct {
+	queue    Enqueuer
+	lock     repository.LeaderLockInterface
+	mu       sync.Mutex
+	entries  []*cronEntry
+	tick     time.Duration
+	now      func() time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	runOnce  sync.Once
+	stopOnce sync.Once
+}
+
+// NewScheduler builds the cron scheduler. Jobs go onto the regular job
+// queue and are processed by the worker like any other job; lock makes sure
+// only one replica enqueues them.
+func NewScheduler(queue Enqueuer, lock repository.LeaderLockInterface) SchedulerInterface {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		queue:   queue,
+		lock:    lock,
+		tick:    5 * time.Second,
+		now:     time.Now,
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+}
+
+func (s *scheduler) Schedule(spec, topic string, payload interface{}) error {
+	schedule, err := parseCron(spec)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.topic == topic {
+			return fmt.Errorf("topic %s is already scheduled", topic)
+		}
+	}
+	s.entries = append(s.entries, &cronEntry{spec: spec, topic: topic, payload: payload, schedule: schedule})
+	return nil
+}
+
+func (s *scheduler) Run() {
+	s.runOnce.Do(func() {
+		defer close(s.stopped)
+		log.Info("[Scheduler] Waiting for scheduler lock...")
+		s.lock.Lead(s.ctx, s.lead)
+	})
+}
+
+func (s *scheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(s.cancel)
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lead runs while this replica is the leader. Runs missed while nobody was
+// leading are skipped rather than replayed.
+func (s *scheduler) lead(ctx context.Context) {
+	log.Info("[Scheduler] Became leader, scheduling recurring jobs")
+	s.resetNext(s.now())
+
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("[Scheduler] No longer leader")
+			return
+		case <-ticker.C:
+			s.enqueueDue(ctx, s.now())
+		}
+	}
+}
+
+func (s *scheduler) resetNext(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		entry.next = entry.schedule.next(now)
+	}
+}
+
+// enqueueDue enqueues every entry whose next run is due. The dedup key ties
+// each job to its scheduled minute, so a leader change mid-minute can't
+// enqueue the same run twice.
+func (s *scheduler) enqueueDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.next.IsZero() || now.Before(entry.next) {
+			continue
+		}
+
+		dedupKey := fmt.Sprintf("cron:%s:%d", entry.topic, entry.next.Unix())
+		if err := s.queue.Enqueue(ctx, entry.topic, entry.payload, WithDedupKey(dedupKey, 0)); err != nil {
+			log.Errorf("[Scheduler] Failed to enqueue %s (%s): %v", entry.topic, entry.spec, err)
+			continue
+		}
+		entry.next = entry.schedule.next(now)
+	}
+}
@@ -0,0 +1,47 @@
+package async
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCronQueue struct {
+	enqueued []string
+}
+
+func (f *fakeCronQueue) Enqueue(_ context.Context, topic string, _ interface{}, _ ...EnqueueOption) error {
+	f.enqueued = append(f.enqueued, topic)
+	return nil
+}
+
+func TestScheduler_RejectsDuplicateTopicsAndBadSpecs(t *testing.T) {
+	s := NewScheduler(&fakeCronQueue{}, nil)
+
+	require.NoError(t, s.Schedule("@daily", "cleanup", nil))
+	assert.Error(t, s.Schedule("@hourly", "cleanup", nil))
+	assert.Error(t, s.Schedule("not a spec", "other", nil))
+}
+
+func TestScheduler_EnqueuesDueEntriesOnce(t *testing.T) {
+	queue := &fakeCronQueue{}
+	s := NewScheduler(queue, nil).(*scheduler)
+	require.NoError(t, s.Schedule("0 * * * *", "hourly", nil))
+	require.NoError(t, s.Schedule("0 0 * * *", "daily", nil))
+
+	start := time.Date(2026, 3, 14, 10, 59, 30, 0, time.UTC)
+	s.resetNext(start)
+
+	s.enqueueDue(context.Background(), start)
+	assert.Empty(t, queue.enqueued)
+
+	s.enqueueDue(context.Background(), start.Add(time.Minute))
+	assert.Equal(t, []string{"hourly"}, queue.enqueued)
+
+	// Later ticks in the same hour don't enqueue it again.
+	s.enqueueDue(context.Background(), start.Add(2*time.Minute))
+	assert.Equal(t, []string{"hourly"}, queue.enqueued)
+}
@@ -2,181 +2,354 @@ package async
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"tofash/internal/modules/notification/entity"
-	notifService "tofash/internal/modules/notification/service"
-	productService "tofash/internal/modules/product/service"
-	"tofash/internal/modules/system/repository"
+	"tofash/internal/modules/system/model"
+	"tofash/internal/shared/metrics"
 
 	"github.com/labstack/gommon/log"
-	"gorm.io/datatypes"
 )
 
+// Registry is the part of the worker that modules use to plug in their
+// own job handlers at wiring time.
+type Registry interface {
+	Register(topic string, handler HandlerFunc, opts ...HandlerOption)
+}
+
 type WorkerInterface interface {
+	Registry
+	// Run claims and dispatches jobs until Shutdown is called.
 	Run()
-	Stop()
+	// Shutdown stops claiming new jobs and waits for in-flight jobs to
+	// finish. If ctx expires first, running handlers are cancelled and
+	// ctx.Err() is returned.
+	Shutdown(ctx context.Context) error
+}
+
+// HandlerOption tunes how the worker runs a topic's handler.
+type HandlerOption func(*topicPool)
+
+// WithConcurrency sets how many jobs of the topic may run at once. Topics
+// default to 1, which keeps handlers that read-modify-write shared rows
+// (such as stock updates) free of lost updates.
+func WithConcurrency(n int) HandlerOption {
+	return func(p *topicPool) {
+		if n > 0 {
+			p.concurrency = n
+		}
+	}
+}
+
+type topicPool struct {
+	topic       string
+	handler     HandlerFunc
+	concurrency int
+	slots       chan struct{}
 }
 
 type worker struct {
-	jobRepo      repository.JobRepositoryInterface
-	productSvc   productService.ProductServiceInterface
-	notifSvc     notifService.NotificationServiceInterface
-	stopChan     chan struct{}
-	pollInterval time.Duration
-}
-
-func NewWorker(
-	jobRepo repository.JobRepositoryInterface,
-	productSvc productService.ProductServiceInterface,
-	notifSvc notifService.NotificationServiceInterface,
-) WorkerInterface {
+	id             string
+	queue          Queue
+	wake           chan struct{}
+	pools          map[string]*topicPool
+	mu             sync.RWMutex
+	stopChan       chan struct{}
+	stopOnce       sync.Once
+	stopped        chan struct{}
+	running        atomic.Bool
+	inFlight       sync.WaitGroup
+	baseCtx        context.Context
+	cancelBase     context.CancelFunc
+	pollInterval   time.Duration
+	leaseDuration  time.Duration
+	reaperInterval time.Duration
+	unknownGrace   time.Duration
+}
+
+// NewWorker builds the job worker. If the queue is a Notifier the worker
+// wakes up as soon as a job is enqueued and only polls as a slow fallback
+// (for delayed jobs and missed notifications); otherwise it polls every 2
+// seconds.
+func NewWorker(queue Queue) WorkerInterface {
+	pollInterval := 2 * time.Second
+	if _, ok := queue.(Notifier); ok {
+		pollInterval = 15 * time.Second
+	}
+
+	baseCtx, cancel := context.WithCancel(context.Background())
 	return &worker{
-		jobRepo:      jobRepo,
-		productSvc:   productSvc,
-		notifSvc:     notifSvc,
-		stopChan:     make(chan struct{}),
-		pollInterval: 2 * time.Second,
+		id:             newWorkerID(),
+		queue:          queue,
+		wake:           make(chan struct{}, 1),
+		pools:          make(map[string]*topicPool),
+		stopChan:       make(chan struct{}),
+		stopped:        make(chan struct{}),
+		baseCtx:        baseCtx,
+		cancelBase:     cancel,
+		pollInterval:   pollInterval,
+		leaseDuration:  time.Minute,
+		reaperInterval: 30 * time.Second,
+		unknownGrace:   5 * time.Minute,
 	}
 }
 
+// newWorkerID identifies this process as a lease owner, e.g. "api-7f9c-4121"
+// (hostname and pid).
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Register binds a handler to a topic. Registering the same topic twice
+// replaces the previous handler.
+func (w *worker) Register(topic string, handler HandlerFunc, opts ...HandlerOption) {
+	pool := &topicPool{topic: topic, handler: handler, concurrency: 1}
+	for _, opt := range opts {
+		opt(pool)
+	}
+	pool.slots = make(chan struct{}, pool.concurrency)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, exists := w.pools[topic]; exists {
+		log.Warnf("[Worker] Handler for topic %s is being replaced", topic)
+	}
+	w.pools[topic] = pool
+}
+
+func (w *worker) pool(topic string) (*topicPool, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	p, ok := w.pools[topic]
+	return p, ok
+}
+
+func (w *worker) topics() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	topics := make([]string, 0, len(w.pools))
+	for topic := range w.pools {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
 func (w *worker) Run() {
-	log.Info("[Worker] Starting async worker...")
+	w.running.Store(true)
+	defer close(w.stopped)
+
+	log.Infof("[Worker] Starting async worker %s...", w.id)
 	ticker := time.NewTicker(w.pollInterval)
 	defer ticker.Stop()
+	reaper := time.NewTicker(w.reaperInterval)
+	defer reaper.Stop()
+
+	if notifier, ok := w.queue.(Notifier); ok {
+		listenCtx, stopListening := context.WithCancel(context.Background())
+		defer stopListening()
+		go notifier.Listen(listenCtx, func(string) { w.notify() })
+	}
 
 	for {
 		select {
 		case <-w.stopChan:
-			log.Info("[Worker] Stopping worker...")
+			log.Info("[Worker] Stopped claiming new jobs")
 			return
 		case <-ticker.C:
-			w.processJobs()
+			w.dispatch()
+		case <-w.wake:
+			w.dispatch()
+		case <-reaper.C:
+			w.sweep()
 		}
 	}
 }
 
-func (w *worker) Stop() {
-	close(w.stopChan)
+// notify asks the run loop to dispatch as soon as possible. Wake-ups that
+// arrive while one is already pending are coalesced.
+func (w *worker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
 }
 
-func (w *worker) processJobs() {
-	ctx := context.Background()
-	jobs, err := w.jobRepo.FetchPendingJobs(ctx, 10) // Process 10 jobs at a time
-	if err != nil {
-		log.Errorf("[Worker] Failed to fetch jobs: %v", err)
-		return
-	}
+func (w *worker) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stopChan) })
 
-	for _, job := range jobs {
-		log.Infof("[Worker] Processing job ID: %d, Topic: %s", job.ID, job.Topic)
+	drained := make(chan struct{})
+	go func() {
+		// Wait for the run loop to exit so no new job is dispatched while
+		// we wait on the in-flight ones.
+		if w.running.Load() {
+			<-w.stopped
+		}
+		w.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Info("[Worker] All in-flight jobs finished")
+		w.cancelBase()
+		return nil
+	case <-ctx.Done():
+		log.Warnf("[Worker] Shutdown deadline reached, cancelling in-flight jobs")
+		w.cancelBase()
+		return ctx.Err()
+	}
+}
 
-		// Mark as processing (optional, depends on simple or complex logic)
-		// For now we just process and mark completed/failed.
+// dispatch claims jobs for every registered topic that has free slots and
+// runs each one on its own goroutine.
+func (w *worker) dispatch() {
+	ctx := context.Background()
 
-		var processErr error
+	for _, topic := range w.topics() {
+		pool, ok := w.pool(topic)
+		if !ok {
+			continue
+		}
 
-		switch job.Topic {
-		case "stock_update":
-			processErr = w.handleStockUpdate(ctx, job.Payload)
-		case "email_notification":
-			processErr = w.handleEmailNotification(ctx, job.Payload)
-		default:
-			log.Warnf("[Worker] Unknown topic: %s", job.Topic)
+		free := cap(pool.slots) - len(pool.slots)
+		if free <= 0 {
+			continue
 		}
 
-		status := "completed"
-		errMsg := ""
-		if processErr != nil {
-			status = "failed"
-			errMsg = processErr.Error()
-			log.Errorf("[Worker] Job %d failed: %v", job.ID, processErr)
-		} else {
-			log.Infof("[Worker] Job %d completed successfully", job.ID)
+		jobs, err := w.queue.Claim(ctx, w.id, topic, free, w.leaseDuration)
+		if err != nil {
+			log.Errorf("[Worker] Failed to claim %s jobs: %v", topic, err)
+			continue
 		}
 
-		_ = w.jobRepo.UpdateJobStatus(ctx, job.ID, status, errMsg)
+		for _, job := range jobs {
+			pool.slots <- struct{}{}
+			w.inFlight.Add(1)
+			go func(job model.Job) {
+				defer w.inFlight.Done()
+				defer w.notify() // a slot is free again, pick up any backlog
+				defer func() { <-pool.slots }()
+				w.processJob(job, pool.handler)
+			}(job)
+		}
 	}
 }
 
-// --- Handlers ---
+func (w *worker) processJob(job model.Job, handle HandlerFunc) {
+	// Status updates use a fresh context so they still land after the
+	// handler context has been cancelled by Shutdown.
+	ctx := context.Background()
+	log.Infof("[Worker] Processing job ID: %d, Topic: %s", job.ID, job.Topic)
+
+	start := time.Now()
+	processErr := w.runWithHeartbeat(job, handle)
+	elapsed := time.Since(start).Seconds()
+
+	if processErr != nil {
+		metrics.JobsFailed.WithLabelValues(job.Topic).Inc()
+
+		var permanent *permanentError
+		if errors.As(processErr, &permanent) {
+			metrics.JobDuration.WithLabelValues(job.Topic, model.JobStatusDead).Observe(elapsed)
+			log.Errorf("[Worker] Job %d failed permanently: %v", job.ID, processErr)
+			if err := w.queue.Kill(ctx, job, processErr.Error()); err != nil {
+				log.Errorf("[Worker] Failed to dead-letter job %d: %v", job.ID, err)
+				return
+			}
+			metrics.JobsDead.WithLabelValues(job.Topic).Inc()
+			return
+		}
 
-type StockUpdatePayload struct {
-	ProductID int64 `json:"product_id"`
-	Quantity  int64 `json:"quantity"`
-}
+		lastAttempt := job.Attempts+1 >= job.MaxAttempts
+		outcome := model.JobStatusFailed
+		if lastAttempt {
+			outcome = model.JobStatusDead
+		}
+		metrics.JobDuration.WithLabelValues(job.Topic, outcome).Observe(elapsed)
 
-func (w *worker) handleStockUpdate(ctx context.Context, payload datatypes.JSON) error {
-	var data StockUpdatePayload
-	if err := json.Unmarshal(payload, &data); err != nil {
-		return err
+		log.Errorf("[Worker] Job %d failed (attempt %d/%d): %v", job.ID, job.Attempts+1, job.MaxAttempts, processErr)
+		if err := w.queue.Retry(ctx, job, processErr.Error()); err != nil {
+			log.Errorf("[Worker] Failed to reschedule job %d: %v", job.ID, err)
+			return
+		}
+		if lastAttempt {
+			metrics.JobsDead.WithLabelValues(job.Topic).Inc()
+		}
+		return
 	}
 
-	// Assuming ProductService has a method to update stock.
-	// If not, we might need to expose one or use repository directly.
-	// Based on previous code, there was logic in consumer.
-	// We'll reimplement it here or call a service method.
-
-	// Previous Logic:
-	// product.Stock -= int(orderItem.Quantity)
-	// db.Save(&product)
-
-	// BUT, ProductService usually handles business logic.
-	// Let's check ProductService methods. If no direct method, we might need to add one.
-	// For now, I'll assume we can call a method or I will need to extend ProductService.
-
-	// Let's assume we need to implement UpdateStock in ProductService if not exists.
-	// Checking `product_service.go` is recommended. I'll defer implementation details
-	// or assume UpdateStock exists/will serve.
-
-	return w.productSvc.UpdateStock(ctx, data.ProductID, int(data.Quantity))
+	metrics.JobDuration.WithLabelValues(job.Topic, model.JobStatusCompleted).Observe(elapsed)
+	log.Infof("[Worker] Job %d completed successfully", job.ID)
+	if err := w.queue.Complete(ctx, job); err != nil {
+		log.Errorf("[Worker] Failed to mark job %d completed: %v", job.ID, err)
+		return
+	}
+	metrics.JobsCompleted.WithLabelValues(job.Topic).Inc()
 }
 
-type NotificationPayload struct {
-	ReceiverEmail string `json:"receiver_email"`
-	Subject       string `json:"subject"`
-	Message       string `json:"message"`
-	Type          string `json:"type"`
-	ReceiverID    int64  `json:"receiver_id"`
-}
+// runWithHeartbeat runs the handler while periodically extending the job's
+// lease. If the lease is lost (reaped or claimed elsewhere) or the worker is
+// shutting down past its deadline, the handler's context is cancelled so it
+// can stop early. A panicking handler is reported as a failed run, with the
+// panic value and stack as the error, so it is retried like any other.
+func (w *worker) runWithHeartbeat(job model.Job, handle HandlerFunc) (err error) {
+	jobCtx, cancel := context.WithCancel(w.baseCtx)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(w.leaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := w.queue.Extend(context.Background(), job, w.id, w.leaseDuration)
+				if errors.Is(err, ErrLeaseLost) {
+					log.Warnf("[Worker] Lost lease on job %d, cancelling handler", job.ID)
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Errorf("[Worker] Failed to extend lease on job %d: %v", job.ID, err)
+				}
+			}
+		}
+	}()
 
-func (w *worker) handleEmailNotification(ctx context.Context, payload datatypes.JSON) error {
-	var data NotificationPayload
-	if err := json.Unmarshal(payload, &data); err != nil {
-		return err
-	}
+	return handle(jobCtx, job.ID, job.Payload)
+}
 
-	// Reusing NotificationService logic
-	notifEntity := entity.NotificationEntity{
-		ReceiverEmail:    &data.ReceiverEmail,
-		Subject:          &data.Subject,
-		Message:          data.Message,
-		NotificationType: data.Type, // EMAIL or PUSH
-		Status:           "PENDING",
-		ReceiverID:       uint(data.ReceiverID),
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
+// sweep hands the queue its periodic housekeeping. Jobs of unknown topics
+// are only dead-lettered once they have been runnable for a while, so a
+// replica running an older build doesn't kill topics a newer one handles.
+func (w *worker) sweep() {
+	err := w.queue.Sweep(context.Background(), w.topics(), time.Now().Add(-w.unknownGrace))
+	if err != nil {
+		log.Errorf("[Worker] Queue sweep failed: %v", err)
 	}
-
-	// Create Notification Record
-	// Assuming `SendPushNotification` or equivalent handles creation + sending or just sending.
-	// Looking at old consumer: it created record then sent email.
-
-	// Create repo call is needed? `notifRepo.CreateNotification` was used.
-	// But `worker` doesn't have `notifRepo`.
-	// `notifSvc` should ideally encapsulate this.
-
-	// Let's assume `notifSvc.SendNotification` exists or similar.
-	// If not, we should probably add `CreateNotification` to service.
-
-	// For now, let's call SendEmail directly via Service if available.
-	// Actually the old code used `emailService.SendEmailNotif`.
-	// Use case: Sending email.
-
-	// Wait, `notifSvc` usually has high level methods.
-	// We might need to inject `MessageEmailInterface` into worker too if logic was separated.
-	// However, `NotificationService` might be enough.
-
-	return w.notifSvc.CreateAndSend(ctx, notifEntity)
 }
@@ -0,0 +1,291 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tofash/internal/modules/system/model"
+	"tofash/internal/modules/system/repository"
+	"tofash/internal/shared/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+type fakeJobRepo struct {
+	repository.JobRepositoryInterface
+	mu          sync.Mutex
+	pending     []model.Job
+	extendErr   error
+	statuses    map[uint]string
+	retried     map[uint]string
+	knownTopics []string
+}
+
+func newFakeJobRepo(jobs ...model.Job) *fakeJobRepo {
+	return &fakeJobRepo{pending: jobs, statuses: map[uint]string{}, retried: map[uint]string{}}
+}
+
+func (f *fakeJobRepo) ClaimJobs(ctx context.Context, workerID string, topic string, limit int, lease time.Duration) ([]model.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var claimed, rest []model.Job
+	for _, job := range f.pending {
+		if job.Topic == topic && len(claimed) < limit {
+			claimed = append(claimed, job)
+		} else {
+			rest = append(rest, job)
+		}
+	}
+	f.pending = rest
+	return claimed, nil
+}
+
+func (f *fakeJobRepo) ExtendLease(ctx context.Context, jobID uint, workerID string, lease time.Duration) error {
+	return f.extendErr
+}
+
+func (f *fakeJobRepo) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeJobRepo) DeadLetterUnknownTopics(ctx context.Context, knownTopics []string, runnableBefore time.Time) (int64, error) {
+	f.knownTopics = knownTopics
+	return 0, nil
+}
+
+func (f *fakeJobRepo) UpdateJobStatus(ctx context.Context, jobID uint, workerID string, status string, errorMsg string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[jobID] = status
+	return nil
+}
+
+func (f *fakeJobRepo) RetryJob(ctx context.Context, job model.Job, errorMsg string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retried[job.ID] = errorMsg
+	return nil
+}
+
+type testPayload struct {
+	Value string `json:"value"`
+}
+
+func TestWorker_DispatchesToRegisteredHandler(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 7, Topic: "greet", Payload: datatypes.JSON(`{"value":"hi"}`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+
+	var got string
+	var gotID uint
+	w.Register("greet", Typed(func(_ context.Context, jobID uint, p testPayload) error {
+		got = p.Value
+		gotID = jobID
+		return nil
+	}))
+
+	w.dispatch()
+	w.inFlight.Wait()
+	assert.Equal(t, "hi", got)
+	assert.Equal(t, uint(7), gotID)
+	assert.Equal(t, model.JobStatusCompleted, repo.statuses[7])
+}
+
+func TestWorker_UnknownTopicsAreDeadLettered(t *testing.T) {
+	repo := newFakeJobRepo()
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+	w.Register("b_topic", func(_ context.Context, _ uint, _ datatypes.JSON) error { return nil })
+	w.Register("a_topic", func(_ context.Context, _ uint, _ datatypes.JSON) error { return nil })
+
+	w.sweep()
+	assert.Equal(t, []string{"a_topic", "b_topic"}, repo.knownTopics)
+}
+
+func TestWorker_UndecodablePayloadGoesDead(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 3, Topic: "greet", Payload: datatypes.JSON(`"not an object"`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+	w.Register("greet", Typed(func(_ context.Context, _ uint, p testPayload) error { return nil }))
+
+	w.dispatch()
+	w.inFlight.Wait()
+	assert.Equal(t, model.JobStatusDead, repo.statuses[3])
+	assert.Empty(t, repo.retried)
+}
+
+func TestWorker_HandlerErrorIsRetried(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 4, Topic: "flaky", Payload: datatypes.JSON(`{}`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+	w.Register("flaky", func(_ context.Context, _ uint, _ datatypes.JSON) error { return errors.New("smtp timeout") })
+
+	w.dispatch()
+	w.inFlight.Wait()
+	assert.Equal(t, "smtp timeout", repo.retried[4])
+	assert.NotContains(t, repo.statuses, uint(4))
+}
+
+func TestWorker_HandlerPanicIsRetried(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 5, Topic: "buggy", Payload: datatypes.JSON(`{}`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+	w.Register("buggy", func(_ context.Context, _ uint, _ datatypes.JSON) error { panic("nil map") })
+
+	w.dispatch()
+	w.inFlight.Wait()
+	assert.Contains(t, repo.retried[5], "handler panicked: nil map")
+	assert.Contains(t, repo.retried[5], "runWithHeartbeat")
+	assert.Len(t, w.pools["buggy"].slots, 0)
+}
+
+func TestWorker_RecordsJobMetrics(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	w := NewWorker(q).(*worker)
+	w.Register("metrics_ok", func(_ context.Context, _ uint, _ datatypes.JSON) error { return nil }, WithConcurrency(2))
+	w.Register("metrics_bad", func(_ context.Context, _ uint, _ datatypes.JSON) error {
+		return Permanent(errors.New("bad input"))
+	})
+
+	assert.NoError(t, q.Enqueue(ctx, "metrics_ok", datatypes.JSON(`{}`)))
+	assert.NoError(t, q.Enqueue(ctx, "metrics_ok", datatypes.JSON(`{}`)))
+	assert.NoError(t, q.Enqueue(ctx, "metrics_bad", datatypes.JSON(`{}`)))
+
+	stats, err := q.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+
+	w.dispatch()
+	w.inFlight.Wait()
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.JobsEnqueued.WithLabelValues("metrics_ok")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.JobsCompleted.WithLabelValues("metrics_ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.JobsFailed.WithLabelValues("metrics_bad")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.JobsDead.WithLabelValues("metrics_bad")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.JobsDead.WithLabelValues("metrics_ok")))
+}
+
+func TestWorker_LostLeaseCancelsHandler(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 5, Topic: "slow", Payload: datatypes.JSON(`{}`)})
+	repo.extendErr = repository.ErrLeaseLost
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+	w.leaseDuration = 30 * time.Millisecond
+
+	w.Register("slow", func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+
+	w.dispatch()
+	w.inFlight.Wait()
+	assert.Equal(t, context.Canceled.Error(), repo.retried[5])
+}
+
+func TestWorker_RespectsTopicConcurrency(t *testing.T) {
+	repo := newFakeJobRepo(
+		model.Job{ID: 10, Topic: "mail", Payload: datatypes.JSON(`{}`)},
+		model.Job{ID: 11, Topic: "mail", Payload: datatypes.JSON(`{}`)},
+		model.Job{ID: 12, Topic: "mail", Payload: datatypes.JSON(`{}`)},
+	)
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+
+	release := make(chan struct{})
+	var running atomic.Int32
+	w.Register("mail", func(_ context.Context, _ uint, _ datatypes.JSON) error {
+		running.Add(1)
+		<-release
+		return nil
+	}, WithConcurrency(2))
+
+	w.dispatch()
+	assert.Eventually(t, func() bool { return running.Load() == 2 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, repo.pending, 1)
+
+	close(release)
+	w.inFlight.Wait()
+}
+
+func TestWorker_ShutdownWaitsForInFlightJobs(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 20, Topic: "slow", Payload: datatypes.JSON(`{}`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+
+	started := make(chan struct{})
+	w.Register("slow", func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return ctx.Err()
+	})
+
+	w.dispatch()
+	<-started
+	assert.NoError(t, w.Shutdown(context.Background()))
+	assert.Equal(t, model.JobStatusCompleted, repo.statuses[20])
+}
+
+func TestWorker_ShutdownDeadlineCancelsHandlers(t *testing.T) {
+	repo := newFakeJobRepo(model.Job{ID: 21, Topic: "stuck", Payload: datatypes.JSON(`{}`)})
+	w := NewWorker(NewPostgresQueue(repo, nil)).(*worker)
+
+	started := make(chan struct{})
+	w.Register("stuck", func(ctx context.Context, _ uint, _ datatypes.JSON) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	w.dispatch()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, w.Shutdown(ctx), context.DeadlineExceeded)
+
+	w.inFlight.Wait()
+	assert.Equal(t, context.Canceled.Error(), repo.retried[21])
+}
+
+type fakeListener struct {
+	notify chan string
+}
+
+func (l *fakeListener) Listen(ctx context.Context, onNotify func(topic string)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case topic := <-l.notify:
+			onNotify(topic)
+		}
+	}
+}
+
+func TestWorker_NotificationWakesDispatchBeforePoll(t *testing.T) {
+	repo := newFakeJobRepo()
+	listener := &fakeListener{notify: make(chan string)}
+	w := NewWorker(NewPostgresQueue(repo, listener)).(*worker)
+
+	handled := make(chan struct{})
+	w.Register("instant", func(_ context.Context, _ uint, _ datatypes.JSON) error {
+		close(handled)
+		return nil
+	})
+
+	go w.Run()
+	repo.mu.Lock()
+	repo.pending = append(repo.pending, model.Job{ID: 30, Topic: "instant", Payload: datatypes.JSON(`{}`)})
+	repo.mu.Unlock()
+	listener.notify <- "instant"
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("job was not dispatched on notification")
+	}
+	assert.NoError(t, w.Shutdown(context.Background()))
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"tofash/internal/modules/system/model"
+
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	JobsEnqueued  = newJobCounter("enqueued", "Jobs added to the queue.")
+	JobsCompleted = newJobCounter("completed", "Jobs whose handler succeeded.")
+	// JobsFailed counts every failed attempt, including the last one of a
+	// job that then goes to dead.
+	JobsFailed = newJobCounter("failed", "Job attempts whose handler returned an error.")
+	JobsDead   = newJobCounter("dead", "Jobs moved to dead after a permanent error or their last attempt.")
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "processing_duration_seconds",
+		Help:      "Time spent running job handlers.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"topic", "outcome"})
+)
+
+func newJobCounter(name, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      name + "_total",
+		Help:      help,
+	}, []string{"topic"})
+}
+
+func init() {
+	Registry.MustRegister(JobsEnqueued, JobsCompleted, JobsFailed, JobsDead, JobDuration)
+}
+
+// JobStatsFunc reports the current per-topic queue depth.
+type JobStatsFunc func(ctx context.Context) ([]model.JobQueueStats, error)
+
+const jobStatsTimeout = 5 * time.Second
+
+var (
+	jobDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "jobs", "queue_depth"),
+		"Jobs currently waiting or running, by topic and status.",
+		[]string{"topic", "status"}, nil,
+	)
+	jobAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "jobs", "queue_age_seconds"),
+		"How long the oldest runnable pending job of the topic has been waiting.",
+		[]string{"topic"}, nil,
+	)
+)
+
+// jobStatsCollector queries the queue on every scrape, so the gauges are
+// never staler than the scrape interval and cost nothing between scrapes.
+type jobStatsCollector struct {
+	stats JobStatsFunc
+}
+
+// RegisterJobStats exports queue depth and age gauges read from stats.
+func RegisterJobStats(stats JobStatsFunc) error {
+	return Registry.Register(&jobStatsCollector{stats: stats})
+}
+
+func (c *jobStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobDepthDesc
+	ch <- jobAgeDesc
+}
+
+func (c *jobStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobStatsTimeout)
+	defer cancel()
+
+	stats, err := c.stats(ctx)
+	if err != nil {
+		log.Errorf("[Metrics] Failed to read job queue stats: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(jobDepthDesc, prometheus.GaugeValue, float64(s.Count), s.Topic, s.Status)
+		if s.Status == model.JobStatusPending {
+			age := 0.0
+			if s.OldestRunAt != nil && s.OldestRunAt.Before(now) {
+				age = now.Sub(*s.OldestRunAt).Seconds()
+			}
+			ch <- prometheus.MustNewConstMetric(jobAgeDesc, prometheus.GaugeValue, age, s.Topic)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package uow
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+// txState is the transaction carried by a unit of work's context, plus the
+// callbacks waiting for it to commit.
+type txState struct {
+	tx          *gorm.DB
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+// UnitOfWorkInterface runs several repository calls as one database
+// transaction. Repositories join it by resolving their handle through DB.
+type UnitOfWorkInterface interface {
+	// Do runs fn inside a transaction. The transaction is committed when fn
+	// returns nil and rolled back otherwise. Nested calls join the outer
+	// transaction.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type unitOfWork struct {
+	db *gorm.DB
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	state := &txState{}
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, txKey{}, state))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, callback := range state.afterCommit {
+		callback()
+	}
+	return nil
+}
+
+func NewUnitOfWork(db *gorm.DB) UnitOfWorkInterface {
+	return &unitOfWork{db: db}
+}
+
+// DB returns the transaction carried by ctx, or db bound to ctx when the
+// call is not part of a unit of work.
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db.WithContext(ctx)
+}
+
+// InTransaction reports whether ctx carries a unit of work.
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// AfterCommit runs fn once the unit of work carried by ctx has committed,
+// and drops it on rollback. Outside a unit of work fn runs immediately.
+// Use it for side effects that cannot join the transaction.
+func AfterCommit(ctx context.Context, fn func()) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		fn()
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.afterCommit = append(state.afterCommit, fn)
+}